@@ -1,5 +1,7 @@
 package commands
 
+import "strings"
+
 type ArgumentType int
 
 const (
@@ -7,14 +9,28 @@ const (
 	ArgFile
 )
 
+// CompleteFunc returns the completion candidates for an argument value
+// starting with prefix.
+type CompleteFunc func(prefix string) []string
+
 type Argument struct {
 	Name          string
 	Type          ArgumentType
-	Required      bool // error if no value is specified
-	Variadic      bool // unlimited values can be specfied
-	SupportsStdin bool // can accept stdin as a value
-	Recursive     bool // supports recursive file adding (with '-r' flag)
+	Required      bool   // error if no value is specified
+	Variadic      bool   // unlimited values can be specfied
+	SupportsStdin bool   // can accept stdin as a value
+	Recursive     bool   // supports recursive file adding (with '-r' flag)
+	Glob          bool   // expands glob patterns in file paths (for shells that don't)
+	ResolvePath   bool   // string value is a client path, resolved against the client's CWD
+	AtFile        bool   // the CLI reads the values from the lines of the file of an `@file` value
+	Default       string // value used when an optional string arg is omitted
 	Description   string
+
+	Editor         bool   // when omitted on a terminal, the CLI opens $EDITOR for the value
+	EditorTemplate string // initial text of the editor
+
+	Completions []string     // static shell completion candidates
+	Complete    CompleteFunc // dynamic shell completion candidates
 }
 
 func StringArg(name string, required, variadic bool, description string) Argument {
@@ -46,6 +62,20 @@ func (a Argument) EnableStdin() Argument {
 	return a
 }
 
+// WithDefault sets the value that is used when an optional string argument
+// is not provided by the caller.
+func (a Argument) WithDefault(value string) Argument {
+	if a.Type != ArgString {
+		panic("Only ArgString arguments can have a default value")
+	}
+	if a.Required {
+		panic("Required arguments can't have a default value")
+	}
+
+	a.Default = value
+	return a
+}
+
 func (a Argument) EnableRecursive() Argument {
 	if a.Type != ArgFile {
 		panic("Only ArgFile arguments can enable recursive")
@@ -54,3 +84,91 @@ func (a Argument) EnableRecursive() Argument {
 	a.Recursive = true
 	return a
 }
+
+// EnableGlob makes the CLI expand glob patterns (e.g. `*.txt`) in the paths
+// given for this argument, for shells which don't do it themselves (such as
+// Windows cmd). Paths that exist as given are never expanded.
+func (a Argument) EnableGlob() Argument {
+	if a.Type != ArgFile {
+		panic("Only ArgFile arguments can enable globbing")
+	}
+
+	a.Glob = true
+	return a
+}
+
+// EnableResolvePath declares that the values of a string argument are file
+// system paths on the client machine (which are not uploaded, unlike ArgFile
+// values). The CLI expands them (see PathOption) and resolves relative paths
+// against its working directory, so they keep their meaning when the command
+// is executed by a daemon with a different working directory. Other string
+// arguments are always passed through untouched.
+func (a Argument) EnableResolvePath() Argument {
+	if a.Type != ArgString {
+		panic("Only ArgString arguments can enable path resolution, ArgFile paths are always resolved")
+	}
+
+	a.ResolvePath = true
+	return a
+}
+
+// EnableAtFile makes the CLI read the values of the argument from the lines
+// of a file (ignoring empty lines) when it is given as `@file`, to support
+// lists of values that are too long for the OS. A leading `@@` escapes a
+// literal `@`. Without it, values starting with `@` (like npm scopes or
+// handles) are passed as they are.
+func (a Argument) EnableAtFile() Argument {
+	if a.Type != ArgString {
+		panic("Only ArgString arguments can enable @file values")
+	}
+
+	a.AtFile = true
+	return a
+}
+
+// EnableEditor makes the CLI open the user's editor ($VISUAL or $EDITOR) on
+// template when the string argument isn't given and stdin is a terminal. The
+// saved text is the value, without the lines starting with '#', so the
+// template can explain what to write in comments. It is meant for long text
+// values, like messages or documents.
+func (a Argument) EnableEditor(template string) Argument {
+	if a.Type != ArgString {
+		panic("Only ArgString arguments can enable the editor")
+	}
+
+	a.Editor = true
+	a.EditorTemplate = template
+	return a
+}
+
+// WithCompletions adds static shell completion candidates for the argument.
+func (a Argument) WithCompletions(candidates ...string) Argument {
+	a.Completions = append(a.Completions[:len(a.Completions):len(a.Completions)], candidates...)
+	return a
+}
+
+// WithCompleteFunc sets a function that provides the shell completion
+// candidates for the argument (e.g. by listing keys or subpaths).
+func (a Argument) WithCompleteFunc(f CompleteFunc) Argument {
+	a.Complete = f
+	return a
+}
+
+// Candidates returns the completion candidates for a value of this argument
+// starting with prefix.
+func (a Argument) Candidates(prefix string) []string {
+	var candidates []string
+	for _, c := range a.Completions {
+		if strings.HasPrefix(c, prefix) {
+			candidates = append(candidates, c)
+		}
+	}
+	if a.Complete != nil {
+		for _, c := range a.Complete(prefix) {
+			if strings.HasPrefix(c, prefix) {
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ErrKindPartialFailure is the Kind of the error of a Batch some items of
+// which failed. Its "failed" detail lists the items, and "total" counts all
+// of them.
+const ErrKindPartialFailure = "partial-failure"
+
+// ItemError is the value of the FrameItemError frames a Batch sends for the
+// items that failed.
+type ItemError struct {
+	Item  string
+	Error string
+}
+
+func (e ItemError) String() string {
+	return e.Item + ": " + e.Error
+}
+
+// Batch is the output of a command that processes many inputs, some of which
+// may fail without aborting the others. Failures are reported inline in the
+// output stream as FrameItemError frames, and as one overall error of kind
+// ErrKindPartialFailure once the batch is closed.
+type Batch struct {
+	res  Response
+	emit Emitter
+	done func()
+
+	mu     sync.Mutex
+	total  int
+	failed []string
+}
+
+// NewBatch sets the output of res to the channel of a Batch (see
+// ChannelEmitter).
+func NewBatch(req Request, res Response) *Batch {
+	emit, done := ChannelEmitter(req, res)
+	return &Batch{res: res, emit: emit, done: done}
+}
+
+// Emit sends the output value of an item that succeeded.
+func (b *Batch) Emit(v interface{}) error {
+	b.mu.Lock()
+	b.total++
+	b.mu.Unlock()
+	return b.emit(v)
+}
+
+// Fail reports that item failed with err.
+func (b *Batch) Fail(item string, err error) error {
+	b.mu.Lock()
+	b.total++
+	b.failed = append(b.failed, item)
+	b.mu.Unlock()
+	return b.emit(Frame{Type: FrameItemError, Value: ItemError{Item: item, Error: err.Error()}})
+}
+
+// Close ends the output. If items failed, the response fails with an error of
+// kind ErrKindPartialFailure.
+func (b *Batch) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.failed) > 0 {
+		b.res.SetError(&Error{
+			Message: fmt.Sprintf("%d of %d items failed", len(b.failed), b.total),
+			Code:    ErrNormal,
+			Kind:    ErrKindPartialFailure,
+			Details: map[string]interface{}{
+				"failed": append([]string(nil), b.failed...),
+				"total":  b.total,
+			},
+		}, ErrNormal)
+	}
+	b.done()
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	cmd := &Command{
+		Run: func(req Request, res Response) {
+			b := NewBatch(req, res)
+			go func() {
+				defer b.Close()
+				for _, name := range []string{"a", "bad", "c", "worse"} {
+					if len(name) > 1 {
+						b.Fail(name, errors.New("no such file"))
+						continue
+					}
+					b.Emit(name)
+				}
+			}()
+		},
+	}
+
+	req, err := NewRequestBuilder(cmd).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failures []ItemError
+	FrameHandlerKey.Set(req, func(t FrameType, v interface{}) {
+		if t == FrameItemError {
+			failures = append(failures, v.(ItemError))
+		}
+	})
+	res := cmd.Call(req)
+
+	var values []interface{}
+	for v := range res.Output().(<-chan interface{}) {
+		values = append(values, v)
+	}
+
+	if !reflect.DeepEqual(values, []interface{}{"a", "c"}) {
+		t.Errorf("Unexpected values %v", values)
+	}
+	expected := []ItemError{{"bad", "no such file"}, {"worse", "no such file"}}
+	if !reflect.DeepEqual(failures, expected) {
+		t.Errorf("Expected item errors %v, got %v", expected, failures)
+	}
+
+	e := res.Error()
+	if e == nil || e.Kind != ErrKindPartialFailure || e.Message != "2 of 4 items failed" {
+		t.Fatalf("Expected a partial failure, got %v", e)
+	}
+	if failed := e.Details["failed"]; !reflect.DeepEqual(failed, []string{"bad", "worse"}) {
+		t.Errorf("Unexpected failed items %v", failed)
+	}
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/ipfs/go-commands/files"
+)
+
+// RequestBuilder builds a Request for a command in a tree, resolving the
+// command and its option definitions from the path. Errors are reported by
+// Build.
+type RequestBuilder struct {
+	root  *Command
+	path  []string
+	opts  OptMap
+	args  []string
+	files files.File
+	ctx   context.Context
+}
+
+// NewRequestBuilder returns a RequestBuilder for commands in the tree of root.
+func NewRequestBuilder(root *Command) *RequestBuilder {
+	return &RequestBuilder{
+		root: root,
+		opts: make(OptMap),
+	}
+}
+
+// Path appends names to the command path of the request.
+func (b *RequestBuilder) Path(names ...string) *RequestBuilder {
+	b.path = append(b.path, names...)
+	return b
+}
+
+// Option sets the value of the option with the given name. String values are
+// converted to the type of the option's definition.
+func (b *RequestBuilder) Option(name string, value interface{}) *RequestBuilder {
+	b.opts[name] = value
+	return b
+}
+
+// Arg appends argument values to the request.
+func (b *RequestBuilder) Arg(args ...string) *RequestBuilder {
+	b.args = append(b.args, args...)
+	return b
+}
+
+// Files sets the file arguments of the request.
+func (b *RequestBuilder) Files(f files.File) *RequestBuilder {
+	b.files = f
+	return b
+}
+
+// Context sets the root context of the request.
+func (b *RequestBuilder) Context(ctx context.Context) *RequestBuilder {
+	b.ctx = ctx
+	return b
+}
+
+// Build returns the request. It returns an error if the path doesn't resolve
+// to a command, an option isn't defined for it or has an invalid value, or
+// the arguments don't match the command's definitions.
+func (b *RequestBuilder) Build() (Request, error) {
+	cmd, err := b.root.Get(b.path)
+	if err != nil {
+		return nil, err
+	}
+
+	optDefs, err := b.root.GetOptions(b.path)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := make(OptMap, len(b.opts))
+	for k, v := range b.opts {
+		if _, ok := optDefs[k]; !ok {
+			return nil, fmt.Errorf("Unrecognized option '%s'", k)
+		}
+		opts[k] = v
+	}
+
+	var args []string
+	if b.args != nil {
+		args = make([]string, len(b.args))
+		copy(args, b.args)
+	}
+
+	path := make([]string, len(b.path))
+	copy(path, b.path)
+
+	req, err := NewRequest(path, opts, args, b.files, cmd, optDefs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.CheckArguments(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.ctx != nil {
+		err = req.SetRootContext(b.ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
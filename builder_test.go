@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestRequestBuilder(t *testing.T) {
+	peers := &Command{
+		Options: []Option{
+			IntOption("n", "count", "a number"),
+		},
+		Arguments: []Argument{
+			StringArg("peer", true, false, "a peer"),
+		},
+	}
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"swarm": {
+				Subcommands: map[string]*Command{
+					"peers": peers,
+				},
+			},
+		},
+	}
+
+	req, err := NewRequestBuilder(root).
+		Path("swarm", "peers").
+		Option("timeout", "5s").
+		Option("count", "3").
+		Arg("QmPeer").
+		Context(context.Background()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Command() != peers {
+		t.Error("Expected the command to be resolved")
+	}
+	if n, _, err := req.Option("n").Int(); n != 3 || err != nil {
+		t.Errorf("Expected option 'count' to be 3, got %v (%v)", n, err)
+	}
+	if _, ok := req.Context().Deadline(); !ok {
+		t.Error("Expected the timeout to set a deadline on the context")
+	}
+	if args := req.Arguments(); len(args) != 1 || args[0] != "QmPeer" {
+		t.Errorf("Expected arguments [QmPeer], got %v", args)
+	}
+
+	if _, err := NewRequestBuilder(root).Path("swarm", "nope").Arg("x").Build(); err == nil {
+		t.Error("Expected an error for an unknown command")
+	}
+	if _, err := NewRequestBuilder(root).Path("swarm", "peers").Option("nope", true).Arg("x").Build(); err == nil {
+		t.Error("Expected an error for an unknown option")
+	}
+	if _, err := NewRequestBuilder(root).Path("swarm", "peers").Option("count", "x").Arg("x").Build(); err == nil {
+		t.Error("Expected an error for an invalid option value")
+	}
+	if _, err := NewRequestBuilder(root).Path("swarm", "peers").Build(); err == nil {
+		t.Error("Expected an error for a missing argument")
+	}
+}
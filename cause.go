@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Cancellation causes front-ends pass to CancelRequest.
+var (
+	ErrClientDisconnected = errors.New("client went away")
+	ErrInterrupted        = errors.New("interrupted")
+)
+
+// TimeoutError is the cause of requests that ran out of their timeout.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.Timeout)
+}
+
+// DeadlineError is the cause of requests that ran past their deadline.
+type DeadlineError struct {
+	Deadline time.Time
+}
+
+func (e DeadlineError) Error() string {
+	return fmt.Sprintf("deadline %s exceeded", e.Deadline.Format(time.RFC3339))
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"fmt"
 	"sort"
 	"strings"
 
@@ -8,6 +9,67 @@ import (
 	levenshtein "github.com/texttheater/golang-levenshtein/levenshtein"
 )
 
+// ErrKindUnknownCommand is the Kind of the errors of command lines naming a
+// subcommand that doesn't exist. Their "suggestions" detail lists the
+// subcommands with similar names.
+const ErrKindUnknownCommand = "unknown-command"
+
+// Kinds of the errors of invalid flags in command lines. Their details are
+// the "token" of the command line that failed, its "position" (from 0) and
+// the name of the "option". The "suggestions" of unknown options list the
+// flags of options with similar names.
+const (
+	ErrKindUnknownOption = "unknown-option"
+	ErrKindInvalidOption = "invalid-option" // e.g. a missing or duplicate value
+)
+
+// optionError returns an error of the kind for the option name.
+func optionError(kind, name, format string, a ...interface{}) *cmds.Error {
+	return &cmds.Error{
+		Message: fmt.Sprintf(format, a...),
+		Code:    cmds.ErrClient,
+		Kind:    kind,
+		Details: map[string]interface{}{"option": name},
+	}
+}
+
+// unknownCmdError returns the error for the unknown subcommand name of cmd,
+// suggesting the subcommands of cmd it may be a typo of.
+func unknownCmdError(name string, cmd *cmds.Command) *cmds.Error {
+	suggestions := suggestUnknownCmd(name, cmd)
+
+	var msg string
+	switch len(suggestions) {
+	case 0:
+		msg = fmt.Sprintf("Unknown Command \"%s\"\n", name)
+	case 1:
+		msg = fmt.Sprintf("Unknown Command \"%s\"\n\nDid you mean this?\n\n\t%s", name, suggestions[0])
+	default:
+		msg = fmt.Sprintf("Unknown Command \"%s\"\n\nDid you mean any of these?\n\n\t%s", name, strings.Join(suggestions, "\n\t"))
+	}
+
+	return &cmds.Error{
+		Message: msg,
+		Code:    cmds.ErrClient,
+		Kind:    ErrKindUnknownCommand,
+		Details: map[string]interface{}{
+			"command":     name,
+			"suggestions": suggestions,
+		},
+	}
+}
+
+// levenshteinOptions weigh deletions most, as typos more often miss letters
+// than add them
+var levenshteinOptions = levenshtein.Options{
+	InsCost: 1,
+	DelCost: 3,
+	SubCost: 2,
+	Matches: func(sourceCharacter rune, targetCharacter rune) bool {
+		return sourceCharacter == targetCharacter
+	},
+}
+
 // Make a custom slice that can be sorted by its levenshtein value
 type suggestionSlice []*suggestion
 
@@ -25,39 +87,38 @@ func (s suggestionSlice) Swap(i, j int) {
 }
 
 func (s suggestionSlice) Less(i, j int) bool {
-	return s[i].levenshtein < s[j].levenshtein
+	if s[i].levenshtein != s[j].levenshtein {
+		return s[i].levenshtein < s[j].levenshtein
+	}
+	return s[i].cmd < s[j].cmd
 }
 
-func suggestUnknownCmd(args []string, root *cmds.Command) []string {
-	arg := args[0]
+// suggestUnknownCmd returns the names of the subcommands of cmd that arg may
+// be a typo of, the closest first.
+func suggestUnknownCmd(arg string, cmd *cmds.Command) []string {
 	var suggestions []string
 	sortableSuggestions := make(suggestionSlice, 0)
 	var sFinal []string
 	const MIN_LEVENSHTEIN = 3
 
-	var options levenshtein.Options = levenshtein.Options{
-		InsCost: 1,
-		DelCost: 3,
-		SubCost: 2,
-		Matches: func(sourceCharacter rune, targetCharacter rune) bool {
-			return sourceCharacter == targetCharacter
-		},
-	}
-
 	// Start with a simple strings.Contains check
-	for name, _ := range root.Subcommands {
-		if strings.Contains(arg, name) {
+	for name, sub := range cmd.Subcommands {
+		if strings.Contains(arg, name) && sub.IsListed() {
 			suggestions = append(suggestions, name)
 		}
 	}
 
 	// If the string compare returns a match, return
 	if len(suggestions) > 0 {
+		sort.Strings(suggestions)
 		return suggestions
 	}
 
-	for name, _ := range root.Subcommands {
-		lev := levenshtein.DistanceForStrings([]rune(arg), []rune(name), options)
+	for name, sub := range cmd.Subcommands {
+		if !sub.IsListed() {
+			continue
+		}
+		lev := levenshtein.DistanceForStrings([]rune(arg), []rune(name), levenshteinOptions)
 		if lev <= MIN_LEVENSHTEIN {
 			sortableSuggestions = append(sortableSuggestions, &suggestion{name, lev})
 		}
@@ -69,3 +130,47 @@ func suggestUnknownCmd(args []string, root *cmds.Command) []string {
 	}
 	return sFinal
 }
+
+// suggestOption returns the flags of the options arg may be a typo or an
+// abbreviation of, the closest first. Single-letter names are too short to
+// be told apart, so they are only matched by abbreviations of long names.
+func suggestOption(arg string, optDefs map[string]cmds.Option) []string {
+	if len(arg) < 2 {
+		return nil
+	}
+
+	// suggest every option once, by its longest name
+	longest := make(map[cmds.Option]string, len(optDefs))
+	for name, opt := range optDefs {
+		if len(name) > len(longest[opt]) {
+			longest[opt] = name
+		}
+	}
+
+	var prefixed []string
+	candidates := make(suggestionSlice, 0)
+	for opt, name := range longest {
+		if len(name) < 2 || cmds.IsExperimentalOption(opt) {
+			continue
+		}
+		if strings.HasPrefix(name, arg) {
+			prefixed = append(prefixed, optionFlag(name))
+			continue
+		}
+		lev := levenshtein.DistanceForStrings([]rune(arg), []rune(name), levenshteinOptions)
+		if lev <= 3 {
+			candidates = append(candidates, &suggestion{optionFlag(name), lev})
+		}
+	}
+
+	if len(prefixed) > 0 {
+		sort.Strings(prefixed)
+		return prefixed
+	}
+	sort.Sort(candidates)
+	suggestions := make([]string, len(candidates))
+	for i, c := range candidates {
+		suggestions[i] = c.cmd
+	}
+	return suggestions
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// Values of the --color option
+const (
+	ColorAuto   = "auto"   // color the output written to terminals
+	ColorAlways = "always" // color the output, even in pipes and files
+	ColorNever  = "never"  // never color the output
+)
+
+// Color is when the help texts, errors and warnings written by this package
+// are colored. With ColorAuto, output is colored if it's written to a
+// terminal and the NO_COLOR environment variable isn't set. Front-ends set it
+// from the --color option with SetColorFromRequest.
+var Color = ColorAuto
+
+// SetColorFromRequest sets Color from the --color option of req, if it's
+// set. It fails for values other than auto, always and never.
+func SetColorFromRequest(req cmds.Request) error {
+	mode, found, err := cmds.GlobalOption(req, cmds.OptionColor).String()
+	if err != nil || !found {
+		return err
+	}
+	switch mode {
+	case ColorAuto, ColorAlways, ColorNever:
+		Color = mode
+		return nil
+	}
+	return &cmds.Error{
+		Message: fmt.Sprintf("Invalid value %q for the color option, expected auto, always or never", mode),
+		Code:    cmds.ErrClient,
+	}
+}
+
+// style is an SGR escape sequence parameter
+type style string
+
+const (
+	styleBold   style = "1"
+	styleRed    style = "31"
+	styleYellow style = "33"
+)
+
+func (s style) apply(text string) string {
+	return "\x1b[" + string(s) + "m" + text + "\x1b[0m"
+}
+
+// colorEnabled returns true if output written to w is colored, see Color.
+func colorEnabled(w io.Writer) bool {
+	switch Color {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return writesToTerminal(w) && ansiConsole(w)
+}
+
+// writesToTerminal returns true if w is a file that is a terminal.
+func writesToTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	term, err := isTerminal(f)
+	return err == nil && term
+}
+
+// paint returns text in the style s, if output written to w is colored.
+func paint(w io.Writer, s style, text string) string {
+	if !colorEnabled(w) {
+		return text
+	}
+	return s.apply(text)
+}
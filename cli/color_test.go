@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+func TestColor(t *testing.T) {
+	defer func(c string) { Color = c }(Color)
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+
+	root := &cmds.Command{
+		Helptext: cmds.HelpText{Tagline: "A tool"},
+		Options:  []cmds.Option{cmds.BoolOption("quiet", "Write less output")},
+	}
+	help := func() string {
+		var buf bytes.Buffer
+		if err := LongHelp("tool", root, nil, &buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	// not a terminal
+	if s := help(); strings.Contains(s, "\x1b[") {
+		t.Errorf("Expected no colors in pipes, got %q", s)
+	}
+
+	Color = ColorAlways
+	if s := help(); !strings.Contains(s, "\x1b[1mOPTIONS:\x1b[0m") {
+		t.Errorf("Expected a bold heading, got %q", s)
+	}
+	var buf bytes.Buffer
+	NewErrorReport(&cmds.Error{Message: "oops"}).WriteText(&buf)
+	if buf.String() != "\x1b[31mError:\x1b[0m oops\n" {
+		t.Errorf("Expected a red error, got %q", buf.String())
+	}
+
+	Color = ColorAuto
+	os.Setenv("NO_COLOR", "1")
+	if colorEnabled(os.Stdout) {
+		t.Error("Expected NO_COLOR to disable colors")
+	}
+
+	opts := cmds.OptMap{cmds.ColorOpt: "never"}
+	req, err := cmds.NewRequest(nil, opts, nil, nil, root, map[string]cmds.Option{cmds.ColorOpt: cmds.OptionColor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetColorFromRequest(req); err != nil || Color != ColorNever {
+		t.Errorf("Expected the color to be set from the request, got %q (%v)", Color, err)
+	}
+	req.SetOption(cmds.ColorOpt, "sometimes")
+	if err := SetColorFromRequest(req); err == nil {
+		t.Error("Expected an invalid color mode to fail")
+	}
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// Complete returns the shell completion candidates for the last of the given
+// command line words (not including the program name). The last word is the
+// (possibly empty) prefix being completed. Candidates are subcommand names,
+// option flags (when the prefix starts with '-') and the candidates declared
+// on the argument at the current position.
+//
+// File arguments have no candidates, so the shell can fall back to completing
+// file names.
+func Complete(root *cmds.Command, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	prefix := words[len(words)-1]
+
+	cmd := root
+	var path []string
+	numArgs := 0
+	expectValue := false
+	for _, word := range words[:len(words)-1] {
+		switch {
+		case expectValue:
+			expectValue = false
+
+		case word == "--" || word == "-" || !strings.HasPrefix(word, "-"):
+			if sub := cmd.Subcommand(word); sub != nil && numArgs == 0 {
+				cmd = sub
+				path = append(path, word)
+			} else if word != "--" {
+				numArgs++
+			}
+
+		default:
+			// a flag, which consumes the next word if it isn't a bool and has no
+			// '=' value
+			if strings.Contains(word, "=") {
+				continue
+			}
+			optDefs, err := root.GetOptions(path)
+			if err != nil {
+				return nil
+			}
+			opt, found := optDefs[strings.TrimLeft(word, "-")]
+			expectValue = found && opt.Type() != cmds.Bool
+		}
+	}
+
+	if expectValue {
+		// completing an option value
+		return nil
+	}
+
+	if strings.HasPrefix(prefix, "-") {
+		return completeOptions(root, path, prefix)
+	}
+
+	var candidates []string
+	if numArgs == 0 {
+		for name, sub := range cmd.Subcommands {
+			if strings.HasPrefix(name, prefix) && sub.IsListed() {
+				candidates = append(candidates, name)
+			}
+		}
+		sort.Strings(candidates)
+	}
+
+	if argDef := getArgDef(numArgs, cmd.Arguments); argDef != nil && argDef.Type == cmds.ArgString {
+		if numArgs < len(cmd.Arguments) || argDef.Variadic {
+			candidates = append(candidates, argDef.Candidates(prefix)...)
+		}
+	}
+
+	return candidates
+}
+
+func completeOptions(root *cmds.Command, path []string, prefix string) []string {
+	optDefs, err := root.GetOptions(path)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+	for name := range optDefs {
+		flag := optionFlag(name)
+		if strings.HasPrefix(flag, prefix) {
+			candidates = append(candidates, flag)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
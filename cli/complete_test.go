@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-commands"
+)
+
+func TestComplete(t *testing.T) {
+	root := &commands.Command{
+		Options: []commands.Option{
+			commands.StringOption("string", "s", "a string"),
+			commands.BoolOption("bool", "b", "a bool"),
+		},
+		Subcommands: map[string]*commands.Command{
+			"config": {
+				Arguments: []commands.Argument{
+					commands.StringArg("key", true, false, "a key").WithCompleteFunc(func(prefix string) []string {
+						return []string{"Addresses", "API", "Bootstrap"}
+					}),
+					commands.StringArg("value", false, false, "a value").WithCompletions("true", "false"),
+				},
+				Subcommands: map[string]*commands.Command{
+					"show": {},
+				},
+			},
+			"cat": {
+				Arguments: []commands.Argument{
+					commands.FileArg("path", true, true, "a file"),
+				},
+			},
+		},
+	}
+
+	test := func(line words, expected words) {
+		candidates := Complete(root, line)
+		if !sameWords(candidates, expected) {
+			t.Errorf("Completions for %v are %v instead of %v", line, candidates, expected)
+		}
+	}
+
+	test(words{""}, words{"cat", "config"})
+	test(words{"c"}, words{"cat", "config"})
+	test(words{"co"}, words{"config"})
+	test(words{"config", ""}, words{"show", "Addresses", "API", "Bootstrap"})
+	test(words{"config", "A"}, words{"Addresses", "API"})
+	test(words{"config", "-b", "API", "f"}, words{"false"})
+	test(words{"config", "API", "true", ""}, words{})
+	test(words{"config", "--string", ""}, words{})
+	test(words{"-s", "foo", "config", "B"}, words{"Bootstrap"})
+	test(words{"cat", ""}, words{})
+	test(words{"--s"}, words{"--show-sensitive", "--show-transfer-stats", "--stat", "--stream-channels", "--string"})
+}
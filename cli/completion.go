@@ -0,0 +1,492 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// completionPath are the completion candidates of a command in the generated
+// scripts.
+type completionPath struct {
+	path        string          // the command path, joined with '/'
+	subcommands []string        // names of the enabled subcommands
+	taglines    []string        // taglines of the subcommands
+	values      []string        // static candidates of the string arguments
+	args        []cmds.Argument // the arguments with static candidates
+	options     []cmds.Option   // the options, sorted by name
+	fileArgs    bool            // the command takes file arguments
+}
+
+// words returns the subcommands and argument candidates.
+func (p completionPath) words() []string {
+	return append(p.subcommands[:len(p.subcommands):len(p.subcommands)], p.values...)
+}
+
+// flags returns the sorted flags of the options, those of options that take
+// a file path only if pathOnly is true.
+func (p completionPath) flags(pathOnly bool) []string {
+	var flags []string
+	for _, opt := range p.options {
+		if pathOnly && !cmds.IsPathOption(opt) {
+			continue
+		}
+		for _, name := range opt.Names() {
+			flags = append(flags, optionFlag(name))
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// completionPaths walks the command tree, returning the completion candidates
+// of every listed (enabled and not hidden) command.
+func completionPaths(root *cmds.Command) ([]completionPath, error) {
+	var paths []completionPath
+
+	var walk func(cmd *cmds.Command, path []string) error
+	walk = func(cmd *cmds.Command, path []string) error {
+		p := completionPath{path: "/" + strings.Join(path, "/")}
+		if len(path) == 0 {
+			p.path = ""
+		}
+
+		optDefs, err := root.GetOptions(path)
+		if err != nil {
+			return err
+		}
+		seen := make(map[cmds.Option]bool)
+		for _, opt := range optDefs {
+			if !seen[opt] {
+				seen[opt] = true
+				p.options = append(p.options, opt)
+			}
+		}
+		sort.Slice(p.options, func(i, j int) bool {
+			return p.options[i].Names()[0] < p.options[j].Names()[0]
+		})
+
+		p.subcommands = listedSubcommands(cmd)
+		for _, name := range p.subcommands {
+			p.taglines = append(p.taglines, cmd.Subcommands[name].Helptext.Tagline)
+		}
+
+		for _, arg := range cmd.Arguments {
+			switch arg.Type {
+			case cmds.ArgFile:
+				p.fileArgs = true
+			case cmds.ArgString:
+				p.values = append(p.values, arg.Completions...)
+				if len(arg.Completions) > 0 {
+					p.args = append(p.args, arg)
+				}
+			}
+		}
+		paths = append(paths, p)
+
+		for _, name := range p.subcommands {
+			if err := walk(cmd.Subcommands[name], append(path[:len(path):len(path)], name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root, nil); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// subPaths returns the quoted paths of all the subcommands in paths, for the
+// scripts to find the command being completed.
+func subPaths(paths []completionPath) []string {
+	var sp []string
+	for _, p := range paths[1:] {
+		sp = append(sp, shellQuote(p.path))
+	}
+	return sp
+}
+
+var nonIdentChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// shellQuote quotes s as a single word for sh-like shells.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// GenerateBashCompletion writes a bash completion script for the program
+// rootName with the command tree root. The script completes subcommands,
+// option flags, the static candidates of string arguments (see
+// cmds.Argument.Completions) and file names, for file arguments and path
+// options. Load it with `source`, or install it in the bash-completion
+// directory.
+func GenerateBashCompletion(rootName string, root *cmds.Command, out io.Writer) error {
+	paths, err := completionPaths(root)
+	if err != nil {
+		return err
+	}
+
+	fn := "_" + nonIdentChars.ReplaceAllString(rootName, "_") + "_complete"
+
+	subPaths := subPaths(paths)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# bash completion for %s\n\n", rootName)
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	b.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("\tlocal cmdpath=\"\" i w\n")
+	b.WriteString("\tfor ((i = 1; i < COMP_CWORD; i++)); do\n")
+	b.WriteString("\t\tw=\"${COMP_WORDS[i]}\"\n")
+	if len(subPaths) > 0 {
+		b.WriteString("\t\tcase \"$cmdpath/$w\" in\n")
+		fmt.Fprintf(&b, "\t\t%s) cmdpath=\"$cmdpath/$w\" ;;\n", strings.Join(subPaths, "|"))
+		b.WriteString("\t\tesac\n")
+	}
+	b.WriteString("\tdone\n\n")
+
+	b.WriteString("\tlocal words=\"\" opts=\"\" pathopts=\"\" files=0\n")
+	b.WriteString("\tcase \"$cmdpath\" in\n")
+	for _, p := range paths {
+		fmt.Fprintf(&b, "\t%s)\n", shellQuote(p.path))
+		if words := p.words(); len(words) > 0 {
+			fmt.Fprintf(&b, "\t\twords=%s\n", shellQuote(strings.Join(words, " ")))
+		}
+		if flags := p.flags(false); len(flags) > 0 {
+			fmt.Fprintf(&b, "\t\topts=%s\n", shellQuote(strings.Join(flags, " ")))
+		}
+		if flags := p.flags(true); len(flags) > 0 {
+			fmt.Fprintf(&b, "\t\tpathopts=%s\n", shellQuote(strings.Join(flags, " ")))
+		}
+		if p.fileArgs {
+			b.WriteString("\t\tfiles=1\n")
+		}
+		b.WriteString("\t\t;;\n")
+	}
+	b.WriteString("\tesac\n\n")
+
+	b.WriteString("\tif [[ \" $pathopts \" == *\" $prev \"* ]]; then\n")
+	b.WriteString("\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	b.WriteString("\telif [[ \"$cur\" == -* ]]; then\n")
+	b.WriteString("\t\tCOMPREPLY=($(compgen -W \"$opts\" -- \"$cur\"))\n")
+	b.WriteString("\telif [ \"$files\" = 1 ]; then\n")
+	b.WriteString("\t\tCOMPREPLY=($(compgen -f -W \"$words\" -- \"$cur\"))\n")
+	b.WriteString("\telse\n")
+	b.WriteString("\t\tCOMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	b.WriteString("\tfi\n")
+	b.WriteString("}\n\n")
+	fmt.Fprintf(&b, "complete -F %s %s\n", fn, shellQuote(rootName))
+
+	_, err = b.WriteTo(out)
+	return err
+}
+
+// zshOptionSpecs returns the _arguments specs of the options of p, with their
+// descriptions.
+func zshOptionSpecs(p completionPath) []string {
+	escape := strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+
+	var specs []string
+	for _, opt := range p.options {
+		var flags []string
+		for _, name := range opt.Names() {
+			flags = append(flags, optionFlag(name))
+		}
+
+		excl := ""
+		if len(flags) > 1 {
+			excl = "(" + strings.Join(flags, " ") + ")"
+		}
+		arg := ""
+		switch {
+		case cmds.IsPathOption(opt):
+			arg = ":file:_files"
+		case opt.Type() != cmds.Bool:
+			arg = ":" + opt.Names()[0] + ":"
+		}
+
+		for _, flag := range flags {
+			specs = append(specs, excl+flag+"["+escape.Replace(opt.Description())+"]"+arg)
+		}
+	}
+	return specs
+}
+
+// GenerateZshCompletion writes a zsh completion script for the program
+// rootName with the command tree root. Like GenerateBashCompletion's, but
+// options and subcommands are listed with their descriptions and taglines.
+// Install it as `_<rootName>` in a directory of $fpath.
+func GenerateZshCompletion(rootName string, root *cmds.Command, out io.Writer) error {
+	paths, err := completionPaths(root)
+	if err != nil {
+		return err
+	}
+
+	fn := "_" + nonIdentChars.ReplaceAllString(rootName, "_")
+	subPaths := subPaths(paths)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#compdef %s\n\n", rootName)
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	b.WriteString("\tlocal cmdpath=\"\" i w\n")
+	b.WriteString("\tfor ((i = 2; i < CURRENT; i++)); do\n")
+	b.WriteString("\t\tw=\"${words[i]}\"\n")
+	if len(subPaths) > 0 {
+		b.WriteString("\t\tcase \"$cmdpath/$w\" in\n")
+		fmt.Fprintf(&b, "\t\t%s) cmdpath=\"$cmdpath/$w\" ;;\n", strings.Join(subPaths, "|"))
+		b.WriteString("\t\tesac\n")
+	}
+	b.WriteString("\tdone\n\n")
+
+	b.WriteString("\tlocal -a opts subs vals\n")
+	b.WriteString("\tlocal files=0 state\n")
+	b.WriteString("\tcase \"$cmdpath\" in\n")
+	for _, p := range paths {
+		fmt.Fprintf(&b, "\t%s)\n", shellQuote(p.path))
+		if specs := zshOptionSpecs(p); len(specs) > 0 {
+			b.WriteString("\t\topts=(\n")
+			for _, spec := range specs {
+				fmt.Fprintf(&b, "\t\t\t%s\n", shellQuote(spec))
+			}
+			b.WriteString("\t\t)\n")
+		}
+		if len(p.subcommands) > 0 {
+			b.WriteString("\t\tsubs=(\n")
+			for i, name := range p.subcommands {
+				entry := strings.Replace(name, ":", `\:`, -1)
+				if p.taglines[i] != "" {
+					entry += ":" + p.taglines[i]
+				}
+				fmt.Fprintf(&b, "\t\t\t%s\n", shellQuote(entry))
+			}
+			b.WriteString("\t\t)\n")
+		}
+		if len(p.values) > 0 {
+			quoted := make([]string, len(p.values))
+			for i, v := range p.values {
+				quoted[i] = shellQuote(v)
+			}
+			fmt.Fprintf(&b, "\t\tvals=(%s)\n", strings.Join(quoted, " "))
+		}
+		if p.fileArgs {
+			b.WriteString("\t\tfiles=1\n")
+		}
+		b.WriteString("\t\t;;\n")
+	}
+	b.WriteString("\tesac\n\n")
+
+	b.WriteString("\t_arguments -s : \"${opts[@]}\" '*: :->args'\n")
+	b.WriteString("\tif [[ $state == args ]]; then\n")
+	b.WriteString("\t\tlocal ret=1\n")
+	b.WriteString("\t\t(( ${#subs} )) && _describe -t commands command subs && ret=0\n")
+	b.WriteString("\t\t(( ${#vals} )) && compadd -a vals && ret=0\n")
+	b.WriteString("\t\t(( files )) && _files && ret=0\n")
+	b.WriteString("\t\treturn ret\n")
+	b.WriteString("\tfi\n")
+	b.WriteString("}\n\n")
+	fmt.Fprintf(&b, "%s \"$@\"\n", fn)
+
+	_, err = b.WriteTo(out)
+	return err
+}
+
+// fishQuote quotes s as a single word for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// GenerateFishCompletion writes a fish completion script for the program
+// rootName with the command tree root. It completes the same candidates as
+// GenerateBashCompletion's, with the descriptions of options, the taglines of
+// subcommands and the names of the arguments as hints. Install it as
+// `<rootName>.fish` in ~/.config/fish/completions.
+func GenerateFishCompletion(rootName string, root *cmds.Command, out io.Writer) error {
+	paths, err := completionPaths(root)
+	if err != nil {
+		return err
+	}
+
+	fn := "__" + nonIdentChars.ReplaceAllString(rootName, "_") + "_at"
+	prog := fishQuote(rootName)
+	subPaths := make([]string, 0, len(paths))
+	for _, p := range paths[1:] {
+		subPaths = append(subPaths, fishQuote(p.path))
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# fish completion for %s\n\n", rootName)
+	b.WriteString("# true if the command being completed is at the path $argv[1]\n")
+	fmt.Fprintf(&b, "function %s\n", fn)
+	b.WriteString("\tset -l tokens (commandline -opc)\n")
+	b.WriteString("\tset -l cmdpath \"\"\n")
+	b.WriteString("\tset -e tokens[1]\n")
+	b.WriteString("\tfor w in $tokens\n")
+	if len(subPaths) > 0 {
+		b.WriteString("\t\tswitch \"$cmdpath/$w\"\n")
+		fmt.Fprintf(&b, "\t\t\tcase %s\n", strings.Join(subPaths, " "))
+		b.WriteString("\t\t\t\tset cmdpath \"$cmdpath/$w\"\n")
+		b.WriteString("\t\tend\n")
+	}
+	b.WriteString("\tend\n")
+	b.WriteString("\ttest \"$cmdpath\" = \"$argv[1]\"\n")
+	b.WriteString("end\n\n")
+
+	fmt.Fprintf(&b, "complete -c %s -f\n", prog)
+	for _, p := range paths {
+		cond := fishQuote(fn + " " + fishQuote(p.path))
+		complete := fmt.Sprintf("complete -c %s -n %s", prog, cond)
+
+		b.WriteString("\n")
+		for i, name := range p.subcommands {
+			fmt.Fprintf(&b, "%s -a %s", complete, fishQuote(name))
+			if p.taglines[i] != "" {
+				fmt.Fprintf(&b, " -d %s", fishQuote(p.taglines[i]))
+			}
+			b.WriteString("\n")
+		}
+		for _, arg := range p.args {
+			fmt.Fprintf(&b, "%s -a %s -d %s\n", complete, fishQuote(strings.Join(arg.Completions, " ")), fishQuote(arg.Name))
+		}
+		if p.fileArgs {
+			fmt.Fprintf(&b, "%s -F\n", complete)
+		}
+		for _, opt := range p.options {
+			b.WriteString(complete)
+			for _, name := range opt.Names() {
+				if len(name) == 1 {
+					fmt.Fprintf(&b, " -s %s", name)
+				} else {
+					fmt.Fprintf(&b, " -l %s", name)
+				}
+			}
+			switch {
+			case cmds.IsPathOption(opt):
+				b.WriteString(" -r -F")
+			case opt.Type() != cmds.Bool:
+				b.WriteString(" -x")
+			}
+			if opt.Description() != "" {
+				fmt.Fprintf(&b, " -d %s", fishQuote(opt.Description()))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	_, err = b.WriteTo(out)
+	return err
+}
+
+// psQuote quotes s as a single word for PowerShell.
+func psQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// GeneratePowerShellCompletion writes the registration of a PowerShell
+// argument completer for the program rootName with the command tree root.
+// It completes subcommands, option flags and the static candidates of string
+// arguments, with their descriptions as tooltips. Where it has no candidates
+// (e.g. file arguments) PowerShell completes paths. Load it from $PROFILE.
+func GeneratePowerShellCompletion(rootName string, root *cmds.Command, out io.Writer) error {
+	paths, err := completionPaths(root)
+	if err != nil {
+		return err
+	}
+
+	subPaths := make([]string, 0, len(paths))
+	for _, p := range paths[1:] {
+		subPaths = append(subPaths, psQuote(p.path))
+	}
+
+	candidate := func(b *bytes.Buffer, text, kind, tip string) {
+		if tip == "" {
+			tip = text
+		}
+		fmt.Fprintf(b, "\t\t\t,@(%s, %s, %s)\n", psQuote(text), psQuote(kind), psQuote(tip))
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# PowerShell completion for %s\n\n", rootName)
+	fmt.Fprintf(&b, "Register-ArgumentCompleter -Native -CommandName %s -ScriptBlock {\n", psQuote(rootName))
+	b.WriteString("\tparam($wordToComplete, $commandAst, $cursorPosition)\n\n")
+	fmt.Fprintf(&b, "\t$subPaths = @(%s)\n", strings.Join(subPaths, ", "))
+	b.WriteString("\t$cmdpath = ''\n")
+	b.WriteString("\tforeach ($element in $commandAst.CommandElements | Select-Object -Skip 1) {\n")
+	b.WriteString("\t\tif ($element.Extent.EndOffset -ge $cursorPosition) { break }\n")
+	b.WriteString("\t\t$w = $element.ToString()\n")
+	b.WriteString("\t\tif ($subPaths -contains \"$cmdpath/$w\") { $cmdpath = \"$cmdpath/$w\" }\n")
+	b.WriteString("\t}\n\n")
+
+	b.WriteString("\t$candidates = @{\n")
+	for _, p := range paths {
+		fmt.Fprintf(&b, "\t\t%s = @(\n", psQuote(p.path))
+		for i, name := range p.subcommands {
+			candidate(&b, name, "Command", p.taglines[i])
+		}
+		for _, arg := range p.args {
+			for _, c := range arg.Completions {
+				candidate(&b, c, "ParameterValue", arg.Name)
+			}
+		}
+		for _, opt := range p.options {
+			for _, name := range opt.Names() {
+				candidate(&b, optionFlag(name), "ParameterName", opt.Description())
+			}
+		}
+		b.WriteString("\t\t)\n")
+	}
+	b.WriteString("\t}\n\n")
+
+	b.WriteString("\tforeach ($c in $candidates[$cmdpath]) {\n")
+	b.WriteString("\t\tif ($c[1] -eq 'ParameterName' -and $wordToComplete -notlike '-*') { continue }\n")
+	b.WriteString("\t\tif ($c[0] -like \"$wordToComplete*\") {\n")
+	b.WriteString("\t\t\t[System.Management.Automation.CompletionResult]::new($c[0], $c[0], $c[1], $c[2])\n")
+	b.WriteString("\t\t}\n")
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+
+	_, err = b.WriteTo(out)
+	return err
+}
+
+// CompletionCommand returns a hidden command that writes the completion
+// script of the tree rooted at root for a shell, named as its subcommand
+// (e.g. `completion fish`). rootName is the name of the program.
+func CompletionCommand(rootName string, root *cmds.Command) *cmds.Command {
+	shells := map[string]func(string, *cmds.Command, io.Writer) error{
+		"bash":       GenerateBashCompletion,
+		"zsh":        GenerateZshCompletion,
+		"fish":       GenerateFishCompletion,
+		"powershell": GeneratePowerShellCompletion,
+	}
+
+	cmd := &cmds.Command{
+		Helptext: cmds.HelpText{
+			Tagline: "Generate shell completion scripts.",
+		},
+		Subcommands: make(map[string]*cmds.Command, len(shells)),
+		Hidden:      true,
+	}
+	for name, generate := range shells {
+		generate := generate
+		cmd.Subcommands[name] = &cmds.Command{
+			Helptext: cmds.HelpText{
+				Tagline: fmt.Sprintf("Write the %s completion script.", name),
+			},
+			Run: func(req cmds.Request, res cmds.Response) {
+				var b bytes.Buffer
+				if err := generate(rootName, root, &b); err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+				res.SetOutput(&b)
+			},
+			RawOutput: true,
+		}
+	}
+	return cmd
+}
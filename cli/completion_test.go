@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+var completionRoot = &cmds.Command{
+	Options: []cmds.Option{
+		cmds.PathOption("config", "c", "The config file"),
+		cmds.BoolOption("quiet", "Write [less] output"),
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": {
+			Arguments: []cmds.Argument{
+				cmds.FileArg("file", true, true, "The files to add"),
+			},
+		},
+		"pin": {
+			Helptext: cmds.HelpText{Tagline: "Keep objects [stored]"},
+			Subcommands: map[string]*cmds.Command{
+				"ls": {
+					Arguments: []cmds.Argument{
+						{Name: "type", Type: cmds.ArgString, Completions: []string{"direct", "recursive"}},
+					},
+				},
+			},
+		},
+		"hidden": {
+			Enabled: func() bool { return false },
+		},
+	},
+}
+
+func TestGenerateBashCompletion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := GenerateBashCompletion("ipfs", completionRoot, &buf); err != nil {
+		t.Fatal(err)
+	}
+	script := buf.String()
+
+	for _, s := range []string{
+		"_ipfs_complete() {",
+		"\t\t'/add'|'/pin'|'/pin/ls') cmdpath=\"$cmdpath/$w\" ;;\n",
+		"\t'')\n\t\twords='add pin'\n",
+		"\t'/add')\n",
+		"\t\tfiles=1\n",
+		"\t'/pin/ls')\n\t\twords='direct recursive'\n",
+		"\t\tpathopts='--config -c'\n",
+		"complete -F _ipfs_complete 'ipfs'\n",
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("Expected the script to contain %q, got:\n%s", s, script)
+		}
+	}
+	if strings.Contains(script, "hidden") {
+		t.Errorf("Expected disabled commands to be left out, got:\n%s", script)
+	}
+}
+
+func TestGenerateZshCompletion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := GenerateZshCompletion("ipfs", completionRoot, &buf); err != nil {
+		t.Fatal(err)
+	}
+	script := buf.String()
+
+	for _, s := range []string{
+		"#compdef ipfs\n",
+		"_ipfs() {",
+		"\t\t'/add'|'/pin'|'/pin/ls') cmdpath=\"$cmdpath/$w\" ;;\n",
+		"\t\t\t'(--config -c)--config[The config file]:file:_files'\n",
+		"\t\t\t'(--config -c)-c[The config file]:file:_files'\n",
+		"\t\t\t'--quiet[Write \\[less\\] output]'\n",
+		"\t\t\t'--timeout[",
+		"]:timeout:'\n",
+		"\t\tsubs=(\n\t\t\t'add'\n\t\t\t'pin:Keep objects [stored]'\n\t\t)\n",
+		"\t\tvals=('direct' 'recursive')\n",
+		"\t\tfiles=1\n",
+		"_ipfs \"$@\"\n",
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("Expected the script to contain %q, got:\n%s", s, script)
+		}
+	}
+}
+
+func TestGenerateFishCompletion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := GenerateFishCompletion("ipfs", completionRoot, &buf); err != nil {
+		t.Fatal(err)
+	}
+	script := buf.String()
+
+	for _, s := range []string{
+		"function __ipfs_at\n",
+		"\t\t\tcase '/add' '/pin' '/pin/ls'\n",
+		"complete -c 'ipfs' -f\n",
+		"complete -c 'ipfs' -n '__ipfs_at \\'\\'' -a 'pin' -d 'Keep objects [stored]'\n",
+		"complete -c 'ipfs' -n '__ipfs_at \\'/add\\'' -F\n",
+		"complete -c 'ipfs' -n '__ipfs_at \\'/pin/ls\\'' -a 'direct recursive' -d 'type'\n",
+		"complete -c 'ipfs' -n '__ipfs_at \\'\\'' -l config -s c -r -F -d 'The config file'\n",
+		"complete -c 'ipfs' -n '__ipfs_at \\'\\'' -l quiet -d 'Write [less] output'\n",
+		" -l timeout -x -d ",
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("Expected the script to contain %q, got:\n%s", s, script)
+		}
+	}
+}
+
+func TestCompletionCommand(t *testing.T) {
+	cmd := CompletionCommand("ipfs", completionRoot)
+	fish := cmd.Subcommand("fish")
+	if fish == nil {
+		t.Fatal("Expected a fish subcommand")
+	}
+
+	req, err := cmds.NewRequest(nil, nil, nil, nil, fish, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := fish.Call(req)
+	if res.Error() != nil {
+		t.Fatal(res.Error())
+	}
+	out, ok := res.Output().(io.Reader)
+	if !ok {
+		t.Fatalf("Expected the script as a stream, got %T", res.Output())
+	}
+	script, err := ioutil.ReadAll(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected bytes.Buffer
+	GenerateFishCompletion("ipfs", completionRoot, &expected)
+	if string(script) != expected.String() {
+		t.Errorf("Expected the fish script, got:\n%s", script)
+	}
+}
+
+func TestGeneratePowerShellCompletion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := GeneratePowerShellCompletion("ipfs", completionRoot, &buf); err != nil {
+		t.Fatal(err)
+	}
+	script := buf.String()
+
+	for _, s := range []string{
+		"Register-ArgumentCompleter -Native -CommandName 'ipfs' -ScriptBlock {\n",
+		"\t$subPaths = @('/add', '/pin', '/pin/ls')\n",
+		"\t\t'' = @(\n\t\t\t,@('add', 'Command', 'add')\n\t\t\t,@('pin', 'Command', 'Keep objects [stored]')\n",
+		"\t\t\t,@('--config', 'ParameterName', 'The config file')\n\t\t\t,@('-c', 'ParameterName', 'The config file')\n",
+		"\t\t'/pin/ls' = @(\n\t\t\t,@('direct', 'ParameterValue', 'type')\n\t\t\t,@('recursive', 'ParameterValue', 'type')\n",
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("Expected the script to contain %q, got:\n%s", s, script)
+		}
+	}
+}
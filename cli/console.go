@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+var (
+	consolesMu sync.Mutex
+	// consoles caches the result of enableConsole per file descriptor
+	consoles = map[uintptr]bool{}
+)
+
+// EnableConsole prepares the console f for the CLI's output: on Windows, it
+// turns on the processing of ANSI escape sequences (used for colors) and
+// switches the console to UTF-8. It returns false if the console can't
+// render ANSI sequences, like older Windows consoles, in which case the
+// output isn't colored. Other systems need no setup. The CLI calls it before
+// coloring output, front-ends may call it at startup for output of their
+// own.
+func EnableConsole(f *os.File) bool {
+	consolesMu.Lock()
+	defer consolesMu.Unlock()
+	if ok, found := consoles[f.Fd()]; found {
+		return ok
+	}
+	ok := enableConsole(f)
+	consoles[f.Fd()] = ok
+	return ok
+}
+
+// ansiConsole returns true if ANSI sequences written to w are rendered, or
+// passed on if w is not a console.
+func ansiConsole(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return !ok || EnableConsole(f)
+}
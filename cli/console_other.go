@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package cli
+
+import (
+	"os"
+)
+
+func enableConsole(f *os.File) bool {
+	return true
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestEnableConsole(t *testing.T) {
+	f, err := ioutil.TempFile("", "console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// files and pipes pass ANSI sequences on, whatever the system
+	if !EnableConsole(f) || !ansiConsole(f) {
+		t.Error("Expected a file to take ANSI sequences")
+	}
+	consolesMu.Lock()
+	_, cached := consoles[f.Fd()]
+	consolesMu.Unlock()
+	if !cached {
+		t.Error("Expected the console setup to be cached")
+	}
+
+	if !ansiConsole(&bytes.Buffer{}) {
+		t.Error("Expected a buffer to take ANSI sequences")
+	}
+	if runtime.GOOS != "windows" && !enableConsole(os.Stdout) {
+		t.Error("Expected consoles to need no setup")
+	}
+}
@@ -0,0 +1,40 @@
+//go:build windows
+// +build windows
+
+package cli
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	kernel32               = syscall.NewLazyDLL("kernel32.dll")
+	procSetConsoleMode     = kernel32.NewProc("SetConsoleMode")
+	procSetConsoleOutputCP = kernel32.NewProc("SetConsoleOutputCP")
+)
+
+const (
+	// see https://learn.microsoft.com/windows/console/setconsolemode
+	enableVirtualTerminalProcessing = 0x0004
+
+	utf8CodePage = 65001
+)
+
+func enableConsole(f *os.File) bool {
+	h := syscall.Handle(f.Fd())
+	var mode uint32
+	if err := syscall.GetConsoleMode(h, &mode); err != nil {
+		// not a console, e.g. a pipe or a terminal emulator like mintty,
+		// which handles ANSI sequences itself
+		return true
+	}
+
+	procSetConsoleOutputCP.Call(utf8CodePage)
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+	// consoles before Windows 10 don't know the mode and fail
+	r, _, _ := procSetConsoleMode.Call(uintptr(h), uintptr(mode|enableVirtualTerminalProcessing))
+	return r != 0
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package cli
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoEchoControl = errors.New("Secrets can't be prompted for on this platform, the terminal's echo can't be disabled")
+
+func disableEcho(f *os.File) (restore func(), err error) {
+	return nil, errNoEchoControl
+}
@@ -0,0 +1,35 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package cli
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func termios(fd uintptr, req uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// disableEcho turns off the echo of the terminal f, until restore is called.
+func disableEcho(f *os.File) (restore func(), err error) {
+	var old syscall.Termios
+	if err := termios(f.Fd(), ioctlGetTermios, &old); err != nil {
+		return nil, err
+	}
+
+	t := old
+	t.Lflag &^= syscall.ECHO
+	if err := termios(f.Fd(), ioctlSetTermios, &t); err != nil {
+		return nil, err
+	}
+	return func() {
+		termios(f.Fd(), ioctlSetTermios, &old)
+	}, nil
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// DefaultEditor is the editor used when neither $VISUAL nor $EDITOR is set.
+var DefaultEditor = "vi"
+
+// Edit opens the user's editor ($VISUAL, $EDITOR, or DefaultEditor) on a
+// temporary file with the text template, and returns the text saved once
+// the editor exits. Lines starting with '#' are removed from it, like git
+// does with commit messages, as are trailing blank lines. The editor runs on
+// the terminal of stdin, stdout and stderr.
+func Edit(template string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = DefaultEditor
+	}
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		return "", fmt.Errorf("No editor is set, set $EDITOR")
+	}
+
+	f, err := ioutil.TempFile("", "edit-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(template)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(args[0], append(args[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("The editor '%s' failed: %s", editor, err)
+	}
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return stripComments(string(data)), nil
+}
+
+// stripComments removes the lines starting with '#' and the trailing blank
+// lines of text.
+func stripComments(text string) string {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "#") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.TrimRight(strings.Join(kept, "\n"), " \t\n")
+}
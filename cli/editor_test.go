@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEdit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test editor is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the editor keeps the template, but for its first line, and adds a line
+	editor := filepath.Join(dir, "editor")
+	script := "#!/bin/sh\nsed -i.bak 1d \"$1\"\necho 'the end' >> \"$1\"\n"
+	if err := ioutil.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("VISUAL", os.Getenv("VISUAL"))
+	defer os.Setenv("EDITOR", os.Getenv("EDITOR"))
+	os.Setenv("VISUAL", "")
+	os.Setenv("EDITOR", editor)
+
+	text, err := Edit("first\nsecond\n# write the message above\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "second\n\nthe end" {
+		t.Errorf("unexpected text %q", text)
+	}
+
+	os.Setenv("VISUAL", filepath.Join(dir, "missing"))
+	if _, err := Edit(""); err == nil {
+		t.Error("Expected a missing editor to fail")
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	cases := map[string]string{
+		"":                        "",
+		"# only comments\n#\n":    "",
+		"text\n# comment\nmore\n": "text\nmore",
+		"keep # this\r\n\r\n":     "keep # this",
+	}
+	for in, expected := range cases {
+		if out := stripComments(in); out != expected {
+			t.Errorf("stripComments(%q) = %q, expected %q", in, out, expected)
+		}
+	}
+}
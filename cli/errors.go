@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// Stable error types of ErrorReports, for scripts to match on.
+const (
+	ErrorUsage          = "usage"          // invalid command line, as returned by Parse
+	ErrorClient         = "client"         // the request was invalid (cmds.ErrClient)
+	ErrorNormal         = "error"          // the command failed (cmds.ErrNormal)
+	ErrorImplementation = "implementation" // a bug in the command (cmds.ErrImplementation)
+	ErrorTimeout        = "timeout"        // the request ran out of its timeout or deadline
+	ErrorInterrupted    = "interrupted"    // the request was interrupted
+)
+
+// Exit statuses returned by ExitCode. They only depend on the error's code
+// and cause, so remote executions exit like local ones.
+const (
+	ExitSuccess        = 0
+	ExitError          = 1   // ErrorNormal
+	ExitUsage          = 2   // ErrorUsage and ErrorClient
+	ExitImplementation = 3   // ErrorImplementation
+	ExitTimeout        = 124 // ErrorTimeout, like timeout(1)
+	ExitInterrupted    = 130 // ErrorInterrupted, like shells for SIGINT
+)
+
+// ErrorReport is the machine-parsable form of an error, written out instead
+// of the error text if the --json-errors option is set.
+type ErrorReport struct {
+	Message string
+	Code    cmds.ErrorType
+	Type    string
+
+	// Kind, Details and Hints are set from errors that are cmds.Errors
+	Kind    string                 `json:",omitempty"`
+	Details map[string]interface{} `json:",omitempty"`
+	Hints   []string               `json:",omitempty"`
+}
+
+// NewErrorReport returns the report of an error returned by a command (or the
+// cause of its request, see cmds.CancelCause).
+func NewErrorReport(err error) ErrorReport {
+	r := ErrorReport{Message: err.Error(), Code: cmds.ErrNormal, Type: ErrorNormal}
+
+	var e *cmds.Error
+	var ev cmds.Error
+	switch {
+	case errors.As(err, &e):
+		r.Code, r.Kind, r.Details, r.Hints = e.Code, e.Kind, e.Details, e.Hints
+	case errors.As(err, &ev):
+		r.Code, r.Kind, r.Details, r.Hints = ev.Code, ev.Kind, ev.Details, ev.Hints
+	}
+
+	var timeout cmds.TimeoutError
+	var deadline cmds.DeadlineError
+	switch {
+	case errors.As(err, &timeout), errors.As(err, &deadline):
+		r.Type = ErrorTimeout
+	case errors.Is(err, cmds.ErrInterrupted):
+		r.Type = ErrorInterrupted
+	case r.Code == cmds.ErrClient:
+		r.Type = ErrorClient
+	case r.Code == cmds.ErrImplementation:
+		r.Type = ErrorImplementation
+	}
+	return r
+}
+
+// UsageErrorReport returns the report of an error returned by Parse.
+func UsageErrorReport(err error) ErrorReport {
+	r := ErrorReport{Message: err.Error(), Code: cmds.ErrClient, Type: ErrorUsage}
+	var e *cmds.Error
+	if errors.As(err, &e) {
+		r.Kind, r.Details, r.Hints = e.Kind, e.Details, e.Hints
+	}
+	return r
+}
+
+// ExitCode returns the exit status for the report's error.
+func (r ErrorReport) ExitCode() int {
+	switch r.Type {
+	case ErrorUsage, ErrorClient:
+		return ExitUsage
+	case ErrorImplementation:
+		return ExitImplementation
+	case ErrorTimeout:
+		return ExitTimeout
+	case ErrorInterrupted:
+		return ExitInterrupted
+	}
+	return ExitError
+}
+
+// ExitCode returns the exit status of a command that failed with err (or
+// ExitSuccess if err is nil). Errors of output streams that fail after
+// writing some values, locally or in a remote execution, are *cmds.Errors
+// with the code the command failed with.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+	return NewErrorReport(err).ExitCode()
+}
+
+// WriteText writes the report for the user: the error message, followed by
+// its hints, one per line.
+func (r ErrorReport) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "%s %s\n", paint(w, styleRed, "Error:"), r.Message); err != nil {
+		return err
+	}
+	for _, h := range r.Hints {
+		if _, err := fmt.Fprintf(w, "hint: %s\n", h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes the report as a JSON object on its own line.
+func (r ErrorReport) Write(w io.Writer) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// JSONErrors returns true if the --json-errors option is in the command line
+// input. Unlike parsing the options, it also works for invalid command lines,
+// so usage errors can be reported in JSON too.
+func JSONErrors(input []string) bool {
+	for _, arg := range input {
+		switch arg {
+		case "--":
+			return false
+		case "--" + cmds.JSONErrorsOpt, "--" + cmds.JSONErrorsOpt + "=true":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-commands"
+)
+
+func TestErrorReports(t *testing.T) {
+	if !JSONErrors([]string{"add", "--json-errors", "--bad-option"}) {
+		t.Error("Expected --json-errors to be found")
+	}
+	if JSONErrors([]string{"add", "--", "--json-errors"}) {
+		t.Error("Expected --json-errors to be an argument after '--'")
+	}
+
+	root := &commands.Command{}
+	_, _, _, err := Parse([]string{"--json-errors", "--bad-option"}, nil, root)
+	if err == nil {
+		t.Fatal("Expected a usage error")
+	}
+
+	var buf bytes.Buffer
+	if err := UsageErrorReport(err).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Message":"Unrecognized option 'bad-option'","Code":1,"Type":"usage","Kind":"unknown-option",` +
+		`"Details":{"option":"bad-option","position":1,"suggestions":[],"token":"--bad-option"}}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	cases := []struct {
+		err  error
+		typ  string
+		code commands.ErrorType
+	}{
+		{errors.New("oops"), ErrorNormal, commands.ErrNormal},
+		{&commands.Error{Message: "bad", Code: commands.ErrClient}, ErrorClient, commands.ErrClient},
+		{commands.Error{Message: "bug", Code: commands.ErrImplementation}, ErrorImplementation, commands.ErrImplementation},
+		{commands.TimeoutError{Timeout: time.Second}, ErrorTimeout, commands.ErrNormal},
+		{fmt.Errorf("stopped: %w", commands.ErrInterrupted), ErrorInterrupted, commands.ErrNormal},
+	}
+	for _, c := range cases {
+		r := NewErrorReport(c.err)
+		if r.Type != c.typ || r.Code != c.code || r.Message != c.err.Error() {
+			t.Errorf("Unexpected report for '%s': %+v", c.err, r)
+		}
+	}
+}
+
+func TestErrorHints(t *testing.T) {
+	err := commands.Error{Message: "Unknown option 'r'"}.WithHint("did you mean --recursive?").WithHint("see --help")
+	r := NewErrorReport(fmt.Errorf("add: %w", err))
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Error: add: Unknown option 'r'\nhint: did you mean --recursive?\nhint: see --help\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"Message":"add: Unknown option 'r'","Code":0,"Type":"error","Hints":["did you mean --recursive?","see --help"]}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{nil, ExitSuccess},
+		{errors.New("oops"), ExitError},
+		{&commands.Error{Message: "bad", Code: commands.ErrClient}, ExitUsage},
+		{commands.Error{Message: "bug", Code: commands.ErrImplementation}, ExitImplementation},
+		{commands.DeadlineError{Deadline: time.Now()}, ExitTimeout},
+		{commands.ErrInterrupted, ExitInterrupted},
+	}
+	for _, c := range cases {
+		if code := ExitCode(c.err); code != c.code {
+			t.Errorf("Expected exit code %d for '%v', got %d", c.code, c.err, code)
+		}
+	}
+
+	if code := UsageErrorReport(errors.New("bad flag")).ExitCode(); code != ExitUsage {
+		t.Errorf("Expected exit code %d for usage errors, got %d", ExitUsage, code)
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+)
+
+// expandPath expands a leading `~` to the user's home directory, and
+// environment variables (`$VAR` or `${VAR}`) anywhere in a path value, the way
+// a shell would if the value came from the command line. This also applies
+// to values that never went through a shell (e.g. from config files or env).
+// A backslash escapes a literal `~` or `$`.
+func expandPath(s string) (string, error) {
+	var buf bytes.Buffer
+
+	if len(s) > 0 && s[0] == '~' && (len(s) == 1 || os.IsPathSeparator(s[1])) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(home)
+		s = s[1:]
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '$' || s[i+1] == '~'):
+			buf.WriteByte(s[i+1])
+			i++
+
+		case c == '$':
+			name, n := varName(s[i+1:])
+			if n == 0 {
+				buf.WriteByte(c)
+				continue
+			}
+			buf.WriteString(os.Getenv(name))
+			i += n
+
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// varName returns the name of the variable at the start of s (after the
+// '$'), and the number of bytes it takes up including any braces.
+func varName(s string) (string, int) {
+	if len(s) > 0 && s[0] == '{' {
+		for i := 1; i < len(s); i++ {
+			if s[i] == '}' {
+				return s[1:i], i + 1
+			}
+		}
+		return "", 0
+	}
+
+	i := 0
+	for i < len(s) && isVarChar(s[i], i == 0) {
+		i++
+	}
+	return s[:i], i
+}
+
+func isVarChar(c byte, first bool) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || !first && '0' <= c && c <= '9'
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"sort"
 	"strings"
+	"sync"
 	"text/template"
 
 	cmds "github.com/ipfs/go-commands"
@@ -35,10 +36,25 @@ type helpFields struct {
 	Subcommands string
 	Description string
 	MoreHelp    bool
+
+	// Command is the command the help text is about, for custom templates
+	Command *cmds.Command
+
+	// color is true if the help is styled, see Heading
+	color bool
+}
+
+// Heading returns the heading of a section, in bold if the help is colored.
+func (f helpFields) Heading(s string) string {
+	if !f.color {
+		return s
+	}
+	return styleBold.apply(s)
 }
 
 // TrimNewlines removes extra newlines from fields. This makes aligning
 // commands easier. Below, the leading + tralining newlines are removed:
+//
 //	Synopsis: `
 //	    ipfs config <key>          - Get value of <key>
 //	    ipfs config <key> <value>  - Set value of <key> to <value>
@@ -74,49 +90,93 @@ func (f *helpFields) IndentAll() {
 
 const usageFormat = "{{if .Usage}}{{.Usage}}{{else}}{{.Path}}{{if .ArgUsage}} {{.ArgUsage}}{{end}} - {{.Tagline}}{{end}}"
 
-const longHelpFormat = `
+// header and footer are empty blocks around both help texts, for custom
+// templates to fill in (see SetHelpTemplates)
+const helpBlocksFormat = `{{define "header"}}{{end}}{{define "footer"}}{{end}}`
+
+const longHelpFormat = `{{template "header" .}}
 {{.Indent}}{{template "usage" .}}
 
-{{if .Arguments}}ARGUMENTS:
+{{block "arguments" .}}{{if .Arguments}}{{.Heading "ARGUMENTS:"}}
 
 {{.Arguments}}
 
-{{end}}{{if .Options}}OPTIONS:
+{{end}}{{end}}{{block "options" .}}{{if .Options}}{{.Heading "OPTIONS:"}}
 
 {{.Options}}
 
-{{end}}{{if .Subcommands}}SUBCOMMANDS:
+{{end}}{{end}}{{block "subcommands" .}}{{if .Subcommands}}{{.Heading "SUBCOMMANDS:"}}
 
 {{.Subcommands}}
 
 {{.Indent}}Use '{{.Path}} <subcmd> --help' for more information about each command.
 
-{{end}}{{if .Description}}DESCRIPTION:
+{{end}}{{end}}{{block "description" .}}{{if .Description}}{{.Heading "DESCRIPTION:"}}
 
 {{.Description}}
 
-{{end}}
+{{end}}{{end}}{{template "footer" .}}
 `
-const shortHelpFormat = `USAGE:
+const shortHelpFormat = `{{template "header" .}}{{.Heading "USAGE:"}}
 
 {{.Indent}}{{template "usage" .}}
-{{if .Synopsis}}
+{{block "synopsis" .}}{{if .Synopsis}}
 {{.Synopsis}}
-{{end}}{{if .Description}}
+{{end}}{{end}}{{block "shortDescription" .}}{{if .Description}}
 {{.Description}}
-{{end}}
-{{if .MoreHelp}}Use '{{.Path}} --help' for more information about this command.
-{{end}}
+{{end}}{{end}}
+{{block "moreHelp" .}}{{if .MoreHelp}}Use '{{.Path}} --help' for more information about this command.
+{{end}}{{end}}{{template "footer" .}}
 `
 
-var usageTemplate *template.Template
+// defaultHelpTemplates are the templates of the help texts, which
+// SetHelpTemplates adds to
+var defaultHelpTemplates *template.Template
+
+// helpTemplatesMu guards longHelpTemplate and shortHelpTemplate
+var helpTemplatesMu sync.RWMutex
 var longHelpTemplate *template.Template
 var shortHelpTemplate *template.Template
 
 func init() {
-	usageTemplate = template.Must(template.New("usage").Parse(usageFormat))
-	longHelpTemplate = template.Must(usageTemplate.New("longHelp").Parse(longHelpFormat))
-	shortHelpTemplate = template.Must(usageTemplate.New("shortHelp").Parse(shortHelpFormat))
+	defaultHelpTemplates = template.Must(template.New("usage").Parse(usageFormat))
+	template.Must(defaultHelpTemplates.Parse(helpBlocksFormat))
+	template.Must(defaultHelpTemplates.New("longHelp").Parse(longHelpFormat))
+	template.Must(defaultHelpTemplates.New("shortHelp").Parse(shortHelpFormat))
+
+	longHelpTemplate = defaultHelpTemplates.Lookup("longHelp")
+	shortHelpTemplate = defaultHelpTemplates.Lookup("shortHelp")
+}
+
+// SetHelpTemplates customizes the layout of LongHelp and ShortHelp. text is
+// parsed as a text/template on top of the default templates, so it can
+// redefine the "longHelp" and "shortHelp" layouts entirely (e.g. to reorder
+// them), or only some of their blocks:
+//
+//	{{define "footer"}}Report bugs at https://example.com/issues
+//	{{end}}
+//
+// The blocks are "header" and "footer" (empty by default), "usage",
+// "arguments", "options", "subcommands" and "description" in the long help,
+// and "synopsis", "shortDescription" and "moreHelp" in the short help. Their
+// data has the fields Path, ArgUsage, Tagline, Arguments, Options, Synopsis,
+// Subcommands, Description, MoreHelp, Indent and Command (the command the
+// help is about), and the method Heading, which styles section headings. Empty definitions don't replace blocks, define a block as
+// {{""}} to remove it. An empty text restores the default templates.
+func SetHelpTemplates(text string) error {
+	t, err := defaultHelpTemplates.Clone()
+	if err != nil {
+		return err
+	}
+	if _, err := t.Parse(text); err != nil {
+		return err
+	}
+
+	helpTemplatesMu.Lock()
+	defer helpTemplatesMu.Unlock()
+	longHelpTemplate = t.Lookup("longHelp")
+	shortHelpTemplate = t.Lookup("shortHelp")
+	return nil
 }
 
 // LongHelp returns a formatted CLI helptext string, generated for the given command
@@ -135,7 +195,7 @@ func LongHelp(rootName string, root *cmds.Command, path []string, out io.Writer)
 		Indent:      indentStr,
 		Path:        pathStr,
 		ArgUsage:    usageText(cmd),
-		Tagline:     cmd.Helptext.Tagline,
+		Tagline:     tagline(rootName, cmd),
 		Arguments:   cmd.Helptext.Arguments,
 		Options:     cmd.Helptext.Options,
 		Synopsis:    cmd.Helptext.Synopsis,
@@ -143,6 +203,8 @@ func LongHelp(rootName string, root *cmds.Command, path []string, out io.Writer)
 		Description: cmd.Helptext.ShortDescription,
 		Usage:       cmd.Helptext.Usage,
 		MoreHelp:    (cmd != root),
+		Command:     cmd,
+		color:       colorEnabled(out),
 	}
 
 	if len(cmd.Helptext.LongDescription) > 0 {
@@ -166,7 +228,12 @@ func LongHelp(rootName string, root *cmds.Command, path []string, out io.Writer)
 	// indent all fields that have been set
 	fields.IndentAll()
 
-	return longHelpTemplate.Execute(out, fields)
+	fields.WrapToTerminal()
+
+	helpTemplatesMu.RLock()
+	t := longHelpTemplate
+	helpTemplatesMu.RUnlock()
+	return t.Execute(out, fields)
 }
 
 // ShortHelp returns a formatted CLI helptext string, generated for the given command
@@ -190,11 +257,13 @@ func ShortHelp(rootName string, root *cmds.Command, path []string, out io.Writer
 		Indent:      indentStr,
 		Path:        pathStr,
 		ArgUsage:    usageText(cmd),
-		Tagline:     cmd.Helptext.Tagline,
+		Tagline:     tagline(rootName, cmd),
 		Synopsis:    cmd.Helptext.Synopsis,
 		Description: cmd.Helptext.ShortDescription,
 		Usage:       cmd.Helptext.Usage,
 		MoreHelp:    (cmd != root),
+		Command:     cmd,
+		color:       colorEnabled(out),
 	}
 
 	// trim the extra newlines (see TrimNewlines doc)
@@ -203,7 +272,12 @@ func ShortHelp(rootName string, root *cmds.Command, path []string, out io.Writer
 	// indent all fields that have been set
 	fields.IndentAll()
 
-	return shortHelpTemplate.Execute(out, fields)
+	fields.WrapToTerminal()
+
+	helpTemplatesMu.RLock()
+	t := shortHelpTemplate
+	helpTemplatesMu.RUnlock()
+	return t.Execute(out, fields)
 }
 
 func argumentText(cmd *cmds.Command) []string {
@@ -215,6 +289,12 @@ func argumentText(cmd *cmds.Command) []string {
 	lines = align(lines)
 	for i, arg := range cmd.Arguments {
 		lines[i] += " - " + arg.Description
+		if arg.Default != "" {
+			lines[i] += fmt.Sprintf(" (default: %q)", arg.Default)
+		}
+		if arg.SupportsStdin {
+			lines[i] += fmt.Sprintf(" (use '%s' to read from stdin)", stdinArg)
+		}
 	}
 
 	return lines
@@ -228,11 +308,27 @@ func optionFlag(flag string) string {
 	}
 }
 
+// commandOptions returns the options listed in the help of cmd: its own, and
+// the global --dry-run option if cmd supports it.
+func commandOptions(cmd *cmds.Command) []cmds.Option {
+	if !cmd.SupportsDryRun {
+		return cmd.Options
+	}
+	for _, opt := range cmd.Options {
+		for _, name := range opt.Names() {
+			if name == cmds.DryRunOpt {
+				return cmd.Options
+			}
+		}
+	}
+	return append(cmd.Options[:len(cmd.Options):len(cmd.Options)], cmds.OptionDryRun)
+}
+
 func optionText(cmd ...*cmds.Command) []string {
 	// get a slice of the options we want to list out
 	options := make([]cmds.Option, 0)
 	for _, c := range cmd {
-		for _, opt := range c.Options {
+		for _, opt := range commandOptions(c) {
 			options = append(options, opt)
 		}
 	}
@@ -288,26 +384,93 @@ func subcommandText(cmd *cmds.Command, rootName string, path []string) []string
 	if len(path) > 0 {
 		prefix += " "
 	}
-	subcmds := make([]*cmds.Command, len(cmd.Subcommands))
-	lines := make([]string, len(cmd.Subcommands))
 
-	i := 0
-	for name, sub := range cmd.Subcommands {
-		usage := usageText(sub)
+	names := listedSubcommands(cmd)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		usage := usageText(cmd.Subcommands[name])
 		if len(usage) > 0 {
 			usage = " " + usage
 		}
 		lines[i] = prefix + name + usage
-		subcmds[i] = sub
-		i++
 	}
 
 	lines = align(lines)
-	for i, sub := range subcmds {
-		lines[i] += " - " + sub.Helptext.Tagline
+	for i, name := range names {
+		lines[i] += " - " + tagline(rootName, cmd.Subcommands[name])
+		if name == cmd.DefaultSubcommand && defaultSubcommand(cmd) != nil {
+			lines[i] += " (default)"
+		}
 	}
 
-	return lines
+	return groupByCategory(cmd, names, lines)
+}
+
+// tagline returns the tagline of cmd, with a note naming its replacement if
+// it is deprecated
+func tagline(rootName string, cmd *cmds.Command) string {
+	if !cmd.Deprecated {
+		return cmd.Helptext.Tagline
+	}
+	note := "(deprecated)"
+	if cmd.ReplacedBy != "" {
+		note = fmt.Sprintf("(deprecated, use '%s %s')", rootName, cmd.ReplacedBy)
+	}
+	return strings.TrimSpace(cmd.Helptext.Tagline + " " + note)
+}
+
+// otherCategory is the heading of the subcommands without a category, when
+// the others have one
+const otherCategory = "Other"
+
+// groupByCategory groups the lines of the subcommands of cmd (with names)
+// under a heading per category, if any of them has one. Categories are in
+// the order of cmd.Categories, followed by the others sorted by name.
+func groupByCategory(cmd *cmds.Command, names, lines []string) []string {
+	byCategory := map[string][]string{}
+	for i, name := range names {
+		c := cmd.Subcommands[name].Category
+		byCategory[c] = append(byCategory[c], lines[i])
+	}
+	if _, ok := byCategory[""]; ok && len(byCategory) == 1 {
+		return lines
+	}
+
+	categories := make([]string, 0, len(byCategory))
+	seen := map[string]bool{"": true}
+	for _, c := range cmd.Categories {
+		if _, ok := byCategory[c]; ok && !seen[c] {
+			categories = append(categories, c)
+			seen[c] = true
+		}
+	}
+	rest := make([]string, 0, len(byCategory))
+	for c := range byCategory {
+		if !seen[c] {
+			rest = append(rest, c)
+		}
+	}
+	sort.Strings(rest)
+	categories = append(categories, rest...)
+	if _, ok := byCategory[""]; ok {
+		categories = append(categories, "")
+	}
+
+	grouped := make([]string, 0, len(lines)+2*len(categories))
+	for _, c := range categories {
+		if len(grouped) > 0 {
+			grouped = append(grouped, "")
+		}
+		heading := c
+		if heading == "" {
+			heading = otherCategory
+		}
+		grouped = append(grouped, heading+":")
+		for _, line := range byCategory[c] {
+			grouped = append(grouped, indentStr+line)
+		}
+	}
+	return grouped
 }
 
 func usageText(cmd *cmds.Command) string {
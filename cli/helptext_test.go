@@ -0,0 +1,208 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+func TestSetHelpTemplates(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"cat": {
+				Helptext: cmds.HelpText{
+					Tagline:          "Show objects.",
+					ShortDescription: "Writes the objects to stdout.",
+				},
+				Options: []cmds.Option{
+					cmds.BoolOption("quiet", "q", "Write less output"),
+				},
+			},
+		},
+	}
+	help := func() string {
+		var buf bytes.Buffer
+		if err := LongHelp("tool", root, []string{"cat"}, &buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	original := help()
+
+	err := SetHelpTemplates(`{{define "header"}}Tool v1 ({{.Command.Helptext.Tagline}})
+{{end}}{{define "options"}}FLAGS:
+
+{{.Options}}
+
+{{end}}{{define "description"}}{{""}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetHelpTemplates("")
+
+	custom := help()
+	if !strings.HasPrefix(custom, "Tool v1 (Show objects.)\n") {
+		t.Errorf("Expected the custom header, got:\n%s", custom)
+	}
+	if !strings.Contains(custom, "FLAGS:\n\n    -q, --quiet bool - Write less output\n") || strings.Contains(custom, "OPTIONS:") {
+		t.Errorf("Expected the custom options block, got:\n%s", custom)
+	}
+	if strings.Contains(custom, "DESCRIPTION:") {
+		t.Errorf("Expected the description block to be removed, got:\n%s", custom)
+	}
+
+	if err := SetHelpTemplates(`{{define "options"}}`); err == nil {
+		t.Error("Expected an invalid template to fail")
+	}
+	if got := help(); got != custom {
+		t.Errorf("Expected invalid templates to be ignored, got:\n%s", got)
+	}
+
+	SetHelpTemplates("")
+	if got := help(); got != original {
+		t.Errorf("Expected the default help text, got:\n%s", got)
+	}
+}
+
+func TestHelpWrapping(t *testing.T) {
+	root := &cmds.Command{
+		Helptext: cmds.HelpText{
+			Tagline:          "Show objects.",
+			ShortDescription: "Writes the data of the objects to stdout, one after the other.",
+		},
+		Options: []cmds.Option{
+			cmds.BoolOption("quiet", "q", "Write less output, only the hashes of the objects"),
+		},
+	}
+
+	defer func(w int) { HelpWidth = w }(HelpWidth)
+	HelpWidth = 50
+
+	var buf bytes.Buffer
+	if err := LongHelp("tool", root, nil, &buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"    -q, --quiet bool - Write less output, only the\n" +
+			"                       hashes of the objects\n",
+		"    Writes the data of the objects to stdout, one\n" +
+			"    after the other.\n",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Expected the help to contain %q, got:\n%s", s, buf.String())
+		}
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if len(line) > HelpWidth {
+			t.Errorf("Expected lines of at most %d columns, got %q", HelpWidth, line)
+		}
+	}
+}
+
+func TestHiddenCommands(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"cat":   {Helptext: cmds.HelpText{Tagline: "Show objects."}},
+			"debug": {Helptext: cmds.HelpText{Tagline: "Internal plumbing."}, Hidden: true},
+		},
+	}
+	root.Subcommands["completion"] = CompletionCommand("tool", root)
+
+	var buf bytes.Buffer
+	if err := LongHelp("tool", root, nil, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.Contains(s, "tool cat") || strings.Contains(s, "debug") || strings.Contains(s, "completion") {
+		t.Errorf("Expected only the listed subcommands in the help, got:\n%s", s)
+	}
+
+	if c := Complete(root, []string{""}); len(c) != 1 || c[0] != "cat" {
+		t.Errorf("Expected only the listed subcommands to be completed, got %v", c)
+	}
+
+	buf.Reset()
+	if err := GenerateBashCompletion("tool", root, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "debug") {
+		t.Errorf("Expected hidden commands to be left out of completion scripts, got:\n%s", buf.String())
+	}
+
+	_, cmd, _, err := Parse([]string{"debug"}, nil, root)
+	if err != nil || cmd != root.Subcommands["debug"] {
+		t.Errorf("Expected hidden commands to be callable, got %v (%v)", cmd, err)
+	}
+}
+
+func TestDryRunHelp(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"rm": {SupportsDryRun: true, Options: []cmds.Option{cmds.BoolOption("force", "f", "Remove pinned objects")}},
+			"gc": {},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := LongHelp("tool", root, []string{"rm"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.Contains(s, "--dry-run        bool - Show what the command would do, without doing it") {
+		t.Errorf("Expected the help to list --dry-run, got:\n%s", s)
+	}
+
+	buf.Reset()
+	if err := LongHelp("tool", root, []string{"gc"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "dry-run") {
+		t.Errorf("Expected no --dry-run in the help, got:\n%s", buf.String())
+	}
+}
+
+func TestSubcommandCategories(t *testing.T) {
+	root := &cmds.Command{
+		Categories: []string{"Basic", "Network"},
+		Subcommands: map[string]*cmds.Command{
+			"add":     {Category: "Basic", Helptext: cmds.HelpText{Tagline: "Add a file."}},
+			"cat":     {Category: "Basic", Helptext: cmds.HelpText{Tagline: "Show a file."}},
+			"swarm":   {Category: "Network", Helptext: cmds.HelpText{Tagline: "Manage peers."}},
+			"repo":    {Category: "Advanced", Helptext: cmds.HelpText{Tagline: "Manage the repo."}},
+			"version": {Helptext: cmds.HelpText{Tagline: "Show the version."}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := LongHelp("tool", root, nil, &buf); err != nil {
+		t.Fatal(err)
+	}
+	// blank lines are indented like in the other blocks
+	expected := "SUBCOMMANDS:\n\n" +
+		"    Basic:\n" +
+		"        tool add     - Add a file.\n" +
+		"        tool cat     - Show a file.\n" +
+		"    \n" +
+		"    Network:\n" +
+		"        tool swarm   - Manage peers.\n" +
+		"    \n" +
+		"    Advanced:\n" +
+		"        tool repo    - Manage the repo.\n" +
+		"    \n" +
+		"    Other:\n" +
+		"        tool version - Show the version.\n"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected the subcommands grouped by category:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	for _, sub := range root.Subcommands {
+		sub.Category = ""
+	}
+	buf.Reset()
+	if err := LongHelp("tool", root, nil, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "Other:") || !strings.Contains(buf.String(), "    tool add     - Add a file.\n    tool cat ") {
+		t.Errorf("Expected the subcommands without headings, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// HistoryEntry is a recorded command invocation. The values of secret options
+// (see cmds.SecretOption) are redacted in both Line and Request.
+type HistoryEntry struct {
+	Time    time.Time
+	Line    string          // the invocation, e.g. "add --pin foo"
+	Request json.RawMessage // the request, encoded by cmds.MarshalRedactedRequest
+	Status  int             // the exit status
+}
+
+// History records command invocations in a local file, one JSON encoded
+// entry per line.
+type History struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewHistory returns a History recorded in the file at path. The file is
+// created when the first entry is recorded.
+func NewHistory(path string) *History {
+	return &History{path: path}
+}
+
+// Record appends an entry for req, which exited with status.
+func (h *History) Record(req cmds.Request, status int) error {
+	data, err := cmds.MarshalRedactedRequest(req)
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(HistoryEntry{
+		Time:    time.Now(),
+		Line:    historyLine(req),
+		Request: data,
+		Status:  status,
+	})
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Entries returns the recorded entries, oldest first.
+func (h *History) Entries() ([]HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var e HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("Invalid history entry: %s", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Request returns a new request for the n-th entry (starting at 1), resolved
+// in the tree of root. Secret options are not recorded, so they are unset.
+func (h *History) Request(n int, root *cmds.Command) (cmds.Request, error) {
+	entries, err := h.Entries()
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > len(entries) {
+		return nil, fmt.Errorf("No history entry %d", n)
+	}
+
+	// it's a new invocation, so it gets a new request ID
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(entries[n-1].Request, &fields); err != nil {
+		return nil, fmt.Errorf("Invalid history entry: %s", err)
+	}
+	delete(fields, "ID")
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return cmds.UnmarshalRequest(data, root)
+}
+
+// historyLine formats the path, options and arguments of req like a command
+// line, with secret option values redacted.
+func historyLine(req cmds.Request) string {
+	words := append([]string{}, req.Path()...)
+
+	opts := req.Options()
+	names := make([]string, 0, len(opts))
+	for k := range opts {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		flag := "-" + k
+		if len(k) > 1 {
+			flag = "--" + k
+		}
+
+		var def cmds.Option
+		if opt := req.Option(k); opt != nil {
+			def = opt.Definition()
+		}
+		switch {
+		case cmds.IsSecretOption(def):
+			words = append(words, flag+"="+cmds.Redacted)
+		case def != nil && def.Type() == cmds.Bool && opts[k] == true:
+			words = append(words, flag)
+		default:
+			words = append(words, fmt.Sprintf("%s=%v", flag, opts[k]))
+		}
+	}
+
+	for _, arg := range req.Arguments() {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"") {
+			arg = strconv.Quote(arg)
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
+}
+
+// HistoryCommand returns a builtin command that lists the entries of h, and
+// re-runs them with its "run" subcommand. Entries are re-run in the tree of
+// root, and their output is encoded with the encoding of the "run" request.
+func HistoryCommand(h *History, root *cmds.Command) *cmds.Command {
+	run := &cmds.Command{
+		Helptext: cmds.HelpText{
+			Tagline: "Re-run a previous command.",
+		},
+		Arguments: []cmds.Argument{
+			cmds.StringArg("entry", true, false, "The number of the history entry."),
+		},
+		Run: func(req cmds.Request, res cmds.Response) {
+			n, err := strconv.Atoi(req.Arguments()[0])
+			if err != nil {
+				res.SetError(fmt.Errorf("Invalid history entry '%s'", req.Arguments()[0]), cmds.ErrClient)
+				return
+			}
+
+			r, err := h.Request(n, root)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+			if enc, found, _ := req.Option(cmds.EncShort).String(); found {
+				r.SetOption(cmds.EncShort, enc)
+			}
+			if ctx := req.Context(); ctx != nil {
+				if err := r.SetRootContext(ctx); err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+			}
+
+			out := root.Call(r)
+			if e := out.Error(); e != nil {
+				res.SetError(e, e.Code)
+				return
+			}
+
+			reader, err := out.Reader()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			res.SetOutput(reader)
+			res.SetCloser(out)
+		},
+	}
+
+	return &cmds.Command{
+		Helptext: cmds.HelpText{
+			Tagline: "List previous commands.",
+		},
+		Run: func(req cmds.Request, res cmds.Response) {
+			entries, err := h.Entries()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			res.SetOutput(&entries)
+		},
+		Marshalers: cmds.MarshalerMap{
+			cmds.Text: func(res cmds.Response) (io.Reader, error) {
+				entries := res.Output().(*[]HistoryEntry)
+
+				var buf bytes.Buffer
+				for i, e := range *entries {
+					fmt.Fprintf(&buf, "%4d  %s  %s", i+1, e.Time.Format(time.RFC3339), e.Line)
+					if e.Status != 0 {
+						fmt.Fprintf(&buf, "  (exit %d)", e.Status)
+					}
+					buf.WriteString("\n")
+				}
+				return &buf, nil
+			},
+		},
+		Type: []HistoryEntry{},
+		Subcommands: map[string]*cmds.Command{
+			"run": run,
+		},
+	}
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-commands"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := NewHistory(filepath.Join(dir, "history"))
+
+	echo := &commands.Command{
+		Options: []commands.Option{
+			commands.SecretOption("token", "an API token"),
+			commands.BoolOption("upper", "u", "use upper case"),
+		},
+		Arguments: []commands.Argument{
+			commands.StringArg("text", true, true, "the text"),
+		},
+		Run: func(req commands.Request, res commands.Response) {
+			text := strings.Join(req.Arguments(), " ")
+			if upper, _, _ := req.Option("upper").Bool(); upper {
+				text = strings.ToUpper(text)
+			}
+			res.SetOutput(strings.NewReader(text))
+		},
+	}
+	root := &commands.Command{
+		Subcommands: map[string]*commands.Command{
+			"echo": echo,
+		},
+	}
+	root.Subcommands["history"] = HistoryCommand(h, root)
+
+	entries, err := h.Entries()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Expected no entries, got %v (%v)", entries, err)
+	}
+
+	req, _, _, err := Parse([]string{"echo", "--upper", "--token=s3cret", "hello world"}, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Record(req, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = h.Entries()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected one entry, got %v (%v)", entries, err)
+	}
+	expected := `echo --token=<redacted> --upper "hello world"`
+	if entries[0].Line != expected {
+		t.Errorf("Expected line %q, got %q", expected, entries[0].Line)
+	}
+	if strings.Contains(string(entries[0].Request), "s3cret") {
+		t.Error("Expected the secret option to be redacted")
+	}
+
+	req, _, _, err = Parse([]string{"history", "run", "1"}, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetOption(commands.EncShort, commands.Text)
+	res := root.Call(req)
+	if res.Error() != nil {
+		t.Fatal(res.Error())
+	}
+	out, err := res.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(out)
+	if buf.String() != "HELLO WORLD" {
+		t.Errorf("Expected the entry to be re-run, got %q", buf.String())
+	}
+
+	r, err := h.Request(1, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID() == "" || r.ID() == req.ID() {
+		t.Error("Expected the re-run request to get a new ID")
+	}
+	if _, found, _ := r.Option("token").String(); found {
+		t.Error("Expected the secret option to be unset")
+	}
+	if _, err := h.Request(2, root); err == nil {
+		t.Error("Expected a missing entry to fail")
+	}
+}
+
+func TestHistoryLineUndefinedOption(t *testing.T) {
+	cmd := &commands.Command{}
+	req, err := commands.NewRequest(nil, commands.OptMap{"extra": "x"}, []string{"a b"}, nil, cmd, map[string]commands.Option{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := historyLine(req); line != `--extra=x "a b"` {
+		t.Errorf("Unexpected history line %q", line)
+	}
+}
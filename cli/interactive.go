@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// promptOutput is where interactive prompts are written to
+var promptOutput io.Writer = os.Stderr
+
+var errNoPromptInput = errors.New("Interactive mode needs input on stdin")
+
+// isInteractive returns true if the interactive option is set in opts, as
+// parsed by parseOpts, and it's the global one (see cmds.GlobalOption).
+func isInteractive(opts map[string]interface{}, optDefs map[string]cmds.Option) bool {
+	if optDefs[cmds.InteractiveOpt] != cmds.OptionInteractive {
+		return false
+	}
+	v, ok := opts[cmds.InteractiveOpt]
+	if !ok {
+		return false
+	}
+	s, _ := v.(string)
+	return s != "false"
+}
+
+// prompter asks the user for the values of missing arguments and options.
+// A nil prompter fails as soon as it has to ask for anything.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	raw io.Reader // the reader of in, for the echo of secrets
+
+	used bool // whether anything was read from in
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out, raw: in}
+}
+
+// ask prompts for a value until a non-empty one is entered. If there are
+// choices, they are shown as a menu, and can be picked by their number.
+func (p *prompter) ask(label, description string, choices []string) (string, error) {
+	if p == nil {
+		return "", errNoPromptInput
+	}
+	p.used = true
+
+	if len(choices) > 0 {
+		fmt.Fprintf(p.out, "%s - %s\n", label, description)
+		for i, c := range choices {
+			fmt.Fprintf(p.out, "  %d) %s\n", i+1, c)
+		}
+	}
+
+	for {
+		if len(choices) > 0 {
+			fmt.Fprintf(p.out, "%s: ", label)
+		} else {
+			fmt.Fprintf(p.out, "%s (%s): ", label, description)
+		}
+
+		line, err := p.in.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return "", errNoPromptInput
+			}
+			return "", err
+		}
+		if line == "" {
+			continue
+		}
+
+		if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= len(choices) {
+			return choices[n-1], nil
+		}
+		return line, nil
+	}
+}
+
+// promptMissing asks for the values of the required arguments that weren't
+// given in stringVals, and for the options that are required by the values of
+// other options (see Command.Requires). Options are set in opts, the
+// argument values are returned.
+func (p *prompter) promptMissing(cmd *cmds.Command, optDefs map[string]cmds.Option, opts map[string]interface{}, stringVals []string) ([]string, error) {
+	for i, argDef := range cmd.Arguments {
+		if i < len(stringVals) {
+			if argDef.Variadic {
+				break
+			}
+			continue
+		}
+		if !argDef.Required {
+			continue
+		}
+
+		v, err := p.ask(argDef.Name, argDef.Description, argDef.Candidates(""))
+		if err != nil {
+			return nil, err
+		}
+		stringVals = append(stringVals, v)
+	}
+
+	for _, r := range cmd.Requires {
+		val, found := lookupOption(optDefs, opts, r.Option)
+		if !found || (r.Value != nil && val != fmt.Sprint(r.Value)) {
+			continue
+		}
+
+		for _, name := range r.Requires {
+			if _, found := lookupOption(optDefs, opts, name); found {
+				continue
+			}
+
+			description := name
+			def, ok := optDefs[name]
+			if ok {
+				description = def.Description()
+			}
+			var v string
+			var err error
+			if ok && cmds.IsSecretOption(def) {
+				v, err = p.askSecret(fmt.Sprintf("--%s (%s)", name, description), false)
+			} else {
+				v, err = p.ask("--"+name, description, nil)
+			}
+			if err != nil {
+				return nil, err
+			}
+			opts[name] = v
+		}
+	}
+
+	return stringVals, nil
+}
+
+// lookupOption returns the value of an option in opts under any of its names,
+// as a string. Bool flags without a value are "true".
+func lookupOption(optDefs map[string]cmds.Option, opts map[string]interface{}, name string) (string, bool) {
+	def, ok := optDefs[name]
+	if !ok {
+		return "", false
+	}
+
+	for _, n := range def.Names() {
+		v, found := opts[n]
+		if !found {
+			continue
+		}
+
+		s := fmt.Sprint(v)
+		if def.Type() == cmds.Bool && s == "" {
+			s = "true"
+		}
+		return s, true
+	}
+	return "", false
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	context "golang.org/x/net/context"
+)
+
+// interruptExitCode is the exit status after a forced exit, the status shells
+// use for processes killed by SIGINT.
+const interruptExitCode = 130
+
+// interruptOutput is where the notice of the first interrupt is written
+var interruptOutput io.Writer = os.Stderr
+
+// exit is os.Exit, replaced in tests
+var exit = os.Exit
+
+// InterruptContext returns a context derived from parent that is canceled on
+// the first SIGINT (Ctrl-C) or SIGTERM, so the request stops and its PostRun
+// and cleanup can still finish. The second signal exits the process right
+// away. Front-ends set it as the root context of their requests:
+//
+//	ctx, stop := cli.InterruptContext(context.Background())
+//	defer stop()
+//	req.SetRootContext(ctx)
+//
+// stop restores the default handling of the signals and releases the
+// context.
+func InterruptContext(parent context.Context) (ctx context.Context, stop func()) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(parent)
+	done := make(chan struct{})
+	go handleInterrupts(sigs, cancel, done)
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel()
+	}
+}
+
+// handleInterrupts cancels the context on the first signal received on sigs,
+// and exits on the second, until done is closed.
+func handleInterrupts(sigs <-chan os.Signal, cancel context.CancelFunc, done <-chan struct{}) {
+	select {
+	case <-sigs:
+		fmt.Fprintln(interruptOutput, "Interrupted, press Ctrl-C again to force exit")
+		cancel()
+	case <-done:
+		return
+	}
+
+	select {
+	case <-sigs:
+		exit(interruptExitCode)
+	case <-done:
+	}
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	context "golang.org/x/net/context"
+)
+
+func TestHandleInterrupts(t *testing.T) {
+	var out bytes.Buffer
+	interruptOutput = &out
+	exited := make(chan int, 1)
+	exit = func(code int) { exited <- code }
+	defer func() {
+		interruptOutput = os.Stderr
+		exit = os.Exit
+	}()
+
+	sigs := make(chan os.Signal, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		handleInterrupts(sigs, cancel, done)
+		close(finished)
+	}()
+
+	sigs <- os.Interrupt
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected the first interrupt to cancel the context")
+	}
+	select {
+	case code := <-exited:
+		t.Fatalf("Didn't expect to exit (%d) on the first interrupt", code)
+	default:
+	}
+
+	sigs <- os.Interrupt
+	select {
+	case code := <-exited:
+		if code != interruptExitCode {
+			t.Errorf("expected exit code %d, got %d", interruptExitCode, code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the second interrupt to exit")
+	}
+	<-finished
+
+	if out.String() != "Interrupted, press Ctrl-C again to force exit\n" {
+		t.Errorf("unexpected notice %q", out.String())
+	}
+}
+
+func TestInterruptContextStop(t *testing.T) {
+	ctx, stop := InterruptContext(context.Background())
+	if ctx.Err() != nil {
+		t.Fatal("Expected a live context")
+	}
+	stop()
+	if ctx.Err() == nil {
+		t.Error("Expected stop to release the context")
+	}
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"os"
+	"strings"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// SetLocaleFromEnv declares the locale and timezone of the process, from the
+// LC_ALL, LANG and TZ environment variables, on req. Front-ends call it so
+// commands run on a server honor the user's settings.
+func SetLocaleFromEnv(req cmds.Request) {
+	if tag := envLocale(); tag != "" {
+		cmds.SetLocale(req, tag)
+	}
+	if tz := os.Getenv("TZ"); tz != "" {
+		// unknown timezones are left to the server's default
+		_ = cmds.SetTimezone(req, strings.TrimPrefix(tz, ":"))
+	}
+}
+
+// envLocale returns the locale of the environment as a language tag, e.g.
+// "en-US" for LANG=en_US.UTF-8, or "" for the C locale.
+func envLocale() string {
+	v := os.Getenv("LC_ALL")
+	if v == "" {
+		v = os.Getenv("LANG")
+	}
+	if i := strings.IndexAny(v, ".@"); i >= 0 {
+		v = v[:i]
+	}
+	if v == "C" || v == "POSIX" {
+		return ""
+	}
+	return strings.Replace(v, "_", "-", -1)
+}
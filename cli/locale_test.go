@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestEnvLocale(t *testing.T) {
+	for _, c := range []struct {
+		lcAll, lang, expected string
+	}{
+		{"", "en_US.UTF-8", "en-US"},
+		{"fr_CA@euro", "en_US.UTF-8", "fr-CA"},
+		{"", "C", ""},
+		{"POSIX", "", ""},
+		{"", "", ""},
+	} {
+		t.Setenv("LC_ALL", c.lcAll)
+		t.Setenv("LANG", c.lang)
+		if l := envLocale(); l != c.expected {
+			t.Errorf("LC_ALL=%q LANG=%q: expected %q, got %q", c.lcAll, c.lang, c.expected, l)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+type markdownFields struct {
+	Path        string
+	Usage       string
+	Tagline     string
+	Arguments   []string
+	Options     []string
+	Subcommands []string
+	Description string
+	Examples    string
+}
+
+const markdownFormat = "## {{.Path}}\n" +
+	"{{if .Tagline}}\n{{.Tagline}}\n{{end}}" +
+	"\n### Synopsis\n\n```\n{{.Usage}}\n```\n" +
+	"{{if .Arguments}}\n### Arguments\n\n{{range .Arguments}}- {{.}}\n{{end}}{{end}}" +
+	"{{if .Options}}\n### Options\n\n{{range .Options}}- {{.}}\n{{end}}{{end}}" +
+	"{{if .Subcommands}}\n### Subcommands\n\n{{range .Subcommands}}- {{.}}\n{{end}}{{end}}" +
+	"{{if .Description}}\n### Description\n\n{{.Description}}\n{{end}}" +
+	"{{if .Examples}}\n### Examples\n\n```\n{{.Examples}}\n```\n{{end}}"
+
+var markdownTemplate = template.Must(template.New("markdown").Parse(markdownFormat))
+
+var anchorChars = regexp.MustCompile(`[^a-z0-9_ -]`)
+
+// markdownAnchor returns the anchor of the heading of a command, as generated
+// by GitHub and most other renderers.
+func markdownAnchor(heading string) string {
+	s := anchorChars.ReplaceAllString(strings.ToLower(heading), "")
+	return "#" + strings.Replace(s, " ", "-", -1)
+}
+
+// MarkdownHelp writes the reference documentation of the command at path in
+// Markdown: its usage, arguments, options, subcommands, description and
+// examples (the synopsis of the help text). It is built from the same help
+// text as LongHelp, so both stay in sync.
+func MarkdownHelp(rootName string, root *cmds.Command, path []string, out io.Writer) error {
+	cmd, err := root.Get(path)
+	if err != nil {
+		return err
+	}
+
+	pathStr := strings.Join(append([]string{rootName}, path...), " ")
+	fields := markdownFields{
+		Path:        pathStr,
+		Usage:       pathStr,
+		Tagline:     tagline(rootName, cmd),
+		Description: cmd.Helptext.ShortDescription,
+		Examples:    strings.Trim(cmd.Helptext.Synopsis, "\n"),
+	}
+	if cmd.Helptext.Usage != "" {
+		fields.Usage = cmd.Helptext.Usage
+	} else if usage := usageText(cmd); usage != "" {
+		fields.Usage += " " + usage
+	}
+	if cmd.Helptext.LongDescription != "" {
+		fields.Description = cmd.Helptext.LongDescription
+	}
+	fields.Description = strings.Trim(fields.Description, "\n")
+
+	for _, arg := range cmd.Arguments {
+		line := fmt.Sprintf("`%s` - %s", argUsageText(arg), arg.Description)
+		if arg.Default != "" {
+			line += fmt.Sprintf(" (default: %q)", arg.Default)
+		}
+		if arg.SupportsStdin {
+			line += fmt.Sprintf(" (use `%s` to read from stdin)", stdinArg)
+		}
+		fields.Arguments = append(fields.Arguments, line)
+	}
+
+	for _, opt := range commandOptions(cmd) {
+		names := sortByLength(opt.Names())
+		flags := make([]string, len(names))
+		for i, name := range names {
+			flags[i] = "`" + optionFlag(name) + "`"
+		}
+		fields.Options = append(fields.Options, fmt.Sprintf("%s (%v) - %s", strings.Join(flags, ", "), opt.Type(), opt.Description()))
+	}
+
+	for _, name := range listedSubcommands(cmd) {
+		heading := pathStr + " " + name
+		line := fmt.Sprintf("[`%s`](%s)", heading, markdownAnchor(heading))
+		if t := tagline(rootName, cmd.Subcommands[name]); t != "" {
+			line += " - " + t
+		}
+		fields.Subcommands = append(fields.Subcommands, line)
+	}
+
+	return markdownTemplate.Execute(out, fields)
+}
+
+// GenerateMarkdown writes the Markdown reference documentation of every
+// listed (enabled and not hidden) command of the tree rooted at root (see
+// MarkdownHelp), in the order of a depth-first walk with the subcommands
+// sorted by name.
+func GenerateMarkdown(rootName string, root *cmds.Command, out io.Writer) error {
+	var walk func(cmd *cmds.Command, path []string) error
+	walk = func(cmd *cmds.Command, path []string) error {
+		if len(path) > 0 {
+			if _, err := io.WriteString(out, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := MarkdownHelp(rootName, root, path, out); err != nil {
+			return err
+		}
+		for _, name := range listedSubcommands(cmd) {
+			if err := walk(cmd.Subcommands[name], append(path[:len(path):len(path)], name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root, nil)
+}
+
+// listedSubcommands returns the sorted names of the subcommands of cmd that
+// are enabled and not hidden.
+func listedSubcommands(cmd *cmds.Command) []string {
+	names := make([]string, 0, len(cmd.Subcommands))
+	for name, sub := range cmd.Subcommands {
+		if sub.IsListed() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
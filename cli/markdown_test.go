@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+func TestGenerateMarkdown(t *testing.T) {
+	root := &cmds.Command{
+		Helptext: cmds.HelpText{Tagline: "A tool"},
+		Subcommands: map[string]*cmds.Command{
+			"cat": {
+				Helptext: cmds.HelpText{
+					Tagline:          "Show the contents of objects.",
+					ShortDescription: "\nWrites the data of the objects to stdout.\n",
+					Synopsis:         "\ntool cat <path>\n",
+				},
+				Options: []cmds.Option{
+					cmds.IntOption("length", "l", "The number of bytes to read"),
+				},
+				Arguments: []cmds.Argument{
+					cmds.StringArg("path", true, true, "The paths of the objects"),
+				},
+			},
+			"off": {
+				Enabled: func() bool { return false },
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := GenerateMarkdown("tool", root, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "## tool\n" +
+		"\nA tool\n" +
+		"\n### Synopsis\n\n```\ntool\n```\n" +
+		"\n### Subcommands\n\n- [`tool cat`](#tool-cat) - Show the contents of objects.\n" +
+		"\n## tool cat\n" +
+		"\nShow the contents of objects.\n" +
+		"\n### Synopsis\n\n```\ntool cat <path>...\n```\n" +
+		"\n### Arguments\n\n- `<path>...` - The paths of the objects\n" +
+		"\n### Options\n\n- `-l`, `--length` (int) - The number of bytes to read\n" +
+		"\n### Description\n\nWrites the data of the objects to stdout.\n" +
+		"\n### Examples\n\n```\ntool cat <path>\n```\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"compress/gzip"
+	"io"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// OutputWriter returns the writer front-ends write the output of req to when
+// it goes to a file. If the command has the compress option
+// (cmds.OptionCompress) and it is set, the output is gzipped as it is written. The returned writer has to be closed to write the end of
+// the compressed stream; closing it doesn't close w.
+func OutputWriter(req cmds.Request, w io.Writer) io.WriteCloser {
+	opt := req.Option(cmds.CompressOpt)
+	if opt == nil || opt.Definition() != cmds.OptionCompress {
+		return nopWriteCloser{w}
+	}
+	if compress, _, _ := opt.Bool(); compress {
+		return gzip.NewWriter(w)
+	}
+	return nopWriteCloser{w}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
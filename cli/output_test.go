@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+func TestOutputWriter(t *testing.T) {
+	cmd := &cmds.Command{Options: []cmds.Option{cmds.OptionCompress}}
+	optDefs, err := cmd.GetOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compress := range []bool{false, true} {
+		req, err := cmds.NewRequest(nil, cmds.OptMap{cmds.CompressOpt: compress}, nil, nil, cmd, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		w := OutputWriter(req, &buf)
+		w.Write([]byte("output"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		out := buf.Bytes()
+		if compress {
+			gz, err := gzip.NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out, err = ioutil.ReadAll(gz); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if string(out) != "output" {
+			t.Errorf("compress=%v: unexpected output %q", compress, out)
+		}
+	}
+}
+
+func TestOutputWriterOwnCompressOption(t *testing.T) {
+	// a command's own compress option isn't for the output file
+	cmd := &cmds.Command{Options: []cmds.Option{cmds.BoolOption(cmds.CompressOpt, "C", "Compress the archive")}}
+	optDefs, err := cmd.GetOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := cmds.NewRequest(nil, cmds.OptMap{"C": true}, nil, nil, cmd, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := OutputWriter(req, &buf)
+	w.Write([]byte("output"))
+	w.Close()
+	if buf.String() != "output" {
+		t.Errorf("Expected the output as it is, got %q", buf.String())
+	}
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// DefaultPager is the pager used when $PAGER isn't set.
+var DefaultPager = "less"
+
+// pagerEnv are the environment variables set for the pager, unless they are
+// already set: less quits if the output fits on a screen (F), passes colors
+// through (R) and doesn't clear the screen when it exits (X), like with git.
+var pagerEnv = map[string]string{
+	"LESS": "FRX",
+	"LV":   "-c",
+}
+
+// PagerWriter returns the writer front-ends write the text output of req to
+// when it goes to stdout (out). If out is a terminal and the output is longer
+// than a screen, it is piped through $PAGER (DefaultPager if it isn't set).
+// Shorter output, output that isn't text encoded, and the output of requests
+// with the --no-pager option, is written to out as it is. Setting $PAGER to
+// "" or "cat" disables the pager. The returned writer has to be closed to
+// flush the output and wait for the pager to exit; closing it doesn't close
+// out.
+func PagerWriter(req cmds.Request, out *os.File) io.WriteCloser {
+	if noPager, _, _ := cmds.GlobalOption(req, cmds.OptionNoPager).Bool(); noPager {
+		return nopWriteCloser{out}
+	}
+	if enc, _, _ := req.Option(cmds.EncShort).String(); cmds.EncodingType(strings.ToLower(enc)) != cmds.Text {
+		return nopWriteCloser{out}
+	}
+	if !writesToTerminal(out) {
+		return nopWriteCloser{out}
+	}
+
+	pager, ok := os.LookupEnv("PAGER")
+	if !ok {
+		pager = DefaultPager
+	}
+	args := strings.Fields(pager)
+	rows := cmds.TerminalHeight(out)
+	if len(args) == 0 || args[0] == "cat" || rows == 0 {
+		return nopWriteCloser{out}
+	}
+	return newPagerWriter(out, args, rows)
+}
+
+// pagerWriter buffers the output until it has more lines than fit on the
+// screen (leaving a line for the prompt), then starts the pager and pipes
+// everything through it.
+type pagerWriter struct {
+	out  io.Writer
+	args []string
+	rows int
+
+	buf   bytes.Buffer
+	lines int
+
+	cmd  *exec.Cmd
+	pipe io.WriteCloser
+}
+
+func newPagerWriter(out io.Writer, args []string, rows int) *pagerWriter {
+	return &pagerWriter{out: out, args: args, rows: rows}
+}
+
+func (w *pagerWriter) Write(p []byte) (int, error) {
+	if w.pipe != nil {
+		return w.pipe.Write(p)
+	}
+	if w.args == nil {
+		// the pager couldn't be started
+		return w.out.Write(p)
+	}
+
+	w.buf.Write(p)
+	w.lines += bytes.Count(p, []byte("\n"))
+	if w.lines < w.rows {
+		return len(p), nil
+	}
+
+	if err := w.startPager(); err != nil {
+		w.args = nil
+	}
+	if err := w.flush(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *pagerWriter) startPager() error {
+	cmd := exec.Command(w.args[0], w.args[1:]...)
+	cmd.Stdout = w.out
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for k, v := range pagerEnv {
+		if _, ok := os.LookupEnv(k); !ok {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+
+	pipe, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	w.cmd, w.pipe = cmd, pipe
+	return nil
+}
+
+// flush writes the buffered output to the pager, or to out if there is none.
+func (w *pagerWriter) flush() error {
+	var dst io.Writer = w.out
+	if w.pipe != nil {
+		dst = w.pipe
+	}
+	_, err := w.buf.WriteTo(dst)
+	return err
+}
+
+// Close writes the buffered output, if it fit on a screen, or waits for the
+// pager to exit.
+func (w *pagerWriter) Close() error {
+	if w.pipe == nil {
+		return w.flush()
+	}
+	w.pipe.Close()
+	return w.cmd.Wait()
+}
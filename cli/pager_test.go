@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+func TestPagerWriter(t *testing.T) {
+	if _, err := exec.LookPath("tr"); err != nil {
+		t.Skip("tr is needed as a pager")
+	}
+	pager := []string{"tr", "a-z", "A-Z"}
+
+	var buf bytes.Buffer
+	w := newPagerWriter(&buf, pager, 3)
+	io.WriteString(w, "one\ntwo\n")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != "one\ntwo\n" {
+		t.Errorf("Expected output that fits on the screen not to be paged, got %q", s)
+	}
+
+	buf.Reset()
+	w = newPagerWriter(&buf, pager, 3)
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		io.WriteString(w, line)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != "ONE\nTWO\nTHREE\nFOUR\n" {
+		t.Errorf("Expected long output to be paged, got %q", s)
+	}
+
+	buf.Reset()
+	w = newPagerWriter(&buf, []string{"does-not-exist-pager"}, 1)
+	io.WriteString(w, "one\ntwo\n")
+	io.WriteString(w, "three\n")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != "one\ntwo\nthree\n" {
+		t.Errorf("Expected the output without a pager, got %q", s)
+	}
+}
+
+func TestPagerWriterDisabled(t *testing.T) {
+	f, err := ioutil.TempFile("", "pager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	optDefs := map[string]cmds.Option{cmds.EncShort: cmds.OptionEncodingType, cmds.NoPagerOpt: cmds.OptionNoPager}
+	for _, opts := range []cmds.OptMap{
+		{cmds.EncShort: cmds.Text},
+		{cmds.EncShort: cmds.JSON},
+		{cmds.EncShort: cmds.Text, cmds.NoPagerOpt: true},
+	} {
+		req, err := cmds.NewRequest(nil, opts, nil, nil, &cmds.Command{}, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := PagerWriter(req, f).(nopWriteCloser); !ok {
+			t.Errorf("Expected no pager for %v on a file", opts)
+		}
+	}
+}
@@ -3,9 +3,12 @@ package cli
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 
 	cmds "github.com/ipfs/go-commands"
@@ -13,6 +16,9 @@ import (
 	util "github.com/ipfs/go-commands/util"
 )
 
+// stdinArg is the argument value that means "read this value from stdin"
+const stdinArg = "-"
+
 // Parse parses the input commandline string (cmd, flags, and args).
 // returns the corresponding command Request object.
 func Parse(input []string, stdin *os.File, root *cmds.Command) (cmds.Request, *cmds.Command, []string, error) {
@@ -21,15 +27,67 @@ func Parse(input []string, stdin *os.File, root *cmds.Command) (cmds.Request, *c
 		return nil, nil, path, err
 	}
 
+	// `--version` runs the version subcommand of RegisterVersion
+	if _, ok := opts[cmds.VersionOpt]; ok && len(path) == 0 {
+		if optDefs, err := root.GetOptions(nil); err == nil && optDefs[cmds.VersionOpt] == cmds.OptionVersion {
+			if sub := root.Subcommand(cmds.VersionOpt); sub != nil {
+				delete(opts, cmds.VersionOpt)
+				cmd, path = sub, []string{cmds.VersionOpt}
+			}
+		}
+	}
+
+	// deprecated commands may be run by their replacement
+	var deprecation string
+	if cmd.ForwardToReplacement {
+		if replacement, replacementPath := cmds.Replacement(root, cmd); replacement != nil {
+			deprecation = cmds.DeprecationWarning(path, cmd)
+			cmd, path = replacement, replacementPath
+		}
+	}
+
+	stringVals, err = expandArgFiles(stringVals, cmd.Arguments)
+	if err != nil {
+		return nil, cmd, path, err
+	}
+
 	optDefs, err := root.GetOptions(path)
 	if err != nil {
 		return nil, cmd, path, err
 	}
 
+	if isInteractive(opts, optDefs) {
+		var p *prompter
+		if stdin != nil {
+			p = newPrompter(stdin, promptOutput)
+		}
+		stringVals, err = p.promptMissing(cmd, optDefs, opts, stringVals)
+		if err != nil {
+			return nil, cmd, path, err
+		}
+
+		// stdin that was read for the prompts doesn't provide argument values
+		if p != nil && p.used {
+			stdin = nil
+		}
+	}
+
+	for k, v := range opts {
+		if def, ok := optDefs[k]; ok && cmds.IsPathOption(def) {
+			opts[k], err = expandPath(v.(string))
+			if err != nil {
+				return nil, cmd, path, err
+			}
+		}
+	}
+
 	req, err := cmds.NewRequest(path, opts, nil, nil, cmd, optDefs)
 	if err != nil {
 		return nil, cmd, path, err
 	}
+	if deprecation != "" {
+		forwardedKey.Set(req, deprecation)
+	}
 
 	// if -r is provided, and it is associated with the package builtin
 	// recursive path option, allow recursive file paths
@@ -42,7 +100,7 @@ func Parse(input []string, stdin *os.File, root *cmds.Command) (cmds.Request, *c
 		}
 	}
 
-	stringArgs, fileArgs, err := parseArgs(stringVals, stdin, cmd.Arguments, recursive, root)
+	stringArgs, fileArgs, err := parseArgs(stringVals, stdin, cmd.Arguments, recursive, cmd)
 	if err != nil {
 		return req, cmd, path, err
 	}
@@ -56,10 +114,28 @@ func Parse(input []string, stdin *os.File, root *cmds.Command) (cmds.Request, *c
 		return req, cmd, path, err
 	}
 
+	if cmd.Validate != nil {
+		err = cmd.Validate(req)
+		if err != nil {
+			return req, cmd, path, err
+		}
+	}
+
 	return req, cmd, path, nil
 }
 
-// Parse a command line made up of sub-commands, short arguments, long arguments and positional arguments
+// Parse a command line made up of sub-commands, short arguments, long arguments and positional arguments.
+//
+// Parsing follows GNU getopt conventions: options may be interleaved with
+// positional arguments (e.g. `cmd foo -r bar`), and `--` terminates option
+// parsing, so every argument after it is positional. Sub-commands are only
+// resolved until the first positional argument is found. If the
+// POSIXLY_CORRECT environment variable is set, option parsing also stops at
+// the first positional argument.
+//
+// Single-letter flags can be bundled, POSIX style: `-rvq` is `-r -v -q`. The
+// last flag of a bundle may take a value, from the rest of the bundle or the
+// next argument (`-rs foo`, `-rsfoo` and `-rs=foo` set -s to foo).
 func parseOpts(args []string, root *cmds.Command) (
 	path []string,
 	opts map[string]interface{},
@@ -75,37 +151,84 @@ func parseOpts(args []string, root *cmds.Command) (
 
 	// parseFlag checks that a flag is valid and saves it into opts
 	// Returns true if the optional second argument is used
-	parseFlag := func(name string, arg *string, mustUse bool) (bool, error) {
+	parseFlag := func(name string, arg *string, mustUse bool) (bool, *cmds.Error) {
 		if _, ok := opts[name]; ok {
-			return false, fmt.Errorf("Duplicate values for option '%s'", name)
+			return false, optionError(ErrKindInvalidOption, name, "Duplicate values for option '%s'", name)
 		}
 
 		optDef, found := optDefs[name]
 		if !found {
-			err = fmt.Errorf("Unrecognized option '%s'", name)
-			return false, err
+			e := optionError(ErrKindUnknownOption, name, "Unrecognized option '%s'", name)
+			suggestions := suggestOption(name, optDefs)
+			e.Details["suggestions"] = suggestions
+			if len(suggestions) > 0 {
+				e.Hints = append(e.Hints, "did you mean "+strings.Join(suggestions, " or ")+"?")
+			}
+			return false, e
 		}
 
 		if optDef.Type() == cmds.Bool {
 			if mustUse {
-				return false, fmt.Errorf("Option '%s' takes no arguments, but was passed '%s'", name, *arg)
+				return false, optionError(ErrKindInvalidOption, name, "Option '%s' takes no arguments, but was passed '%s'", name, *arg)
 			}
 			opts[name] = ""
 			return false, nil
 		} else {
 			if arg == nil {
-				return true, fmt.Errorf("Missing argument for option '%s'", name)
+				return true, optionError(ErrKindInvalidOption, name, "Missing argument for option '%s'", name)
 			}
 			opts[name] = *arg
 			return true, nil
 		}
 	}
 
+	// flagError adds the failed token of the command line to e, with the
+	// usage of the command
+	flagError := func(e *cmds.Error, i int) error {
+		e.Details["token"] = args[i]
+		e.Details["position"] = i
+		if name := e.Details["option"].(string); args[i] != optionFlag(name) && !strings.HasPrefix(args[i], optionFlag(name)+"=") {
+			e.Message += fmt.Sprintf(" in '%s'", args[i])
+		}
+		if usage := strings.TrimSpace(strings.Join(path, " ") + " " + usageText(cmd)); usage != "" {
+			e.Hints = append(e.Hints, "usage: "+usage)
+		}
+		return e
+	}
+
+	// useDefault resolves the default subcommand of cmd, and theirs in turn
+	// (see Command.DefaultSubcommand). It returns true if cmd changed.
+	useDefault := func() (bool, error) {
+		changed := false
+		for sub := defaultSubcommand(cmd); sub != nil; sub = defaultSubcommand(cmd) {
+			path = append(path, cmd.DefaultSubcommand)
+			cmd = sub
+			changed = true
+		}
+		if changed {
+			optDefs, err = root.GetOptions(path)
+		}
+		return changed, err
+	}
+
+	// useDefaultFor resolves the default subcommands if the flag name isn't
+	// an option of cmd
+	useDefaultFor := func(name string) error {
+		if _, found := optDefs[name]; found {
+			return nil
+		}
+		_, err := useDefault()
+		return err
+	}
+
 	optDefs, err = root.GetOptions(path)
 	if err != nil {
 		return
 	}
 
+	posixlyCorrect := os.Getenv("POSIXLY_CORRECT") != ""
+	positional := false // true once the first positional argument was found
+
 	consumed := false
 	for i, arg := range args {
 		switch {
@@ -114,9 +237,17 @@ func parseOpts(args []string, root *cmds.Command) (
 			consumed = false
 			continue
 
+		case positional && posixlyCorrect:
+			// options end at the first positional argument
+			stringVals = append(stringVals, args[i:]...)
+			return
+
 		case arg == "--":
 			// treat all remaining arguments as positional arguments
 			stringVals = append(stringVals, args[i+1:]...)
+			if len(stringVals) > 0 {
+				_, err = useDefault()
+			}
 			return
 
 		case strings.HasPrefix(arg, "--"):
@@ -137,15 +268,20 @@ func parseOpts(args []string, root *cmds.Command) (
 					next = nil
 				}
 			}
-			consumed, err = parseFlag(arg[2:], next, len(split) == 2)
-			if err != nil {
+			if err = useDefaultFor(arg[2:]); err != nil {
+				return
+			}
+			var ferr *cmds.Error
+			consumed, ferr = parseFlag(arg[2:], next, len(split) == 2)
+			if ferr != nil {
+				err = flagError(ferr, i)
 				return
 			}
 			if !slurped {
 				consumed = false
 			}
 
-		case strings.HasPrefix(arg, "-") && arg != "-":
+		case strings.HasPrefix(arg, "-") && arg != "-" && !negativeNumber(arg, optDefs):
 			// args is one or more flags in short form, followed by an optional argument
 			// all flags except the last one have type bool
 			for arg = arg[1:]; len(arg) != 0; arg = arg[1:] {
@@ -168,9 +304,12 @@ func parseOpts(args []string, root *cmds.Command) (
 						rest = nil
 					}
 				}
-				var end bool
-				end, err = parseFlag(arg[0:1], rest, mustUse)
-				if err != nil {
+				if err = useDefaultFor(arg[0:1]); err != nil {
+					return
+				}
+				end, ferr := parseFlag(arg[0:1], rest, mustUse)
+				if ferr != nil {
+					err = flagError(ferr, i)
 					return
 				}
 				if end {
@@ -180,8 +319,20 @@ func parseOpts(args []string, root *cmds.Command) (
 			}
 
 		default:
-			// arg is a sub-command or a positional argument
-			sub := cmd.Subcommand(arg)
+			// arg is a sub-command or a positional argument. once we have seen a
+			// positional argument, everything else is positional as well (so
+			// argument values that happen to be sub-command names work)
+			var sub *cmds.Command
+			if !positional {
+				sub = cmd.Subcommand(arg)
+			}
+			if sub == nil && !positional && takesArguments(defaultSubcommand(cmd)) {
+				// the value is for the default subcommand, or one of its subcommands
+				if _, err = useDefault(); err != nil {
+					return
+				}
+				sub = cmd.Subcommand(arg)
+			}
 			if sub != nil {
 				cmd = sub
 				path = append(path, arg)
@@ -190,14 +341,104 @@ func parseOpts(args []string, root *cmds.Command) (
 					return
 				}
 			} else {
+				positional = true
 				stringVals = append(stringVals, arg)
 			}
 		}
 	}
+	_, err = useDefault()
 	return
 }
 
-func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursive bool, root *cmds.Command) ([]string, []files.File, error) {
+// defaultSubcommand returns the default subcommand of cmd, or nil if it has
+// none or can be called itself.
+func defaultSubcommand(cmd *cmds.Command) *cmds.Command {
+	if cmd.DefaultSubcommand == "" || cmd.Run != nil || cmd.Subscribe != nil {
+		return nil
+	}
+	return cmd.Subcommand(cmd.DefaultSubcommand)
+}
+
+// takesArguments returns true if positional arguments can follow cmd on the
+// command line, as its arguments or subcommands.
+func takesArguments(cmd *cmds.Command) bool {
+	return cmd != nil && (len(cmd.Arguments) > 0 || len(cmd.Subcommands) > 0)
+}
+
+// negativeNumber returns true if arg is a negative number (e.g. -5 or -0.5)
+// rather than short flags, i.e. if no single-letter option is named after its
+// first digit.
+func negativeNumber(arg string, optDefs map[string]cmds.Option) bool {
+	if len(arg) < 2 || !strings.ContainsRune("0123456789.", rune(arg[1])) {
+		return false
+	}
+	if _, err := strconv.ParseFloat(arg, 64); err != nil {
+		return false
+	}
+	_, isOpt := optDefs[arg[1:2]]
+	return !isOpt
+}
+
+// expandArgFiles replaces the `@file` positional arguments of the arguments
+// that enable it (see Argument.EnableAtFile) with the lines of that file. The
+// inputs are matched to argDefs by position, the last (variadic) one taking
+// the rest.
+func expandArgFiles(inputs []string, argDefs []cmds.Argument) ([]string, error) {
+	expanded := make([]string, 0, len(inputs))
+	for i, input := range inputs {
+		if !atFileArg(i, argDefs) {
+			expanded = append(expanded, input)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(input, "@@"):
+			expanded = append(expanded, input[1:])
+
+		case strings.HasPrefix(input, "@") && len(input) > 1:
+			data, err := ioutil.ReadFile(input[1:])
+			if err != nil {
+				return nil, fmt.Errorf("Could not read arguments from '%s': %s", input[1:], err)
+			}
+
+			for _, line := range strings.Split(string(data), "\n") {
+				line = strings.TrimSuffix(line, "\r")
+				if line != "" {
+					expanded = append(expanded, line)
+				}
+			}
+
+		default:
+			expanded = append(expanded, input)
+		}
+	}
+	return expanded, nil
+}
+
+// atFileArg returns true if the input at position i is a value of an
+// argument with AtFile.
+func atFileArg(i int, argDefs []cmds.Argument) bool {
+	if len(argDefs) == 0 {
+		return false
+	}
+	if i >= len(argDefs) {
+		last := argDefs[len(argDefs)-1]
+		return last.Variadic && last.AtFile
+	}
+	return argDefs[i].AtFile
+}
+
+func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursive bool, cmd *cmds.Command) ([]string, []files.File, error) {
+	// an explicit '-' argument reads from stdin even if it is a terminal
+	// (or on Windows), so keep a reference to it around
+	dashStdin := stdin
+
+	// arguments that enable the editor are written in it on terminals
+	editable := false
+	if stdin != nil {
+		editable, _ = isTerminal(stdin)
+	}
+
 	// ignore stdin on Windows
 	if runtime.GOOS == "windows" {
 		stdin = nil
@@ -224,23 +465,22 @@ func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursi
 	// if there is at least one ArgDef, we can safely trigger the inputs loop
 	// below to parse stdin.
 	numInputs := len(inputs)
+	stdinCounted := false
 	if len(argDefs) > 0 && argDefs[len(argDefs)-1].SupportsStdin && stdin != nil {
 		numInputs += 1
+		stdinCounted = true
 	}
 
 	// if we have more arg values provided than argument definitions,
 	// and the last arg definition is not variadic (or there are no definitions), return an error
 	notVariadic := len(argDefs) == 0 || !argDefs[len(argDefs)-1].Variadic
+	if notVariadic && len(inputs) > len(argDefs) && len(argDefs) > 0 {
+		// name the values, rather than guessing at a mistyped subcommand
+		return nil, nil, cmds.ExtraArgsError(inputs[len(argDefs):], len(argDefs))
+	}
 	if notVariadic && len(inputs) > len(argDefs) {
-		suggestions := suggestUnknownCmd(inputs, root)
-
-		if len(suggestions) > 1 {
-			return nil, nil, fmt.Errorf("Unknown Command \"%s\"\n\nDid you mean any of these?\n\n\t%s", inputs[0], strings.Join(suggestions, "\n\t"))
-		} else if len(suggestions) > 0 {
-			return nil, nil, fmt.Errorf("Unknown Command \"%s\"\n\nDid you mean this?\n\n\t%s", inputs[0], suggestions[0])
-		} else {
-			return nil, nil, fmt.Errorf("Unknown Command \"%s\"\n", inputs[0])
-		}
+		// the first value couldn't be resolved as a subcommand of cmd
+		return nil, nil, unknownCmdError(inputs[0], cmd)
 	}
 
 	stringArgs := make([]string, 0, numInputs)
@@ -260,10 +500,44 @@ func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursi
 		}
 
 		var err error
+		if argDef.SupportsStdin && len(inputs) > 0 && inputs[0] == stdinArg {
+			// '-' means "read this value from stdin"
+			if dashStdin == nil {
+				return nil, nil, fmt.Errorf("Argument '%s' can't be read from stdin, stdin was already used", argDef.Name)
+			}
+
+			if argDef.Type == cmds.ArgString {
+				stringArgs, err = appendDashStdinAsString(stringArgs, dashStdin, argDef.Variadic)
+				if err != nil {
+					return nil, nil, err
+				}
+			} else {
+				fileArgs, _ = appendStdinAsFile(fileArgs, dashStdin)
+			}
+			inputs = inputs[1:]
+
+			// stdin can only be read once, and it no longer provides an extra value
+			dashStdin, stdin = nil, nil
+			if stdinCounted {
+				numInputs--
+				stdinCounted = false
+			}
+
+			argDefIndex++
+			continue
+		}
+
 		if argDef.Type == cmds.ArgString {
 			if stdin == nil || !argDef.SupportsStdin {
 				// add string values
-				stringArgs, inputs = appendString(stringArgs, inputs)
+				if argDef.ResolvePath {
+					stringArgs, inputs, err = appendPath(stringArgs, inputs)
+					if err != nil {
+						return nil, nil, err
+					}
+				} else {
+					stringArgs, inputs = appendString(stringArgs, inputs)
+				}
 
 			} else {
 				if len(inputs) > 0 {
@@ -302,6 +576,22 @@ func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursi
 	// check to make sure we didn't miss any required arguments
 	if len(argDefs) > argDefIndex {
 		for _, argDef := range argDefs[argDefIndex:] {
+			if editable && argDef.Editor {
+				value, err := Edit(argDef.EditorTemplate)
+				if err != nil {
+					return nil, nil, err
+				}
+				if value != "" {
+					stringArgs = append(stringArgs, value)
+					continue
+				}
+				if argDef.Required {
+					return nil, nil, fmt.Errorf("Argument '%s' is required, aborting on an empty text", argDef.Name)
+				}
+			}
+			// values of later arguments can't follow the missing one
+			editable = false
+
 			if argDef.Required {
 				return nil, nil, fmt.Errorf("Argument '%s' is required", argDef.Name)
 			}
@@ -329,6 +619,20 @@ func appendString(args, inputs []string) ([]string, []string) {
 	return append(args, inputs[0]), inputs[1:]
 }
 
+// appendPath appends a client path value, made absolute relative to the
+// current working directory
+func appendPath(args, inputs []string) ([]string, []string, error) {
+	p, err := expandPath(inputs[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err = filepath.Abs(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(args, p), inputs[1:], nil
+}
+
 func appendStdinAsString(args []string, stdin *os.File) ([]string, *os.File, error) {
 	buf := new(bytes.Buffer)
 
@@ -341,39 +645,107 @@ func appendStdinAsString(args []string, stdin *os.File) ([]string, *os.File, err
 	return append(args, strings.Split(input, "\n")...), nil, nil
 }
 
+// appendDashStdinAsString reads the value of a '-' argument from stdin. The
+// whole input (without the trailing newline) is used as a single value, unless
+// the argument is variadic, in which case every line is a value.
+func appendDashStdinAsString(args []string, stdin *os.File, variadic bool) ([]string, error) {
+	if variadic {
+		args, _, err := appendStdinAsString(args, stdin)
+		return args, err
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(stdin); err != nil {
+		return nil, err
+	}
+
+	input := strings.TrimSuffix(buf.String(), "\n")
+	input = strings.TrimSuffix(input, "\r")
+	return append(args, input), nil
+}
+
 func appendFile(args []files.File, inputs []string, argDef *cmds.Argument, recursive bool) ([]files.File, []string, error) {
-	fpath := inputs[0]
+	fpath, err := expandPath(inputs[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if argDef.Glob && hasGlobMeta(fpath) {
+		if _, err := os.Lstat(fpath); os.IsNotExist(err) {
+			matches, err := filepath.Glob(fpath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Invalid pattern '%s': %s", fpath, err)
+			}
+			if len(matches) == 0 {
+				return nil, nil, fmt.Errorf("No files match the pattern '%s'", fpath)
+			}
 
+			for _, match := range matches {
+				var err error
+				args, err = appendFilePath(args, match, argDef, recursive)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			return args, inputs[1:], nil
+		}
+	}
+
+	args, err = appendFilePath(args, fpath, argDef, recursive)
+	if err != nil {
+		return nil, nil, err
+	}
+	return args, inputs[1:], nil
+}
+
+// hasGlobMeta returns true if the path contains any of the special characters
+// recognized by filepath.Match
+func hasGlobMeta(path string) bool {
+	magicChars := `*?[`
+	if runtime.GOOS != "windows" {
+		magicChars = `*?[\`
+	}
+	return strings.ContainsAny(path, magicChars)
+}
+
+func appendFilePath(args []files.File, fpath string, argDef *cmds.Argument, recursive bool) ([]files.File, error) {
 	if fpath == "." {
 		cwd, err := os.Getwd()
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		fpath = cwd
 	}
 	stat, err := os.Lstat(fpath)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	// the full path is relative to the client's working directory, even if the
+	// file is read by someone else (e.g. while uploading it to a daemon)
+	fullpath, err := filepath.Abs(fpath)
+	if err != nil {
+		return nil, err
 	}
 
 	if stat.IsDir() {
 		if !argDef.Recursive {
 			err = fmt.Errorf("Invalid path '%s', argument '%s' does not support directories",
 				fpath, argDef.Name)
-			return nil, nil, err
+			return nil, err
 		}
 		if !recursive {
 			err = fmt.Errorf("'%s' is a directory, use the '-%s' flag to specify directories",
 				fpath, cmds.RecShort)
-			return nil, nil, err
+			return nil, err
 		}
 	}
 
-	arg, err := files.NewSerialFile(path.Base(fpath), fpath, stat)
+	arg, err := files.NewSerialFile(path.Base(fpath), fullpath, stat)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	return append(args, arg), inputs[1:], nil
+	return append(args, arg), nil
 }
 
 func appendStdinAsFile(args []files.File, stdin *os.File) ([]files.File, *os.File) {
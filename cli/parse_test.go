@@ -1,9 +1,12 @@
 package cli
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -64,6 +67,78 @@ func TestSameWords(t *testing.T) {
 	test(f, f, true)
 }
 
+func TestShortFlagBundling(t *testing.T) {
+	cmd := &commands.Command{
+		Options: []commands.Option{
+			commands.OptionRecursivePath,
+			commands.StringOption("string", "s", "a string"),
+		},
+	}
+
+	for _, c := range []struct {
+		args  string
+		opts  kvs
+		words words
+	}{
+		{"-rvq", kvs{"r": "", "v": "", "q": ""}, words{}},
+		{"-rvs foo bar", kvs{"r": "", "v": "", "s": "foo"}, words{"bar"}},
+		{"-rvsfoo bar", kvs{"r": "", "v": "", "s": "foo"}, words{"bar"}},
+		{"-rvs=foo", kvs{"r": "", "v": "", "s": "foo"}, words{}},
+		{"-qsr", kvs{"q": "", "s": "r"}, words{}},
+	} {
+		_, opts, input, _, err := parseOpts(strings.Split(c.args, " "), cmd)
+		if err != nil {
+			t.Errorf("Command line '%v' failed to parse: %v", c.args, err)
+		} else if !sameWords(input, c.words) || !sameKVs(opts, c.opts) {
+			t.Errorf("Command line '%v':\n  parsed as  %v %v\n  instead of %v %v",
+				c.args, opts, input, c.opts, c.words)
+		}
+	}
+
+	for _, args := range []string{"-rxq", "-rvr", "-rs", "-rq=x"} {
+		if _, _, _, _, err := parseOpts(strings.Split(args, " "), cmd); err == nil {
+			t.Errorf("Command line '%v' parsing should have failed", args)
+		}
+	}
+}
+
+func TestNegativeNumbers(t *testing.T) {
+	cmd := &commands.Command{
+		Options: []commands.Option{
+			commands.BoolOption("bool", "b", "a bool"),
+			commands.IntOption("count", "n", "a number"),
+			commands.BoolOption("one", "1", "a digit flag"),
+		},
+	}
+
+	for _, c := range []struct {
+		args  string
+		opts  kvs
+		words words
+	}{
+		{"-5", kvs{}, words{"-5"}},
+		{"-0.5 -b", kvs{"b": ""}, words{"-0.5"}},
+		{"-.5", kvs{}, words{"-.5"}},
+		{"-2e3 --count -3", kvs{"count": "-3"}, words{"-2e3"}},
+		{"-n -7 -3", kvs{"n": "-7"}, words{"-3"}},
+		{"-1", kvs{"1": ""}, words{}},
+	} {
+		_, opts, input, _, err := parseOpts(strings.Split(c.args, " "), cmd)
+		if err != nil {
+			t.Errorf("Command line '%v' failed to parse: %v", c.args, err)
+		} else if !sameWords(input, c.words) || !sameKVs(opts, c.opts) {
+			t.Errorf("Command line '%v':\n  parsed as  %v %v\n  instead of %v %v",
+				c.args, opts, input, c.opts, c.words)
+		}
+	}
+
+	for _, args := range []string{"-5x", "-12"} {
+		if _, _, _, _, err := parseOpts(strings.Split(args, " "), cmd); err == nil {
+			t.Errorf("Command line '%v' parsing should have failed", args)
+		}
+	}
+}
+
 func TestOptionParsing(t *testing.T) {
 	subCmd := &commands.Command{}
 	cmd := &commands.Command{
@@ -117,6 +192,16 @@ func TestOptionParsing(t *testing.T) {
 	test("--string=foo", kvs{"string": "foo"}, words{})
 	test("-- -b", kvs{}, words{"-b"})
 	test("foo -b", kvs{"b": ""}, words{"foo"})
+	test("test beep -b boop", kvs{"b": ""}, words{"beep", "boop"})
+	test("beep test", kvs{}, words{"beep", "test"})
+	test("test -- -b test", kvs{}, words{"-b", "test"})
+	test("foo -- -s bar", kvs{}, words{"foo", "-s", "bar"})
+	test("-s -- foo", kvs{"s": "--"}, words{"foo"})
+
+	os.Setenv("POSIXLY_CORRECT", "1")
+	test("test beep -b boop", kvs{}, words{"beep", "-b", "boop"})
+	test("-b test beep", kvs{"b": ""}, words{"beep"})
+	os.Unsetenv("POSIXLY_CORRECT")
 }
 
 func TestArgumentParsing(t *testing.T) {
@@ -232,6 +317,11 @@ func TestArgumentParsing(t *testing.T) {
 	testFail([]string{"reversedoptional"}, "didn't provide any args, 1 required")
 	testFail([]string{"reversedoptional", "value1", "value2", "value3"}, "provided too many args, only takes 1")
 
+	_, _, _, err := Parse([]string{"optionalsecond", "value1", "value2", "bad", "value3"}, nil, rootCmd)
+	if err == nil || err.Error() != `Unexpected arguments "bad", "value3", the command takes 2 arguments at most` {
+		t.Errorf("Expected the surplus values to be named, got %v", err)
+	}
+
 	// Use a temp file to simulate stdin
 	fileToSimulateStdin := func(t *testing.T, content string) *os.File {
 		fstdin, err := ioutil.TempFile("", "")
@@ -286,4 +376,510 @@ func TestArgumentParsing(t *testing.T) {
 
 	fstdin = fileToSimulateStdin(t, "stdin1")
 	test([]string{"optionalsecond", "value1", "value2"}, fstdin, []string{"value1", "value2"})
+
+	// '-' reads the argument value from stdin
+	fstdin = fileToSimulateStdin(t, "stdin1\nstdin2\n")
+	test([]string{"stdinenablednotvariadic2args", "value1", "-"}, fstdin, []string{"value1", "stdin1\nstdin2"})
+	test([]string{"stdinenabled", "-"}, fstdin, []string{"stdin1", "stdin2"})
+	test([]string{"stdinenablednotvariadic2args", "-", "value2"}, fstdin, []string{"-", "value2"})
+	testFail([]string{"stdinenabled", "-"}, "stdin isn't available")
+}
+
+func TestGlobExpansion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.txt", "b.txt", "c.md"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rootCmd := &commands.Command{
+		Subcommands: map[string]*commands.Command{
+			"add": {
+				Arguments: []commands.Argument{
+					commands.FileArg("path", true, true, "some files").EnableGlob(),
+				},
+			},
+		},
+	}
+
+	req, _, _, err := Parse([]string{"add", filepath.Join(dir, "*.txt")}, nil, rootCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for {
+		f, err := req.Files().NextFile()
+		if err != nil {
+			break
+		}
+		names = append(names, f.FileName())
+	}
+	if !sameWords(names, words{"a.txt", "b.txt"}) {
+		t.Errorf("Expected the pattern to match a.txt and b.txt, got %v", names)
+	}
+
+	_, _, _, err = Parse([]string{"add", filepath.Join(dir, "*.go")}, nil, rootCmd)
+	if err == nil {
+		t.Error("Should have failed (pattern doesn't match any files)")
+	}
+}
+
+func TestArgFileExpansion(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.WriteString(f, "value2\n\nvalue3\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	rootCmd := &commands.Command{
+		Arguments: []commands.Argument{
+			commands.StringArg("a", true, true, "some arg").EnableAtFile(),
+		},
+		Subcommands: map[string]*commands.Command{
+			"plain": {
+				Arguments: []commands.Argument{
+					commands.StringArg("a", true, true, "some arg"),
+				},
+			},
+		},
+	}
+
+	req, _, _, err := Parse([]string{"value1", "@" + f.Name(), "@@literal"}, nil, rootCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := words{"value1", "value2", "value3", "@literal"}
+	if !sameWords(req.Arguments(), expected) {
+		t.Errorf("Arguments are '%v' instead of '%v'", req.Arguments(), expected)
+	}
+
+	_, _, _, err = Parse([]string{"@" + f.Name() + ".missing"}, nil, rootCmd)
+	if err == nil {
+		t.Error("Should have failed (argument file doesn't exist)")
+	}
+
+	// arguments that don't enable it take @ values as they are
+	req, _, _, err = Parse([]string{"plain", "@scope/pkg", "@" + f.Name()}, nil, rootCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = words{"@scope/pkg", "@" + f.Name()}
+	if !sameWords(req.Arguments(), expected) {
+		t.Errorf("Arguments are '%v' instead of '%v'", req.Arguments(), expected)
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	os.Setenv("CMDS_TEST_DIR", "/tmp/dir")
+	defer os.Unsetenv("CMDS_TEST_DIR")
+
+	tests := map[string]string{
+		"~":                         home,
+		"~/foo":                     home + "/foo",
+		"~foo":                      "~foo",
+		`\~/foo`:                    "~/foo",
+		"$CMDS_TEST_DIR/a":          "/tmp/dir/a",
+		"${CMDS_TEST_DIR}a":         "/tmp/dira",
+		`\$CMDS_TEST_DIR`:           "$CMDS_TEST_DIR",
+		"a$":                        "a$",
+		"/foo/$CMDS_TEST_UNSET/bar": "/foo//bar",
+	}
+	for in, expected := range tests {
+		out, err := expandPath(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != expected {
+			t.Errorf("expandPath(%q) = %q instead of %q", in, out, expected)
+		}
+	}
+
+	rootCmd := &commands.Command{
+		Options: []commands.Option{
+			commands.PathOption("config", "a path"),
+			commands.StringOption("name", "a string"),
+		},
+	}
+	req, _, _, err := Parse([]string{"--config=$CMDS_TEST_DIR", "--name=$CMDS_TEST_DIR"}, nil, rootCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := req.Option("config").String(); v != "/tmp/dir" {
+		t.Errorf("Expected the path option to be expanded, got %q", v)
+	}
+	if v, _, _ := req.Option("name").String(); v != "$CMDS_TEST_DIR" {
+		t.Errorf("Expected the string option not to be expanded, got %q", v)
+	}
+}
+
+func TestPathResolution(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd := &commands.Command{
+		Arguments: []commands.Argument{
+			commands.StringArg("path", true, false, "a client path").EnableResolvePath(),
+			commands.StringArg("name", true, false, "a string"),
+			commands.FileArg("file", true, false, "a file"),
+		},
+	}
+
+	req, _, _, err := Parse([]string{"foo/bar", "foo/bar", "parse.go"}, nil, rootCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := words{filepath.Join(cwd, "foo/bar"), "foo/bar"}
+	if !sameWords(req.Arguments(), expected) {
+		t.Errorf("Arguments are '%v' instead of '%v'", req.Arguments(), expected)
+	}
+
+	f, err := req.Files().NextFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.FileName() != "parse.go" || f.FullPath() != filepath.Join(cwd, "parse.go") {
+		t.Errorf("File has name '%s' and path '%s'", f.FileName(), f.FullPath())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	rootCmd := &commands.Command{
+		Options: []commands.Option{
+			commands.BoolOption("all", "a", "use all values"),
+		},
+		Arguments: []commands.Argument{
+			commands.StringArg("value", false, true, "some values"),
+		},
+		Validate: func(req commands.Request) error {
+			all, _, _ := req.Option("all").Bool()
+			if all && len(req.Arguments()) > 0 {
+				return errors.New("option 'all' can't be used with values")
+			}
+			return nil
+		},
+	}
+
+	if _, _, _, err := Parse([]string{"--all"}, nil, rootCmd); err != nil {
+		t.Error(err)
+	}
+	if _, _, _, err := Parse([]string{"x", "y"}, nil, rootCmd); err != nil {
+		t.Error(err)
+	}
+	if _, _, _, err := Parse([]string{"--all", "x"}, nil, rootCmd); err == nil {
+		t.Error("Expected the request to fail validation")
+	}
+}
+
+func TestInteractive(t *testing.T) {
+	promptOutput = ioutil.Discard
+	defer func() { promptOutput = os.Stderr }()
+
+	rootCmd := &commands.Command{
+		Options: []commands.Option{
+			commands.BoolOption("pin", "pin the value"),
+			commands.StringOption("pin-name", "name of the pin"),
+		},
+		Arguments: []commands.Argument{
+			commands.StringArg("kind", true, false, "kind of value").WithCompletions("file", "directory"),
+			commands.StringArg("value", true, false, "some value"),
+			commands.StringArg("extra", false, false, "optional value"),
+		},
+		Requires: []commands.OptionRequirement{
+			{Option: "pin", Requires: []string{"pin-name"}},
+		},
+	}
+
+	input := func(s string) *os.File {
+		f, err := ioutil.TempFile("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, s); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Seek(0, 0); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	f := input("2\n\nabc\nmypin\n")
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	req, _, _, err := Parse([]string{"--interactive", "--pin"}, f, rootCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := words{"directory", "abc"}
+	if !sameWords(req.Arguments(), expected) {
+		t.Errorf("Arguments are '%v' instead of '%v'", req.Arguments(), expected)
+	}
+	if name, _, _ := req.Option("pin-name").String(); name != "mypin" {
+		t.Errorf("Option 'pin-name' is '%s' instead of 'mypin'", name)
+	}
+
+	g := input("")
+	defer os.Remove(g.Name())
+	defer g.Close()
+
+	if _, _, _, err := Parse([]string{"--interactive", "file"}, g, rootCmd); err == nil {
+		t.Error("Should have failed (no input for missing argument)")
+	}
+	if _, _, _, err := Parse([]string{"--interactive", "file"}, nil, rootCmd); err == nil {
+		t.Error("Should have failed (no stdin)")
+	}
+	if _, _, _, err := Parse([]string{"--interactive", "file", "abc"}, nil, rootCmd); err != nil {
+		t.Error(err)
+	}
+
+	// stdin is still read for arguments if nothing was prompted for
+	stdinCmd := &commands.Command{
+		Arguments: []commands.Argument{
+			commands.StringArg("value", false, false, "some value").EnableStdin(),
+		},
+	}
+	h := input("fromstdin\n")
+	defer os.Remove(h.Name())
+	defer h.Close()
+
+	req, _, _, err = Parse([]string{"--interactive"}, h, stdinCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameWords(req.Arguments(), words{"fromstdin"}) {
+		t.Errorf("Expected the argument from stdin, got %v", req.Arguments())
+	}
+}
+
+func TestUnknownCommandSuggestions(t *testing.T) {
+	root := &commands.Command{
+		Subcommands: map[string]*commands.Command{
+			"add": {},
+			"pin": {
+				Subcommands: map[string]*commands.Command{
+					"ls":  {},
+					"rm":  {},
+					"add": {},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		input       []string
+		suggestions []string
+	}{
+		{[]string{"pin", "lz"}, []string{"ls"}},
+		{[]string{"pin", "ad"}, []string{"add"}},
+		{[]string{"pim"}, []string{"pin"}},
+		{[]string{"pin", "xxxxxx"}, nil},
+	}
+	for _, c := range cases {
+		_, _, _, err := Parse(c.input, nil, root)
+		var e *commands.Error
+		if !errors.As(err, &e) || e.Kind != ErrKindUnknownCommand || e.Code != commands.ErrClient {
+			t.Errorf("%v: expected an unknown command error, got %v", c.input, err)
+			continue
+		}
+		suggestions, _ := e.Details["suggestions"].([]string)
+		if !sameWords(suggestions, c.suggestions) {
+			t.Errorf("%v: expected the suggestions %v, got %v", c.input, c.suggestions, suggestions)
+		}
+		if len(c.suggestions) > 0 && !strings.Contains(e.Message, "Did you mean this?\n\n\t"+c.suggestions[0]) {
+			t.Errorf("%v: expected the message to suggest %q, got %q", c.input, c.suggestions[0], e.Message)
+		}
+		if r := UsageErrorReport(err); r.Kind != ErrKindUnknownCommand {
+			t.Errorf("%v: expected the usage report to keep the kind, got %+v", c.input, r)
+		}
+	}
+}
+
+func TestFlagErrors(t *testing.T) {
+	root := &commands.Command{
+		Subcommands: map[string]*commands.Command{
+			"add": {
+				Options: []commands.Option{
+					commands.OptionRecursivePath,
+					commands.StringOption("chunker", "s", "the chunking algorithm"),
+				},
+				Arguments: []commands.Argument{
+					commands.StringArg("path", true, true, "the paths to add"),
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		input       []string
+		kind        string
+		message     string
+		token       string
+		position    int
+		suggestions []string
+	}{
+		{[]string{"add", "--recursve", "foo"}, ErrKindUnknownOption, "Unrecognized option 'recursve'", "--recursve", 1, []string{"--recursive"}},
+		{[]string{"add", "foo", "--chunk=size-10"}, ErrKindUnknownOption, "Unrecognized option 'chunk'", "--chunk=size-10", 2, []string{"--chunker"}},
+		{[]string{"add", "-rxs", "foo"}, ErrKindUnknownOption, "Unrecognized option 'x' in '-rxs'", "-rxs", 1, []string{}},
+		{[]string{"add", "foo", "--chunker"}, ErrKindInvalidOption, "Missing argument for option 'chunker'", "--chunker", 2, nil},
+		{[]string{"add", "-r", "foo", "-r"}, ErrKindInvalidOption, "Duplicate values for option 'r'", "-r", 3, nil},
+	}
+	for _, c := range cases {
+		_, _, _, err := Parse(c.input, nil, root)
+		var e *commands.Error
+		if !errors.As(err, &e) || e.Kind != c.kind || e.Code != commands.ErrClient {
+			t.Errorf("%v: expected a %s error, got %v", c.input, c.kind, err)
+			continue
+		}
+		if e.Message != c.message {
+			t.Errorf("%v: expected the message %q, got %q", c.input, c.message, e.Message)
+		}
+		if e.Details["token"] != c.token || e.Details["position"] != c.position {
+			t.Errorf("%v: expected the token %q at %d, got %v", c.input, c.token, c.position, e.Details)
+		}
+		if c.kind == ErrKindUnknownOption {
+			suggestions, _ := e.Details["suggestions"].([]string)
+			if !sameWords(suggestions, c.suggestions) {
+				t.Errorf("%v: expected the suggestions %v, got %v", c.input, c.suggestions, suggestions)
+			}
+		}
+		if last := e.Hints[len(e.Hints)-1]; last != "usage: add <path>..." {
+			t.Errorf("%v: expected the usage as the last hint, got %q", c.input, last)
+		}
+	}
+
+	var buf bytes.Buffer
+	_, _, _, err := Parse([]string{"add", "--recursve"}, nil, root)
+	UsageErrorReport(err).WriteText(&buf)
+	expected := "Error: Unrecognized option 'recursve'\nhint: did you mean --recursive?\nhint: usage: add <path>...\n"
+	if buf.String() != expected {
+		t.Errorf("expected the report %q, got %q", expected, buf.String())
+	}
+}
+
+func TestEditorArgumentWithoutTerminal(t *testing.T) {
+	root := &commands.Command{
+		Arguments: []commands.Argument{
+			commands.StringArg("message", true, false, "the message").EnableEditor("# write the message\n"),
+		},
+	}
+
+	// the editor can't be used without a terminal, and isn't started
+	defer os.Setenv("EDITOR", os.Getenv("EDITOR"))
+	os.Setenv("EDITOR", "false")
+	stdin, err := ioutil.TempFile("", "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(stdin.Name())
+	defer stdin.Close()
+
+	_, _, _, err = Parse(nil, stdin, root)
+	if err == nil || err.Error() != "Argument 'message' is required" {
+		t.Errorf("Expected the argument to be required, got %v", err)
+	}
+
+	req, _, _, err := Parse([]string{"hello"}, stdin, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := req.Arguments(); len(args) != 1 || args[0] != "hello" {
+		t.Errorf("unexpected arguments %v", args)
+	}
+}
+
+func TestDefaultSubcommand(t *testing.T) {
+	tail := &commands.Command{
+		Helptext:  commands.HelpText{Tagline: "Follow the logs."},
+		Options:   []commands.Option{commands.BoolOption("follow", "f", "keep reading")},
+		Arguments: []commands.Argument{commands.StringArg("subsystem", false, false, "the subsystem")},
+		Run:       func(commands.Request, commands.Response) {},
+	}
+	ls := &commands.Command{Run: func(commands.Request, commands.Response) {}}
+	root := &commands.Command{
+		Options: []commands.Option{commands.BoolOption("help", "h", "show the help")},
+		Subcommands: map[string]*commands.Command{
+			"log": {
+				DefaultSubcommand: "tail",
+				Subcommands:       map[string]*commands.Command{"tail": tail, "ls": ls},
+			},
+		},
+	}
+
+	cases := []struct {
+		input []string
+		path  []string
+		opts  kvs
+		words words
+	}{
+		{[]string{"log"}, []string{"log", "tail"}, kvs{}, words{}},
+		{[]string{"log", "-f"}, []string{"log", "tail"}, kvs{"f": ""}, words{}},
+		{[]string{"log", "dht", "--follow"}, []string{"log", "tail"}, kvs{"follow": ""}, words{"dht"}},
+		{[]string{"log", "--", "ls"}, []string{"log", "tail"}, kvs{}, words{"ls"}},
+		{[]string{"log", "ls"}, []string{"log", "ls"}, kvs{}, words{}},
+		{[]string{"log", "tail", "-f"}, []string{"log", "tail"}, kvs{"f": ""}, words{}},
+	}
+	for _, c := range cases {
+		path, opts, input, cmd, err := parseOpts(c.input, root)
+		if err != nil {
+			t.Errorf("%v: failed to parse: %v", c.input, err)
+			continue
+		}
+		if !sameWords(path, c.path) || !sameKVs(opts, c.opts) || !sameWords(input, c.words) {
+			t.Errorf("%v: parsed as %v %v %v, instead of %v %v %v", c.input, path, opts, input, c.path, c.opts, c.words)
+		}
+		if expected, _ := root.Get(c.path); cmd != expected {
+			t.Errorf("%v: resolved the wrong command", c.input)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := LongHelp("tool", root, []string{"log"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "tool log tail [<subsystem>] - Follow the logs. (default)") {
+		t.Errorf("Expected the help to mark the default subcommand, got:\n%s", buf.String())
+	}
+}
+
+func TestVersionFlag(t *testing.T) {
+	root := &commands.Command{
+		Subcommands: map[string]*commands.Command{"cat": {}},
+	}
+	root.RegisterVersion(commands.VersionInfo{Version: "0.4.2"})
+
+	for _, input := range [][]string{{"--version"}, {"version"}} {
+		req, cmd, path, err := Parse(input, nil, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cmd != root.Subcommands["version"] || !sameWords(path, []string{"version"}) {
+			t.Errorf("%v: expected the version subcommand, got %v", input, path)
+		}
+		if _, ok := req.Options()[commands.VersionOpt]; ok {
+			t.Errorf("%v: expected no --version option on the request", input)
+		}
+	}
+
+	if _, _, _, err := Parse([]string{"cat", "--version"}, nil, root); err != nil {
+		t.Errorf("Expected subcommands to accept the root's --version option: %v", err)
+	}
 }
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// ProgressBar renders Progress values as a single line progress bar, which
+// is redrawn on every update.
+type ProgressBar struct {
+	// Width is the number of cells of the bar itself.
+	Width int
+
+	w    io.Writer
+	last int // length of the last drawn line
+}
+
+// NewProgressBar returns a ProgressBar that draws on w (usually stderr).
+func NewProgressBar(w io.Writer) *ProgressBar {
+	return &ProgressBar{Width: 30, w: w}
+}
+
+// Update redraws the bar for p.
+func (b *ProgressBar) Update(p cmds.Progress) {
+	line := b.format(p)
+	pad := ""
+	if n := b.last - len(line); n > 0 {
+		pad = strings.Repeat(" ", n)
+	}
+	fmt.Fprintf(b.w, "\r%s%s", line, pad)
+	b.last = len(line)
+}
+
+// Done ends the bar's line, if anything was drawn.
+func (b *ProgressBar) Done() {
+	if b.last > 0 {
+		fmt.Fprintln(b.w)
+		b.last = 0
+	}
+}
+
+// Handle is a cmds.FrameHandler that draws the values of progress frames.
+// Set it with cmds.FrameHandlerKey to render the progress of a request.
+func (b *ProgressBar) Handle(t cmds.FrameType, v interface{}) {
+	if t != cmds.FrameProgress {
+		return
+	}
+	switch p := v.(type) {
+	case cmds.Progress:
+		b.Update(p)
+	case *cmds.Progress:
+		b.Update(*p)
+	}
+}
+
+// TrackUpload makes the bar show the progress of uploading the files of req,
+// if it has files, its progress option (cmds.OptionProgress) is set and it
+// isn't quiet. The HTTP client reports the bytes of file contents it sends.
+// It returns false if the upload isn't tracked.
+func (b *ProgressBar) TrackUpload(req cmds.Request) bool {
+	if req.Files() == nil || cmds.Quiet(req) {
+		return false
+	}
+	opt := req.Option(cmds.ProgressOpt)
+	if opt == nil {
+		return false
+	}
+	if show, _, _ := opt.Bool(); !show {
+		return false
+	}
+	cmds.UploadProgressKey.Set(req, b.Update)
+	return true
+}
+
+// Track makes the bar show the progress of reading the output of res, if
+// the response has a length (for streams) or an item count (for channels).
+// It returns false, leaving the output as it is, if it has neither or if the
+// request is quiet.
+func (b *ProgressBar) Track(res cmds.Response) bool {
+	if req := res.Request(); req != nil && cmds.Quiet(req) {
+		return false
+	}
+	switch out := res.Output().(type) {
+	case io.Reader:
+		if res.Length() == 0 {
+			return false
+		}
+		p := cmds.Progress{Total: int64(res.Length()), Unit: "bytes"}
+		res.SetOutput(&cmds.CountingReader{Reader: out, Count: func(n int) {
+			p.Current += int64(n)
+			b.Update(p)
+		}})
+		return true
+
+	case <-chan interface{}:
+		if cmds.ItemCount(res) == 0 {
+			return false
+		}
+		var done <-chan struct{}
+		if req := res.Request(); req != nil && req.Context() != nil {
+			done = req.Context().Done()
+		}
+
+		p := cmds.Progress{Total: int64(cmds.ItemCount(res)), Unit: "items"}
+		ch := make(chan interface{})
+		go func() {
+			defer close(ch)
+			for v := range out {
+				select {
+				case ch <- v:
+				case <-done:
+					return
+				}
+				p.Current++
+				b.Update(p)
+			}
+		}()
+		res.SetOutput((<-chan interface{})(ch))
+		return true
+	}
+	return false
+}
+
+func (b *ProgressBar) format(p cmds.Progress) string {
+	count := fmt.Sprint(p.Current)
+	if p.Total > 0 {
+		count += "/" + fmt.Sprint(p.Total)
+	}
+	if p.Unit != "" {
+		count += " " + p.Unit
+	}
+
+	var line string
+	if p.Total > 0 {
+		cur := p.Current
+		if cur > p.Total {
+			cur = p.Total
+		}
+		if cur < 0 {
+			cur = 0
+		}
+		filled := int(int64(b.Width) * cur / p.Total)
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", b.Width-filled)
+		line = fmt.Sprintf("[%s] %3d%% %s", bar, 100*cur/p.Total, count)
+	} else {
+		line = count
+	}
+
+	if p.Message != "" {
+		line += " " + p.Message
+	}
+	return line
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	cmds "github.com/ipfs/go-commands"
+	files "github.com/ipfs/go-commands/files"
+)
+
+func TestProgressBar(t *testing.T) {
+	var buf bytes.Buffer
+	bar := NewProgressBar(&buf)
+	bar.Width = 10
+
+	bar.Handle(cmds.FrameProgress, cmds.Progress{Current: 5, Total: 10, Unit: "bytes", Message: "adding"})
+	bar.Handle(cmds.FrameLog, "ignored")
+	bar.Handle(cmds.FrameProgress, cmds.Progress{Current: 10, Total: 10})
+	bar.Update(cmds.Progress{Current: 3})
+	bar.Done()
+	bar.Done()
+
+	expected := "\r[=====     ]  50% 5/10 bytes adding" +
+		"\r[==========] 100% 10/10" + "            " +
+		"\r3" + "                      " +
+		"\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestProgressBarTrack(t *testing.T) {
+	var buf bytes.Buffer
+	bar := NewProgressBar(&buf)
+	bar.Width = 4
+
+	res := cmds.NewResponse(nil)
+	res.SetOutput(bytes.NewReader([]byte("abcd")))
+	if bar.Track(res) {
+		t.Error("Expected no progress without a length")
+	}
+
+	res.SetLength(4)
+	if !bar.Track(res) {
+		t.Fatal("Expected the stream to be tracked")
+	}
+	if _, err := ioutil.ReadAll(res.Output().(io.Reader)); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != "\r[====] 100% 4/4 bytes" {
+		t.Errorf("unexpected progress %q", s)
+	}
+
+	bar.Done()
+	buf.Reset()
+	ch := make(chan interface{}, 2)
+	ch <- "a"
+	ch <- "b"
+	close(ch)
+	res.SetOutput((<-chan interface{})(ch))
+	cmds.SetItemCount(res, 2)
+	if !bar.Track(res) {
+		t.Fatal("Expected the channel to be tracked")
+	}
+	for range res.Output().(<-chan interface{}) {
+	}
+	bar.Done()
+	expected := "\r[==  ]  50% 1/2 items\r[====] 100% 2/2 items\n"
+	if s := buf.String(); s != expected {
+		t.Errorf("expected progress %q, got %q", expected, s)
+	}
+}
+
+func TestProgressBarTrackUpload(t *testing.T) {
+	cmd := &cmds.Command{Options: []cmds.Option{cmds.OptionProgress}}
+	optDefs := map[string]cmds.Option{cmds.ProgressOpt: cmds.OptionProgress, cmds.QuietOpt: cmds.OptionQuiet}
+	f := files.NewSliceFile("", "", []files.File{
+		files.NewReaderFile("a.txt", "a.txt", ioutil.NopCloser(strings.NewReader("abcd")), nil),
+	})
+
+	var buf bytes.Buffer
+	bar := NewProgressBar(&buf)
+	bar.Width = 4
+
+	for _, c := range []struct {
+		opts    cmds.OptMap
+		files   files.File
+		tracked bool
+	}{
+		{cmds.OptMap{cmds.ProgressOpt: true}, f, true},
+		{cmds.OptMap{cmds.ProgressOpt: false}, f, false},
+		{cmds.OptMap{}, f, false},
+		{cmds.OptMap{cmds.ProgressOpt: true, cmds.QuietOpt: true}, f, false},
+		{cmds.OptMap{cmds.ProgressOpt: true}, nil, false},
+	} {
+		req, err := cmds.NewRequest(nil, c.opts, nil, c.files, cmd, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tracked := bar.TrackUpload(req); tracked != c.tracked {
+			t.Errorf("expected tracked=%v for %v", c.tracked, c.opts)
+		}
+		progress, ok := cmds.UploadProgressKey.Get(req).(func(cmds.Progress))
+		if ok != c.tracked {
+			t.Errorf("expected the upload progress to be set: %v, was %v", c.tracked, ok)
+		}
+		if ok {
+			progress(cmds.Progress{Current: 2, Total: 4, Unit: "bytes"})
+		}
+	}
+
+	if s := buf.String(); s != "\r[==  ]  50% 2/4 bytes" {
+		t.Errorf("unexpected progress %q", s)
+	}
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var errSecretMismatch = errors.New("The entries didn't match")
+
+// PromptSecret prompts for a secret (e.g. a passphrase) on stdin, without
+// echoing what's typed. If confirm is true, the secret must be entered a
+// second time, e.g. when it's being set. If stdin isn't a terminal, the
+// secret is read from its first line, or its first two lines with confirm.
+//
+// Commands with SecretOptions get them prompted for this way in interactive
+// mode (see cmds.InteractiveOpt).
+func PromptSecret(label string, confirm bool) (string, error) {
+	return newPrompter(os.Stdin, promptOutput).askSecret(label, confirm)
+}
+
+// terminal returns the terminal the prompter reads from, or nil if its input
+// isn't a terminal.
+func (p *prompter) terminal() *os.File {
+	f, ok := p.raw.(*os.File)
+	if !ok {
+		return nil
+	}
+	term, err := isTerminal(f)
+	if err != nil || !term {
+		return nil
+	}
+	return f
+}
+
+// askSecret prompts for a non-empty secret with echo disabled, see
+// PromptSecret.
+func (p *prompter) askSecret(label string, confirm bool) (string, error) {
+	if p == nil {
+		return "", errNoPromptInput
+	}
+	p.used = true
+
+	read := func(prompt string) (string, error) {
+		fmt.Fprintf(p.out, "%s: ", prompt)
+		if f := p.terminal(); f != nil {
+			restore, err := disableEcho(f)
+			if err != nil {
+				return "", err
+			}
+			defer fmt.Fprintln(p.out) // the newline wasn't echoed
+			defer restore()
+		}
+
+		line, err := p.in.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return "", errNoPromptInput
+			}
+			return "", err
+		}
+		return line, nil
+	}
+
+	for {
+		secret, err := read(label)
+		if err != nil {
+			return "", err
+		}
+		if secret == "" {
+			continue
+		}
+		if !confirm {
+			return secret, nil
+		}
+
+		again, err := read("Repeat " + label)
+		if err != nil {
+			return "", err
+		}
+		if again != secret {
+			return "", errSecretMismatch
+		}
+		return secret, nil
+	}
+}
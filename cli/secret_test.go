@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-commands"
+)
+
+func TestPromptSecret(t *testing.T) {
+	var out bytes.Buffer
+	p := newPrompter(strings.NewReader("\nhunter2\nhunter2\n"), &out)
+	secret, err := p.askSecret("Passphrase", true)
+	if err != nil || secret != "hunter2" {
+		t.Errorf("Expected the secret, got %q (%v)", secret, err)
+	}
+	if out.String() != "Passphrase: Passphrase: Repeat Passphrase: " {
+		t.Errorf("Unexpected prompts %q", out.String())
+	}
+
+	p = newPrompter(strings.NewReader("hunter2\nhunter3\n"), &out)
+	if _, err := p.askSecret("Passphrase", true); err != errSecretMismatch {
+		t.Errorf("Expected mismatching entries to fail, got %v", err)
+	}
+	p = newPrompter(strings.NewReader(""), &out)
+	if _, err := p.askSecret("Passphrase", false); err != errNoPromptInput {
+		t.Errorf("Expected a missing secret to fail, got %v", err)
+	}
+}
+
+func TestInteractiveSecretOption(t *testing.T) {
+	var out bytes.Buffer
+	promptOutput = &out
+	defer func() { promptOutput = os.Stderr }()
+
+	root := &commands.Command{
+		Options: []commands.Option{
+			commands.BoolOption("encrypt", "Encrypt the output"),
+			commands.SecretOption("key", "The encryption key"),
+		},
+		Requires: []commands.OptionRequirement{
+			{Option: "encrypt", Requires: []string{"key"}},
+		},
+	}
+
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	io.WriteString(f, "s3cret\n")
+	f.Seek(0, 0)
+
+	req, _, _, err := Parse([]string{"--interactive", "--encrypt"}, f, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, _, _ := req.Option("key").String(); key != "s3cret" {
+		t.Errorf("Expected the key to be prompted for, got %q", key)
+	}
+	if out.String() != "--key (The encryption key): " {
+		t.Errorf("Unexpected prompt %q", out.String())
+	}
+}
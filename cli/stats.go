@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// TransferStatsText returns the line front-ends print (e.g. to stderr) after
+// running req, if the --show-transfer-stats option is set. It returns false
+// if the option isn't set, or if the request wasn't sent over the network.
+func TransferStatsText(req cmds.Request) (string, bool) {
+	show, _, _ := cmds.GlobalOption(req, cmds.OptionTransferStats).Bool()
+	if !show {
+		return "", false
+	}
+
+	stats, ok := cmds.TransferStatsKey.Get(req).(*cmds.TransferStats)
+	if !ok {
+		return "", false
+	}
+	return "Transferred: " + stats.String(), true
+}
+
+// StatText returns the summary front-ends print (e.g. to stderr) once the
+// output of res was read, if the --stat option is set: a "name: value" line
+// per trailer of the response, sorted by name. It returns false if the option
+// isn't set, or if the response has no trailers.
+func StatText(res cmds.Response) (string, bool) {
+	show, _, _ := cmds.GlobalOption(res.Request(), cmds.OptionStat).Bool()
+	if !show {
+		return "", false
+	}
+
+	trailers := cmds.Trailers(res)
+	if len(trailers) == 0 {
+		return "", false
+	}
+	names := make([]string, 0, len(trailers))
+	for name := range trailers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s: %s\n", name, trailers[name])
+	}
+	return buf.String(), true
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"testing"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+func TestStatText(t *testing.T) {
+	cmd := &cmds.Command{}
+	optDefs, err := cmd.GetOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		opts     cmds.OptMap
+		expected string
+		ok       bool
+	}{
+		{cmds.OptMap{}, "", false},
+		{cmds.OptMap{cmds.StatOpt: true}, "elapsed: 1.5s\nitems: 3\n", true},
+	} {
+		req, err := cmds.NewRequest(nil, c.opts, nil, nil, cmd, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := cmds.NewResponse(req)
+		cmds.SetTrailer(res, "items", "3")
+		cmds.SetTrailer(res, "elapsed", "1.5s")
+
+		s, ok := StatText(res)
+		if s != c.expected || ok != c.ok {
+			t.Errorf("expected %q %v, got %q %v", c.expected, c.ok, s, ok)
+		}
+	}
+}
+
+func TestStatTextOwnStatOption(t *testing.T) {
+	cmd := &cmds.Command{Options: []cmds.Option{cmds.BoolOption(cmds.StatOpt, "Show the file's stat")}}
+	optDefs, err := cmd.GetOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := cmds.NewRequest(nil, cmds.OptMap{cmds.StatOpt: true}, nil, nil, cmd, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := cmds.NewResponse(req)
+	cmds.SetTrailer(res, "items", "3")
+
+	if s, ok := StatText(res); ok {
+		t.Errorf("Expected no summary for the command's own stat option, got %q", s)
+	}
+}
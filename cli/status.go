@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// StatusLine renders a spinner, the time elapsed since it was started and the
+// latest progress message on a single line, while a command runs. It is
+// opt-in: front-ends start it for commands that may take a while, and stop
+// it, which clears the line, before printing the final output.
+type StatusLine struct {
+	// Interval is the time between redraws of the line.
+	Interval time.Duration
+
+	w     io.Writer
+	tty   bool
+	start time.Time
+	done  chan struct{}
+	exit  chan struct{}
+	stop  sync.Once
+
+	mu    sync.Mutex
+	msg   string
+	frame int
+	last  int // length of the last drawn line
+}
+
+// NewStatusLine returns a StatusLine that draws on w (usually stderr). It
+// only draws if w is a terminal.
+func NewStatusLine(w io.Writer) *StatusLine {
+	return &StatusLine{
+		Interval: 100 * time.Millisecond,
+		w:        w,
+		tty:      writesToTerminal(w),
+		done:     make(chan struct{}),
+		exit:     make(chan struct{}),
+	}
+}
+
+// Start starts redrawing the line every Interval until Stop is called. It
+// returns false, drawing nothing, if the line's writer isn't a terminal.
+func (s *StatusLine) Start() bool {
+	if !s.tty {
+		return false
+	}
+	s.start = time.Now()
+	s.draw()
+	go func() {
+		defer close(s.exit)
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.draw()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return true
+}
+
+// SetMessage sets the message shown after the elapsed time.
+func (s *StatusLine) SetMessage(msg string) {
+	s.mu.Lock()
+	s.msg = msg
+	s.mu.Unlock()
+}
+
+// Handle is a cmds.FrameHandler that shows the messages of progress frames.
+// Set it with cmds.FrameHandlerKey to show the status of a request.
+func (s *StatusLine) Handle(t cmds.FrameType, v interface{}) {
+	if t != cmds.FrameProgress {
+		return
+	}
+	var p cmds.Progress
+	switch v := v.(type) {
+	case cmds.Progress:
+		p = v
+	case *cmds.Progress:
+		p = *v
+	default:
+		return
+	}
+	if p.Message != "" {
+		s.SetMessage(p.Message)
+	}
+}
+
+// Stop stops redrawing the line and clears it. It is safe to call more than
+// once, and on lines that weren't started.
+func (s *StatusLine) Stop() {
+	s.stop.Do(func() {
+		close(s.done)
+		if !s.tty || s.start.IsZero() {
+			return
+		}
+		<-s.exit
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.last > 0 {
+			fmt.Fprintf(s.w, "\r%s\r", strings.Repeat(" ", s.last))
+			s.last = 0
+		}
+	})
+}
+
+func (s *StatusLine) draw() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line := s.format(time.Since(s.start))
+	s.frame = (s.frame + 1) % len(spinnerFrames)
+	pad := ""
+	if n := s.last - len(line); n > 0 {
+		pad = strings.Repeat(" ", n)
+	}
+	fmt.Fprintf(s.w, "\r%s%s", line, pad)
+	s.last = len(line)
+}
+
+func (s *StatusLine) format(elapsed time.Duration) string {
+	line := spinnerFrames[s.frame] + " " + elapsed.Truncate(time.Second).String()
+	if s.msg != "" {
+		line += " " + s.msg
+	}
+	return line
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+func TestStatusLine(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewStatusLine(&buf)
+	if s.Start() {
+		t.Error("Expected no status line on a buffer")
+	}
+	s.Stop()
+	if buf.Len() > 0 {
+		t.Errorf("Expected nothing to be drawn, got %q", buf.String())
+	}
+
+	s = NewStatusLine(&buf)
+	s.tty = true
+	s.Interval = time.Millisecond
+	s.Handle(cmds.FrameProgress, cmds.Progress{Current: 1, Message: "fetching blocks"})
+	s.Handle(cmds.FrameProgress, &cmds.Progress{Current: 2})
+	if !s.Start() {
+		t.Fatal("Expected the status line to start")
+	}
+	time.Sleep(50 * time.Millisecond)
+	s.Stop()
+	s.Stop()
+
+	out := buf.String()
+	if !strings.HasPrefix(out, "\r| 0s fetching blocks\r/ 0s fetching blocks") {
+		t.Errorf("unexpected status line %q", out)
+	}
+	clear := "\r" + strings.Repeat(" ", len("| 0s fetching blocks")) + "\r"
+	if !strings.HasSuffix(out, clear) {
+		t.Errorf("Expected the line to be cleared, got %q", out)
+	}
+}
+
+func TestStatusLineFormat(t *testing.T) {
+	s := NewStatusLine(&bytes.Buffer{})
+	if line := s.format(61500 * time.Millisecond); line != "| 1m1s" {
+		t.Errorf("unexpected line %q", line)
+	}
+	s.frame = 3
+	s.SetMessage("pinning")
+	if line := s.format(2 * time.Second); line != "\\ 2s pinning" {
+		t.Errorf("unexpected line %q", line)
+	}
+}
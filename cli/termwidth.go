@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// HelpWidth is the width LongHelp and ShortHelp wrap lines at. If it's 0, the
+// width of the terminal on stdout is used (see cmds.TerminalWidth), and lines
+// aren't wrapped when stdout isn't a terminal.
+var HelpWidth = 0
+
+// minWrapWidth is the narrowest width lines are wrapped at, under it the help
+// text is left as it is
+const minWrapWidth = 20
+
+func helpWidth() int {
+	if HelpWidth > 0 {
+		return HelpWidth
+	}
+	return cmds.TerminalWidth(os.Stdout)
+}
+
+// WrapToTerminal wraps the lines of the fields that don't fit in the help
+// width (see HelpWidth), with wrapText. The synopsis is left as it is, it's
+// usually preformatted.
+func (f *helpFields) WrapToTerminal() {
+	width := helpWidth()
+	f.Arguments = wrapText(f.Arguments, width, true)
+	f.Options = wrapText(f.Options, width, true)
+	f.Subcommands = wrapText(f.Subcommands, width, true)
+	f.Description = wrapText(f.Description, width, false)
+}
+
+// wrapText wraps the lines of s that are longer than width at word
+// boundaries. Continuation lines keep the indentation of the line or, in
+// tables (lines of "<name> - <description>"), are aligned with the
+// description.
+func wrapText(s string, width int, table bool) string {
+	if width < minWrapWidth || s == "" {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = wrapLine(line, width, table)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func wrapLine(line string, width int, table bool) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+
+	lead := len(line) - len(strings.TrimLeft(line, " "))
+	hang := lead
+	if i := strings.Index(line, " - "); table && i >= 0 && i+3 <= width-minWrapWidth {
+		hang = utf8.RuneCountInString(line[:i+3])
+	}
+
+	words := strings.Fields(line)
+	var b strings.Builder
+	b.WriteString(line[:lead])
+	col := lead
+	start := true
+	for _, w := range words {
+		n := utf8.RuneCountInString(w)
+		if !start && col+1+n > width {
+			b.WriteString("\n")
+			b.WriteString(strings.Repeat(" ", hang))
+			col = hang
+			start = true
+		}
+		if !start {
+			b.WriteString(" ")
+			col++
+		}
+		b.WriteString(w)
+		col += n
+		start = false
+	}
+	return b.String()
+}
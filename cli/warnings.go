@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// forwardedKey is the key of the deprecation warning of requests that Parse
+// forwarded from a deprecated command to its replacement
+var forwardedKey = cmds.NewKey("cli.forwarded", "")
+
+// WriteWarnings writes the warnings of res to w (usually stderr), one per
+// line. Front-ends call it once the output of res was read, as commands may
+// add warnings while their output is streamed. The warnings of deprecated
+// commands that were forwarded to their replacement come first.
+func WriteWarnings(w io.Writer, res cmds.Response) error {
+	warnings := cmds.Warnings(res)
+	if req := res.Request(); req != nil {
+		if deprecation, ok := forwardedKey.Get(req).(string); ok {
+			warnings = append([]string{deprecation}, warnings...)
+		}
+	}
+	for _, warning := range warnings {
+		if _, err := fmt.Fprintf(w, "%s %s\n", paint(w, styleYellow, "Warning:"), warning); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WarningFrameHandler returns a cmds.FrameHandler that writes the warnings
+// and item errors of a channel output to w as they arrive, like a
+// DeadlineWarning or the ItemErrors of a cmds.Batch.
+func WarningFrameHandler(w io.Writer) cmds.FrameHandler {
+	return func(t cmds.FrameType, v interface{}) {
+		if t == cmds.FrameItemError {
+			fmt.Fprintf(w, "%s %v\n", paint(w, styleRed, "Error:"), v)
+			return
+		}
+		if t != cmds.FrameWarning {
+			return
+		}
+		prefix := paint(w, styleYellow, "Warning:")
+		switch v := v.(type) {
+		case cmds.DeadlineWarning:
+			fmt.Fprintf(w, "%s %s\n", prefix, v.Message)
+		default:
+			fmt.Fprintf(w, "%s %v\n", prefix, v)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+func TestWriteWarnings(t *testing.T) {
+	res := cmds.NewResponse(nil)
+	cmds.AddWarning(res, "one")
+	cmds.AddWarning(res, "two")
+
+	var buf bytes.Buffer
+	if err := WriteWarnings(&buf, res); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != "Warning: one\nWarning: two\n" {
+		t.Errorf("unexpected warnings output %q", s)
+	}
+}
+
+func TestWarningFrameHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := WarningFrameHandler(&buf)
+	h(cmds.FrameWarning, cmds.DeadlineWarning{Message: "cut off soon"})
+	h(cmds.FrameLog, "not a warning")
+
+	if s := buf.String(); s != "Warning: cut off soon\n" {
+		t.Errorf("unexpected warnings output %q", s)
+	}
+}
+
+func TestForwardedDeprecatedCommand(t *testing.T) {
+	ls := &cmds.Command{
+		Helptext: cmds.HelpText{Tagline: "List the files."},
+		Options:  []cmds.Option{cmds.BoolOption("long", "l", "Use the long format")},
+		Run:      func(cmds.Request, cmds.Response) {},
+	}
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"files": {Subcommands: map[string]*cmds.Command{"ls": ls}},
+			"ls": {
+				Helptext:             cmds.HelpText{Tagline: "List the files."},
+				Options:              []cmds.Option{cmds.BoolOption("long", "l", "Use the long format")},
+				Run:                  func(cmds.Request, cmds.Response) {},
+				Deprecated:           true,
+				ReplacedBy:           "files ls",
+				ForwardToReplacement: true,
+			},
+		},
+	}
+
+	req, cmd, path, err := Parse([]string{"ls", "-l"}, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd != ls || strings.Join(path, " ") != "files ls" || strings.Join(req.Path(), " ") != "files ls" {
+		t.Fatalf("Expected the call to be forwarded to 'files ls', got %v", path)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteWarnings(&buf, root.Call(req)); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != "Warning: 'ls' is deprecated, use 'files ls' instead\n" {
+		t.Errorf("unexpected warnings %q", s)
+	}
+
+	buf.Reset()
+	if err := LongHelp("tool", root, nil, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "tool ls    - List the files. (deprecated, use 'tool files ls')") {
+		t.Errorf("Expected the help to mark the deprecated command, got:\n%s", buf.String())
+	}
+}
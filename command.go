@@ -13,7 +13,10 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Function is the type of function that Commands use.
@@ -28,6 +31,9 @@ type Marshaler func(Response) (io.Reader, error)
 // (or an error on failure)
 type MarshalerMap map[EncodingType]Marshaler
 
+// PostRunMap is a map of PostRun functions, keyed by EncodingType
+type PostRunMap map[EncodingType]Function
+
 // HelpText is a set of strings used to generate command help text. The help
 // text follows formats similar to man pages, but not exactly the same.
 type HelpText struct {
@@ -47,14 +53,90 @@ type HelpText struct {
 // Command is a runnable command, with input arguments and options (flags).
 // It can also have Subcommands, to group units of work into sets.
 type Command struct {
-	Options    []Option
-	Arguments  []Argument
+	Options   []Option
+	Arguments []Argument
+
+	// Enabled optionally reports whether the command is available. Disabled
+	// commands are treated as if they weren't part of the tree (see
+	// EnabledWhen). A nil Enabled means the command is always available.
+	Enabled func() bool
+
+	// Hidden commands (e.g. internal or plumbing commands) are callable like
+	// any other, but left out of help texts, generated docs and shell
+	// completions.
+	Hidden bool
+
+	// Experimental commands (and their subcommands) can only be called when
+	// experimental features are enabled, see EnableExperimentalOpt.
+	Experimental bool
+
+	// Deprecated commands are still callable, but calls get a warning (see
+	// DeprecationWarning) and help marks them. ReplacedBy is the path of the
+	// command that replaces it (e.g. "files ls"), which callers are pointed
+	// to. With ForwardToReplacement, the CLI runs the replacement instead, for
+	// commands that were renamed but take the same arguments and options.
+	Deprecated           bool
+	ReplacedBy           string
+	ForwardToReplacement bool
+
+	// Category groups the command with its siblings of the same category
+	// (e.g. "Basic", "Advanced" or "Network") in the help of its parent.
+	Category string
+
+	// Categories orders the categories of the subcommands in the help, those
+	// not listed follow in the order of their names.
+	Categories []string
+
+	// DefaultSubcommand names the subcommand the CLI runs when the command,
+	// which has no Run function of its own, is called without naming one: with
+	// "tail", `tool log` runs `tool log tail`. Options and arguments of the
+	// subcommand may follow, as in `tool log -f`.
+	DefaultSubcommand string
+
+	// SupportsDryRun declares that the command honors the --dry-run option
+	// (see Request.DryRun), by reporting what it would do without doing it.
+	// Other commands fail when they are called with the option, rather than
+	// doing what the caller wanted to avoid.
+	SupportsDryRun bool
+
+	// Requires declares options that are required depending on the values of
+	// other options. They are checked when the options are converted.
+	Requires []OptionRequirement
+
+	// Validate optionally checks the request as a whole (e.g. option X
+	// requires argument Y). It is run after the options are converted, before
+	// PreRun and Run.
+	Validate func(req Request) error
+
 	PreRun     func(req Request) error
 	Run        Function
 	PostRun    Function
 	Marshalers map[EncodingType]Marshaler
 	Helptext   HelpText
 
+	// EncodingPostRun optionally transforms the output of Run differently
+	// per encoding (e.g. humanizing sizes for Text only), in place of PostRun.
+	// Both are run on the client side, see CallPostRun.
+	EncodingPostRun PostRunMap
+
+	// Formats are alternative Marshalers, selected by name with the
+	// --output-format option, e.g. "short" and "long" text renderings. For
+	// encodings a format has no Marshaler for, Marshalers are used.
+	Formats map[string]MarshalerMap
+
+	// Middleware wraps the emitter of this command's output values, after any
+	// globally registered middleware (see UseEmitterMiddleware).
+	Middleware []EmitterMiddleware
+
+	// OutputBuffer is the number of values buffered between the Run function
+	// and the consumer of a ChannelEmitter output, the DefaultOutputBuffer if
+	// it is zero.
+	OutputBuffer int
+
+	// Sensitive lists the names of output fields that are masked unless the
+	// caller is allowed to see them (see RedactSensitive).
+	Sensitive []string
+
 	// Type describes the type of the output of the Command's Run Function.
 	// In precise terms, the value of Type is an instance of the return type of
 	// the Run Function.
@@ -62,6 +144,27 @@ type Command struct {
 	// ie. If command Run returns &Block{}, then Command.Type == &Block{}
 	Type        interface{}
 	Subcommands map[string]*Command
+
+	// RawOutput declares that the command outputs an opaque byte stream (an
+	// io.Reader, e.g. the contents of a file), which is passed through as it
+	// is instead of being marshaled, in any encoding. Type is ignored.
+	RawOutput bool
+
+	// ProtoMessage optionally converts an output value to the protobuf message
+	// it is encoded as with the protobuf encoding. Values that are messages
+	// (ProtoMarshalers) already are encoded as they are.
+	ProtoMessage func(v interface{}) (ProtoMarshaler, error)
+
+	// Subscribe optionally makes the command a subscription, e.g. for
+	// pubsub or watch commands. Commands without a Run function output the
+	// Events of the returned Topic instead, until the request is cancelled.
+	// The HTTP client resumes broken subscriptions (see http.Subscribe).
+	Subscribe func(req Request) (*Topic, error)
+
+	// InputSchema optionally describes the JSON body accepted by the command.
+	// The HTTP handler validates request bodies sent as application/json
+	// against it before calling the command.
+	InputSchema Schema
 }
 
 // ErrNotCallable signals a command that cannot be called.
@@ -82,7 +185,11 @@ func (c *Command) Call(req Request) Response {
 	}
 	cmd := cmds[len(cmds)-1]
 
-	if cmd.Run == nil {
+	run := cmd.Run
+	if run == nil && cmd.Subscribe != nil {
+		run = subscribeRun(cmd)
+	}
+	if run == nil {
 		res.SetError(ErrNotCallable, ErrClient)
 		return res
 	}
@@ -99,12 +206,59 @@ func (c *Command) Call(req Request) Response {
 		return res
 	}
 
-	cmd.Run(req, res)
+	if err = checkExperimental(cmds, req, res); err != nil {
+		res.SetError(err, ErrClient)
+		return res
+	}
+
+	if err = checkDryRun(cmd, req); err != nil {
+		res.SetError(err, ErrClient)
+		return res
+	}
+
+	if err = checkFormat(cmd, req); err != nil {
+		res.SetError(err, ErrClient)
+		return res
+	}
+
+	if cmd.Validate != nil {
+		err = cmd.Validate(req)
+		if err != nil {
+			res.SetError(err, ErrClient)
+			return res
+		}
+	}
+
+	if cmd.Deprecated {
+		AddWarning(res, DeprecationWarning(req.Path(), cmd))
+	}
+
+	// the warning is added to the response if it's due while Run is
+	// blocking, and sent as a frame if it's due while a channel is read
+	warnAt, warning, warn := deadlineWarning(req, time.Now())
+	var warnTimer *time.Timer
+	if warn {
+		warnTimer = time.AfterFunc(time.Until(warnAt), func() {
+			AddWarning(res, warning.Message)
+		})
+	}
+
+	run(req, res)
+	if warnTimer != nil && !warnTimer.Stop() {
+		warn = false
+	}
 	if res.Error() != nil {
 		return res
 	}
 
 	output := res.Output()
+	if cmd.RawOutput {
+		if _, ok := output.(io.Reader); !ok && output != nil {
+			res.SetError(ErrIncorrectType, ErrNormal)
+		}
+		return res
+	}
+
 	isChan := false
 	actualType := reflect.TypeOf(output)
 	if actualType != nil {
@@ -123,6 +277,10 @@ func (c *Command) Call(req Request) Response {
 		} else if ch, ok := output.(chan interface{}); ok {
 			output = (<-chan interface{})(ch)
 		}
+
+		if ch, ok := output.(<-chan interface{}); ok && warn {
+			res.SetOutput(warnBeforeDeadline(req.Context(), ch, warnAt, warning))
+		}
 	}
 
 	// If the command specified an output type, ensure the actual value returned is of that type
@@ -135,9 +293,30 @@ func (c *Command) Call(req Request) Response {
 		}
 	}
 
+	applyEmitterMiddleware(cmd, req, res)
+	demuxFrames(req, res)
 	return res
 }
 
+// CallPostRun runs the PostRun function of the command for the encoding of
+// req on res: its EncodingPostRun for the encoding, or PostRun if it has
+// none. Front-ends call it on the client side, after Call or after receiving
+// the response of a remote request, so PostRun functions aren't run by
+// servers.
+func (c *Command) CallPostRun(req Request, res Response) {
+	postRun := c.PostRun
+	if opt := req.Option(EncShort); opt != nil {
+		if enc, found, _ := opt.String(); found {
+			if f, ok := c.EncodingPostRun[EncodingType(strings.ToLower(enc))]; ok {
+				postRun = f
+			}
+		}
+	}
+	if postRun != nil && res.Error() == nil {
+		postRun(req, res)
+	}
+}
+
 // Resolve gets the subcommands at the given path
 func (c *Command) Resolve(path []string) ([]*Command, error) {
 	cmds := make([]*Command, len(path)+1)
@@ -183,6 +362,9 @@ func (c *Command) GetOptions(path []string) (map[string]Option, error) {
 
 	optionsMap := make(map[string]Option)
 	for _, opt := range options {
+		if overridableGlobals[opt] && overridden(opt, optionsMap) {
+			continue
+		}
 		for _, name := range opt.Names() {
 			if _, found := optionsMap[name]; found {
 				return nil, fmt.Errorf("Option name '%s' used multiple times", name)
@@ -195,24 +377,85 @@ func (c *Command) GetOptions(path []string) (map[string]Option, error) {
 	return optionsMap, nil
 }
 
+// overridden returns true if a name of opt is already one of the options.
+func overridden(opt Option, options map[string]Option) bool {
+	for _, name := range opt.Names() {
+		if _, found := options[name]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrKindDryRunUnsupported is the Kind of the errors of dry runs of commands
+// that don't support them.
+const ErrKindDryRunUnsupported = "dry-run-unsupported"
+
+// checkDryRun returns an error if req is a dry run and c doesn't support it.
+// Commands with a dry-run option of their own handle it themselves.
+func checkDryRun(c *Command, req Request) error {
+	if !req.DryRun() || c.SupportsDryRun {
+		return nil
+	}
+	if opt := req.Option(DryRunOpt); opt.Definition() != OptionDryRun {
+		return nil
+	}
+	return &Error{
+		Message: fmt.Sprintf("The command doesn't support --%s", DryRunOpt),
+		Code:    ErrClient,
+		Kind:    ErrKindDryRunUnsupported,
+	}
+}
+
+// checkFormat returns an error if the --output-format option names a format
+// the command doesn't have.
+func checkFormat(c *Command, req Request) error {
+	format, found, err := GlobalOption(req, OptionOutputFormat).String()
+	if err != nil || !found {
+		return err
+	}
+	if _, ok := c.Formats[format]; ok {
+		return nil
+	}
+
+	names := make([]string, 0, len(c.Formats))
+	for name := range c.Formats {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("This command has no output format '%s'", format)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("Unknown output format '%s', use one of: %s", format, strings.Join(names, ", "))
+}
+
 func (c *Command) CheckArguments(req Request) error {
 	args := req.Arguments()
 
-	// count required argument definitions
+	// count required argument definitions (file arguments aren't values)
 	numRequired := 0
 	for _, argDef := range c.Arguments {
-		if argDef.Required {
+		if argDef.Required && argDef.Type != ArgFile {
 			numRequired++
 		}
 	}
 
 	// iterate over the arg definitions
 	valueIndex := 0 // the index of the current value (in `args`)
+	variadic := false
+	max := 0 // the number of values the string argument definitions take
 	for _, argDef := range c.Arguments {
+		if argDef.Type != ArgFile {
+			max++
+		}
+
 		// skip optional argument definitions if there aren't sufficient remaining values
 		if len(args)-valueIndex <= numRequired && !argDef.Required || argDef.Type == ArgFile {
 			continue
 		}
+		if argDef.Required {
+			numRequired--
+		}
 
 		// the value for this argument definition. can be nil if it wasn't provided by the caller
 		v, found := "", false
@@ -228,6 +471,9 @@ func (c *Command) CheckArguments(req Request) error {
 		}
 
 		// any additional values are for the variadic arg definition
+		if argDef.Variadic {
+			variadic = true
+		}
 		if argDef.Variadic && valueIndex < len(args)-1 {
 			for _, val := range args[valueIndex:] {
 				err := checkArgValue(val, true, argDef)
@@ -238,12 +484,59 @@ func (c *Command) CheckArguments(req Request) error {
 		}
 	}
 
+	if !variadic && valueIndex < len(args) {
+		return ExtraArgsError(args[valueIndex:], max)
+	}
 	return nil
 }
 
-// Subcommand returns the subcommand with the given id
+// ErrKindExtraArgs is the Kind of the errors of requests with more argument
+// values than their command takes.
+const ErrKindExtraArgs = "extra-arguments"
+
+// ExtraArgsError returns the usage error of surplus argument values, for a
+// command that takes at most max values. The values it names are in the
+// "arguments" detail.
+func ExtraArgsError(extra []string, max int) *Error {
+	quoted := make([]string, len(extra))
+	for i, v := range extra {
+		quoted[i] = strconv.Quote(v)
+	}
+	noun := "arguments"
+	if max == 1 {
+		noun = "argument"
+	}
+	msg := fmt.Sprintf("Unexpected arguments %s, the command takes %d %s at most", strings.Join(quoted, ", "), max, noun)
+	if len(extra) == 1 {
+		msg = fmt.Sprintf("Unexpected argument %s, the command takes %d %s at most", quoted[0], max, noun)
+	}
+	return &Error{
+		Message: msg,
+		Code:    ErrClient,
+		Kind:    ErrKindExtraArgs,
+		Details: map[string]interface{}{"arguments": extra},
+	}
+}
+
+// Subcommand returns the subcommand with the given name, or nil if there is
+// no such subcommand or it is disabled.
 func (c *Command) Subcommand(id string) *Command {
-	return c.Subcommands[id]
+	sub := c.Subcommands[id]
+	if sub == nil || !sub.IsEnabled() {
+		return nil
+	}
+	return sub
+}
+
+// IsListed returns true if the command is enabled and not hidden, i.e. if it
+// is listed in help texts and completions.
+func (c *Command) IsListed() bool {
+	return !c.Hidden && c.IsEnabled()
+}
+
+// IsEnabled returns false if the command was disabled by its Enabled function.
+func (c *Command) IsEnabled() bool {
+	return c.Enabled == nil || c.Enabled()
 }
 
 // checkArgValue returns an error if a given arg value is not valid for the given Argument
@@ -1,6 +1,15 @@
 package commands
 
-import "testing"
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
 
 func noop(req Request, res Response) {
 	return
@@ -155,3 +164,852 @@ func TestResolving(t *testing.T) {
 		t.Error("Returned command path is different than expected", cmds)
 	}
 }
+
+func TestArgumentDefaults(t *testing.T) {
+	cmd := &Command{
+		Arguments: []Argument{
+			StringArg("a", true, false, "some arg"),
+			StringArg("path", false, false, "a path").WithDefault("/"),
+		},
+		Run: noop,
+	}
+
+	test := func(args, expected []string) {
+		req, err := NewRequest(nil, nil, args, nil, cmd, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := req.Arguments()
+		if len(actual) != len(expected) {
+			t.Fatalf("Arguments for %v are %v instead of %v", args, actual, expected)
+		}
+		for i := range actual {
+			if actual[i] != expected[i] {
+				t.Fatalf("Arguments for %v are %v instead of %v", args, actual, expected)
+			}
+		}
+	}
+
+	test([]string{"value"}, []string{"value", "/"})
+	test([]string{"value", "/foo"}, []string{"value", "/foo"})
+	test([]string{}, []string{})
+
+	cmd.Arguments = []Argument{
+		StringArg("path", false, false, "a path").WithDefault("/"),
+		StringArg("b", true, false, "another arg"),
+	}
+	test([]string{"value"}, []string{"/", "value"})
+	test([]string{"/foo", "value"}, []string{"/foo", "value"})
+
+	cmd.Arguments = []Argument{
+		StringArg("a", false, false, "some arg"),
+		StringArg("path", false, false, "a path").WithDefault("/"),
+	}
+	test([]string{}, []string{})
+	test([]string{"value"}, []string{"value", "/"})
+}
+
+func TestEmitterMiddleware(t *testing.T) {
+	count := 0
+	counter := func(req Request, next Emitter) Emitter {
+		return func(v interface{}) error {
+			count++
+			return next(v)
+		}
+	}
+	double := func(req Request, next Emitter) Emitter {
+		return func(v interface{}) error {
+			return next(v.(int) * 2)
+		}
+	}
+	dropOdd := func(req Request, next Emitter) Emitter {
+		return func(v interface{}) error {
+			if v.(int)%2 != 0 {
+				return nil
+			}
+			return next(v)
+		}
+	}
+
+	defaults := emitterMiddleware
+	UseEmitterMiddleware(counter)
+	defer func() { emitterMiddleware = defaults }()
+
+	cmd := &Command{
+		Middleware: []EmitterMiddleware{double},
+		Run: func(req Request, res Response) {
+			res.SetOutput(21)
+		},
+	}
+
+	req, _ := NewRequest(nil, nil, nil, nil, cmd, nil)
+	res := cmd.Call(req)
+	if res.Output() != 42 {
+		t.Errorf("Expected the output to be transformed, got %v", res.Output())
+	}
+	if count != 1 {
+		t.Errorf("Expected the global middleware to see 1 value, got %d", count)
+	}
+
+	cmd = &Command{
+		Middleware: []EmitterMiddleware{dropOdd},
+		Run: func(req Request, res Response) {
+			ch := make(chan interface{})
+			go func() {
+				defer close(ch)
+				for i := 0; i < 6; i++ {
+					ch <- i
+				}
+			}()
+			res.SetOutput((<-chan interface{})(ch))
+		},
+	}
+
+	req, _ = NewRequest(nil, nil, nil, nil, cmd, nil)
+	res = cmd.Call(req)
+	var values []int
+	for v := range res.Output().(<-chan interface{}) {
+		values = append(values, v.(int))
+	}
+	if len(values) != 3 || values[0] != 0 || values[1] != 2 || values[2] != 4 {
+		t.Errorf("Expected the odd values to be dropped, got %v", values)
+	}
+	if count != 7 {
+		t.Errorf("Expected the global middleware to see 7 values, got %d", count)
+	}
+}
+
+func TestEmitterMiddlewareCancel(t *testing.T) {
+	fail := func(req Request, next Emitter) Emitter {
+		return func(v interface{}) error {
+			return errors.New("oops")
+		}
+	}
+
+	cmd := &Command{
+		Middleware: []EmitterMiddleware{fail},
+		Run: func(req Request, res Response) {
+			// never closed, but stops sending once the request is cancelled
+			ch := make(chan interface{})
+			go func() {
+				for {
+					select {
+					case ch <- 1:
+					case <-req.Context().Done():
+						return
+					}
+				}
+			}()
+			res.SetOutput((<-chan interface{})(ch))
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts, _ := cmd.GetOptions(nil)
+	req, _ := NewRequest(nil, nil, nil, nil, cmd, opts)
+	if err := req.SetRootContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res := cmd.Call(req)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		for range res.Output().(<-chan interface{}) {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the output to end once the request was cancelled")
+	}
+}
+
+func TestRequestClone(t *testing.T) {
+	cmd := &Command{
+		Options: []Option{
+			IntOption("b", "beep", "enables beeper"),
+		},
+	}
+	opts, _ := cmd.GetOptions(nil)
+
+	req, _ := NewRequest([]string{"a"}, OptMap{"b": 1}, []string{"x"}, nil, cmd, opts)
+	req.Values()["node"] = "node"
+	GrantScopes(req, "a")
+	if err := req.SetRootContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	clone, ok := CloneRequest(req)
+	if !ok {
+		t.Fatal("Expected the request to be cloned")
+	}
+	clone.SetOption("b", 2)
+	clone.Arguments()[0] = "y"
+	clone.Values()["node"] = "other"
+	GrantScopes(clone, SensitiveScope)
+
+	if v, _, _ := req.Option("b").Int(); v != 1 {
+		t.Error("Setting an option on the clone changed the original")
+	}
+	if req.Arguments()[0] != "x" {
+		t.Error("Changing the arguments of the clone changed the original")
+	}
+	if req.Values()["node"] != "node" {
+		t.Error("Setting a value on the clone changed the original")
+	}
+	if HasScope(req, SensitiveScope) || !HasScope(clone, "a") {
+		t.Error("Scopes of the clone should be independent of the original")
+	}
+	if clone.Command() != cmd || clone.Path()[0] != "a" {
+		t.Error("Clone should keep the command and path")
+	}
+
+	CancelRequest(clone, errors.New("done with the clone"))
+	if clone.Context().Err() == nil || req.Context().Err() != nil {
+		t.Error("Cancelling the clone should only cancel the clone")
+	}
+	if CancelCause(clone) == nil || CancelCause(req) != nil {
+		t.Error("The cause of cancelling the clone shouldn't be the original's")
+	}
+}
+
+func TestDeadlineOption(t *testing.T) {
+	cmd := &Command{}
+	optDefs, err := cmd.GetOptions([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Hour).Truncate(time.Second)
+	req, err := NewRequest(nil, OptMap{DeadlineOpt: deadline.Format(time.RFC3339)}, nil, nil, cmd, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.SetRootContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if dl, ok := req.Context().Deadline(); !ok || !dl.Equal(deadline) {
+		t.Errorf("Expected deadline %v, got %v", deadline, dl)
+	}
+
+	// the earlier of timeout and deadline applies
+	req, err = NewRequest(nil, OptMap{DeadlineOpt: deadline.Format(time.RFC3339), TimeoutOpt: "1m"}, nil, nil, cmd, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.SetRootContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if dl, ok := req.Context().Deadline(); !ok || !dl.Before(deadline) {
+		t.Errorf("Expected the timeout to apply, got deadline %v", dl)
+	}
+
+	req, err = NewRequest(nil, OptMap{DeadlineOpt: "tomorrow"}, nil, nil, cmd, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.SetRootContext(context.Background()); err == nil {
+		t.Error("Expected an error for an invalid deadline")
+	}
+}
+
+func TestRequestConcurrency(t *testing.T) {
+	cmd := &Command{
+		Options: []Option{
+			IntOption("n", "count", "a number"),
+		},
+	}
+	optDefs, err := cmd.GetOptions([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := NewRequest(nil, nil, nil, nil, cmd, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 100; j++ {
+				req.SetOption("count", j)
+				req.Option("count").Int()
+				req.Options()
+				req.SetValue("key", i)
+				req.Value("key")
+				req.SetMetadata("key", "value")
+				req.Metadata()
+				CloneRequest(req)
+			}
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+
+	if _, ok := req.Value("key"); !ok {
+		t.Error("Expected value to be set")
+	}
+}
+
+func TestSetStdin(t *testing.T) {
+	req, err := NewEmptyRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Stdin() != os.Stdin {
+		t.Error("Expected requests to read from os.Stdin by default")
+	}
+
+	in := strings.NewReader("input")
+	req.SetStdin(in)
+	if req.Stdin() != in {
+		t.Error("Expected stdin to be the given reader")
+	}
+	if clone, _ := CloneRequest(req); clone.Stdin() != in {
+		t.Error("Expected clones to share stdin")
+	}
+
+	req.SetStdin(nil)
+	if req.Stdin() != nil {
+		t.Error("Expected no stdin")
+	}
+}
+
+func TestValidateHook(t *testing.T) {
+	ran := false
+	cmd := &Command{
+		Options: []Option{
+			IntOption("n", "count", "a number"),
+		},
+		Validate: func(req Request) error {
+			// options are converted before validation
+			if n, _, _ := req.Option("n").Int(); n > 10 {
+				return errors.New("count can't be more than 10")
+			}
+			return nil
+		},
+		Run: func(req Request, res Response) {
+			ran = true
+		},
+	}
+	optDefs, err := cmd.GetOptions([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := NewRequest(nil, OptMap{"n": "20"}, nil, nil, cmd, optDefs)
+	res := cmd.Call(req)
+	if res.Error() == nil || res.Error().Code != ErrClient || ran {
+		t.Error("Expected the request to fail validation without running")
+	}
+
+	req, _ = NewRequest(nil, OptMap{"n": "5"}, nil, nil, cmd, optDefs)
+	res = cmd.Call(req)
+	if res.Error() != nil || !ran {
+		t.Errorf("Expected the command to run, got error %v", res.Error())
+	}
+}
+
+func TestCancelCause(t *testing.T) {
+	cmd := &Command{}
+	optDefs, err := cmd.GetOptions([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := NewRequest(nil, nil, nil, nil, cmd, optDefs)
+	if err := req.SetRootContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if CancelCause(req) != nil {
+		t.Error("Expected no cause before cancellation")
+	}
+	CancelRequest(req, ErrInterrupted)
+	CancelRequest(req, ErrClientDisconnected)
+	<-req.Context().Done()
+	if CancelCause(req) != ErrInterrupted {
+		t.Errorf("Expected the first cause to be recorded, got %v", CancelCause(req))
+	}
+
+	req, _ = NewRequest(nil, OptMap{TimeoutOpt: "1ms"}, nil, nil, cmd, optDefs)
+	if err := req.SetRootContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-req.Context().Done()
+	if cause, ok := CancelCause(req).(TimeoutError); !ok || cause.Timeout != time.Millisecond {
+		t.Errorf("Expected a timeout cause, got %v", CancelCause(req))
+	}
+	if CancelCause(req).Error() != "timed out after 1ms" {
+		t.Errorf("Unexpected message %q", CancelCause(req).Error())
+	}
+
+	deadline := time.Now().Add(-time.Second).Truncate(time.Second)
+	req, _ = NewRequest(nil, OptMap{TimeoutOpt: "1h", DeadlineOpt: deadline.Format(time.RFC3339)}, nil, nil, cmd, optDefs)
+	if err := req.SetRootContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-req.Context().Done()
+	if cause, ok := CancelCause(req).(DeadlineError); !ok || !cause.Deadline.Equal(deadline) {
+		t.Errorf("Expected a deadline cause, got %v", CancelCause(req))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ = NewRequest(nil, nil, nil, nil, cmd, optDefs)
+	if err := req.SetRootContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	<-req.Context().Done()
+	if CancelCause(req) != context.Canceled {
+		t.Errorf("Expected the context error, got %v", CancelCause(req))
+	}
+
+	// requests without the methods report the error of their context
+	plain := struct{ Request }{req}
+	if CancelRequest(plain, ErrInterrupted) {
+		t.Error("Expected requests without the method not to be cancelled")
+	}
+	if CancelCause(plain) != context.Canceled {
+		t.Errorf("Expected the context error, got %v", CancelCause(plain))
+	}
+}
+
+func TestOptionRequirements(t *testing.T) {
+	cmd := &Command{
+		Options: []Option{
+			StringOption("type", "t", "the type"),
+			StringOption("spec", "s", "the spec of custom types"),
+			BoolOption("debug", "d", "debug the command"),
+			StringOption("log", "the log file"),
+		},
+		Requires: []OptionRequirement{
+			{Option: "type", Value: "custom", Requires: []string{"spec"}},
+			{Option: "debug", Value: true, Requires: []string{"log"}},
+		},
+	}
+	optDefs, err := cmd.GetOptions([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		opts  OptMap
+		error string
+	}{
+		{OptMap{"type": "plain"}, ""},
+		{OptMap{"type": "custom", "s": "x"}, ""},
+		{OptMap{"t": "custom"}, "Option 'spec' is required when option 'type' is 'custom'"},
+		{OptMap{"d": "true"}, "Option 'log' is required when option 'debug' is 'true'"},
+		{OptMap{"debug": "false"}, ""},
+	}
+	for _, tc := range cases {
+		_, err := NewRequest(nil, tc.opts, nil, nil, cmd, optDefs)
+		if tc.error == "" && err != nil {
+			t.Errorf("%v: unexpected error: %s", tc.opts, err)
+		} else if tc.error != "" && (err == nil || err.Error() != tc.error) {
+			t.Errorf("%v: expected error %q, got %v", tc.opts, tc.error, err)
+		}
+	}
+}
+
+func TestNoTimeout(t *testing.T) {
+	cmd := &Command{}
+	optDefs, _ := cmd.GetOptions(nil)
+
+	for _, tout := range []string{"0", "0s", NoTimeout} {
+		req, _ := NewRequest(nil, OptMap{TimeoutOpt: tout}, nil, nil, cmd, optDefs)
+		if !TimeoutDisabled(req) {
+			t.Errorf("Expected timeout %q to disable the timeout", tout)
+		}
+		if err := req.SetRootContext(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := req.Context().Deadline(); ok {
+			t.Errorf("Expected no deadline for timeout %q", tout)
+		}
+	}
+
+	req, _ := NewRequest(nil, OptMap{TimeoutOpt: "1m"}, nil, nil, cmd, optDefs)
+	if TimeoutDisabled(req) {
+		t.Error("Expected a timeout of 1m not to disable the timeout")
+	}
+}
+
+func TestDeadlineWarning(t *testing.T) {
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"stream": {
+				Run: func(req Request, res Response) {
+					ch := make(chan interface{})
+					go func() {
+						defer close(ch)
+						ch <- "a"
+						time.Sleep(100 * time.Millisecond)
+						ch <- "b"
+					}()
+					res.SetOutput((<-chan interface{})(ch))
+				},
+			},
+			"block": {
+				Run: func(req Request, res Response) {
+					time.Sleep(100 * time.Millisecond)
+					res.SetOutput("done")
+				},
+			},
+		},
+	}
+
+	newRequest := func(path string) Request {
+		optDefs, err := root.GetOptions([]string{path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := NewRequest([]string{path}, OptMap{TimeoutOpt: "1s"}, nil, nil, root, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		DeadlineWarningKey.Set(req, 0.02)
+		KeepFramesKey.Set(req, true)
+		if err := req.SetRootContext(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	res := root.Call(newRequest("stream"))
+	var types []FrameType
+	for v := range res.Output().(<-chan interface{}) {
+		if f, ok := v.(Frame); ok {
+			types = append(types, f.Type)
+			if w, ok := f.Value.(DeadlineWarning); !ok || w.Message == "" {
+				t.Errorf("Expected a DeadlineWarning, got %#v", f.Value)
+			}
+			continue
+		}
+		types = append(types, FrameValue)
+	}
+	expected := []FrameType{FrameValue, FrameWarning, FrameValue}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected frames %v, got %v", expected, types)
+	}
+
+	res = root.Call(newRequest("block"))
+	if len(Warnings(res)) != 1 {
+		t.Errorf("Expected a warning for the blocking command, got %q", Warnings(res))
+	}
+
+	req := newRequest("block")
+	DeadlineWarningKey.Set(req, 0.0)
+	if res := root.Call(req); len(Warnings(res)) != 0 {
+		t.Errorf("Expected no warnings with the warning disabled, got %q", Warnings(res))
+	}
+
+	// the warning is opt-in
+	optDefs, err := root.GetOptions([]string{"block"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = NewRequest([]string{"block"}, OptMap{TimeoutOpt: "110ms"}, nil, nil, root, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.SetRootContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if res := root.Call(req); len(Warnings(res)) != 0 {
+		t.Errorf("Expected no warnings by default, got %q", Warnings(res))
+	}
+}
+
+func TestRawOutput(t *testing.T) {
+	output := interface{}(strings.NewReader("raw bytes"))
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"cat": {
+				Run: func(req Request, res Response) {
+					res.SetOutput(output)
+				},
+				Type:      "",
+				RawOutput: true,
+			},
+		},
+	}
+
+	for _, enc := range []EncodingType{JSON, Text} {
+		optDefs, err := root.GetOptions([]string{"cat"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := NewRequest([]string{"cat"}, OptMap{EncShort: string(enc)}, nil, nil, root, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output = strings.NewReader("raw bytes")
+		res := root.Call(req)
+		if res.Error() != nil {
+			t.Fatal(res.Error())
+		}
+		r, err := res.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != output {
+			t.Errorf("%s: expected the output reader to be passed through", enc)
+		}
+	}
+
+	optDefs, _ := root.GetOptions([]string{"cat"})
+	req, _ := NewRequest([]string{"cat"}, nil, nil, nil, root, optDefs)
+	output = "not a stream"
+	if res := root.Call(req); res.Error() == nil || res.Error().Message != ErrIncorrectType.Error() {
+		t.Errorf("Expected ErrIncorrectType for a raw command without a stream, got %v", res.Error())
+	}
+}
+
+func TestExtraArguments(t *testing.T) {
+	cmd := &Command{
+		Arguments: []Argument{
+			StringArg("a", true, false, "a"),
+			StringArg("b", false, false, "b"),
+			FileArg("file", false, false, "file"),
+		},
+	}
+	variadic := &Command{
+		Arguments: []Argument{
+			StringArg("a", true, true, "a"),
+		},
+	}
+
+	for _, c := range []struct {
+		cmd  *Command
+		args []string
+		err  string
+	}{
+		{cmd, []string{"1"}, ""},
+		{cmd, []string{"1", "2"}, ""},
+		{cmd, []string{"1", "2", "3"}, `Unexpected argument "3", the command takes 2 arguments at most`},
+		{variadic, []string{"1", "2", "3"}, ""},
+		{&Command{}, []string{"1", "2"}, `Unexpected arguments "1", "2", the command takes 0 arguments at most`},
+	} {
+		optDefs, _ := c.cmd.GetOptions(nil)
+		req, _ := NewRequest(nil, nil, c.args, nil, c.cmd, optDefs)
+		err := c.cmd.CheckArguments(req)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%v: unexpected error %v", c.args, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != c.err {
+			t.Errorf("%v: expected error %q, got %v", c.args, c.err, err)
+			continue
+		}
+		if e, ok := err.(*Error); !ok || e.Code != ErrClient || e.Kind != ErrKindExtraArgs {
+			t.Errorf("%v: expected a client error of kind %q, got %#v", c.args, ErrKindExtraArgs, err)
+		}
+	}
+}
+
+func TestEncodingPostRun(t *testing.T) {
+	cmd := &Command{
+		Run: func(req Request, res Response) {
+			res.SetOutput(1024)
+		},
+		PostRun: func(req Request, res Response) {
+			res.SetOutput(res.Output().(int) + 1)
+		},
+		EncodingPostRun: PostRunMap{
+			Text: func(req Request, res Response) {
+				res.SetOutput("1 KiB")
+			},
+		},
+	}
+
+	for enc, expected := range map[EncodingType]interface{}{
+		Text: "1 KiB",
+		JSON: 1025,
+	} {
+		optDefs, err := cmd.GetOptions(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := NewRequest(nil, OptMap{EncShort: string(enc)}, nil, nil, cmd, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := cmd.Call(req)
+		if res.Output() != 1024 {
+			t.Errorf("%s: expected Call not to run PostRun, got %v", enc, res.Output())
+		}
+		cmd.CallPostRun(req, res)
+		if res.Output() != expected {
+			t.Errorf("%s: expected output %v, got %v", enc, expected, res.Output())
+		}
+	}
+}
+
+func TestChannelEmitter(t *testing.T) {
+	cmd := &Command{OutputBuffer: 2}
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := NewRequestBuilder(cmd).Context(ctx).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := NewResponse(req)
+
+	emit, done := ChannelEmitter(req, res)
+	emitted := make(chan error, 10)
+	go func() {
+		defer done()
+		for i := 0; i < 5; i++ {
+			err := emit(i)
+			emitted <- err
+			if err != nil {
+				return
+			}
+		}
+	}()
+	out := res.Output().(<-chan interface{})
+
+	// the producer blocks once the buffer is full
+	for i := 0; i < 2; i++ {
+		if err := <-emitted; err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-emitted:
+		t.Fatal("Expected the producer to block on the full buffer")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if v := <-out; v != 0 {
+		t.Errorf("Expected the first value, got %v", v)
+	}
+	if err := <-emitted; err != nil {
+		t.Fatal(err)
+	}
+
+	// cancelling the request unblocks it
+	cancel()
+	if err := <-emitted; err == nil {
+		t.Error("Expected the emitter to fail once the request was cancelled")
+	}
+	for range out {
+	}
+}
+
+func TestOverridableGlobals(t *testing.T) {
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"add": {
+				Options: []Option{BoolOption("quiet", "q", "Write only the hashes")},
+				Run:     noop,
+			},
+			"cat": {Run: noop},
+		},
+	}
+
+	opts, err := root.GetOptions([]string{"add"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts["q"] != root.Subcommands["add"].Options[0] || opts[QuietOpt] != opts["q"] {
+		t.Error("Expected the command's quiet option to take the place of the global one")
+	}
+	if opts["v"] != OptionVerbose {
+		t.Error("Expected the global verbose option")
+	}
+
+	opts, err = root.GetOptions([]string{"cat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts["q"] != OptionQuiet {
+		t.Error("Expected the global quiet option")
+	}
+
+	req, err := NewRequest([]string{"cat"}, OptMap{"q": true}, nil, nil, root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Quiet(req) || Verbose(req) {
+		t.Error("Expected a quiet request")
+	}
+}
+
+func TestOverridableGlobalNames(t *testing.T) {
+	for opt := range overridableGlobals {
+		name := opt.Names()[0]
+		root := &Command{
+			Subcommands: map[string]*Command{
+				"own": {Options: []Option{StringOption(name, "The command's own option")}, Run: noop},
+			},
+		}
+		opts, err := root.GetOptions([]string{"own"})
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		req, err := NewRequest([]string{"own"}, OptMap{name: "x"}, nil, nil, root, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, found, _ := GlobalOption(req, opt).String(); found {
+			t.Errorf("%s: expected the global option not to be found", name)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var dryRun bool
+	run := func(req Request, res Response) {
+		dryRun = req.DryRun()
+		res.SetOutput("ok")
+	}
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"rm":   {Run: run, SupportsDryRun: true},
+			"gc":   {Run: run},
+			"sync": {Run: run, Options: []Option{BoolOption("dry-run", "n", "only list the differences")}},
+		},
+	}
+	call := func(name string, opts OptMap) Response {
+		path := []string{name}
+		optDefs, err := root.GetOptions(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := NewRequest(path, opts, nil, nil, root, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dryRun = false
+		return root.Call(req)
+	}
+
+	if res := call("rm", OptMap{DryRunOpt: true}); res.Error() != nil || !dryRun {
+		t.Errorf("Expected a dry run, got %v (dry run: %v)", res.Error(), dryRun)
+	}
+	if res := call("rm", OptMap{}); res.Error() != nil || dryRun {
+		t.Errorf("Expected a real run, got %v (dry run: %v)", res.Error(), dryRun)
+	}
+
+	res := call("gc", OptMap{DryRunOpt: true})
+	if res.Error() == nil || res.Error().Kind != ErrKindDryRunUnsupported || res.Error().Code != ErrClient {
+		t.Errorf("Expected the dry run to be refused, got %v", res.Error())
+	}
+
+	if res := call("sync", OptMap{"n": true}); res.Error() != nil || !dryRun {
+		t.Errorf("Expected the command's own dry-run option, got %v (dry run: %v)", res.Error(), dryRun)
+	}
+
+	if info := root.Export("tool"); !info.Subcommands[1].DryRun || info.Subcommands[0].DryRun {
+		t.Errorf("Expected the export to declare the dry run support, got %+v", info.Subcommands)
+	}
+}
@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Kinds of the errors returned by Confirm
+const (
+	ErrKindConfirmationRequired = "confirmation-required" // there is no one to ask
+	ErrKindDeclined             = "declined"              // the user answered no
+)
+
+// confirmOutput is where confirmation prompts are written to
+var confirmOutput io.Writer = os.Stderr
+
+// Confirm asks the user the yes/no question (e.g. "Really delete X?") before
+// a command does something destructive. It returns nil if the user answers
+// yes, or if the --yes option is set in req (the global one, or a boolean
+// option of the command's own that takes its place). It fails with an error of kind
+// ErrKindDeclined for any other answer, and of kind
+// ErrKindConfirmationRequired without asking if stdin isn't interactive
+// (e.g. a pipe, or in remote requests, which have no stdin). Stdin readers
+// that aren't files (see Request.SetStdin) are considered interactive.
+func Confirm(req Request, question string) error {
+	if opt := req.Option(YesOpt); opt != nil {
+		if yes, _, _ := opt.Bool(); yes {
+			return nil
+		}
+	}
+
+	in := req.Stdin()
+	if !isInteractive(in) {
+		return &Error{
+			Message: fmt.Sprintf("%s (confirmation required)", question),
+			Code:    ErrClient,
+			Kind:    ErrKindConfirmationRequired,
+			Hints:   []string{fmt.Sprintf("pass --%s to confirm", YesOpt)},
+		}
+	}
+
+	fmt.Fprintf(confirmOutput, "%s [y/N] ", question)
+	answer, err := readLine(in)
+	if err != nil && answer == "" {
+		fmt.Fprintln(confirmOutput)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return &Error{Message: "Aborted", Code: ErrClient, Kind: ErrKindDeclined}
+}
+
+// isInteractive returns true if in is a terminal, or a reader that isn't a
+// file.
+func isInteractive(in io.Reader) bool {
+	if in == nil {
+		return false
+	}
+	f, ok := in.(*os.File)
+	if !ok {
+		return true
+	}
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// readLine reads a line from r, a byte at a time so nothing is read past it.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
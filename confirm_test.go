@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConfirm(t *testing.T) {
+	var out bytes.Buffer
+	defer func(w io.Writer) { confirmOutput = w }(confirmOutput)
+	confirmOutput = &out
+
+	cmd := &Command{}
+	newReq := func(opts OptMap, stdin interface{}) Request {
+		req, err := NewRequest(nil, opts, nil, nil, cmd, map[string]Option{YesOpt: OptionYes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch in := stdin.(type) {
+		case string:
+			req.SetStdin(strings.NewReader(in))
+		case *os.File:
+			req.SetStdin(in)
+		default:
+			req.SetStdin(nil)
+		}
+		return req
+	}
+
+	if err := Confirm(newReq(nil, "y\n"), "Really delete X?"); err != nil {
+		t.Errorf("Expected yes to confirm, got %v", err)
+	}
+	if out.String() != "Really delete X? [y/N] " {
+		t.Errorf("Unexpected prompt %q", out.String())
+	}
+
+	for _, answer := range []string{"n\n", "\n", ""} {
+		err := Confirm(newReq(nil, answer), "Really delete X?")
+		if e, ok := err.(*Error); !ok || e.Kind != ErrKindDeclined {
+			t.Errorf("Expected %q to decline, got %v", answer, err)
+		}
+	}
+
+	out.Reset()
+	if err := Confirm(newReq(OptMap{YesOpt: true}, nil), "Really delete X?"); err != nil || out.Len() > 0 {
+		t.Errorf("Expected --yes to confirm without asking, got %v (%q)", err, out.String())
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	for _, stdin := range []interface{}{r, nil} {
+		err := Confirm(newReq(nil, stdin), "Really delete X?")
+		if e, ok := err.(*Error); !ok || e.Kind != ErrKindConfirmationRequired || len(e.Hints) != 1 {
+			t.Errorf("Expected a confirmation to be required, got %v", err)
+		}
+	}
+	if out.Len() > 0 {
+		t.Errorf("Expected no prompt without an interactive stdin, got %q", out.String())
+	}
+}
+
+func TestConfirmOwnYesOption(t *testing.T) {
+	cmd := &Command{Options: []Option{BoolOption(YesOpt, "y", "Don't ask")}}
+	optDefs, err := cmd.GetOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := NewRequest(nil, OptMap{"y": true}, nil, nil, cmd, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetStdin(nil)
+	if err := Confirm(req, "Really delete X?"); err != nil {
+		t.Errorf("Expected the command's own yes option to confirm, got %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// The CSV and TSV EncodingTypes encode slices of flat structs as a table, with
+// a row per element. The columns are named by the `csv` struct tag of the
+// fields (or the field name), and fields tagged `csv:"-"` are left out.
+// Commands that stream a channel write a row per value (or per element, for
+// slice values), and the header once.
+const (
+	CSV = "csv"
+	TSV = "tsv"
+)
+
+// ErrNotTabular is returned by the CSV and TSV encodings (and text tables) for
+// output values that aren't structs or slices of structs.
+var ErrNotTabular = errors.New("This command's output can't be encoded as a table")
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// tableColumn is a struct field encoded as a column
+type tableColumn struct {
+	name  string
+	index int
+}
+
+// tableColumns returns the columns of the struct type t. Fields have to be
+// scalar values (or fmt.Stringers) to be encoded.
+func tableColumns(t reflect.Type) ([]tableColumn, error) {
+	var cols []tableColumn
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+
+		name := field.Tag.Get("csv")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if !isFlatType(field.Type) {
+			return nil, fmt.Errorf("Field '%s' can't be encoded as a column, it isn't a flat value", field.Name)
+		}
+		cols = append(cols, tableColumn{name, i})
+	}
+	return cols, nil
+}
+
+func isFlatType(t reflect.Type) bool {
+	if t.Implements(stringerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return isFlatType(t.Elem())
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// tableRows returns the struct values in v (a struct, or a slice of them),
+// and their type.
+func tableRows(v interface{}) ([]reflect.Value, reflect.Type, error) {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+
+	switch val.Kind() {
+	case reflect.Struct:
+		return []reflect.Value{val}, val.Type(), nil
+
+	case reflect.Slice, reflect.Array:
+		t := val.Type().Elem()
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, nil, ErrNotTabular
+		}
+
+		rows := make([]reflect.Value, 0, val.Len())
+		for i := 0; i < val.Len(); i++ {
+			elem := val.Index(i)
+			for elem.Kind() == reflect.Ptr && !elem.IsNil() {
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Ptr { // nil element
+				continue
+			}
+			rows = append(rows, elem)
+		}
+		return rows, t, nil
+	}
+
+	return nil, nil, ErrNotTabular
+}
+
+// tableWriter writes rows of struct values of a single type
+type tableWriter struct {
+	comma rune
+	t     reflect.Type
+	cols  []tableColumn
+}
+
+// write encodes the rows in v, and the header before the first ones.
+func (tw *tableWriter) write(v interface{}) (io.Reader, error) {
+	rows, t, err := tableRows(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = tw.comma
+
+	if tw.t == nil {
+		cols, err := tableColumns(t)
+		if err != nil {
+			return nil, err
+		}
+		tw.t = t
+		tw.cols = cols
+
+		header := make([]string, len(cols))
+		for i, c := range cols {
+			header[i] = c.name
+		}
+		w.Write(header)
+	} else if t != tw.t {
+		return nil, fmt.Errorf("Can't encode %s values in a table of %s values", t, tw.t)
+	}
+
+	record := make([]string, len(tw.cols))
+	for _, row := range rows {
+		for i, c := range tw.cols {
+			record[i] = tableCell(row.Field(c.index))
+		}
+		w.Write(record)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// tableCell formats a field value. Nil pointers are empty cells.
+func tableCell(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		if v.Type().Implements(stringerType) {
+			break
+		}
+		v = v.Elem()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func tableMarshaler(comma rune) Marshaler {
+	return func(res Response) (io.Reader, error) {
+		if res.Error() != nil {
+			return nil, res.Error()
+		}
+
+		tw := &tableWriter{comma: comma}
+		ch, ok := res.Output().(<-chan interface{})
+		if !ok {
+			return tw.write(res.Output())
+		}
+
+		return &ChannelMarshaler{
+			Channel: ch,
+			Marshaler: func(v interface{}) (io.Reader, error) {
+				r, err := tw.write(v)
+				if err != nil {
+					drainOutput(res, ch)
+				}
+				return r, err
+			},
+			Res: res,
+		}, nil
+	}
+}
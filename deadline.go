@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DeadlineWarningKey is the key of the fraction of the time to a request's
+// deadline (from when it is called) after which a DeadlineWarning is sent,
+// e.g. 0.8. The warning is off unless the key is set, and fractions outside of
+// (0, 1) disable it too. Front-ends that render warnings (see
+// cli.WarningFrameHandler) can set it for interactive users.
+var DeadlineWarningKey = NewKey("cmds.deadlineWarning", float64(0))
+
+// DeadlineWarning is the value of the FrameWarning frame that channel outputs
+// carry when their request nears its deadline, so interactive users can
+// re-run the command with a larger timeout before it gets cut off.
+type DeadlineWarning struct {
+	Deadline time.Time
+	Message  string
+}
+
+// deadlineWarning returns when req should be warned about its deadline, and
+// the warning. It returns false if the request has no deadline, or if the
+// warning is disabled.
+func deadlineWarning(req Request, now time.Time) (time.Time, DeadlineWarning, bool) {
+	ctx := req.Context()
+	if ctx == nil {
+		return time.Time{}, DeadlineWarning{}, false
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return time.Time{}, DeadlineWarning{}, false
+	}
+
+	fraction, _ := DeadlineWarningKey.Get(req).(float64)
+	if fraction <= 0 || fraction >= 1 {
+		return time.Time{}, DeadlineWarning{}, false
+	}
+
+	left := deadline.Sub(now)
+	at := now.Add(time.Duration(float64(left) * fraction))
+	return at, DeadlineWarning{
+		Deadline: deadline,
+		Message: fmt.Sprintf("the command will be cut off in %s, re-run it with a larger --timeout if it needs more time",
+			deadline.Sub(at).Round(time.Millisecond)),
+	}, true
+}
+
+// warnBeforeDeadline passes the values of in through, sending the FrameWarning
+// frame of w among them at the given time.
+func warnBeforeDeadline(ctx context.Context, in <-chan interface{}, at time.Time, w DeadlineWarning) <-chan interface{} {
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+
+		timer := time.NewTimer(time.Until(at))
+		defer timer.Stop()
+
+		due := timer.C
+		for {
+			var v interface{}
+			select {
+			case in, ok := <-in:
+				if !ok {
+					return
+				}
+				v = in
+			case <-due:
+				due = nil
+				v = Frame{Type: FrameWarning, Value: w}
+			}
+
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeprecationWarning returns the warning about calling the deprecated
+// command cmd at path, which points to its replacement if it has one.
+func DeprecationWarning(path []string, cmd *Command) string {
+	name := strings.Join(path, " ")
+	if cmd.ReplacedBy != "" {
+		return fmt.Sprintf("'%s' is deprecated, use '%s' instead", name, cmd.ReplacedBy)
+	}
+	return fmt.Sprintf("'%s' is deprecated and will be removed in a future version", name)
+}
+
+// Replacement returns the command that replaces the deprecated command cmd,
+// looked up in the tree rooted at root, and its path. It returns nil if cmd
+// isn't deprecated or has no replacement in the tree.
+func Replacement(root, cmd *Command) (*Command, []string) {
+	if !cmd.Deprecated || cmd.ReplacedBy == "" {
+		return nil, nil
+	}
+	path := strings.Fields(cmd.ReplacedBy)
+	replacement, err := root.Get(path)
+	if err != nil || replacement == cmd {
+		return nil, nil
+	}
+	return replacement, path
+}
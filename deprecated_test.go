@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"testing"
+)
+
+func TestDeprecatedCommands(t *testing.T) {
+	run := func(req Request, res Response) { res.SetOutput("ok") }
+	ls := &Command{Run: run}
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"files": {Subcommands: map[string]*Command{"ls": ls}},
+			"ls":    {Run: run, Deprecated: true, ReplacedBy: "files ls"},
+			"old":   {Run: run, Deprecated: true},
+		},
+	}
+
+	call := func(path []string) Response {
+		req, err := NewRequest(path, nil, nil, nil, root, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root.Call(req)
+	}
+
+	res := call([]string{"ls"})
+	if res.Error() != nil || len(Warnings(res)) != 1 || Warnings(res)[0] != "'ls' is deprecated, use 'files ls' instead" {
+		t.Errorf("Expected a deprecation warning, got %v %v", res.Error(), Warnings(res))
+	}
+	res = call([]string{"old"})
+	if len(Warnings(res)) != 1 || Warnings(res)[0] != "'old' is deprecated and will be removed in a future version" {
+		t.Errorf("Expected a deprecation warning, got %v", Warnings(res))
+	}
+	if res := call([]string{"files", "ls"}); len(Warnings(res)) != 0 {
+		t.Errorf("Expected no warnings, got %v", Warnings(res))
+	}
+
+	if cmd, path := Replacement(root, root.Subcommands["ls"]); cmd != ls || len(path) != 2 {
+		t.Errorf("Expected the replacement 'files ls', got %v", path)
+	}
+	for _, name := range []string{"old", "files"} {
+		if cmd, _ := Replacement(root, root.Subcommands[name]); cmd != nil {
+			t.Errorf("Expected no replacement for %s", name)
+		}
+	}
+}
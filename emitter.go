@@ -0,0 +1,183 @@
+package commands
+
+import (
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Emitter passes a single output value of a command on towards the
+// marshalers.
+type Emitter func(value interface{}) error
+
+// EmitterMiddleware wraps an Emitter, in the same way HTTP middleware wraps a
+// handler. The returned Emitter may transform values before passing them to
+// next, drop them by not calling next at all (e.g. for sampling), or simply
+// observe them (e.g. for counting). An error aborts the output stream and is
+// set on the Response.
+type EmitterMiddleware func(req Request, next Emitter) Emitter
+
+var (
+	emitterMiddleware     []EmitterMiddleware
+	emitterMiddlewareLock sync.RWMutex
+)
+
+// UseEmitterMiddleware registers middleware that is applied to the output of
+// every command. Global middleware sees each value before the middleware
+// declared on the Command itself.
+func UseEmitterMiddleware(mw ...EmitterMiddleware) {
+	emitterMiddlewareLock.Lock()
+	defer emitterMiddlewareLock.Unlock()
+
+	emitterMiddleware = append(emitterMiddleware, mw...)
+}
+
+// chainEmitter builds the Emitter that passes values through all of the
+// middleware (in order) before handing them to last.
+func chainEmitter(req Request, mw []EmitterMiddleware, last Emitter) Emitter {
+	emit := last
+	for i := len(mw) - 1; i >= 0; i-- {
+		emit = mw[i](req, emit)
+	}
+	return emit
+}
+
+// applyEmitterMiddleware replaces the output of res with the output of the
+// global and command middleware chain. Raw io.Reader outputs are not values,
+// and are passed through untouched. Value frames in channel outputs are
+// unwrapped. Channels are read until the producer closes them or the request
+// is cancelled, also after an emitter failed.
+func applyEmitterMiddleware(cmd *Command, req Request, res Response) {
+	emitterMiddlewareLock.RLock()
+	mw := make([]EmitterMiddleware, 0, len(emitterMiddleware)+len(cmd.Middleware)+1)
+	if mayBeSensitive(cmd) {
+		mw = append(mw, RedactSensitive)
+	}
+	mw = append(mw, emitterMiddleware...)
+	emitterMiddlewareLock.RUnlock()
+	mw = append(mw, cmd.Middleware...)
+
+	output := res.Output()
+	if len(mw) == 0 || output == nil {
+		return
+	}
+	if _, ok := output.(io.Reader); ok {
+		return
+	}
+
+	var in <-chan interface{}
+	switch ch := output.(type) {
+	case <-chan interface{}:
+		in = ch
+	case chan interface{}:
+		in = ch
+	}
+
+	if in == nil {
+		var emitted interface{}
+		emit := chainEmitter(req, mw, func(v interface{}) error {
+			emitted = v
+			return nil
+		})
+
+		if err := emit(output); err != nil {
+			res.SetError(err, ErrNormal)
+			return
+		}
+		res.SetOutput(emitted)
+		return
+	}
+
+	ctx := req.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	out := make(chan interface{})
+	send := func(v interface{}) error {
+		select {
+		case out <- v:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	emit := chainEmitter(req, mw, send)
+
+	// recv stops at the end of in, or once the request is cancelled, so
+	// producers that don't close their channel don't keep this goroutine
+	recv := func() (interface{}, bool) {
+		select {
+		case v, ok := <-in:
+			return v, ok
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+
+	go func() {
+		defer close(out)
+		for {
+			v, more := recv()
+			if !more {
+				return
+			}
+
+			// middleware only sees primary output values, log and event
+			// frames are passed on as they are
+			var err error
+			if f, ok := v.(Frame); ok && f.Type != FrameValue {
+				err = send(f)
+			} else if ok {
+				err = emit(f.Value)
+			} else {
+				err = emit(v)
+			}
+
+			if err != nil {
+				res.SetError(err, ErrNormal)
+
+				// unblock the producer
+				for _, more := recv(); more; _, more = recv() {
+				}
+				return
+			}
+		}
+	}()
+	res.SetOutput((<-chan interface{})(out))
+}
+
+// DefaultOutputBuffer is the OutputBuffer of commands that don't set one.
+const DefaultOutputBuffer = 16
+
+// ChannelEmitter sets a channel output on res, and returns the Emitter a Run
+// function sends its values with, and the function that ends the output once
+// all were sent. The channel buffers the command's OutputBuffer values: once
+// it is full, emitting blocks until the consumer catches up, so fast
+// producers don't grow memory without bound. If the request is cancelled
+// meanwhile, the Emitter returns the context's error instead.
+func ChannelEmitter(req Request, res Response) (Emitter, func()) {
+	size := DefaultOutputBuffer
+	if cmd := req.Command(); cmd != nil && cmd.OutputBuffer > 0 {
+		size = cmd.OutputBuffer
+	}
+
+	ch := make(chan interface{}, size)
+	res.SetOutput((<-chan interface{})(ch))
+
+	var done <-chan struct{}
+	if ctx := req.Context(); ctx != nil {
+		done = ctx.Done()
+	}
+	emit := func(v interface{}) error {
+		select {
+		case ch <- v:
+			return nil
+		case <-done:
+			return req.Context().Err()
+		}
+	}
+	var once sync.Once
+	return emit, func() { once.Do(func() { close(ch) }) }
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// marshallersMu guards marshallers, which host applications extend with
+// RegisterEncoder
+var marshallersMu sync.RWMutex
+
+// RegisterEncoder makes the encoding name available to all commands, with
+// marshaler encoding their responses. Command.Marshalers still take
+// precedence for their command. It panics if the encoding is already
+// registered (including the builtin ones), or if marshaler is nil.
+func RegisterEncoder(name EncodingType, marshaler Marshaler) {
+	if marshaler == nil {
+		panic("commands: RegisterEncoder marshaler is nil")
+	}
+
+	marshallersMu.Lock()
+	defer marshallersMu.Unlock()
+
+	if _, dup := marshallers[name]; dup {
+		panic(fmt.Sprintf("commands: RegisterEncoder called twice for encoding '%s'", name))
+	}
+	marshallers[name] = marshaler
+}
+
+// Encoders returns the names of the registered encodings, sorted.
+func Encoders() []EncodingType {
+	marshallersMu.RLock()
+	defer marshallersMu.RUnlock()
+
+	names := make([]EncodingType, 0, len(marshallers))
+	for name := range marshallers {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// encoder returns the registered Marshaler of an encoding
+func encoder(name EncodingType) (Marshaler, bool) {
+	marshallersMu.RLock()
+	defer marshallersMu.RUnlock()
+
+	m, ok := marshallers[name]
+	return m, ok
+}
+
+// encodingOption is the encoding option, its description lists the
+// registered encodings.
+type encodingOption struct {
+	Option
+}
+
+func (o *encodingOption) Description() string {
+	names := Encoders()
+	list := make([]string, len(names))
+	for i, name := range names {
+		list[i] = string(name)
+	}
+	if n := len(list); n > 1 {
+		list[n-1] = "or " + list[n-1]
+	}
+	return o.Option.Description() + " (" + strings.Join(list, ", ") + ")"
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrKindExperimental is the Kind of the errors of requests that use
+// experimental commands or options while experimental features are disabled.
+// Their "features" detail lists what's experimental.
+const ErrKindExperimental = "experimental"
+
+// ExperimentalEnv is the environment variable that enables experimental
+// features in the process executing the commands, like the
+// --enable-experimental option, if it's set to a true value (e.g. "1").
+// Programs usually rename it after themselves.
+var ExperimentalEnv = "CMDS_ENABLE_EXPERIMENTAL"
+
+// ExperimentalEnabled returns true if req enabled experimental features, or
+// ExperimentalEnv does.
+func ExperimentalEnabled(req Request) bool {
+	if enabled, _, _ := GlobalOption(req, OptionEnableExperimental).Bool(); enabled {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv(ExperimentalEnv))
+	return enabled
+}
+
+// experimentalFeatures returns the experimental commands of the chain of
+// commands that resolved req and the experimental options set in req.
+func experimentalFeatures(chain []*Command, req Request) []string {
+	var features []string
+	for _, cmd := range chain {
+		if cmd.Experimental {
+			features = append(features, fmt.Sprintf("the command %q", strings.Join(req.Path(), " ")))
+			break
+		}
+	}
+
+	var opts []string
+	for name := range req.Options() {
+		if ov := req.Option(name); ov != nil && IsExperimentalOption(ov.def) {
+			opts = append(opts, fmt.Sprintf("the option %q", name))
+		}
+	}
+	sort.Strings(opts)
+	return append(features, opts...)
+}
+
+// checkExperimental fails if req uses experimental features and they aren't
+// enabled, and warns on res about the features used otherwise.
+func checkExperimental(chain []*Command, req Request, res Response) error {
+	features := experimentalFeatures(chain, req)
+	if len(features) == 0 {
+		return nil
+	}
+
+	if !ExperimentalEnabled(req) {
+		return &Error{
+			Message: fmt.Sprintf("%s %s experimental", capitalize(strings.Join(features, ", ")), pluralIs(len(features))),
+			Code:    ErrClient,
+			Kind:    ErrKindExperimental,
+			Details: map[string]interface{}{"features": features},
+			Hints: []string{
+				fmt.Sprintf("enable experimental features with --%s, or by setting $%s=1", EnableExperimentalOpt, ExperimentalEnv),
+			},
+		}
+	}
+
+	for _, f := range features {
+		AddWarning(res, fmt.Sprintf("%s is experimental, it may change or be removed in a future version", capitalize(f)))
+	}
+	return nil
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func pluralIs(n int) string {
+	if n == 1 {
+		return "is"
+	}
+	return "are"
+}
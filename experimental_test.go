@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestExperimental(t *testing.T) {
+	defer os.Setenv(ExperimentalEnv, os.Getenv(ExperimentalEnv))
+	os.Setenv(ExperimentalEnv, "")
+
+	run := func(req Request, res Response) {
+		res.SetOutput("done")
+	}
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"new": {
+				Experimental: true,
+				Subcommands: map[string]*Command{
+					"sub": {Run: run, Type: ""},
+				},
+			},
+			"old": {
+				Options: []Option{ExperimentalOption(BoolOption("fast", "Go faster"))},
+				Run:     run,
+				Type:    "",
+			},
+		},
+	}
+
+	call := func(path []string, opts OptMap) Response {
+		optDefs, err := root.GetOptions(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := NewRequest(path, opts, nil, nil, root, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root.Call(req)
+	}
+
+	res := call([]string{"new", "sub"}, nil)
+	e := res.Error()
+	if e == nil || e.Kind != ErrKindExperimental || e.Code != ErrClient || len(e.Hints) != 1 {
+		t.Fatalf("Expected an experimental error, got %+v", e)
+	}
+	if e.Message != `The command "new sub" is experimental` {
+		t.Errorf("Unexpected message %q", e.Message)
+	}
+
+	if res := call([]string{"old"}, nil); res.Error() != nil {
+		t.Errorf("Expected the command to run without the experimental option, got %v", res.Error())
+	}
+	if res := call([]string{"old"}, OptMap{"fast": true}); res.Error() == nil || res.Error().Kind != ErrKindExperimental {
+		t.Errorf("Expected the experimental option to be rejected, got %v", res.Error())
+	}
+
+	res = call([]string{"old"}, OptMap{"fast": true, EnableExperimentalOpt: true})
+	if res.Error() != nil {
+		t.Fatal(res.Error())
+	}
+	if w := Warnings(res); len(w) != 1 || w[0] != `The option "fast" is experimental, it may change or be removed in a future version` {
+		t.Errorf("Expected a warning about the experimental option, got %q", w)
+	}
+
+	os.Setenv(ExperimentalEnv, "1")
+	if res := call([]string{"new", "sub"}, nil); res.Error() != nil || len(Warnings(res)) != 1 {
+		t.Errorf("Expected the environment to enable experimental commands, got %v %q", res.Error(), Warnings(res))
+	}
+}
+
+// userOption is an Option that isn't made by this package.
+type userOption struct{}
+
+func (userOption) Names() []string     { return []string{"user"} }
+func (userOption) Type() reflect.Kind  { return String }
+func (userOption) Description() string { return "An option of the user" }
+
+func TestExperimentalOption(t *testing.T) {
+	opt := ExperimentalOption(userOption{})
+	if !IsExperimentalOption(opt) || opt.Names()[0] != "user" {
+		t.Error("Expected options of any type to be made experimental")
+	}
+
+	secret := ExperimentalOption(SecretOption("token", "The API token"))
+	if !IsExperimentalOption(secret) || !IsSecretOption(secret) || IsPathOption(secret) {
+		t.Error("Expected the experimental option to keep being secret")
+	}
+	if IsExperimentalOption(SecretOption("token", "The API token")) {
+		t.Error("Expected options not to be experimental by default")
+	}
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// FeaturesEnv is the environment variable listing the enabled feature flags,
+// separated by commas.
+const FeaturesEnv = "CMDS_FEATURES"
+
+var (
+	enabledFeatures     = map[string]bool{}
+	enabledFeaturesLock sync.RWMutex
+)
+
+// EnableFeatures enables feature flags in addition to the ones listed in the
+// FeaturesEnv environment variable, e.g. from the embedder's config.
+func EnableFeatures(flags ...string) {
+	enabledFeaturesLock.Lock()
+	defer enabledFeaturesLock.Unlock()
+
+	for _, flag := range flags {
+		enabledFeatures[flag] = true
+	}
+}
+
+// FeatureEnabled returns true if the feature flag was enabled, either with
+// EnableFeatures or in the environment.
+func FeatureEnabled(flag string) bool {
+	enabledFeaturesLock.RLock()
+	enabled := enabledFeatures[flag]
+	enabledFeaturesLock.RUnlock()
+	if enabled {
+		return true
+	}
+
+	for _, f := range strings.Split(os.Getenv(FeaturesEnv), ",") {
+		if strings.TrimSpace(f) == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// EnabledWhen returns a Command.Enabled function that enables the command
+// when the feature flag is enabled, so commands can ship dark:
+//
+//	Enabled: cmds.EnabledWhen("experimental-pubsub"),
+func EnabledWhen(flag string) func() bool {
+	return func() bool {
+		return FeatureEnabled(flag)
+	}
+}
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	defer os.Setenv(FeaturesEnv, os.Getenv(FeaturesEnv))
+	defer func() {
+		enabledFeaturesLock.Lock()
+		enabledFeatures = map[string]bool{}
+		enabledFeaturesLock.Unlock()
+	}()
+
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"dark": {
+				Enabled: EnabledWhen("dark-cmd"),
+				Run:     noop,
+			},
+			"config": {
+				Enabled: EnabledWhen("config-cmd"),
+				Run:     noop,
+			},
+		},
+	}
+
+	os.Setenv(FeaturesEnv, "")
+	if _, err := root.Get([]string{"dark"}); err == nil {
+		t.Error("Expected disabled commands not to resolve")
+	}
+	if info := root.Export("root"); len(info.Subcommands) != 0 {
+		t.Error("Expected disabled commands not to be exported")
+	}
+
+	os.Setenv(FeaturesEnv, "other, dark-cmd")
+	if _, err := root.Get([]string{"dark"}); err != nil {
+		t.Error("Expected commands enabled in the environment to resolve")
+	}
+
+	EnableFeatures("config-cmd")
+	if _, err := root.Get([]string{"config"}); err != nil {
+		t.Error("Expected commands enabled with EnableFeatures to resolve")
+	}
+	if info := root.Export("root"); len(info.Subcommands) != 2 {
+		t.Errorf("Expected enabled commands to be exported, got %v", info.Subcommands)
+	}
+}
@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Verbose returns true if the --verbose option is set on the request. Commands
+// and marshalers include extra detail in the output of verbose requests.
+func Verbose(req Request) bool {
+	opt := req.Option(VerboseOpt)
+	if opt == nil {
+		return false
+	}
+	verbose, _, _ := opt.Bool()
+	return verbose
+}
+
+// Quiet returns true if the --quiet option is set on the request. Commands
+// and marshalers leave out the output that isn't essential, like progress
+// and summaries, for quiet requests.
+func Quiet(req Request) bool {
+	opt := req.Option(QuietOpt)
+	if opt == nil {
+		return false
+	}
+	quiet, _, _ := opt.Bool()
+	return quiet
+}
+
+// VisibleFields returns the exported fields of the struct type t which should
+// be shown to the caller of req. Fields tagged with `cmds:"verbose"` belong
+// to the detailed view, and are only visible with the --verbose option.
+func VisibleFields(req Request, t reflect.Type) []reflect.StructField {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	verbose := Verbose(req)
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		if !verbose && hasTagFlag(field, "verbose") {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// MarshalFields is a Text Marshaler for commands with struct output (or slices
+// or channels of structs). Each value is written as one "Name: value" line per
+// visible field (see VisibleFields), with values separated by empty lines.
+func MarshalFields(res Response) (io.Reader, error) {
+	req := res.Request()
+
+	if ch, ok := res.Output().(<-chan interface{}); ok {
+		first := true
+		return &ChannelMarshaler{
+			Channel: ch,
+			Marshaler: func(v interface{}) (io.Reader, error) {
+				buf := new(bytes.Buffer)
+				if !first {
+					buf.WriteString("\n")
+				}
+				first = false
+
+				writeFields(buf, req, reflect.ValueOf(v))
+				return buf, nil
+			},
+			Res: res,
+		}, nil
+	}
+
+	buf := new(bytes.Buffer)
+	v := reflect.ValueOf(res.Output())
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			writeFields(buf, req, v.Index(i))
+		}
+		return buf, nil
+	}
+
+	writeFields(buf, req, v)
+	return buf, nil
+}
+
+func writeFields(w io.Writer, req Request, v reflect.Value) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		fmt.Fprintf(w, "%v\n", v.Interface())
+		return
+	}
+
+	for _, field := range VisibleFields(req, v.Type()) {
+		fmt.Fprintf(w, "%s: %v\n", field.Name, v.FieldByIndex(field.Index).Interface())
+	}
+}
@@ -31,6 +31,12 @@ type File interface {
 	// NextFile returns the next child file available (if the File is a directory).
 	// It will return (nil, io.EOF) if no more files are available.
 	// If the file is a regular file (not a directory), NextFile will return a non-nil error.
+	//
+	// Directories read from the filesystem return their children in
+	// lexicographic order of name. SliceFiles return them in the order they
+	// were given in (use NewSortedSliceFile to sort them), and MultipartFiles
+	// in the order they were encoded, which is the order of the File that was
+	// sent.
 	NextFile() (File, error)
 }
 
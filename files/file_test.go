@@ -1,11 +1,16 @@
 package files
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"os"
+	fp "path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestSliceFiles(t *testing.T) {
@@ -192,3 +197,350 @@ bloop
 		t.Error("Expected NextFile to return (nil, EOF)")
 	}
 }
+
+func fileNames(t *testing.T, dir File) []string {
+	var names []string
+	for {
+		file, err := dir.NextFile()
+		if err == io.EOF {
+			return names
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, file.FileName())
+		if file.IsDirectory() {
+			names = append(names, fileNames(t, file)...)
+		}
+	}
+}
+
+func TestSerialFileOrder(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "files-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, p := range []string{"c/y", "b", "c/x", "a", "B"} {
+		p = fp.Join(tmp, p)
+		if err := os.MkdirAll(fp.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stat, err := os.Stat(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := NewSerialFile("dir", tmp, stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := strings.Join(fileNames(t, sf), " ")
+	expected := "dir/B dir/a dir/b dir/c dir/c/x dir/c/y"
+	if names != expected {
+		t.Errorf("Expected files in order %q, got %q", expected, names)
+	}
+}
+
+func TestSortedSliceFile(t *testing.T) {
+	files := []File{
+		NewReaderFile("dir/b", "dir/b", ioutil.NopCloser(strings.NewReader("b")), nil),
+		NewReaderFile("dir/a", "dir/a", ioutil.NopCloser(strings.NewReader("a")), nil),
+		NewSliceFile("dir/c", "dir/c", nil),
+	}
+
+	sf := NewSortedSliceFile("dir", "dir", files)
+
+	names := strings.Join(fileNames(t, sf), " ")
+	if names != "dir/a dir/b dir/c" {
+		t.Errorf("Expected files in lexicographic order, got %q", names)
+	}
+	if files[0].FileName() != "dir/b" {
+		t.Error("Expected the given slice not to be modified")
+	}
+}
+
+func TestWalkLimits(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "files-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, p := range []string{"a", "b", "c/d/e"} {
+		p = fp.Join(tmp, p)
+		if err := os.MkdirAll(fp.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte("1234"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stat, err := os.Stat(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(opts WalkOptions) error {
+		sf, err := NewSerialFileWithOptions("dir", tmp, stat, opts)
+		if err != nil {
+			return err
+		}
+		var walkDir func(dir File) error
+		walkDir = func(dir File) error {
+			for {
+				file, err := dir.NextFile()
+				if err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				if file.IsDirectory() {
+					if err := walkDir(file); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return walkDir(sf)
+	}
+
+	cases := []struct {
+		opts  WalkOptions
+		limit string
+	}{
+		{WalkOptions{}, ""},
+		{WalkOptions{MaxDepth: 3, MaxEntries: 5, MaxBytes: 12}, ""},
+		{WalkOptions{MaxDepth: 2}, "depth"},
+		{WalkOptions{MaxEntries: 4}, "entries"},
+		{WalkOptions{MaxBytes: 11}, "bytes"},
+	}
+	for _, tc := range cases {
+		err := walk(tc.opts)
+		if tc.limit == "" {
+			if err != nil {
+				t.Errorf("%+v: unexpected error: %s", tc.opts, err)
+			}
+			continue
+		}
+
+		lerr, ok := err.(*LimitError)
+		if !ok {
+			t.Errorf("%+v: expected a LimitError, got %v", tc.opts, err)
+			continue
+		}
+		if lerr.Limit != tc.limit {
+			t.Errorf("%+v: expected %s limit to be exceeded, got %s", tc.opts, tc.limit, lerr.Limit)
+		}
+	}
+}
+
+func TestDataRegions(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "files-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// 1MiB hole followed by some data
+	size := int64(1<<20 + 4)
+	if _, err := tmp.WriteAt([]byte("data"), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+
+	stat, err := os.Stat(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rf := NewReaderFile("file", "file", ioutil.NopCloser(strings.NewReader("")), stat)
+	regions, err := rf.DataRegions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 1 || regions[0] != (Region{0, size}) {
+		t.Errorf("Expected a single region for a non-file reader, got %v", regions)
+	}
+
+	sf, err := NewSerialFile("file", tmp.Name(), stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+
+	regions, err = sf.(SparseFile).DataRegions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// filesystems may not support holes, but the data must be covered
+	if len(regions) == 0 {
+		t.Fatal("Expected at least one data region")
+	}
+	last := regions[len(regions)-1]
+	if last.Offset > 1<<20 || last.Offset+last.Length != size {
+		t.Errorf("Expected the last region to cover the data, got %v", regions)
+	}
+
+	// the read offset is unchanged
+	buf, err := ioutil.ReadAll(sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(buf)) != size {
+		t.Errorf("Expected to read %d bytes, got %d", size, len(buf))
+	}
+}
+
+func TestUnorderedWalk(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "files-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	expected := map[string]bool{"dir/sub": true}
+	for i := 0; i < readdirBatch+10; i++ {
+		name := fmt.Sprintf("f%d", i)
+		if err := ioutil.WriteFile(fp.Join(tmp, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		expected["dir/"+name] = true
+	}
+	if err := os.Mkdir(fp.Join(tmp, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fp.Join(tmp, "sub", "x"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected["dir/sub/x"] = true
+
+	stat, err := os.Stat(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := NewSerialFileWithOptions("dir", tmp, stat, WalkOptions{Unordered: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := fileNames(t, sf)
+	if len(names) != len(expected) {
+		t.Errorf("Expected %d files, got %d", len(expected), len(names))
+	}
+	for _, name := range names {
+		if !expected[name] {
+			t.Errorf("Unexpected file %q", name)
+		}
+		delete(expected, name)
+	}
+	if err := sf.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteToSymlinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "writeto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := fp.Join(tmp, "src")
+	if err := os.MkdirAll(fp.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fp.Join(src, "sub", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub/a.txt", fp.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing", fp.Join(src, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := NewSerialFile("src", src, stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := fp.Join(tmp, "dst")
+	if err := WriteTo(sf, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{"link": "sub/a.txt", "dangling": "missing"} {
+		target, err := os.Readlink(fp.Join(dst, name))
+		if err != nil || target != expected {
+			t.Errorf("Expected %s to link to %q, got %q (%v)", name, expected, target, err)
+		}
+	}
+	if b, err := ioutil.ReadFile(fp.Join(dst, "sub", "a.txt")); err != nil || string(b) != "a" {
+		t.Errorf("Expected the file content to be written, got %q (%v)", b, err)
+	}
+
+	if err := WriteTo(NewLinkFile("link", "link", "x", nil), fp.Join(dst, "link")); err == nil {
+		t.Error("Expected existing files not to be overwritten")
+	}
+}
+
+func TestWriteToMetadata(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "writeto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := fp.Join(tmp, "src")
+	if err := os.Mkdir(src, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fp.Join(src, "a.txt"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, p := range []string{fp.Join(src, "a.txt"), src} {
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stat, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := NewSerialFile("src", src, stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := fp.Join(tmp, "dst")
+	if err := WriteTo(sf, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, mode := range map[string]os.FileMode{dst: 0750, fp.Join(dst, "a.txt"): 0600} {
+		stat, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && stat.Mode().Perm() != mode {
+			t.Errorf("Expected %s to have mode %o, got %o", p, mode, stat.Mode().Perm())
+		}
+		if !stat.ModTime().Equal(mtime) {
+			t.Errorf("Expected %s to be modified at %s, got %s", p, mtime, stat.ModTime())
+		}
+	}
+}
@@ -6,11 +6,15 @@ import (
 	"strings"
 )
 
+// Symlink is a symbolic link. Links aren't followed: the File has no content
+// of its own, and reads as its Target (which is how it's encoded in multipart
+// data). WriteTo creates it as a link again.
 type Symlink struct {
 	name   string
 	path   string
 	Target string
 	stat   os.FileInfo
+	meta   Metadata
 
 	reader io.Reader
 }
@@ -45,6 +49,18 @@ func (f *Symlink) FullPath() string {
 	return f.path
 }
 
+// Stat returns the stat of the link itself (not its target), or nil for
+// received symlinks.
+func (f *Symlink) Stat() os.FileInfo {
+	return f.stat
+}
+
+// Metadata returns the metadata a received symlink was sent with, or nil
+// for symlinks read from the filesystem.
+func (f *Symlink) Metadata() Metadata {
+	return f.meta
+}
+
 func (f *Symlink) Read(b []byte) (int, error) {
 	return f.reader.Read(b)
 }
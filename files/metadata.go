@@ -0,0 +1,144 @@
+package files
+
+import (
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metadata holds the metadata of a file, like its mode and modification time,
+// which is sent along with the file in multipart encoded data. Keys are
+// lower case.
+type Metadata map[string]string
+
+// Metadata keys set for files read from the filesystem.
+const (
+	MetaMode   = "mode"   // the permission bits, in octal (e.g. "0644")
+	MetaMtime  = "mtime"  // the modification time, in RFC 3339 format
+	MetaTarget = "target" // the target of a symlink
+)
+
+// metaHeaderPrefix prefixes the keys of metadata headers in multipart parts,
+// e.g. "File-Meta-Mode: 0644". Values are query escaped.
+const metaHeaderPrefix = "File-Meta-"
+
+// MetaFile is a File with metadata of its own (e.g. a MultipartFile).
+type MetaFile interface {
+	File
+
+	Metadata() Metadata
+}
+
+// MetadataProvider adds the metadata of f to m, e.g. the domain metadata of an
+// embedding application.
+type MetadataProvider func(f File, m Metadata)
+
+var providers struct {
+	sync.RWMutex
+	list []MetadataProvider
+}
+
+// RegisterMetadataProvider adds p to the providers of the metadata of the
+// files that are sent (see FileMetadata).
+func RegisterMetadataProvider(p MetadataProvider) {
+	providers.Lock()
+	defer providers.Unlock()
+	providers.list = append(providers.list, p)
+}
+
+// FileMetadata returns the metadata of f. The mode and modification time are
+// set from the stat of StatFiles (and Symlinks), then the registered
+// providers add theirs, in the order they were registered. The metadata of
+// MetaFiles is used as is, so received files keep what they were sent with.
+func FileMetadata(f File) Metadata {
+	if mf, ok := f.(MetaFile); ok {
+		if m := mf.Metadata(); m != nil {
+			return m
+		}
+	}
+
+	m := Metadata{}
+	switch f := f.(type) {
+	case *Symlink:
+		m[MetaTarget] = f.Target
+		if f.stat != nil {
+			m[MetaMtime] = f.stat.ModTime().UTC().Format(time.RFC3339Nano)
+		}
+	case StatFile:
+		if stat := f.Stat(); stat != nil {
+			m[MetaMode] = "0" + strconv.FormatUint(uint64(stat.Mode().Perm()), 8)
+			m[MetaMtime] = stat.ModTime().UTC().Format(time.RFC3339Nano)
+		}
+	}
+
+	providers.RLock()
+	defer providers.RUnlock()
+	for _, p := range providers.list {
+		p(f, m)
+	}
+	return m
+}
+
+// WriteHeader sets the metadata as headers of a multipart part. Values are
+// escaped, and keys that aren't valid in header names (see validMetaKey) are
+// skipped, so providers can't inject headers of their own.
+func (m Metadata) WriteHeader(h textproto.MIMEHeader) {
+	for k, v := range m {
+		if validMetaKey(k) {
+			h.Set(metaHeaderPrefix+k, url.QueryEscape(v))
+		}
+	}
+}
+
+// validMetaKey returns true if k is a token (RFC 7230), like header names.
+func validMetaKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		c := k[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// MetadataFromHeader returns the metadata in the headers of a multipart part,
+// or nil if there is none.
+func MetadataFromHeader(h textproto.MIMEHeader) Metadata {
+	var m Metadata
+	for k, vs := range h {
+		if !strings.HasPrefix(k, metaHeaderPrefix) || len(vs) == 0 {
+			continue
+		}
+
+		v, err := url.QueryUnescape(vs[0])
+		if err != nil {
+			v = vs[0]
+		}
+		if m == nil {
+			m = Metadata{}
+		}
+		m[strings.ToLower(k[len(metaHeaderPrefix):])] = v
+	}
+	return m
+}
+
+// Mode returns the permission bits in the metadata, if they are set.
+func (m Metadata) Mode() (uint32, bool) {
+	mode, err := strconv.ParseUint(m[MetaMode], 8, 32)
+	return uint32(mode), err == nil
+}
+
+// ModTime returns the modification time in the metadata, if it's set.
+func (m Metadata) ModTime() (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339Nano, m[MetaMtime])
+	return t, err == nil
+}
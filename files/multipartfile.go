@@ -1,18 +1,21 @@
 package files
 
 import (
+	"io"
 	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 const (
 	multipartFormdataType = "multipart/form-data"
 	multipartMixedType    = "multipart/mixed"
 
-	applicationSymlink = "application/symlink"
+	applicationSymlink   = "application/symlink"
+	applicationDirectory = "application/x-directory"
 
 	contentTypeHeader = "Content-Type"
 )
@@ -42,9 +45,18 @@ func NewFileFromPart(part *multipart.Part) (File, error) {
 		return &Symlink{
 			Target: string(out),
 			name:   f.FileName(),
+			path:   f.FileName(),
+			meta:   MetadataFromHeader(part.Header),
+			reader: strings.NewReader(string(out)),
 		}, nil
 	}
 
+	if contentType == applicationDirectory {
+		// marker for an empty directory
+		f.Mediatype = applicationDirectory
+		return f, nil
+	}
+
 	var params map[string]string
 	var err error
 	f.Mediatype, params, err = mime.ParseMediaType(contentType)
@@ -65,13 +77,18 @@ func NewFileFromPart(part *multipart.Part) (File, error) {
 }
 
 func (f *MultipartFile) IsDirectory() bool {
-	return f.Mediatype == multipartFormdataType || f.Mediatype == multipartMixedType
+	return f.Mediatype == multipartFormdataType || f.Mediatype == multipartMixedType ||
+		f.Mediatype == applicationDirectory
 }
 
 func (f *MultipartFile) NextFile() (File, error) {
 	if !f.IsDirectory() {
 		return nil, ErrNotDirectory
 	}
+	if f.Reader == nil {
+		// empty directories have no entries
+		return nil, io.EOF
+	}
 
 	part, err := f.Reader.NextPart()
 	if err != nil {
@@ -94,6 +111,14 @@ func (f *MultipartFile) FileName() string {
 	return filename
 }
 
+// Metadata returns the metadata the file was sent with.
+func (f *MultipartFile) Metadata() Metadata {
+	if f.Part == nil {
+		return nil
+	}
+	return MetadataFromHeader(f.Part.Header)
+}
+
 func (f *MultipartFile) FullPath() string {
 	return f.FileName()
 }
@@ -3,24 +3,86 @@ package files
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	fp "path/filepath"
+	"sort"
 	"syscall"
 )
 
 // serialFile implements File, and reads from a path on the OS filesystem.
 // No more than one file will be opened at a time (directories will advance
-// to the next file when NextFile() is called).
+// to the next file when NextFile() is called). Children are returned in
+// lexicographic order of name, unless the walk is unordered.
+//
+// Children are stat'ed lazily: ordered directories only read the names of
+// their children up front, unordered ones read their entries in batches while
+// they are iterated, keeping the directory open until they are exhausted or
+// closed.
 type serialFile struct {
 	name    string
 	path    string
-	files   []os.FileInfo
+	names   []string
+	dir     *os.File
+	batch   []os.FileInfo
 	stat    os.FileInfo
 	current *File
+	depth   int
+	walk    *walkState
+}
+
+// readdirBatch is the number of entries unordered directories read at once
+const readdirBatch = 1024
+
+// WalkOptions limits how much of a directory tree is walked. Zero values
+// mean no limit.
+type WalkOptions struct {
+	// MaxDepth is the deepest level of nested entries, the children of the
+	// root directory being at depth 1.
+	MaxDepth int
+	// MaxEntries is the total number of entries in the tree.
+	MaxEntries int
+	// MaxBytes is the total size of the regular files in the tree.
+	MaxBytes int64
+
+	// Unordered returns children in the order the filesystem lists them,
+	// instead of sorting them by name. This lets huge directories start
+	// streaming immediately, with memory bounded by a batch of entries.
+	Unordered bool
+}
+
+// LimitError is returned by NextFile when walking a directory would exceed
+// one of its WalkOptions.
+type LimitError struct {
+	// Limit is the name of the exceeded limit: "depth", "entries" or "bytes".
+	Limit string
+	Max   int64
+	Path  string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: exceeded maximum %s of %d", e.Path, e.Limit, e.Max)
+}
+
+// walkState is shared by the directories of one tree, to count against
+// their limits.
+type walkState struct {
+	opts    WalkOptions
+	entries int
+	bytes   int64
 }
 
 func NewSerialFile(name, path string, stat os.FileInfo) (File, error) {
+	return newSerialFile(name, path, stat, &walkState{}, 0)
+}
+
+// NewSerialFileWithOptions is like NewSerialFile, but walks the tree as
+// configured by opts, returning a LimitError from NextFile if the tree
+// exceeds its limits.
+func NewSerialFileWithOptions(name, path string, stat os.FileInfo, opts WalkOptions) (File, error) {
+	return newSerialFile(name, path, stat, &walkState{opts: opts}, 0)
+}
+
+func newSerialFile(name, path string, stat os.FileInfo, walk *walkState, depth int) (File, error) {
 	switch mode := stat.Mode(); {
 	case mode.IsRegular():
 		file, err := os.Open(path)
@@ -29,13 +91,32 @@ func NewSerialFile(name, path string, stat os.FileInfo) (File, error) {
 		}
 		return NewReaderFile(name, path, file, stat), nil
 	case mode.IsDir():
-		// for directories, stat all of the contents first, so we know what files to
-		// open when NextFile() is called
-		contents, err := ioutil.ReadDir(path)
+		dir, err := os.Open(path)
 		if err != nil {
 			return nil, err
 		}
-		return &serialFile{name, path, contents, stat, nil}, nil
+
+		sf := &serialFile{
+			name:  name,
+			path:  path,
+			stat:  stat,
+			depth: depth,
+			walk:  walk,
+		}
+		if walk.opts.Unordered {
+			sf.dir = dir
+			return sf, nil
+		}
+
+		// for ordered directories, read all of the names first, so we know what
+		// files to open when NextFile() is called
+		sf.names, err = dir.Readdirnames(-1)
+		dir.Close()
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(sf.names)
+		return sf, nil
 	case mode&os.ModeSymlink != 0:
 		target, err := os.Readlink(path)
 		if err != nil {
@@ -55,27 +136,30 @@ func (f *serialFile) IsDirectory() bool {
 
 func (f *serialFile) NextFile() (File, error) {
 	// if a file was opened previously, close it
-	err := f.Close()
+	err := f.closeCurrent()
 	if err != nil {
 		return nil, err
 	}
 
 	// if there aren't any files left in the root directory, we're done
-	if len(f.files) == 0 {
-		return nil, io.EOF
+	stat, err := f.nextStat()
+	if err != nil {
+		return nil, err
 	}
 
-	stat := f.files[0]
-	f.files = f.files[1:]
-
 	// open the next file
 	fileName := fp.Join(f.name, stat.Name())
 	filePath := fp.Join(f.path, stat.Name())
 
+	err = f.walk.add(filePath, stat, f.depth+1)
+	if err != nil {
+		return nil, err
+	}
+
 	// recursively call the constructor on the next file
 	// if it's a regular file, we will open it as a ReaderFile
 	// if it's a directory, files in it will be opened serially
-	sf, err := NewSerialFile(fileName, filePath, stat)
+	sf, err := newSerialFile(fileName, filePath, stat, f.walk, f.depth+1)
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +169,34 @@ func (f *serialFile) NextFile() (File, error) {
 	return sf, nil
 }
 
+// nextStat returns the stat of the next child, or io.EOF if there are none.
+func (f *serialFile) nextStat() (os.FileInfo, error) {
+	if f.dir != nil && len(f.batch) == 0 {
+		batch, err := f.dir.Readdir(readdirBatch)
+		if err == io.EOF {
+			f.dir.Close()
+			f.dir = nil
+		} else if err != nil {
+			return nil, err
+		}
+		f.batch = batch
+	}
+
+	if len(f.batch) > 0 {
+		stat := f.batch[0]
+		f.batch = f.batch[1:]
+		return stat, nil
+	}
+
+	if len(f.names) == 0 {
+		return nil, io.EOF
+	}
+
+	name := f.names[0]
+	f.names = f.names[1:]
+	return os.Lstat(fp.Join(f.path, name))
+}
+
 func (f *serialFile) FileName() string {
 	return f.name
 }
@@ -98,6 +210,20 @@ func (f *serialFile) Read(p []byte) (int, error) {
 }
 
 func (f *serialFile) Close() error {
+	err := f.closeCurrent()
+	if err != nil {
+		return err
+	}
+
+	// close the directory if it is still being read
+	if f.dir != nil {
+		err = f.dir.Close()
+		f.dir = nil
+	}
+	return err
+}
+
+func (f *serialFile) closeCurrent() error {
 	// close the current file if there is one
 	if f.current != nil {
 		err := (*f.current).Close()
@@ -105,6 +231,7 @@ func (f *serialFile) Close() error {
 		if err != nil && err != syscall.EINVAL {
 			return err
 		}
+		f.current = nil
 	}
 
 	return nil
@@ -119,12 +246,33 @@ func (f *serialFile) Size() (int64, error) {
 		return f.stat.Size(), nil
 	}
 
+	// only regular files have contents that are read, so only they count
 	var du int64
-	err := fp.Walk(f.FileName(), func(p string, fi os.FileInfo, err error) error {
-		if fi != nil && fi.Mode()&(os.ModeSymlink|os.ModeNamedPipe) == 0 {
+	err := fp.Walk(f.path, func(p string, fi os.FileInfo, err error) error {
+		if fi != nil && fi.Mode().IsRegular() {
 			du += fi.Size()
 		}
 		return nil
 	})
 	return du, err
 }
+
+// add counts an entry at the given depth against the limits of the walk.
+func (w *walkState) add(path string, stat os.FileInfo, depth int) error {
+	if w.opts.MaxDepth > 0 && depth > w.opts.MaxDepth {
+		return &LimitError{Limit: "depth", Max: int64(w.opts.MaxDepth), Path: path}
+	}
+
+	w.entries++
+	if w.opts.MaxEntries > 0 && w.entries > w.opts.MaxEntries {
+		return &LimitError{Limit: "entries", Max: int64(w.opts.MaxEntries), Path: path}
+	}
+
+	if stat.Mode().IsRegular() {
+		w.bytes += stat.Size()
+		if w.opts.MaxBytes > 0 && w.bytes > w.opts.MaxBytes {
+			return &LimitError{Limit: "bytes", Max: w.opts.MaxBytes, Path: path}
+		}
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package files
 import (
 	"errors"
 	"io"
+	fp "path/filepath"
+	"sort"
 )
 
 // SliceFile implements File, and provides simple directory handling.
@@ -19,6 +21,16 @@ func NewSliceFile(filename, path string, files []File) *SliceFile {
 	return &SliceFile{filename, path, files, 0}
 }
 
+// NewSortedSliceFile returns a SliceFile whose children are returned in
+// lexicographic order of name, like the children of a directory read from
+// the filesystem. The files slice is not modified.
+func NewSortedSliceFile(filename, path string, files []File) *SliceFile {
+	sorted := make([]File, len(files))
+	copy(sorted, files)
+	sort.Stable(byFileName(sorted))
+	return NewSliceFile(filename, path, sorted)
+}
+
 func (f *SliceFile) IsDirectory() bool {
 	return true
 }
@@ -74,3 +86,10 @@ func (f *SliceFile) Size() (int64, error) {
 
 	return size, nil
 }
+
+// byFileName sorts files by the last element of their FileName.
+type byFileName []File
+
+func (s byFileName) Len() int           { return len(s) }
+func (s byFileName) Less(i, j int) bool { return fp.Base(s[i].FileName()) < fp.Base(s[j].FileName()) }
+func (s byFileName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,42 @@
+package files
+
+import (
+	"os"
+)
+
+// Region is a range of bytes in a file.
+type Region struct {
+	Offset int64
+	Length int64
+}
+
+// SparseFile is implemented by files that can tell which regions of their
+// contents hold data. The bytes outside of these regions (holes) read as
+// zeros, so transports can skip them instead of reading them.
+type SparseFile interface {
+	File
+
+	// DataRegions returns the regions holding data, in order. Files on
+	// platforms or filesystems without support for holes return a single
+	// region covering the whole file.
+	DataRegions() ([]Region, error)
+}
+
+func (f *ReaderFile) DataRegions() ([]Region, error) {
+	size, err := f.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	if file, ok := f.reader.(*os.File); ok {
+		return dataRegions(file, size)
+	}
+	return wholeRegion(size), nil
+}
+
+func wholeRegion(size int64) []Region {
+	if size == 0 {
+		return nil
+	}
+	return []Region{{0, size}}
+}
@@ -0,0 +1,53 @@
+//go:build linux
+// +build linux
+
+package files
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// lseek whence values for finding data and holes, see lseek(2)
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+func dataRegions(f *os.File, size int64) ([]Region, error) {
+	fd := int(f.Fd())
+
+	// seeking for data and holes moves the offset, restore it when done
+	cur, err := syscall.Seek(fd, 0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Seek(fd, cur, io.SeekStart)
+
+	var regions []Region
+	for off := int64(0); off < size; {
+		data, err := syscall.Seek(fd, off, seekData)
+		if err == syscall.ENXIO {
+			// no more data after off
+			break
+		} else if err == syscall.EINVAL {
+			// the filesystem doesn't support finding holes
+			return wholeRegion(size), nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		hole, err := syscall.Seek(fd, data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		if hole > size {
+			hole = size
+		}
+
+		regions = append(regions, Region{data, hole - data})
+		off = hole
+	}
+	return regions, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package files
+
+import (
+	"os"
+)
+
+func dataRegions(f *os.File, size int64) ([]Region, error) {
+	return wholeRegion(size), nil
+}
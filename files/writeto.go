@@ -0,0 +1,76 @@
+package files
+
+import (
+	"fmt"
+	"io"
+	"os"
+	fp "path/filepath"
+)
+
+// WriteTo writes f to the filesystem at path: regular files with their
+// content, directories with all of their entries, and Symlinks as links to
+// their target (which isn't followed or checked). Entries are named by the
+// last element of their FileName. Existing files are never overwritten. The
+// mode and modification time in the metadata of files and directories (see
+// FileMetadata) are applied once they are written.
+func WriteTo(f File, path string) error {
+	if s, ok := f.(*Symlink); ok {
+		return os.Symlink(s.Target, path)
+	}
+
+	if !f.IsDirectory() {
+		out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, f); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		return applyMetadata(f, path)
+	}
+
+	if err := os.Mkdir(path, 0777); err != nil {
+		return err
+	}
+	for {
+		child, err := f.NextFile()
+		if err == io.EOF {
+			// after the entries, which change the modification time
+			return applyMetadata(f, path)
+		}
+		if err != nil {
+			return err
+		}
+
+		// only use the last element, so entries can't be written outside of path
+		name := fp.Base(fp.FromSlash(child.FileName()))
+		if name == "." || name == ".." || name == string(fp.Separator) {
+			return fmt.Errorf("Invalid file name '%s'", child.FileName())
+		}
+
+		if err := WriteTo(child, fp.Join(path, name)); err != nil {
+			return err
+		}
+	}
+}
+
+// applyMetadata sets the mode and modification time of the file at path from
+// the metadata of f, if it has them.
+func applyMetadata(f File, path string) error {
+	meta := FileMetadata(f)
+	if mode, ok := meta.Mode(); ok {
+		if err := os.Chmod(path, os.FileMode(mode).Perm()); err != nil {
+			return err
+		}
+	}
+	if mtime, ok := meta.ModTime(); ok {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
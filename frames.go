@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"golang.org/x/net/context"
+)
+
+// FrameType tags the values of a command's output stream, so a single stream
+// can carry the primary output interleaved with diagnostics and progress.
+type FrameType string
+
+const (
+	FrameValue FrameType = "value" // primary output values
+	FrameLog   FrameType = "log"   // log and diagnostic lines
+	FrameEvent FrameType = "event" // progress events
+
+	// FrameProgress frames carry Progress values
+	FrameProgress FrameType = "progress"
+
+	// FrameWarning frames carry structured warnings, like DeadlineWarning
+	FrameWarning FrameType = "warning"
+
+	// FrameItemError frames carry the ItemErrors of a Batch
+	FrameItemError FrameType = "item-error"
+)
+
+// Frame is a tagged value of a channel output. Commands send Frames on their
+// output channel to interleave log lines and events with their output; plain
+// values are treated as FrameValue frames.
+type Frame struct {
+	Type  FrameType
+	Value interface{}
+}
+
+// LogFrame returns a FrameLog frame for v.
+func LogFrame(v interface{}) Frame {
+	return Frame{Type: FrameLog, Value: v}
+}
+
+// EventFrame returns a FrameEvent frame for v.
+func EventFrame(v interface{}) Frame {
+	return Frame{Type: FrameEvent, Value: v}
+}
+
+// Progress is a progress update of a command. Total is zero if it isn't
+// known.
+type Progress struct {
+	Current int64
+	Total   int64  `json:",omitempty"`
+	Unit    string `json:",omitempty"` // e.g. "bytes"
+	Message string `json:",omitempty"`
+}
+
+// ProgressFrame returns a FrameProgress frame for p. The CLI renders them as
+// a progress bar, and the HTTP client decodes them as Progress values.
+func ProgressFrame(p Progress) Frame {
+	return Frame{Type: FrameProgress, Value: p}
+}
+
+// FrameHandler receives the values of the log and event frames of an output
+// stream.
+type FrameHandler func(t FrameType, v interface{})
+
+// FrameHandlerKey is the key of a request's FrameHandler. The HTTP client
+// only asks the server for log and event frames if the request has one.
+var FrameHandlerKey = NewKey("cmds.frameHandler", FrameHandler(nil))
+
+// KeepFramesKey makes Command.Call leave the frames in the channel output of
+// a request, for servers that send them on to their clients. Otherwise Call
+// passes the values of the frames to the request's FrameHandler, so the
+// marshalers only see the primary output values, like those of HTTP clients.
+var KeepFramesKey = NewKey("cmds.keepFrames", false)
+
+// demuxFrames replaces a channel output of res with its primary values,
+// unless the request has KeepFramesKey.
+func demuxFrames(req Request, res Response) {
+	if keep, _ := KeepFramesKey.Get(req).(bool); keep {
+		return
+	}
+
+	var in <-chan interface{}
+	switch ch := res.Output().(type) {
+	case <-chan interface{}:
+		in = ch
+	case chan interface{}:
+		in = ch
+	default:
+		return
+	}
+	h, _ := FrameHandlerKey.Get(req).(FrameHandler)
+	res.SetOutput(PrimaryValues(req.Context(), in, h))
+}
+
+// PrimaryValues demultiplexes a channel output. It returns a channel of the
+// primary output values, and calls h (if it is not nil) with the values of the
+// other frames, in the order they arrive.
+func PrimaryValues(ctx context.Context, in <-chan interface{}, h FrameHandler) <-chan interface{} {
+	return mapFrames(ctx, in, func(v interface{}) (interface{}, bool) {
+		f, ok := v.(Frame)
+		if !ok {
+			return v, true
+		}
+		if f.Type == FrameValue {
+			return f.Value, true
+		}
+
+		if h != nil {
+			h(f.Type, f.Value)
+		}
+		return nil, false
+	})
+}
+
+// FramedChannel returns a channel of the values of in as Frames, wrapping
+// plain values in FrameValue frames.
+func FramedChannel(ctx context.Context, in <-chan interface{}) <-chan interface{} {
+	return mapFrames(ctx, in, func(v interface{}) (interface{}, bool) {
+		if f, ok := v.(Frame); ok {
+			return f, true
+		}
+		return Frame{Type: FrameValue, Value: v}, true
+	})
+}
+
+// mapFrames passes the values of in through fn, sending those it keeps on the
+// returned channel until in is closed or ctx is done.
+func mapFrames(ctx context.Context, in <-chan interface{}, fn func(interface{}) (interface{}, bool)) <-chan interface{} {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		for v := range in {
+			v, ok := fn(v)
+			if !ok {
+				continue
+			}
+
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
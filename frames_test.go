@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestFrames(t *testing.T) {
+	newInput := func() <-chan interface{} {
+		ch := make(chan interface{}, 4)
+		ch <- "a"
+		ch <- LogFrame("working")
+		ch <- Frame{Type: FrameValue, Value: "b"}
+		ch <- EventFrame(50)
+		close(ch)
+		return ch
+	}
+
+	var handled []interface{}
+	var values []interface{}
+	for v := range PrimaryValues(context.Background(), newInput(), func(ft FrameType, v interface{}) {
+		handled = append(handled, string(ft), v)
+	}) {
+		values = append(values, v)
+	}
+	if len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Errorf("Expected primary values [a b], got %v", values)
+	}
+	if len(handled) != 4 || handled[0] != "log" || handled[1] != "working" || handled[2] != "event" || handled[3] != 50 {
+		t.Errorf("Expected the log and event frames to be handled, got %v", handled)
+	}
+
+	var frames []Frame
+	for v := range FramedChannel(context.Background(), newInput()) {
+		frames = append(frames, v.(Frame))
+	}
+	expected := []Frame{{FrameValue, "a"}, {FrameLog, "working"}, {FrameValue, "b"}, {FrameEvent, 50}}
+	if len(frames) != len(expected) {
+		t.Fatalf("Expected %d frames, got %v", len(expected), frames)
+	}
+	for i, f := range frames {
+		if f != expected[i] {
+			t.Errorf("Expected frame %v, got %v", expected[i], f)
+		}
+	}
+}
+
+func TestFramesMiddleware(t *testing.T) {
+	var seen []interface{}
+	cmd := &Command{
+		Middleware: []EmitterMiddleware{
+			func(req Request, next Emitter) Emitter {
+				return func(v interface{}) error {
+					seen = append(seen, v)
+					return next(v)
+				}
+			},
+		},
+		Run: func(req Request, res Response) {
+			ch := make(chan interface{}, 2)
+			ch <- LogFrame("log")
+			ch <- Frame{Type: FrameValue, Value: "v"}
+			close(ch)
+			res.SetOutput((<-chan interface{})(ch))
+		},
+	}
+
+	req, err := NewRequest(nil, nil, nil, nil, cmd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	KeepFramesKey.Set(req, true)
+	res := cmd.Call(req)
+
+	var out []interface{}
+	for v := range res.Output().(<-chan interface{}) {
+		out = append(out, v)
+	}
+	if len(out) != 2 || out[0] != LogFrame("log") || out[1] != "v" {
+		t.Errorf("Expected the log frame and the unwrapped value, got %v", out)
+	}
+	if len(seen) != 1 || seen[0] != "v" {
+		t.Errorf("Expected middleware to only see the value, got %v", seen)
+	}
+}
+
+func TestCallDemuxesFrames(t *testing.T) {
+	cmd := &Command{
+		Run: func(req Request, res Response) {
+			ch := make(chan interface{}, 4)
+			ch <- "a"
+			ch <- LogFrame("log")
+			ch <- ProgressFrame(Progress{Current: 1})
+			ch <- Frame{Type: FrameValue, Value: "b"}
+			close(ch)
+			res.SetOutput((<-chan interface{})(ch))
+		},
+	}
+
+	req, err := NewRequest(nil, nil, nil, nil, cmd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handled []FrameType
+	FrameHandlerKey.Set(req, func(t FrameType, v interface{}) {
+		handled = append(handled, t)
+	})
+	res := cmd.Call(req)
+
+	var out []interface{}
+	for v := range res.Output().(<-chan interface{}) {
+		out = append(out, v)
+	}
+	if len(out) != 2 || out[0] != "a" || out[1] != "b" {
+		t.Errorf("Expected only the primary values, got %v", out)
+	}
+	if len(handled) != 2 || handled[0] != FrameLog || handled[1] != FrameProgress {
+		t.Errorf("Expected the log and progress frames to be handled, got %v", handled)
+	}
+
+	// without a handler, the frames are dropped
+	req, err = NewRequest(nil, nil, nil, nil, cmd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = nil
+	for v := range cmd.Call(req).Output().(<-chan interface{}) {
+		out = append(out, v)
+	}
+	if len(out) != 2 {
+		t.Errorf("Expected only the primary values, got %v", out)
+	}
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// ErrKindUnauthorized is the kind of the errors of requests without a valid
+// token, on servers with ServerConfig.AuthTokens.
+const ErrKindUnauthorized = "unauthorized"
+
+const (
+	authorizationHeader   = "Authorization"
+	wwwAuthenticateHeader = "WWW-Authenticate"
+	bearerPrefix          = "Bearer "
+)
+
+// AuthTokenKey sets the token a request is sent with by the client, in an
+// "Authorization: Bearer <token>" header.
+var AuthTokenKey = cmds.NewKey("http.authToken", "")
+
+// tokenAuth checks the bearer tokens of the requests, see
+// ServerConfig.AuthTokens.
+type tokenAuth struct {
+	tokens [][]byte
+	exempt map[string]bool
+}
+
+// newTokenAuth returns the tokenAuth of cfg, or nil if it doesn't have any
+// tokens. The tokens and exemptions are copied, so later changes to cfg
+// don't apply.
+func newTokenAuth(cfg *ServerConfig) *tokenAuth {
+	if len(cfg.AuthTokens) == 0 {
+		return nil
+	}
+
+	a := &tokenAuth{exempt: make(map[string]bool, len(cfg.AuthExempt))}
+	for _, t := range cfg.AuthTokens {
+		if t != "" {
+			a.tokens = append(a.tokens, []byte(t))
+		}
+	}
+	for _, p := range cfg.AuthExempt {
+		a.exempt[strings.Join(strings.Fields(p), " ")] = true
+	}
+	return a
+}
+
+// allow returns whether r has a valid token or calls an exempt command. A
+// nil tokenAuth allows every request.
+func (a *tokenAuth) allow(r *http.Request, root *cmds.Command) bool {
+	if a == nil {
+		return true
+	}
+	if path, _, _, err := resolvePath(r, root); err == nil && a.exempt[strings.Join(path, " ")] {
+		return true
+	}
+
+	h := r.Header.Get(authorizationHeader)
+	if len(h) < len(bearerPrefix) || !strings.EqualFold(h[:len(bearerPrefix)], bearerPrefix) {
+		return false
+	}
+	token := []byte(strings.TrimSpace(h[len(bearerPrefix):]))
+
+	// compare with every token, so the time doesn't tell which one is closest
+	ok := 0
+	for _, t := range a.tokens {
+		ok |= subtle.ConstantTimeCompare(token, t)
+	}
+	return ok == 1
+}
+
+// writeUnauthorized writes the 401 response to a request without a valid
+// token, with an ErrKindUnauthorized error.
+func writeUnauthorized(w http.ResponseWriter, r *http.Request, cfg *ServerConfig) {
+	w.Header().Set(wwwAuthenticateHeader, `Bearer realm="api"`)
+	writeError(w, r, cfg, http.StatusUnauthorized, &cmds.Error{
+		Message: "missing or invalid authentication token",
+		Code:    cmds.ErrClient,
+		Kind:    ErrKindUnauthorized,
+		Hints:   []string{"send the token in an 'Authorization: Bearer <token>' header"},
+	})
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	context "golang.org/x/net/context"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+func TestTokenAuth(t *testing.T) {
+	run := func(req cmds.Request, res cmds.Response) {
+		res.SetOutput("ok")
+	}
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"version": {Run: run},
+			"config": {
+				Subcommands: map[string]*cmds.Command{
+					"show": {Run: run},
+					"set":  {Run: run},
+				},
+			},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.AuthTokens = []string{"secret", "other"}
+	cfg.AuthExempt = []string{"version", "config  show"}
+	server := httptest.NewServer(NewHandler(context.Background(), root, cfg))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	send := func(token string, path ...string) *cmds.Error {
+		req, err := cmds.NewRequestBuilder(root).Path(path...).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			AuthTokenKey.Set(req, token)
+		}
+		res, err := client.Send(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Close()
+		return res.Error()
+	}
+
+	for _, tc := range []struct {
+		token string
+		path  []string
+		ok    bool
+	}{
+		{"", []string{"config", "set"}, false},
+		{"wrong", []string{"config", "set"}, false},
+		{"secre", []string{"config", "set"}, false},
+		{"secret", []string{"config", "set"}, true},
+		{"other", []string{"config", "set"}, true},
+		{"", []string{"version"}, true},
+		{"", []string{"config", "show"}, true},
+	} {
+		e := send(tc.token, tc.path...)
+		if tc.ok && e != nil {
+			t.Errorf("Expected %v with token %q to be allowed, got %v", tc.path, tc.token, e)
+		}
+		if !tc.ok && (e == nil || e.Kind != ErrKindUnauthorized || e.Code != cmds.ErrClient) {
+			t.Errorf("Expected %v with token %q to fail with an %s error, got %+v", tc.path, tc.token, ErrKindUnauthorized, e)
+		}
+	}
+
+	// unknown commands aren't revealed without a token
+	for _, path := range []string{"config/set", "missing"} {
+		res, err := http.Post(server.URL+"/api/v0/"+path, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected %s to fail with status %d, got %d", path, http.StatusUnauthorized, res.StatusCode)
+		}
+		if h := res.Header.Get(wwwAuthenticateHeader); !strings.HasPrefix(h, "Bearer") {
+			t.Errorf("Expected a Bearer %s header, got %q", wwwAuthenticateHeader, h)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", server.URL+"/api/v0/config/set", nil)
+	req.Header.Set(authorizationHeader, "bearer secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the scheme to be case insensitive, got status %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	cmds "github.com/ipfs/go-commands"
+)
+
+// Callbacks are called as the output of a command sent to a server arrives,
+// so user interfaces can be driven from it without polling. Any of them may
+// be nil.
+type Callbacks struct {
+	// OnValue is called with each primary output value, or once with the
+	// output of commands that don't stream values.
+	OnValue func(v interface{})
+
+	// OnProgress is called with the values of event frames, and the
+	// cmds.Progress values of progress frames.
+	OnProgress func(v interface{})
+
+	// OnWarning is called with the values of log frames, and the
+	// cmds.DeadlineWarning values of warning frames.
+	OnWarning func(v interface{})
+
+	// OnItemError is called with the failures a cmds.Batch reports inline.
+	// The batch as a whole fails once its output was consumed.
+	OnItemError func(e cmds.ItemError)
+
+	// OnError is called if sending the request fails, or the command (or its
+	// output stream) fails.
+	OnError func(err error)
+
+	// OnDone is called last, once the output was consumed or an error
+	// occurred.
+	OnDone func()
+}
+
+// SendWithCallbacks sends req with c, passing its output to the callbacks as
+// it arrives. The callbacks are called in the order of the output stream, one
+// at a time. It returns once the output was consumed, with the error that was
+// passed to OnError.
+func SendWithCallbacks(c Client, req cmds.Request, cb Callbacks) (err error) {
+	defer func() {
+		if err != nil && cb.OnError != nil {
+			cb.OnError(err)
+		}
+		if cb.OnDone != nil {
+			cb.OnDone()
+		}
+	}()
+
+	onValue := func(v interface{}) {
+		if cb.OnValue != nil {
+			cb.OnValue(v)
+		}
+	}
+
+	// handle all frames as they are decoded, to keep them in order
+	allFramesKey.Set(req, true)
+	cmds.FrameHandlerKey.Set(req, func(t cmds.FrameType, v interface{}) {
+		switch {
+		case t == cmds.FrameValue:
+			onValue(v)
+		case (t == cmds.FrameEvent || t == cmds.FrameProgress) && cb.OnProgress != nil:
+			cb.OnProgress(v)
+		case (t == cmds.FrameLog || t == cmds.FrameWarning) && cb.OnWarning != nil:
+			cb.OnWarning(v)
+		case t == cmds.FrameItemError && cb.OnItemError != nil:
+			if e, ok := v.(cmds.ItemError); ok {
+				cb.OnItemError(e)
+			}
+		}
+	})
+
+	res, err := c.Send(req)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	if e := res.Error(); e != nil {
+		return e
+	}
+
+	// framed output is handled as it is decoded, the channel only carries
+	// values from servers that don't send frames
+	if ch, ok := res.Output().(<-chan interface{}); ok {
+		for v := range ch {
+			onValue(v)
+		}
+	} else {
+		onValue(res.Output())
+	}
+
+	// errors in the output stream are set once it ends
+	if e := res.Error(); e != nil {
+		return e
+	}
+	return nil
+}
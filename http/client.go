@@ -1,8 +1,8 @@
 package http
 
 import (
+	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,6 +15,7 @@ import (
 	context "golang.org/x/net/context"
 
 	cmds "github.com/ipfs/go-commands"
+	files "github.com/ipfs/go-commands/files"
 )
 
 const (
@@ -74,10 +75,16 @@ func (c *client) Send(req cmds.Request) (cmds.Response, error) {
 
 	var fileReader *MultiFileReader
 	var reader io.Reader
+	stats := cmds.TrackTransfer(req)
+
+	wlog, _ := WireLogKey.Get(req).(WireLogger)
 
 	if req.Files() != nil {
 		fileReader = NewMultiFileReader(req.Files(), true)
-		reader = fileReader
+		if progress, ok := cmds.UploadProgressKey.Get(req).(func(cmds.Progress)); ok {
+			fileReader.OnFileData = uploadProgress(req.Files(), progress)
+		}
+		reader = &cmds.CountingReader{Reader: wlog.tap("> ", fileReader), Count: stats.AddUploaded}
 	} else {
 		// if we have no file data, use an empty Reader
 		// (http.NewRequest panics when a nil Reader is used)
@@ -100,6 +107,31 @@ func (c *client) Send(req cmds.Request) (cmds.Response, error) {
 		httpReq.Header.Set(contentTypeHeader, applicationOctetStream)
 	}
 
+	// errors are sent as errorBody only if we ask for it
+	httpReq.Header.Set(acceptHeader, ErrorContentType+", */*")
+	if id := req.ID(); id != "" {
+		httpReq.Header.Set(requestIDHeader, id)
+	}
+	if token, ok := AuthTokenKey.Get(req).(string); ok {
+		httpReq.Header.Set(authorizationHeader, bearerPrefix+token)
+	}
+	if _, ok := cmds.FrameHandlerKey.Get(req).(cmds.FrameHandler); ok {
+		// ask for log and event frames along with the output
+		httpReq.Header.Set(framingHeader, "1")
+	}
+	for k, v := range req.Metadata() {
+		httpReq.Header.Set(requestMetaHeaderPrefix+k, v)
+	}
+	if id, ok := cmds.LastEventIDKey.Get(req).(uint64); ok {
+		httpReq.Header.Set(lastEventIDHeader, strconv.FormatUint(id, 10))
+	}
+
+	wlog.request("> ", httpReq.Method, httpReq.URL, httpReq.Proto, func(name string) bool {
+		opt := req.Option(name)
+		return opt != nil && cmds.IsSecretOption(opt.Definition())
+	})
+	wlog.headers("> ", httpReq.Header)
+
 	ec := make(chan error, 1)
 	rc := make(chan cmds.Response, 1)
 	dc := req.Context().Done()
@@ -107,10 +139,15 @@ func (c *client) Send(req cmds.Request) (cmds.Response, error) {
 	go func() {
 		httpRes, err := c.httpClient.Do(httpReq)
 		if err != nil {
+			wlog.logf("! %s", err)
 			ec <- err
 			return
 		}
 
+		wlog.logf("< %s %s", httpRes.Proto, httpRes.Status)
+		wlog.headers("< ", httpRes.Header)
+		httpRes.Body = wlog.tapBody("< ", httpRes.Body)
+
 		// using the overridden JSON encoding in request
 		res, err := getResponse(httpRes, req)
 		if err != nil {
@@ -142,9 +179,27 @@ func (c *client) Send(req cmds.Request) (cmds.Response, error) {
 	}
 }
 
+// uploadProgress returns a MultiFileReader.OnFileData function that reports
+// the progress of uploading f to progress.
+func uploadProgress(f files.File, progress func(cmds.Progress)) func(int) {
+	p := cmds.Progress{Unit: "bytes"}
+	if sf, ok := f.(files.SizeFile); ok {
+		if size, err := sf.Size(); err == nil {
+			p.Total = size
+		}
+	}
+	return func(n int) {
+		p.Current += int64(n)
+		progress(p)
+	}
+}
+
 func getQuery(req cmds.Request) (string, error) {
 	query := url.Values{}
 	for k, v := range req.Options() {
+		if opt := req.Option(k); opt != nil && cmds.IsLocalOption(opt.Definition()) {
+			continue
+		}
 		str := fmt.Sprintf("%v", v)
 		query.Set(k, str)
 	}
@@ -188,11 +243,22 @@ func getResponse(httpRes *http.Response, req cmds.Request) (cmds.Response, error
 		}
 		res.SetLength(length)
 	}
+	if items, err := strconv.ParseUint(httpRes.Header.Get(itemCountHeader), 10, 64); err == nil {
+		cmds.SetItemCount(res, items)
+	}
 
-	rr := &httpResponseReader{httpRes}
+	rr := &httpResponseReader{resp: httpRes, stats: cmds.TrackTransfer(req), res: res}
 	res.SetCloser(rr)
 
-	if contentType != applicationJson {
+	if contentType == ErrorContentType {
+		e, err := decodeError(rr)
+		if err != nil {
+			return nil, err
+		}
+		res.SetError(e, e.Code)
+		return res, nil
+
+	} else if contentType != applicationJson {
 		// for all non json output types, just stream back the output
 		res.SetOutput(rr)
 		return res, nil
@@ -201,7 +267,11 @@ func getResponse(httpRes *http.Response, req cmds.Request) (cmds.Response, error
 		// if output is coming from a channel, decode each chunk
 		outChan := make(chan interface{})
 
-		go readStreamedJson(req, rr, outChan)
+		if len(httpRes.Header.Get(framingHeader)) > 0 {
+			go readFramedJson(req, res, rr, outChan)
+		} else {
+			go readStreamedJson(req, res, rr, outChan)
+		}
 
 		res.SetOutput((<-chan interface{})(outChan))
 		return res, nil
@@ -246,15 +316,20 @@ func getResponse(httpRes *http.Response, req cmds.Request) (cmds.Response, error
 	if err != nil && err != io.EOF {
 		return nil, err
 	}
-
+	// read up to the trailer, for the warnings and the stream error
 	res.SetOutput(v)
+	if _, err := io.Copy(ioutil.Discard, rr); err != nil {
+		if e, ok := err.(*cmds.Error); ok {
+			res.SetError(e, e.Code)
+		}
+	}
 
 	return res, nil
 }
 
 // read json objects off of the given stream, and write the objects out to
 // the 'out' channel
-func readStreamedJson(req cmds.Request, rr io.Reader, out chan<- interface{}) {
+func readStreamedJson(req cmds.Request, res cmds.Response, rr io.Reader, out chan<- interface{}) {
 	defer close(out)
 	dec := json.NewDecoder(rr)
 	outputType := reflect.TypeOf(req.Command().Type)
@@ -262,10 +337,11 @@ func readStreamedJson(req cmds.Request, rr io.Reader, out chan<- interface{}) {
 	ctx := req.Context()
 
 	for {
-		v, err := decodeTypedVal(outputType, dec)
+		v, err := decodeOutputVal(req.Command(), outputType, dec)
 		if err != nil {
 			if err != io.EOF {
 				// log.Error(err)
+				res.SetError(err, errorCode(err))
 			}
 			return
 		}
@@ -278,6 +354,84 @@ func readStreamedJson(req cmds.Request, rr io.Reader, out chan<- interface{}) {
 	}
 }
 
+// allFramesKey makes readFramedJson pass value frames to the FrameHandler too,
+// so all frames are handled in order from a single goroutine
+var allFramesKey = cmds.NewKey("http.allFrames", false)
+
+// read json frames off of the given stream, writing the primary output values
+// to the 'out' channel and passing the others to the request's FrameHandler
+func readFramedJson(req cmds.Request, res cmds.Response, rr io.Reader, out chan<- interface{}) {
+	defer close(out)
+	dec := json.NewDecoder(rr)
+	outputType := reflect.TypeOf(req.Command().Type)
+	handler, _ := cmds.FrameHandlerKey.Get(req).(cmds.FrameHandler)
+	allFrames, _ := allFramesKey.Get(req).(bool)
+	wlog, _ := WireLogKey.Get(req).(WireLogger)
+
+	ctx := req.Context()
+
+	for {
+		var frame struct {
+			Type  cmds.FrameType
+			Value json.RawMessage
+		}
+		if err := dec.Decode(&frame); err != nil {
+			if err != io.EOF {
+				res.SetError(err, errorCode(err))
+			}
+			return
+		}
+
+		wlog.logf("< frame: %s", frame.Type)
+
+		if frame.Type != cmds.FrameValue {
+			var v interface{}
+			var err error
+			switch frame.Type {
+			case cmds.FrameProgress:
+				var p cmds.Progress
+				err = json.Unmarshal(frame.Value, &p)
+				v = p
+			case cmds.FrameWarning:
+				var w cmds.DeadlineWarning
+				err = json.Unmarshal(frame.Value, &w)
+				v = w
+			case cmds.FrameItemError:
+				var e cmds.ItemError
+				err = json.Unmarshal(frame.Value, &e)
+				v = e
+			default:
+				err = json.Unmarshal(frame.Value, &v)
+			}
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			if handler != nil {
+				handler(frame.Type, v)
+			}
+			continue
+		}
+
+		v, err := decodeOutputVal(req.Command(), outputType, json.NewDecoder(bytes.NewReader(frame.Value)))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if allFrames && handler != nil {
+			handler(frame.Type, v)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case out <- v:
+		}
+	}
+}
+
 // decode a value of the given type, if the type is nil, attempt to decode into
 // an interface{} anyways
 func decodeTypedVal(t reflect.Type, dec *json.Decoder) (interface{}, error) {
@@ -293,15 +447,41 @@ func decodeTypedVal(t reflect.Type, dec *json.Decoder) (interface{}, error) {
 	return v, err
 }
 
+// decodeOutputVal decodes an output value of cmd of the given type, which is
+// the value of a cmds.Event for subscribe commands.
+func decodeOutputVal(cmd *cmds.Command, t reflect.Type, dec *json.Decoder) (interface{}, error) {
+	if cmd.Subscribe == nil {
+		return decodeTypedVal(t, dec)
+	}
+
+	var ev struct {
+		ID    uint64
+		Value json.RawMessage
+	}
+	if err := dec.Decode(&ev); err != nil {
+		return nil, err
+	}
+	v, err := decodeTypedVal(t, json.NewDecoder(bytes.NewReader(ev.Value)))
+	if err != nil {
+		return nil, err
+	}
+	return cmds.Event{ID: ev.ID, Value: v}, nil
+}
+
 // httpResponseReader reads from the response body, and checks for an error
 // in the http trailer upon EOF, this error if present is returned instead
-// of the EOF.
+// of the EOF. The warnings and trailers in the trailer are added to res.
+// Header names are case-insensitive, so trailer names are lowercased.
 type httpResponseReader struct {
-	resp *http.Response
+	resp  *http.Response
+	stats *cmds.TransferStats
+	res   cmds.Response
+	eof   bool
 }
 
 func (r *httpResponseReader) Read(b []byte) (int, error) {
 	n, err := r.resp.Body.Read(b)
+	r.stats.AddDownloaded(n)
 
 	// reading on a closed response body is as good as an io.EOF here
 	if err != nil && strings.Contains(err.Error(), "read on closed response body") {
@@ -309,6 +489,18 @@ func (r *httpResponseReader) Read(b []byte) (int, error) {
 	}
 	if err == io.EOF {
 		_ = r.resp.Body.Close()
+		if !r.eof {
+			r.eof = true
+			for _, warning := range r.resp.Trailer.Values(StreamWarningHeader) {
+				cmds.AddWarning(r.res, warning)
+			}
+			for k, v := range r.resp.Trailer {
+				if len(v) > 0 && len(k) > len(StreamTrailerPrefix) &&
+					strings.EqualFold(k[:len(StreamTrailerPrefix)], StreamTrailerPrefix) {
+					cmds.SetTrailer(r.res, strings.ToLower(k[len(StreamTrailerPrefix):]), v[0])
+				}
+			}
+		}
 		trailerErr := r.checkError()
 		if trailerErr != nil {
 			return n, trailerErr
@@ -318,10 +510,25 @@ func (r *httpResponseReader) Read(b []byte) (int, error) {
 }
 
 func (r *httpResponseReader) checkError() error {
-	if e := r.resp.Trailer.Get(StreamErrHeader); e != "" {
-		return errors.New(e)
+	e := r.resp.Trailer.Get(StreamErrHeader)
+	if e == "" {
+		return nil
+	}
+
+	code := cmds.ErrNormal
+	if c, err := strconv.ParseUint(r.resp.Trailer.Get(StreamErrCodeHeader), 10, 32); err == nil {
+		code = cmds.ErrorType(c)
+	}
+	return &cmds.Error{Message: e, Code: code, Kind: r.resp.Trailer.Get(StreamErrKindHeader)}
+}
+
+// errorCode returns the code of err if it's a *cmds.Error (like the stream
+// errors of httpResponseReader), or cmds.ErrNormal.
+func errorCode(err error) cmds.ErrorType {
+	if e, ok := err.(*cmds.Error); ok {
+		return e.Code
 	}
-	return nil
+	return cmds.ErrNormal
 }
 
 func (r *httpResponseReader) Close() error {
@@ -0,0 +1,34 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptsGzip returns true if the Accept-Encoding header of r accepts gzip
+// encoded responses.
+func acceptsGzip(r *http.Request) bool {
+	for _, h := range r.Header[acceptEncodingHeader] {
+		for _, coding := range strings.Split(h, ",") {
+			params := strings.Split(coding, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			if name != "gzip" && name != "*" {
+				continue
+			}
+
+			// a quality of zero refuses the coding
+			q := 1.0
+			for _, p := range params[1:] {
+				p = strings.TrimSpace(p)
+				if strings.HasPrefix(p, "q=") {
+					if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+						q = v
+					}
+				}
+			}
+			return q > 0
+		}
+	}
+	return false
+}
@@ -2,6 +2,9 @@ package http
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +14,8 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	cors "github.com/rs/cors"
 	context "golang.org/x/net/context"
@@ -26,6 +31,7 @@ type internalHandler struct {
 	ctx  context.Context
 	root *cmds.Command
 	cfg  *ServerConfig
+	auth *tokenAuth
 }
 
 // The Handler struct is funny because we want to wrap our internal handler
@@ -37,19 +43,42 @@ type Handler struct {
 
 var ErrNotFound = errors.New("404 page not found")
 
+// ErrTimeoutRequired is the error of requests that disable their timeout on
+// servers that don't permit it (see ServerConfig.AllowNoTimeout).
+var ErrTimeoutRequired = errors.New("This server doesn't permit requests without a timeout")
+
 const (
-	StreamErrHeader        = "X-Stream-Error"
-	streamHeader           = "X-Stream-Output"
-	channelHeader          = "X-Chunked-Output"
-	uaHeader               = "User-Agent"
-	contentTypeHeader      = "Content-Type"
-	contentLengthHeader    = "Content-Length"
-	contentDispHeader      = "Content-Disposition"
-	transferEncodingHeader = "Transfer-Encoding"
-	applicationJson        = "application/json"
-	applicationOctetStream = "application/octet-stream"
-	plainText              = "text/plain"
-	originHeader           = "origin"
+	StreamErrHeader          = "X-Stream-Error"
+	StreamErrCodeHeader      = "X-Stream-Error-Code"
+	StreamErrKindHeader      = "X-Stream-Error-Kind"
+	TransferStatsHeader      = "X-Transfer-Stats"
+	StreamWarningHeader      = "X-Stream-Warning"
+	StreamTrailerPrefix      = "X-Stream-Trailer-"
+	streamHeader             = "X-Stream-Output"
+	channelHeader            = "X-Chunked-Output"
+	framingHeader            = "X-Stream-Framing"
+	extraContentLengthHeader = "X-Content-Length"
+	itemCountHeader          = "X-Item-Count"
+	trailerHeader            = "Trailer"
+	requestIDHeader          = "X-Request-Id"
+	contentEncodingHeader    = "Content-Encoding"
+	acceptEncodingHeader     = "Accept-Encoding"
+	acceptHeader             = "Accept"
+	varyHeader               = "Vary"
+	lastEventIDHeader        = "Last-Event-ID"
+	requestMetaHeaderPrefix  = "X-Request-Meta-"
+	exposeHeadersHeader      = "Access-Control-Expose-Headers"
+	uaHeader                 = "User-Agent"
+	contentTypeHeader        = "Content-Type"
+	contentLengthHeader      = "Content-Length"
+	contentDispHeader        = "Content-Disposition"
+	transferEncodingHeader   = "Transfer-Encoding"
+	applicationJson          = "application/json"
+	applicationNdjson        = "application/x-ndjson"
+	applicationOctetStream   = "application/octet-stream"
+	ErrorContentType         = "application/vnd.go-commands.error+json"
+	plainText                = "text/plain"
+	originHeader             = "origin"
 )
 
 const (
@@ -58,18 +87,239 @@ const (
 	ACACredentials = "Access-Control-Allow-Credentials"
 )
 
+// mimeTypesMu guards mimeTypes, see RegisterMimeType
+var mimeTypesMu sync.RWMutex
+
 var mimeTypes = map[string]string{
-	cmds.JSON: "application/json",
-	cmds.XML:  "application/xml",
-	cmds.Text: "text/plain",
+	cmds.JSON:     "application/json",
+	cmds.XML:      "application/xml",
+	cmds.Text:     "text/plain",
+	cmds.YAML:     "application/yaml",
+	cmds.Protobuf: "application/x-protobuf",
+	cmds.NDJSON:   applicationNdjson,
+	cmds.CSV:      "text/csv",
+	cmds.TSV:      "text/tab-separated-values",
 }
 
 type ServerConfig struct {
 	// Headers is an optional map of headers that is written out.
 	Headers map[string][]string
 
-	// CORSOpts is a set of options for CORS headers.
+	// CORSOpts is a set of options for CORS headers. It defaults to
+	// DefaultCORSOptions, see also the Set* methods. It must not be changed
+	// after the handler was created.
 	CORSOpts *cors.Options
+
+	// JSCompat enables the conventions expected by the js-ipfs HTTP API
+	// clients: `arg[]` is accepted as an alias for repeated `arg` values,
+	// stream errors are also written as a final JSON object in the body (browsers
+	// can't read trailers), and the custom headers are exposed to CORS
+	// clients, with X-Content-Length mirroring Content-Length.
+	JSCompat bool
+
+	// Metrics is called with the transfer stats of every request, after its
+	// response was sent.
+	Metrics func(req cmds.Request, stats *cmds.TransferStats)
+
+	// WireLog enables the wire log of all requests, for debugging.
+	WireLog WireLogger
+
+	// DefaultTimeout is the timeout of requests that set neither a timeout
+	// nor a deadline. Zero means no timeout.
+	DefaultTimeout time.Duration
+
+	// AllowNoTimeout permits requests to disable their timeout with
+	// --timeout=0 or --timeout=none (e.g. for trusted local use). Otherwise
+	// they fail with ErrTimeoutRequired.
+	AllowNoTimeout bool
+
+	// AuthTokens enables token authentication: requests have to send one of
+	// the tokens in an "Authorization: Bearer <token>" header, or they fail
+	// with a 401 ErrKindUnauthorized error. They are read when the handler is
+	// created.
+	AuthTokens []string
+
+	// AuthExempt are the paths of the commands that can be called without a
+	// token, like "version" or "config show".
+	AuthExempt []string
+
+	// Compress enables the gzip compression of marshaled response bodies,
+	// for clients that accept it. Output streams are sent as they are.
+	Compress bool
+
+	// MaxJSONBodySize is the size limit in bytes of the JSON bodies that are
+	// validated against a command's InputSchema (they are read in memory).
+	// Zero means DefaultMaxJSONBodySize.
+	MaxJSONBodySize int64
+}
+
+// DefaultMaxJSONBodySize is the size limit of JSON request bodies of servers
+// that don't set their own, see ServerConfig.MaxJSONBodySize.
+const DefaultMaxJSONBodySize = 8 << 20
+
+func (cfg *ServerConfig) maxJSONBodySize() int64 {
+	if cfg.MaxJSONBodySize <= 0 {
+		return DefaultMaxJSONBodySize
+	}
+	return cfg.MaxJSONBodySize
+}
+
+// DefaultCORSOptions returns the CORS options of servers that don't set
+// their own: no cross-origin requests are allowed (requests with an Origin or
+// Referer header are rejected), commands can only be called with POST and
+// credentials aren't allowed.
+func DefaultCORSOptions() *cors.Options {
+	return &cors.Options{
+		AllowedMethods: []string{http.MethodPost},
+	}
+}
+
+// NewServerConfig returns a ServerConfig with DefaultCORSOptions.
+func NewServerConfig() *ServerConfig {
+	return &ServerConfig{CORSOpts: DefaultCORSOptions()}
+}
+
+func (cfg *ServerConfig) corsOpts() *cors.Options {
+	if cfg.CORSOpts == nil {
+		cfg.CORSOpts = DefaultCORSOptions()
+	}
+	return cfg.CORSOpts
+}
+
+// AllowedOrigins returns the origins allowed to call the API from a browser.
+func (cfg *ServerConfig) AllowedOrigins() []string {
+	return cfg.corsOpts().AllowedOrigins
+}
+
+// SetAllowedOrigins sets the origins (like "http://localhost:3000") allowed
+// to call the API from a browser. "*" allows every origin.
+func (cfg *ServerConfig) SetAllowedOrigins(origins ...string) {
+	cfg.corsOpts().AllowedOrigins = origins
+}
+
+// AppendAllowedOrigins adds origins to the allowed origins.
+func (cfg *ServerConfig) AppendAllowedOrigins(origins ...string) {
+	o := cfg.corsOpts()
+	o.AllowedOrigins = append(o.AllowedOrigins, origins...)
+}
+
+// AllowedMethods returns the HTTP methods cross-origin requests may use.
+func (cfg *ServerConfig) AllowedMethods() []string {
+	return cfg.corsOpts().AllowedMethods
+}
+
+// SetAllowedMethods sets the HTTP methods cross-origin requests may use.
+func (cfg *ServerConfig) SetAllowedMethods(methods ...string) {
+	cfg.corsOpts().AllowedMethods = methods
+}
+
+// SetAllowedHeaders sets the non-simple headers cross-origin requests may
+// send (like "Content-Type" or "X-Requested-With").
+func (cfg *ServerConfig) SetAllowedHeaders(headers ...string) {
+	cfg.corsOpts().AllowedHeaders = headers
+}
+
+// SetAllowCredentials sets whether cross-origin requests may include
+// credentials (cookies, HTTP authentication). Only enable it with explicitly
+// allowed origins: with "*", any site could call the API as the user.
+func (cfg *ServerConfig) SetAllowCredentials(allow bool) {
+	cfg.corsOpts().AllowCredentials = allow
+}
+
+// jsStreamError is the trailing object written to the body of a stream that
+// failed, when the server is in JSCompat mode.
+type jsStreamError struct {
+	Message string
+	Code    cmds.ErrorType
+	Type    string
+}
+
+// errorBody is the body of error responses to clients that accept the
+// ErrorContentType, in every encoding (see errorResponse). Its shape is part
+// of the API:
+//
+//	{"code": 1, "message": "...", "kind": "not-found", "details": {...}, "hints": [...]}
+//
+// kind, details and hints are omitted when the error doesn't have them.
+type errorBody struct {
+	Code    cmds.ErrorType         `json:"code"`
+	Message string                 `json:"message"`
+	Kind    string                 `json:"kind,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	Hints   []string               `json:"hints,omitempty"`
+}
+
+func encodeError(e *cmds.Error) (io.Reader, error) {
+	b, err := json.Marshal(errorBody{
+		Code:    e.Code,
+		Message: e.Message,
+		Kind:    e.Kind,
+		Details: e.Details,
+		Hints:   e.Hints,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(append(b, '\n')), nil
+}
+
+// Kinds of the errors the handler responds with before calling a command
+const (
+	ErrKindNotFound     = "not-found"
+	ErrKindForbidden    = "forbidden"
+	ErrKindInvalidInput = "invalid-input" // the "errors" detail lists the problems
+)
+
+// acceptsErrorType returns true if the client of r accepts error responses
+// with the ErrorContentType.
+func acceptsErrorType(r *http.Request) bool {
+	for _, accept := range r.Header.Values(acceptHeader) {
+		for _, t := range strings.Split(accept, ",") {
+			if strings.TrimSpace(strings.Split(t, ";")[0]) == ErrorContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// errorResponse returns the content type and the body of the error response
+// to r. Clients that accept it get an errorBody with the ErrorContentType.
+// Others, and all clients of servers in JSCompat mode, get the
+// {"Message", "Code", "Type"} object older clients and js-ipfs decode, as
+// application/json.
+func errorResponse(r *http.Request, cfg *ServerConfig, e *cmds.Error) (string, io.Reader, error) {
+	if acceptsErrorType(r) && !cfg.JSCompat {
+		out, err := encodeError(e)
+		return ErrorContentType, out, err
+	}
+
+	b, err := json.Marshal(jsStreamError{Message: e.Message, Code: e.Code, Type: "error"})
+	if err != nil {
+		return "", nil, err
+	}
+	return applicationJson, bytes.NewReader(append(b, '\n')), nil
+}
+
+// writeError writes the error response e to r, with the given status.
+func writeError(w http.ResponseWriter, r *http.Request, cfg *ServerConfig, status int, e *cmds.Error) {
+	mime, out, err := errorResponse(r, cfg, e)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(contentTypeHeader, mime)
+	w.WriteHeader(status)
+	io.Copy(w, out)
+}
+
+// decodeError reads an errorBody from r.
+func decodeError(r io.Reader) (*cmds.Error, error) {
+	var b errorBody
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, err
+	}
+	return &cmds.Error{Code: b.Code, Message: b.Message, Kind: b.Kind, Details: b.Details, Hints: b.Hints}, nil
 }
 
 func skipAPIHeader(h string) bool {
@@ -92,8 +342,14 @@ func NewHandler(ctx context.Context, root *cmds.Command, cfg *ServerConfig) *Han
 
 	// Wrap the internal handler with CORS handling-middleware.
 	// Create a handler for the API.
-	internal := internalHandler{ctx, root, cfg}
-	c := cors.New(*cfg.CORSOpts)
+	internal := internalHandler{ctx, root, cfg, newTokenAuth(cfg)}
+	opts := *cfg.corsOpts()
+	if len(opts.AllowedOrigins) == 0 && opts.AllowOriginFunc == nil &&
+		opts.AllowOriginRequestFunc == nil && opts.AllowOriginVaryRequestFunc == nil {
+		// the cors package allows every origin when none is set
+		opts.AllowOriginFunc = func(string) bool { return false }
+	}
+	c := cors.New(opts)
 	return &Handler{internal, c.Handler(internal)}
 }
 
@@ -117,20 +373,60 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	if !allowOrigin(r, i.cfg) || !allowReferer(r, i.cfg) {
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte("403 - Forbidden"))
+		writeError(w, r, i.cfg, http.StatusForbidden, &cmds.Error{
+			Message: "403 - Forbidden",
+			Code:    cmds.ErrClient,
+			Kind:    ErrKindForbidden,
+		})
 		// log.Warningf("API blocked request to %s. (possible CSRF)", r.URL)
 		return
 	}
 
-	req, err := Parse(r, i.root)
+	if !i.auth.allow(r, i.root) {
+		writeUnauthorized(w, r, i.cfg)
+		return
+	}
+
+	wlog := i.cfg.WireLog
+	wlog.request("< ", r.Method, r.URL, r.Proto, secretOptions(r, i.root))
+	wlog.headers("< ", r.Header)
+	r.Body = wlog.tapBody("< ", r.Body)
+
+	if i.cfg.JSCompat {
+		normalizeJSQuery(r)
+	}
+
+	// count the request body as it's read, by Parse or the command
+	stats := &cmds.TransferStats{}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{&cmds.CountingReader{Reader: r.Body, Count: stats.AddUploaded}, r.Body}
+
+	req, err := parse(w, r, i.root, i.cfg.maxJSONBodySize())
 	if err != nil {
+		if verr, ok := err.(cmds.ValidationError); ok {
+			writeError(w, r, i.cfg, http.StatusBadRequest, &cmds.Error{
+				Message: verr.Error(),
+				Code:    cmds.ErrClient,
+				Kind:    ErrKindInvalidInput,
+				Details: map[string]interface{}{"errors": verr},
+			})
+			return
+		}
+
 		if err == ErrNotFound {
-			w.WriteHeader(http.StatusNotFound)
+			writeError(w, r, i.cfg, http.StatusNotFound, &cmds.Error{Message: err.Error(), Code: cmds.ErrClient, Kind: ErrKindNotFound})
 		} else {
-			w.WriteHeader(http.StatusBadRequest)
+			writeError(w, r, i.cfg, http.StatusBadRequest, &cmds.Error{Message: err.Error(), Code: cmds.ErrClient})
 		}
-		w.Write([]byte(err.Error()))
+		return
+	}
+
+	cmds.TransferStatsKey.Set(req, stats)
+
+	if err := applyTimeoutPolicy(req, i.cfg); err != nil {
+		writeError(w, r, i.cfg, http.StatusBadRequest, &cmds.Error{Message: err.Error(), Code: cmds.ErrClient})
 		return
 	}
 
@@ -140,12 +436,23 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	req.SetRootContext(ctx)
 	err = req.SetRootContext(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, i.cfg, http.StatusInternalServerError, &cmds.Error{Message: err.Error(), Code: cmds.ErrNormal})
 		return
 	}
 
+	// record the client going away as the cause of the cancellation
+	go func() {
+		select {
+		case <-r.Context().Done():
+			cmds.CancelRequest(req, cmds.ErrClientDisconnected)
+		case <-ctx.Done():
+		}
+	}()
+
 	// call the command
+	cmds.KeepFramesKey.Set(req, true)
 	res := i.root.Call(req)
+	setFraming(w, r, req, res, wlog)
 
 	// set user's headers first.
 	for k, v := range i.cfg.Headers {
@@ -154,8 +461,92 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// echo the request ID so clients can correlate the response
+	if id := req.ID(); id != "" {
+		w.Header().Set(requestIDHeader, id)
+	}
+
 	// now handle responding to the client properly
-	sendResponse(w, r, res, req)
+	sendResponse(w, r, res, req, i.cfg)
+
+	if i.cfg.Metrics != nil {
+		i.cfg.Metrics(req, stats)
+	}
+}
+
+// secretOptions returns the function that tells whether the option name of
+// the command r calls is secret.
+func secretOptions(r *http.Request, root *cmds.Command) func(name string) bool {
+	var optDefs map[string]cmds.Option
+	if path, _, _, err := resolvePath(r, root); err == nil {
+		optDefs, _ = root.GetOptions(path)
+	}
+	return func(name string) bool {
+		return cmds.IsSecretOption(optDefs[name])
+	}
+}
+
+// applyTimeoutPolicy checks that the request may disable its timeout, and
+// sets the server's default timeout if the request has none.
+func applyTimeoutPolicy(req cmds.Request, cfg *ServerConfig) error {
+	if cmds.TimeoutDisabled(req) {
+		if !cfg.AllowNoTimeout {
+			return ErrTimeoutRequired
+		}
+		return nil
+	}
+
+	if cfg.DefaultTimeout <= 0 {
+		return nil
+	}
+	_, tfound, _ := req.Option(cmds.TimeoutOpt).String()
+	_, dfound, _ := cmds.GlobalOption(req, cmds.OptionDeadline).String()
+	if !tfound && !dfound {
+		req.SetOption(cmds.TimeoutOpt, cfg.DefaultTimeout.String())
+	}
+	return nil
+}
+
+// setFraming sends the frames of a channel output as they are if the client
+// asked for them, and only the primary output values otherwise. Unframed
+// clients get the item errors of a cmds.Batch as warnings instead.
+func setFraming(w http.ResponseWriter, r *http.Request, req cmds.Request, res cmds.Response, wlog WireLogger) {
+	var ch <-chan interface{}
+	switch out := res.Output().(type) {
+	case <-chan interface{}:
+		ch = out
+	case chan interface{}:
+		ch = out
+	default:
+		return
+	}
+
+	if r.Header.Get(framingHeader) != "" {
+		w.Header().Set(framingHeader, "1")
+		res.SetOutput(wlog.frames(req.Context(), "> ", cmds.FramedChannel(req.Context(), ch)))
+	} else {
+		res.SetOutput(cmds.PrimaryValues(req.Context(), ch, func(t cmds.FrameType, v interface{}) {
+			if t == cmds.FrameItemError {
+				cmds.AddWarning(res, fmt.Sprint(v))
+			}
+		}))
+	}
+}
+
+// normalizeJSQuery rewrites the `arg[]` query values sent by some JS clients
+// into the repeated `arg` values expected by Parse.
+func normalizeJSQuery(r *http.Request) {
+	query := r.URL.Query()
+	jsArgs, ok := query["arg[]"]
+	if !ok {
+		return
+	}
+
+	delete(query, "arg[]")
+	for _, arg := range jsArgs {
+		query.Add("arg", arg)
+	}
+	r.URL.RawQuery = query.Encode()
 }
 
 func guessMimeType(res cmds.Response) (string, error) {
@@ -168,39 +559,70 @@ func guessMimeType(res cmds.Response) (string, error) {
 		return "", errors.New("no encoding option set")
 	}
 
+	mimeTypesMu.RLock()
+	defer mimeTypesMu.RUnlock()
 	return mimeTypes[enc], nil
 }
 
-func sendResponse(w http.ResponseWriter, r *http.Request, res cmds.Response, req cmds.Request) {
+// RegisterMimeType sets the Content-Type of responses in the encoding enc,
+// e.g. for encodings added with cmds.RegisterEncoder. Responses in encodings
+// without a mime type are sent without a Content-Type.
+func RegisterMimeType(enc cmds.EncodingType, mime string) {
+	mimeTypesMu.Lock()
+	defer mimeTypesMu.Unlock()
+	mimeTypes[string(enc)] = mime
+}
+
+func sendResponse(w http.ResponseWriter, r *http.Request, res cmds.Response, req cmds.Request, cfg *ServerConfig) {
 	mime, err := guessMimeType(res)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, cfg, http.StatusInternalServerError, &cmds.Error{Message: err.Error(), Code: cmds.ErrNormal})
 		return
 	}
 
 	status := http.StatusOK
+	var out io.Reader
 	// if response contains an error, write an HTTP error status code
-	if e := res.Error(); e != nil {
+	e := res.Error()
+	if e != nil {
 		if e.Code == cmds.ErrClient {
 			status = http.StatusBadRequest
 		} else {
 			status = http.StatusInternalServerError
 		}
-		// NOTE: The error will actually be written out by the reader below
+		mime, out, err = errorResponse(r, cfg, e)
+	} else {
+		out, err = res.Reader()
 	}
-
-	out, err := res.Reader()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, cfg, http.StatusInternalServerError, &cmds.Error{Message: err.Error(), Code: cmds.ErrNormal})
 		return
 	}
 
 	h := w.Header()
 	if res.Length() > 0 {
 		h.Set(contentLengthHeader, strconv.FormatUint(res.Length(), 10))
+		if cfg.JSCompat {
+			h.Set(extraContentLengthHeader, strconv.FormatUint(res.Length(), 10))
+		}
+	}
+	if cmds.ItemCount(res) > 0 {
+		h.Set(itemCountHeader, strconv.FormatUint(cmds.ItemCount(res), 10))
+	}
+	if cfg.JSCompat {
+		h.Set(trailerHeader, strings.Join([]string{
+			StreamErrHeader, StreamErrCodeHeader, StreamErrKindHeader, TransferStatsHeader,
+			StreamWarningHeader,
+		}, ", "))
+		h.Set(exposeHeadersHeader, strings.Join([]string{
+			streamHeader, channelHeader, extraContentLengthHeader, framingHeader,
+			itemCountHeader,
+		}, ", "))
 	}
 
-	if _, ok := res.Output().(io.Reader); ok {
+	_, isStream := res.Output().(io.Reader)
+	isStream = isStream && e == nil
+	if isStream {
 		// we don't set the Content-Type for streams, so that browsers can MIME-sniff the type themselves
 		// we set this header so clients have a way to know this is an output stream
 		// (not marshalled command output)
@@ -208,17 +630,26 @@ func sendResponse(w http.ResponseWriter, r *http.Request, res cmds.Response, req
 		h.Set(streamHeader, "1")
 	}
 
+	compress := cfg.Compress && !isStream && acceptsGzip(r)
+	if compress {
+		h.Set(contentEncodingHeader, "gzip")
+		h.Add(varyHeader, acceptEncodingHeader)
+		h.Del(contentLengthHeader)
+		h.Del(extraContentLengthHeader)
+	}
+
 	// if output is a channel and user requested streaming channels,
 	// use chunk copier for the output
 	_, isChan := res.Output().(chan interface{})
 	if !isChan {
 		_, isChan = res.Output().(<-chan interface{})
 	}
+	isChan = isChan && e == nil
 
 	streamChans, _, _ := req.Option("stream-channels").Bool()
 	if isChan {
 		h.Set(channelHeader, "1")
-		if streamChans {
+		if streamChans && mime != applicationNdjson {
 			// streaming output from a channel will always be json objects
 			mime = applicationJson
 		}
@@ -229,13 +660,19 @@ func sendResponse(w http.ResponseWriter, r *http.Request, res cmds.Response, req
 	}
 	h.Set(transferEncodingHeader, "chunked")
 
+	cfg.WireLog.logf("> HTTP/1.1 %d %s", status, http.StatusText(status))
+	cfg.WireLog.headers("> ", h)
+
 	if r.Method == "HEAD" { // after all the headers.
 		return
 	}
 
-	if err := writeResponse(status, w, out); err != nil {
+	out = cfg.WireLog.tap("> ", out)
+
+	if err := writeResponse(status, w, out, cfg.JSCompat, compress, cmds.TrackTransfer(req), res); err != nil {
 		if strings.Contains(err.Error(), "broken pipe") {
 			// log.Info("client disconnect while writing stream ", err)
+			cmds.CancelRequest(req, cmds.ErrClientDisconnected)
 			return
 		}
 
@@ -245,7 +682,14 @@ func sendResponse(w http.ResponseWriter, r *http.Request, res cmds.Response, req
 
 // Copies from an io.Reader to a http.ResponseWriter.
 // Flushes chunks over HTTP stream as they are read (if supported by transport).
-func writeResponse(status int, w http.ResponseWriter, out io.Reader) error {
+// If jsCompat is set, a stream error is also written out as a final JSON
+// object in the body, before the trailer. If compress is set, the body is
+// gzipped as it streams, flushing the compressed output of every read. The
+// bytes of the (compressed) body are counted
+// in stats, and sent in the TransferStatsHeader trailer. The warnings and
+// trailers of res are sent in StreamWarningHeader and StreamTrailerPrefix
+// trailers, once the body is written.
+func writeResponse(status int, w http.ResponseWriter, out io.Reader, jsCompat, compress bool, stats *cmds.TransferStats, res cmds.Response) error {
 	// hijack the connection so we can write our own chunked output and trailers
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
@@ -268,37 +712,92 @@ func writeResponse(status int, w http.ResponseWriter, out io.Reader) error {
 	writer.WriteString("\r\n")
 
 	// write body
-	streamErr := writeChunks(out, writer)
+	var body io.Writer = chunkWriter{writer, stats}
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(body)
+		body = gz
+	}
+	streamErr := writeChunks(out, body)
+	if streamErr != nil && jsCompat {
+		writeJSStreamError(streamErr, body)
+	}
+	if gz != nil {
+		gz.Close()
+	}
 
 	// close body
 	writer.WriteString("0\r\n")
 
 	// if there was a stream error, write out an error trailer. hopefully
-	// the client will pick it up!
+	// the client will pick it up! the code lets clients fail the same way a
+	// local execution would, after some output was already written.
 	if streamErr != nil {
+		code, kind := cmds.ErrNormal, ""
+		if ce, ok := streamErr.(*cmds.Error); ok {
+			code, kind = ce.Code, ce.Kind
+		}
 		writer.WriteString(StreamErrHeader + ": " + sanitizedErrStr(streamErr) + "\r\n")
+		writer.WriteString(fmt.Sprintf("%s: %d\r\n", StreamErrCodeHeader, code))
+		if kind != "" {
+			writer.WriteString(StreamErrKindHeader + ": " + sanitizeHeaderValue(kind) + "\r\n")
+		}
+	}
+	writer.WriteString(fmt.Sprintf("%s: uploaded=%d, downloaded=%d\r\n",
+		TransferStatsHeader, stats.Uploaded(), stats.Downloaded()))
+	for _, warning := range cmds.Warnings(res) {
+		writer.WriteString(StreamWarningHeader + ": " + sanitizeHeaderValue(warning) + "\r\n")
+	}
+	for name, value := range cmds.Trailers(res) {
+		writer.WriteString(StreamTrailerPrefix + sanitizeHeaderValue(name) + ": " + sanitizeHeaderValue(value) + "\r\n")
 	}
 	writer.WriteString("\r\n") // close response
 	writer.Flush()
 	return streamErr
 }
 
-func writeChunks(r io.Reader, w *bufio.ReadWriter) error {
+// chunkWriter writes every Write as a chunk of a chunked body, flushing it
+// right away, and counts the bytes in stats.
+type chunkWriter struct {
+	w     *bufio.ReadWriter
+	stats *cmds.TransferStats
+}
+
+func (c chunkWriter) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	c.w.WriteString(fmt.Sprintf("%x\r\n", len(b)))
+	n, err := c.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	c.stats.AddDownloaded(n)
+
+	c.w.WriteString("\r\n")
+	return n, c.w.Flush()
+}
+
+// flusher is implemented by writers that buffer, like gzip.Writer.
+type flusher interface {
+	Flush() error
+}
+
+func writeChunks(r io.Reader, w io.Writer) error {
 	buf := make([]byte, 32*1024)
 	for {
 		n, err := r.Read(buf)
 
 		if n > 0 {
-			length := fmt.Sprintf("%x\r\n", n)
-			w.WriteString(length)
-
-			_, err := w.Write(buf[0:n])
-			if err != nil {
+			if _, err := w.Write(buf[0:n]); err != nil {
 				return err
 			}
-
-			w.WriteString("\r\n")
-			w.Flush()
+			if f, ok := w.(flusher); ok {
+				if err := f.Flush(); err != nil {
+					return err
+				}
+			}
 		}
 
 		if err != nil && err != io.EOF {
@@ -311,8 +810,34 @@ func writeChunks(r io.Reader, w *bufio.ReadWriter) error {
 	return nil
 }
 
+func writeJSStreamError(streamErr error, w io.Writer) {
+	e := jsStreamError{
+		Message: streamErr.Error(),
+		Code:    cmds.ErrNormal,
+		Type:    "error",
+	}
+	if ce, ok := streamErr.(*cmds.Error); ok {
+		e.Code = ce.Code
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+
+	w.Write(b)
+	if f, ok := w.(flusher); ok {
+		f.Flush()
+	}
+}
+
 func sanitizedErrStr(err error) string {
-	s := err.Error()
+	return sanitizeHeaderValue(err.Error())
+}
+
+// sanitizeHeaderValue cuts s at the first line break
+func sanitizeHeaderValue(s string) string {
 	s = strings.Split(s, "\n")[0]
 	s = strings.Split(s, "\r")[0]
 	return s
@@ -330,7 +855,7 @@ func allowOrigin(r *http.Request, cfg *ServerConfig) bool {
 		return true
 	}
 
-	for _, o := range cfg.CORSOpts.AllowedOrigins {
+	for _, o := range cfg.AllowedOrigins() {
 		if o == "*" { // ok! you asked for it!
 			return true
 		}
@@ -372,7 +897,7 @@ func allowReferer(r *http.Request, cfg *ServerConfig) bool {
 	// check CORS ACAOs and pretend Referer works like an origin.
 	// this is valid for many (most?) sane uses of the API in
 	// other applications, and will have the desired effect.
-	for _, o := range cfg.CORSOpts.AllowedOrigins {
+	for _, o := range cfg.AllowedOrigins() {
 		if o == "*" { // ok! you asked for it!
 			return true
 		}
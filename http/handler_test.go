@@ -1,14 +1,27 @@
 package http
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	cors "github.com/rs/cors"
+	context "golang.org/x/net/context"
 
-	// cmds "github.com/ipfs/go-commands"
+	cmds "github.com/ipfs/go-commands"
+	"github.com/ipfs/go-commands/files"
 )
 
 func assertHeaders(t *testing.T, resHeaders http.Header, reqHeaders map[string]string) {
@@ -351,3 +364,1274 @@ func TestAllowedMethod(t *testing.T) {
 		tc.test(t)
 	}
 }
+
+func TestJSCompat(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"fail": {
+				Arguments: []cmds.Argument{
+					cmds.StringArg("a", true, true, "some arg"),
+				},
+				Run: func(req cmds.Request, res cmds.Response) {
+					ch := make(chan interface{})
+					go func() {
+						defer close(ch)
+						ch <- req.Arguments()
+						res.SetError(errors.New("oops"), cmds.ErrNormal)
+					}()
+					res.SetOutput((<-chan interface{})(ch))
+				},
+			},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.JSCompat = true
+	server := httptest.NewServer(NewHandler(context.Background(), root, cfg))
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/api/v0/fail?arg[]=a&arg[]=b", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if _, ok := res.Trailer[StreamErrHeader]; !ok {
+		t.Errorf("Expected the %s trailer to be declared", StreamErrHeader)
+	}
+	if !strings.Contains(res.Header.Get(exposeHeadersHeader), channelHeader) {
+		t.Errorf("Expected %s to be exposed", channelHeader)
+	}
+
+	body, _ := ioutil.ReadAll(res.Body)
+	dec := json.NewDecoder(bytes.NewReader(body))
+
+	var args []string
+	if err := dec.Decode(&args); err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 2 || args[0] != "a" || args[1] != "b" {
+		t.Errorf("Expected args [a b], got %v", args)
+	}
+
+	var e jsStreamError
+	if err := dec.Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != "error" || e.Message != "oops" {
+		t.Errorf("Unexpected stream error object: %+v", e)
+	}
+}
+
+func TestInputSchema(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"put": {
+				InputSchema: cmds.Schema{
+					"type":     "object",
+					"required": []string{"key"},
+				},
+				Run: func(req cmds.Request, res cmds.Response) {
+					body, _ := ioutil.ReadAll(req.Files())
+					res.SetOutput(string(body))
+				},
+			},
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+
+	req, err := http.NewRequest("POST", server.URL+"/api/v0/put", strings.NewReader(`{"value": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(contentTypeHeader, applicationJson)
+	req.Header.Set(acceptHeader, ErrorContentType)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, res.StatusCode, http.StatusBadRequest)
+
+	var verr struct {
+		Kind    string
+		Details struct {
+			Errors cmds.ValidationError
+		}
+	}
+	if err := json.NewDecoder(res.Body).Decode(&verr); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if verr.Kind != ErrKindInvalidInput || len(verr.Details.Errors) != 1 || verr.Details.Errors[0].Path != "/key" {
+		t.Errorf("Expected a field error for /key, got %+v", verr)
+	}
+
+	res, err = http.Post(server.URL+"/api/v0/put", applicationJson, strings.NewReader(`{"key": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, res.StatusCode, http.StatusOK)
+
+	var body string
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if body != `{"key": 1}` {
+		t.Errorf("Expected the command to receive the body, got %q", body)
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.MaxJSONBodySize = 16
+	limited := httptest.NewServer(NewHandler(context.Background(), root, cfg))
+	defer limited.Close()
+
+	res, err = http.Post(limited.URL+"/api/v0/put", applicationJson, strings.NewReader(`{"key": "too long for the limit"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, res.StatusCode, http.StatusBadRequest)
+	res.Body.Close()
+
+	res, err = http.Post(limited.URL+"/api/v0/put", applicationJson, strings.NewReader(`{"key": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, res.StatusCode, http.StatusOK)
+	res.Body.Close()
+}
+
+func TestRequestMeta(t *testing.T) {
+	var id string
+	var meta map[string]string
+	sub := &cmds.Command{
+		Run: func(req cmds.Request, res cmds.Response) {
+			id = req.ID()
+			meta = req.Metadata()
+			res.SetOutput("ok")
+		},
+	}
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"test": sub,
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+
+	optDefs, err := root.GetOptions([]string{"test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := cmds.NewRequest([]string{"test"}, nil, nil, nil, sub, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetID("abc123")
+	req.SetMetadata("trace", "xyz")
+
+	res, err := NewClient(strings.TrimPrefix(server.URL, "http://")).Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error() != nil {
+		t.Fatal(res.Error())
+	}
+	res.Close()
+
+	if id != "abc123" {
+		t.Errorf("Expected request ID 'abc123', got %q", id)
+	}
+	if meta["trace"] != "xyz" {
+		t.Errorf("Expected metadata 'trace' to be 'xyz', got %v", meta)
+	}
+}
+
+func TestFraming(t *testing.T) {
+	sub := &cmds.Command{
+		Run: func(req cmds.Request, res cmds.Response) {
+			ch := make(chan interface{}, 3)
+			ch <- "a"
+			ch <- cmds.LogFrame("working")
+			ch <- "b"
+			close(ch)
+			res.SetOutput((<-chan interface{})(ch))
+		},
+		Type: "",
+	}
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"test": sub,
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	send := func(h cmds.FrameHandler) []string {
+		optDefs, err := root.GetOptions([]string{"test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := cmds.NewRequest([]string{"test"}, nil, nil, nil, sub, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != nil {
+			cmds.FrameHandlerKey.Set(req, h)
+		}
+
+		res, err := client.Send(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Close()
+
+		var values []string
+		for v := range res.Output().(<-chan interface{}) {
+			values = append(values, *v.(*string))
+		}
+		return values
+	}
+
+	var logs []interface{}
+	values := send(func(ft cmds.FrameType, v interface{}) {
+		if ft == cmds.FrameLog {
+			logs = append(logs, v)
+		}
+	})
+	if strings.Join(values, " ") != "a b" {
+		t.Errorf("Expected values [a b], got %v", values)
+	}
+	if len(logs) != 1 || logs[0] != "working" {
+		t.Errorf("Expected the log frame to be handled, got %v", logs)
+	}
+
+	// clients that don't ask for frames only get the values
+	values = send(nil)
+	if strings.Join(values, " ") != "a b" {
+		t.Errorf("Expected values [a b], got %v", values)
+	}
+}
+
+func TestCallbacks(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"ok": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					ch := make(chan interface{}, 5)
+					ch <- cmds.EventFrame(50.0)
+					ch <- "a"
+					ch <- cmds.LogFrame("careful")
+					ch <- cmds.ProgressFrame(cmds.Progress{Current: 2, Total: 4, Unit: "files"})
+					ch <- "b"
+					close(ch)
+					res.SetOutput((<-chan interface{})(ch))
+				},
+			},
+			"fail": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					res.SetError(errors.New("failed"), cmds.ErrNormal)
+				},
+			},
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	newRequest := func(name string) cmds.Request {
+		req, err := cmds.NewRequestBuilder(root).Path(name).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	var events []string
+	cb := Callbacks{
+		OnValue: func(v interface{}) { events = append(events, "value:"+v.(string)) },
+		OnProgress: func(v interface{}) {
+			if p, ok := v.(cmds.Progress); ok {
+				events = append(events, fmt.Sprintf("progress:%d/%d %s", p.Current, p.Total, p.Unit))
+				return
+			}
+			events = append(events, "progress")
+		},
+		OnWarning: func(v interface{}) { events = append(events, "warning:"+v.(string)) },
+		OnError:   func(err error) { events = append(events, "error:"+err.Error()) },
+		OnDone:    func() { events = append(events, "done") },
+	}
+
+	if err := SendWithCallbacks(client, newRequest("ok"), cb); err != nil {
+		t.Fatal(err)
+	}
+	expected := "progress value:a warning:careful progress:2/4 files value:b done"
+	if s := strings.Join(events, " "); s != expected {
+		t.Errorf("Expected callbacks %q, got %q", expected, s)
+	}
+
+	events = nil
+	if err := SendWithCallbacks(client, newRequest("fail"), cb); err == nil {
+		t.Error("Expected an error")
+	}
+	expected = "error:failed done"
+	if s := strings.Join(events, " "); s != expected {
+		t.Errorf("Expected callbacks %q, got %q", expected, s)
+	}
+}
+
+func TestStreamErrorCode(t *testing.T) {
+	sub := &cmds.Command{
+		Run: func(req cmds.Request, res cmds.Response) {
+			ch := make(chan interface{})
+			go func() {
+				defer close(ch)
+				ch <- "a"
+				res.SetError(cmds.WrapError(errors.New("bad value"), cmds.ErrClient, "bad-value"), cmds.ErrClient)
+			}()
+			res.SetOutput((<-chan interface{})(ch))
+		},
+		Type: "",
+	}
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"partial": sub,
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	req, err := cmds.NewRequestBuilder(root).Path("partial").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+
+	var values []string
+	for v := range res.Output().(<-chan interface{}) {
+		values = append(values, *v.(*string))
+	}
+	if len(values) != 1 || values[0] != "a" {
+		t.Errorf("Expected values [a], got %v", values)
+	}
+
+	e := res.Error()
+	if e == nil || e.Message != "bad value" || e.Code != cmds.ErrClient || e.Kind != "bad-value" {
+		t.Errorf("Expected the stream error with its code and kind, got %+v", e)
+	}
+}
+
+func TestTransferStats(t *testing.T) {
+	sub := &cmds.Command{
+		Arguments: []cmds.Argument{
+			cmds.FileArg("file", true, false, "a file"),
+		},
+		Run: func(req cmds.Request, res cmds.Response) {
+			f, err := req.Files().NextFile()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			b, err := ioutil.ReadAll(f)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			res.SetOutput(bytes.NewReader(bytes.Repeat(b, 2)))
+		},
+	}
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"double": sub,
+		},
+	}
+
+	done := make(chan *cmds.TransferStats, 1)
+	cfg := originCfg(defaultOrigins)
+	cfg.Metrics = func(req cmds.Request, stats *cmds.TransferStats) {
+		done <- stats
+	}
+	server := httptest.NewServer(NewHandler(context.Background(), root, cfg))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	file := files.NewReaderFile("a.txt", "a.txt", ioutil.NopCloser(strings.NewReader("hello")), nil)
+	req, err := cmds.NewRequestBuilder(root).
+		Path("double").
+		Files(files.NewSliceFile("", "", []files.File{file})).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(res.Output().(io.Reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Close()
+	if string(out) != "hellohello" {
+		t.Errorf("Unexpected output %q", out)
+	}
+
+	stats, ok := cmds.TransferStatsKey.Get(req).(*cmds.TransferStats)
+	if !ok {
+		t.Fatal("Expected the client to track the transfer")
+	}
+	if stats.Uploaded() == 0 || stats.Downloaded() != uint64(len(out)) {
+		t.Errorf("Unexpected client stats: %s", stats)
+	}
+
+	serverStats := <-done
+	if serverStats.Uploaded() != stats.Uploaded() || serverStats.Downloaded() != stats.Downloaded() {
+		t.Errorf("Expected the server stats (%s) to match the client stats (%s)", serverStats, stats)
+	}
+}
+
+func TestStructuredErrorResponse(t *testing.T) {
+	sub := &cmds.Command{
+		Run: func(req cmds.Request, res cmds.Response) {
+			e := cmds.WrapError(errors.New("no such key"), cmds.ErrClient, "not-found").WithDetail("key", "abc").WithHint("run put first")
+			res.SetError(e, cmds.ErrClient)
+		},
+	}
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"get": sub,
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	req, err := cmds.NewRequestBuilder(root).Path("get").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+
+	e := res.Error()
+	if e == nil || e.Kind != "not-found" || e.Code != cmds.ErrClient || e.Details["key"] != "abc" ||
+		len(e.Hints) != 1 || e.Hints[0] != "run put first" {
+		t.Errorf("Expected the structured error, got %+v", e)
+	}
+}
+
+func TestErrorContentType(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"get": &cmds.Command{
+				Run: func(req cmds.Request, res cmds.Response) {
+					e := cmds.WrapError(errors.New("no such key"), cmds.ErrClient, "not-found").WithDetail("key", "abc")
+					res.SetError(e, cmds.ErrClient)
+				},
+			},
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+
+	for _, enc := range []string{cmds.JSON, cmds.Text} {
+		req, err := http.NewRequest("POST", server.URL+"/api/v0/get?encoding="+enc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(acceptHeader, "text/plain, "+ErrorContentType+";q=0.9")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertStatus(t, res.StatusCode, http.StatusBadRequest)
+		if ct := res.Header.Get(contentTypeHeader); ct != ErrorContentType {
+			t.Errorf("Expected the %s error to have content type %q, got %q", enc, ErrorContentType, ct)
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		expected := map[string]interface{}{
+			"code":    float64(cmds.ErrClient),
+			"message": "no such key",
+			"kind":    "not-found",
+			"details": map[string]interface{}{"key": "abc"},
+		}
+		if !reflect.DeepEqual(body, expected) {
+			t.Errorf("Expected the %s error body %v, got %v", enc, expected, body)
+		}
+	}
+}
+
+func TestWireLog(t *testing.T) {
+	sub := &cmds.Command{
+		Run: func(req cmds.Request, res cmds.Response) {
+			ch := make(chan interface{}, 2)
+			ch <- cmds.LogFrame("working")
+			ch <- "done"
+			close(ch)
+			res.SetOutput((<-chan interface{})(ch))
+		},
+		Type: "",
+	}
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"work": sub,
+		},
+	}
+
+	var mu sync.Mutex
+	var serverLog, clientLog []string
+	logTo := func(lines *[]string) WireLogger {
+		return func(line string) {
+			mu.Lock()
+			defer mu.Unlock()
+			*lines = append(*lines, line)
+		}
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.WireLog = logTo(&serverLog)
+	server := httptest.NewServer(NewHandler(context.Background(), root, cfg))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	req, err := cmds.NewRequestBuilder(root).Path("work").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	WireLogKey.Set(req, logTo(&clientLog))
+	cmds.FrameHandlerKey.Set(req, func(cmds.FrameType, interface{}) {})
+
+	res, err := client.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range res.Output().(<-chan interface{}) {
+	}
+	res.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	contains := func(lines []string, prefix string) bool {
+		for _, l := range lines {
+			if strings.HasPrefix(l, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, prefix := range []string{"> POST /api/v0/work", "> " + framingHeader + ": 1", "< HTTP/1.1 200 OK", "< frame: log", "< frame: value", "< body: "} {
+		if !contains(clientLog, prefix) {
+			t.Errorf("Expected a client log line starting with %q in %q", prefix, clientLog)
+		}
+	}
+	for _, prefix := range []string{"< POST /api/v0/work", "> HTTP/1.1 200 OK", "> frame: log", "> body: "} {
+		if !contains(serverLog, prefix) {
+			t.Errorf("Expected a server log line starting with %q in %q", prefix, serverLog)
+		}
+	}
+}
+
+func TestFormatWireData(t *testing.T) {
+	if s := formatWireData([]byte("a\tb\n")); s != `"a\tb\n"` {
+		t.Errorf("Expected quoted text, got %s", s)
+	}
+	if s := formatWireData([]byte{0, 1, 2, 0xff}); s != "<4 bytes of binary data>" {
+		t.Errorf("Expected binary data to be summarized, got %s", s)
+	}
+	// a rune cut off by the truncation is still text
+	if s := formatWireData([]byte("h\xc3")); s != `"h"` {
+		t.Errorf("Expected a cut off rune to be dropped, got %s", s)
+	}
+}
+
+func TestTimeoutPolicy(t *testing.T) {
+	var deadlines []bool
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"wait": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					_, ok := req.Context().Deadline()
+					deadlines = append(deadlines, ok)
+					res.SetOutput("ok")
+				},
+			},
+		},
+	}
+
+	get := func(cfg *ServerConfig, query string) int {
+		server := httptest.NewServer(NewHandler(context.Background(), root, cfg))
+		defer server.Close()
+
+		res, err := http.Post(server.URL+"/api/v0/wait"+query, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		ioutil.ReadAll(res.Body)
+		return res.StatusCode
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.DefaultTimeout = time.Minute
+	if status := get(cfg, ""); status != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", status)
+	}
+	if status := get(cfg, "?timeout=none"); status != http.StatusBadRequest {
+		t.Errorf("Expected unlimited requests to be rejected, got %d", status)
+	}
+
+	cfg.AllowNoTimeout = true
+	if status := get(cfg, "?timeout=0"); status != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", status)
+	}
+
+	expected := []bool{true, false}
+	if len(deadlines) != 2 || deadlines[0] != expected[0] || deadlines[1] != expected[1] {
+		t.Errorf("Expected the default timeout, then none, got %v", deadlines)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"value": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					cmds.AddWarning(res, "value is stale")
+					res.SetOutput("a")
+				},
+				Type: "",
+			},
+			"stream": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					ch := make(chan interface{})
+					go func() {
+						defer close(ch)
+						ch <- "a"
+						cmds.AddWarning(res, "skipped b\nbad name")
+						ch <- "c"
+					}()
+					res.SetOutput((<-chan interface{})(ch))
+				},
+				Type: "",
+			},
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	for name, expected := range map[string][]string{
+		"value":  {"value is stale"},
+		"stream": {"skipped b"},
+	} {
+		req, err := cmds.NewRequestBuilder(root).Path(name).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Send(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ch, ok := res.Output().(<-chan interface{}); ok {
+			for range ch {
+			}
+		}
+		if res.Error() != nil {
+			t.Errorf("%s: unexpected error %v", name, res.Error())
+		}
+		if w := cmds.Warnings(res); !reflect.DeepEqual(w, expected) {
+			t.Errorf("%s: expected warnings %q, got %q", name, expected, w)
+		}
+		res.Close()
+	}
+}
+
+func TestValueStreamError(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"value": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					res.SetOutput("a")
+				},
+				Marshalers: cmds.MarshalerMap{
+					cmds.JSON: func(res cmds.Response) (io.Reader, error) {
+						fail := &cmds.Error{Message: "disk failed", Code: cmds.ErrNormal}
+						return io.MultiReader(strings.NewReader("\"a\"\n"), errorReader{fail}), nil
+					},
+				},
+				Type: "",
+			},
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	req, err := cmds.NewRequestBuilder(root).Path("value").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if res.Error() == nil || res.Error().Message != "disk failed" {
+		t.Errorf("Expected the stream error, got %v", res.Error())
+	}
+}
+
+// errorReader fails every read with err.
+type errorReader struct{ err error }
+
+func (r errorReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestBatchItemErrorsUnframed(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"batch": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					b := cmds.NewBatch(req, res)
+					go func() {
+						defer b.Close()
+						b.Emit("a")
+						b.Fail("b", errors.New("bad name"))
+					}()
+				},
+				Type: "",
+			},
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/api/v0/batch", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := ioutil.ReadAll(res.Body)
+	if strings.Contains(string(body), "bad name") {
+		t.Errorf("Expected no item error frames in the body, got %q", body)
+	}
+	if w := res.Trailer.Get(StreamWarningHeader); w != "b: bad name" {
+		t.Errorf("Expected the item error as a warning, got %q", w)
+	}
+	if k := res.Trailer.Get(StreamErrKindHeader); k != cmds.ErrKindPartialFailure {
+		t.Errorf("Expected a %s error, got %q", cmds.ErrKindPartialFailure, k)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	topic := cmds.NewTopic(4, 10)
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"watch": {
+				Subscribe: func(req cmds.Request) (*cmds.Topic, error) {
+					return topic, nil
+				},
+				Type: "",
+			},
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	defer func(d time.Duration) { SubscribeRetry = d }(SubscribeRetry)
+	SubscribeRetry = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := cmds.NewRequestBuilder(root).Path("watch").Context(ctx).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan cmds.Event, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- Subscribe(client, req, func(ev cmds.Event) { events <- ev })
+	}()
+
+	waitSubscribers := func(n int) {
+		for i := 0; topic.Subscribers() != n; i++ {
+			if i == 500 {
+				t.Fatalf("Expected %d subscribers, got %d", n, topic.Subscribers())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	expectEvent := func(id uint64, value string) {
+		select {
+		case ev := <-events:
+			if ev.ID != id || *ev.Value.(*string) != value {
+				t.Errorf("Expected event %d %q, got %d %v", id, value, ev.ID, ev.Value)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected event %d", id)
+		}
+	}
+
+	waitSubscribers(1)
+	topic.Publish("a")
+	topic.Publish("b")
+	expectEvent(1, "a")
+	expectEvent(2, "b")
+
+	// events published while the connection is down are replayed
+	server.CloseClientConnections()
+	topic.Publish("c")
+	expectEvent(3, "c")
+	topic.Publish("d")
+	expectEvent(4, "d")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestTrailers(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"count": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					ch := make(chan interface{})
+					go func() {
+						defer close(ch)
+						ch <- "a"
+						ch <- "b"
+						cmds.SetTrailer(res, "items", "2")
+					}()
+					res.SetOutput((<-chan interface{})(ch))
+				},
+				Type: "",
+			},
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	req, err := cmds.NewRequestBuilder(root).Path("count").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	for range res.Output().(<-chan interface{}) {
+	}
+
+	expected := map[string]string{"items": "2"}
+	if tr := cmds.Trailers(res); !reflect.DeepEqual(tr, expected) {
+		t.Errorf("Expected trailers %v, got %v", expected, tr)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	type out struct{ Value string }
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"value": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					res.SetOutput(&out{strings.Repeat("a", 1000)})
+				},
+				Type: out{},
+			},
+		},
+	}
+
+	cfg := originCfg(defaultOrigins)
+	cfg.Compress = true
+	server := httptest.NewServer(NewHandler(context.Background(), root, cfg))
+	defer server.Close()
+
+	req, err := http.NewRequest("POST", server.URL+"/api/v0/value", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if enc := res.Header.Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Expected a gzip encoded response, got %q", enc)
+	}
+	gz, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v out
+	if err := json.NewDecoder(gz).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Value != strings.Repeat("a", 1000) {
+		t.Errorf("Unexpected output %q", v.Value)
+	}
+
+	// the client negotiates compression transparently
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+	creq, err := cmds.NewRequestBuilder(root).Path("value").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cres, err := client.Send(creq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := cres.Output().(*out); !ok || len(v.Value) != 1000 {
+		t.Errorf("Unexpected client output %#v", cres.Output())
+	}
+
+	for h, expected := range map[string]bool{
+		"gzip":                true,
+		"deflate, gzip;q=0.5": true,
+		"GZIP":                true,
+		"*":                   true,
+		"gzip;q=0":            false,
+		"deflate":             false,
+		"":                    false,
+	} {
+		r := &http.Request{Header: http.Header{}}
+		if h != "" {
+			r.Header.Set("Accept-Encoding", h)
+		}
+		if acceptsGzip(r) != expected {
+			t.Errorf("Accept-Encoding %q: expected %v", h, expected)
+		}
+	}
+}
+
+func TestItemCount(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"list": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					ch := make(chan interface{}, 3)
+					ch <- "a"
+					ch <- "b"
+					ch <- "c"
+					close(ch)
+					cmds.SetItemCount(res, 3)
+					res.SetOutput((<-chan interface{})(ch))
+				},
+				Type: "",
+			},
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(context.Background(), root, originCfg(defaultOrigins)))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	req, err := cmds.NewRequestBuilder(root).Path("list").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if n := cmds.ItemCount(res); n != 3 {
+		t.Errorf("Expected an item count of 3, got %d", n)
+	}
+	for range res.Output().(<-chan interface{}) {
+	}
+}
+
+func TestCORSConfig(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"version": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					res.SetOutput("1.0")
+				},
+			},
+		},
+	}
+
+	do := func(cfg *ServerConfig, method, origin string, hdrs map[string]string) *http.Response {
+		server := httptest.NewServer(NewHandler(context.Background(), root, cfg))
+		defer server.Close()
+
+		req, err := http.NewRequest(method, server.URL+"/api/v0/version", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", origin)
+		for k, v := range hdrs {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	// the defaults don't allow any origin
+	res := do(&ServerConfig{}, "POST", "http://example.com", nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the default config to reject origins, got status %d", res.StatusCode)
+	}
+	if o := res.Header.Get(ACAOrigin); o != "" {
+		t.Errorf("Expected no %s header, got %q", ACAOrigin, o)
+	}
+
+	cfg := NewServerConfig()
+	cfg.SetAllowedOrigins("http://localhost:3000")
+	cfg.AppendAllowedOrigins("http://example.com")
+	cfg.SetAllowedHeaders("X-Requested-With")
+	cfg.SetAllowCredentials(true)
+	if o := cfg.AllowedOrigins(); len(o) != 2 {
+		t.Fatalf("Expected 2 allowed origins, got %v", o)
+	}
+
+	res = do(cfg, "POST", "http://example.com", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected an allowed origin to be accepted, got status %d", res.StatusCode)
+	}
+	if o := res.Header.Get(ACAOrigin); o != "http://example.com" {
+		t.Errorf("Expected %s to be %q, got %q", ACAOrigin, "http://example.com", o)
+	}
+	if c := res.Header.Get(ACACredentials); c != "true" {
+		t.Errorf("Expected %s to be %q, got %q", ACACredentials, "true", c)
+	}
+
+	res = do(cfg, "OPTIONS", "http://example.com", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "x-requested-with",
+	})
+	if m := res.Header.Get(ACAMethods); m != "POST" {
+		t.Errorf("Expected %s to be %q, got %q", ACAMethods, "POST", m)
+	}
+
+	// only POST is allowed by default
+	res = do(cfg, "OPTIONS", "http://example.com", map[string]string{
+		"Access-Control-Request-Method": "PUT",
+	})
+	if m := res.Header.Get(ACAMethods); m != "" {
+		t.Errorf("Expected PUT not to be allowed, got %s %q", ACAMethods, m)
+	}
+
+	cfg = NewServerConfig()
+	cfg.SetAllowedOrigins("http://example.com")
+	cfg.SetAllowedMethods("GET", "POST")
+	res = do(cfg, "OPTIONS", "http://example.com", map[string]string{
+		"Access-Control-Request-Method": "GET",
+	})
+	if m := res.Header.Get(ACAMethods); m != "GET" {
+		t.Errorf("Expected %s to be %q, got %q", ACAMethods, "GET", m)
+	}
+	if m := cfg.AllowedMethods(); len(m) != 2 {
+		t.Errorf("Expected 2 allowed methods, got %v", m)
+	}
+}
+
+func TestLocalOptionsNotSent(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"opts": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					res.SetOutput(req.Options())
+				},
+			},
+		},
+	}
+	optDefs, err := root.GetOptions([]string{"opts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := cmds.NewRequest([]string{"opts"}, cmds.OptMap{
+		cmds.ColorOpt:   "never",
+		cmds.NoPagerOpt: true,
+		cmds.TimeoutOpt: "1m",
+	}, nil, nil, root.Subcommands["opts"], optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, err := getQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := values[cmds.ColorOpt]; ok {
+		t.Errorf("Expected --%s not to be sent, got %q", cmds.ColorOpt, query)
+	}
+	if _, ok := values[cmds.NoPagerOpt]; ok {
+		t.Errorf("Expected --%s not to be sent, got %q", cmds.NoPagerOpt, query)
+	}
+	if values.Get(cmds.TimeoutOpt) != "1m" {
+		t.Errorf("Expected --%s to be sent, got %q", cmds.TimeoutOpt, query)
+	}
+}
+
+func TestLegacyErrors(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"get": {
+				Run: func(req cmds.Request, res cmds.Response) {
+					res.SetError(cmds.WrapError(errors.New("no such key"), cmds.ErrClient, "not-found"), cmds.ErrClient)
+				},
+			},
+		},
+	}
+
+	post := func(cfg *ServerConfig, path, accept string) (*http.Response, map[string]interface{}) {
+		server := httptest.NewServer(NewHandler(context.Background(), root, cfg))
+		defer server.Close()
+
+		req, err := http.NewRequest("POST", server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set(acceptHeader, accept)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return res, body
+	}
+
+	jsCfg := originCfg(defaultOrigins)
+	jsCfg.JSCompat = true
+	for _, c := range []struct {
+		cfg    *ServerConfig
+		path   string
+		accept string
+		status int
+		msg    string
+	}{
+		{originCfg(defaultOrigins), "/api/v0/get", "", http.StatusBadRequest, "no such key"},
+		{jsCfg, "/api/v0/get", ErrorContentType, http.StatusBadRequest, "no such key"},
+		{originCfg(defaultOrigins), "/api/v0/missing", "", http.StatusNotFound, ErrNotFound.Error()},
+		{originCfg(defaultOrigins), "/api/v0/get?timeout=none", "", http.StatusBadRequest, ErrTimeoutRequired.Error()},
+	} {
+		res, body := post(c.cfg, c.path, c.accept)
+		assertStatus(t, res.StatusCode, c.status)
+		if ct := res.Header.Get(contentTypeHeader); ct != applicationJson {
+			t.Errorf("%s: expected content type %q, got %q", c.path, applicationJson, ct)
+		}
+		expected := map[string]interface{}{
+			"Message": c.msg,
+			"Code":    float64(cmds.ErrClient),
+			"Type":    "error",
+		}
+		if !reflect.DeepEqual(body, expected) {
+			t.Errorf("%s: expected the error body %v, got %v", c.path, expected, body)
+		}
+	}
+
+	// the other errors are structured too
+	res, body := post(originCfg(defaultOrigins), "/api/v0/missing", ErrorContentType)
+	if ct := res.Header.Get(contentTypeHeader); ct != ErrorContentType || body["kind"] != ErrKindNotFound {
+		t.Errorf("Expected a structured not-found error, got %q %v", ct, body)
+	}
+}
+
+func TestWireLogRedaction(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"login": {
+				Options: []cmds.Option{cmds.SecretOption("password", "The password")},
+				Run: func(req cmds.Request, res cmds.Response) {
+					res.SetOutput("ok")
+				},
+			},
+		},
+	}
+
+	var mu sync.Mutex
+	var lines []string
+	wlog := WireLogger(func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, line)
+	})
+
+	cfg := originCfg(defaultOrigins)
+	cfg.WireLog = wlog
+	cfg.AuthTokens = []string{"t0ken"}
+	server := httptest.NewServer(NewHandler(context.Background(), root, cfg))
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	req, err := cmds.NewRequestBuilder(root).Path("login").Option("password", "s3cret").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	WireLogKey.Set(req, wlog)
+	AuthTokenKey.Set(req, "t0ken")
+	res, err := client.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := res.Error(); e != nil {
+		t.Fatal(e)
+	}
+	res.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	redacted := 0
+	for _, l := range lines {
+		if strings.Contains(l, "s3cret") || strings.Contains(l, "t0ken") {
+			t.Errorf("Expected the secrets to be redacted, got %q", l)
+		}
+		if strings.Contains(l, "password="+cmds.Redacted) || strings.Contains(l, authorizationHeader+": "+cmds.Redacted) {
+			redacted++
+		}
+	}
+	if redacted != 4 {
+		t.Errorf("Expected the password and the token to be redacted on both sides, got %q", lines)
+	}
+}
@@ -27,6 +27,15 @@ type MultiFileReader struct {
 	// if true, the data will be type 'multipart/form-data'
 	// if false, the data will be type 'multipart/mixed'
 	form bool
+
+	// SkipEmptyDirs omits directories without any entries from the data.
+	// Otherwise they are sent as 'application/x-directory' marker parts, since
+	// an empty 'multipart/mixed' part can't be told apart from a missing one.
+	SkipEmptyDirs bool
+
+	// OnFileData, if set, is called with the number of bytes of file contents
+	// read, leaving out the boundaries and headers of the parts.
+	OnFileData func(n int)
 }
 
 // NewMultiFileReader constructs a MultiFileReader. `file` can be any `commands.File`.
@@ -54,7 +63,7 @@ func (mfr *MultiFileReader) Read(buf []byte) (written int, err error) {
 
 	// if the current file isn't set, advance to the next file
 	if mfr.currentFile == nil {
-		file, err := mfr.files.NextFile()
+		file, err := mfr.nextFile()
 		if err == io.EOF {
 			mfr.mpWriter.Close()
 			mfr.closed = true
@@ -70,10 +79,16 @@ func (mfr *MultiFileReader) Read(buf []byte) (written int, err error) {
 				mfr.currentFile = s
 
 				contentType = "application/symlink"
+			} else if e, ok := file.(*emptyDir); ok {
+				// empty directories are sent as a marker part with no content
+				mfr.currentFile = e
+				contentType = "application/x-directory"
 			} else if file.IsDirectory() {
 				// if file is a directory, create a multifilereader from it
 				// (using 'multipart/mixed')
 				nmfr := NewMultiFileReader(file, false)
+				nmfr.SkipEmptyDirs = mfr.SkipEmptyDirs
+				nmfr.OnFileData = mfr.OnFileData
 				mfr.currentFile = nmfr
 				contentType = fmt.Sprintf("multipart/mixed; boundary=%s", nmfr.Boundary())
 			} else {
@@ -93,6 +108,7 @@ func (mfr *MultiFileReader) Read(buf []byte) (written int, err error) {
 			}
 
 			header.Set("Content-Type", contentType)
+			files.FileMetadata(unwrapFile(file)).WriteHeader(header)
 
 			_, err := mfr.mpWriter.CreatePart(header)
 			if err != nil {
@@ -108,6 +124,10 @@ func (mfr *MultiFileReader) Read(buf []byte) (written int, err error) {
 
 	// otherwise, read from file data
 	written, err = mfr.currentFile.Read(buf)
+	if _, nested := mfr.currentFile.(*MultiFileReader); !nested && mfr.OnFileData != nil && written > 0 {
+		// nested readers report the contents of their own files
+		mfr.OnFileData(written)
+	}
 	if err == io.EOF {
 		mfr.currentFile = nil
 		return written, nil
@@ -119,3 +139,65 @@ func (mfr *MultiFileReader) Read(buf []byte) (written int, err error) {
 func (mfr *MultiFileReader) Boundary() string {
 	return mfr.mpWriter.Boundary()
 }
+
+// nextFile returns the next file to write. Directories are checked for
+// entries, so empty ones can be skipped or sent as a marker.
+func (mfr *MultiFileReader) nextFile() (files.File, error) {
+	for {
+		file, err := mfr.files.NextFile()
+		if err != nil {
+			return nil, err
+		}
+
+		if !file.IsDirectory() {
+			return file, nil
+		}
+
+		first, err := file.NextFile()
+		if err == io.EOF {
+			if mfr.SkipEmptyDirs {
+				continue
+			}
+			return &emptyDir{file}, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		return &peekedDir{File: file, first: first}, nil
+	}
+}
+
+// unwrapFile returns the file an emptyDir or peekedDir wraps
+func unwrapFile(file files.File) files.File {
+	switch f := file.(type) {
+	case *emptyDir:
+		return f.File
+	case *peekedDir:
+		return f.File
+	}
+	return file
+}
+
+// emptyDir is a directory without entries. It reads as an empty marker part.
+type emptyDir struct {
+	files.File
+}
+
+func (e *emptyDir) Read(buf []byte) (int, error) {
+	return 0, io.EOF
+}
+
+// peekedDir is a directory whose first entry was already read from it.
+type peekedDir struct {
+	files.File
+	first files.File
+}
+
+func (d *peekedDir) NextFile() (files.File, error) {
+	if d.first != nil {
+		f := d.first
+		d.first = nil
+		return f, nil
+	}
+	return d.File.NextFile()
+}
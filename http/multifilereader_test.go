@@ -4,9 +4,13 @@ import (
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	cmds "github.com/ipfs/go-commands"
 	files "github.com/ipfs/go-commands/files"
 )
 
@@ -104,3 +108,202 @@ func TestOutput(t *testing.T) {
 		t.Error("Expected to get (nil, io.EOF)")
 	}
 }
+
+func TestEmptyDirs(t *testing.T) {
+	newFiles := func() files.File {
+		return files.NewSliceFile("", "", []files.File{
+			files.NewSliceFile("empty", "empty", []files.File{}),
+			files.NewReaderFile("a.txt", "a.txt", ioutil.NopCloser(strings.NewReader("a")), nil),
+		})
+	}
+
+	mfr := NewMultiFileReader(newFiles(), true)
+	mpf := &files.MultipartFile{Mediatype: "multipart/form-data", Reader: multipart.NewReader(mfr, mfr.Boundary())}
+
+	dir, err := mpf.NextFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dir.IsDirectory() || dir.FileName() != "empty" {
+		t.Fatalf("Expected empty directory \"empty\", got %q", dir.FileName())
+	}
+	if child, err := dir.NextFile(); child != nil || err != io.EOF {
+		t.Error("Expected the directory to have no entries")
+	}
+
+	file, err := mpf.NextFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.FileName() != "a.txt" {
+		t.Errorf("Expected \"a.txt\", got %q", file.FileName())
+	}
+
+	mfr = NewMultiFileReader(newFiles(), true)
+	mfr.SkipEmptyDirs = true
+	mpf = &files.MultipartFile{Mediatype: "multipart/form-data", Reader: multipart.NewReader(mfr, mfr.Boundary())}
+
+	file, err = mpf.NextFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.FileName() != "a.txt" {
+		t.Errorf("Expected the empty directory to be skipped, got %q", file.FileName())
+	}
+	if file, err := mpf.NextFile(); file != nil || err != io.EOF {
+		t.Error("Expected to get (nil, io.EOF)")
+	}
+}
+
+func TestFileMetadata(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Close()
+
+	mtime := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chmod(tmp.Name(), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmp.Name(), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files.RegisterMetadataProvider(func(f files.File, m files.Metadata) {
+		if f.FileName() == "a.txt" {
+			m["owner"] = "alice & bob"
+			m["note"] = "line\r\nX-Injected: 1"
+			m["bad\r\nX-Injected: 1\r\nX"] = "value"
+		}
+	})
+
+	sf := files.NewSliceFile("", "", []files.File{
+		files.NewReaderFile("a.txt", "a.txt", ioutil.NopCloser(strings.NewReader("a")), stat),
+		files.NewLinkFile("link", "link", "a.txt", nil),
+	})
+	mfr := NewMultiFileReader(sf, true)
+	mpReader := multipart.NewReader(mfr, mfr.Boundary())
+
+	part, err := mpReader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := part.Header["X-Injected"]; ok || len(part.Header) != 6 {
+		t.Errorf("Expected invalid metadata keys to be skipped, got %v", part.Header)
+	}
+	f, err := files.NewFileFromPart(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := files.FileMetadata(f)
+	if mode, ok := meta.Mode(); !ok || mode != 0640 {
+		t.Errorf("Expected mode 0640, got %o (%v)", mode, ok)
+	}
+	if mt, ok := meta.ModTime(); !ok || !mt.Equal(mtime) {
+		t.Errorf("Expected mtime %s, got %s (%v)", mtime, mt, ok)
+	}
+	if meta["owner"] != "alice & bob" || meta["note"] != "line\r\nX-Injected: 1" {
+		t.Errorf("Expected the provided metadata, got %v", meta)
+	}
+
+	part, err = mpReader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err = files.NewFileFromPart(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta = files.FileMetadata(f)
+	if meta[files.MetaTarget] != "a.txt" {
+		t.Errorf("Expected the symlink target in the metadata, got %v", meta)
+	}
+	if _, ok := meta["owner"]; ok {
+		t.Error("Expected no provided metadata for the symlink")
+	}
+}
+
+func TestSymlinkRoundTrip(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "symlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	sf := files.NewSliceFile("", "", []files.File{
+		files.NewSliceFile("dir", "dir", []files.File{
+			files.NewReaderFile("dir/a.txt", "dir/a.txt", ioutil.NopCloser(strings.NewReader("a")), nil),
+			files.NewLinkFile("dir/link", "dir/link", "a.txt", nil),
+		}),
+	})
+	mfr := NewMultiFileReader(sf, true)
+	mpReader := multipart.NewReader(mfr, mfr.Boundary())
+
+	part, err := mpReader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := files.NewFileFromPart(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(tmp, "dir")
+	if err := files.WriteTo(dir, out); err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.Readlink(filepath.Join(out, "link"))
+	if err != nil || target != "a.txt" {
+		t.Errorf("Expected the symlink to be kept, got %q (%v)", target, err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(out, "link")); err != nil || string(b) != "a" {
+		t.Errorf("Expected the link to resolve to a.txt, got %q (%v)", b, err)
+	}
+}
+
+func TestUploadProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.txt": "bleep", "sub/b.txt": "bloop!"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stat, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := files.NewSerialFile("dir", dir, stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf := files.NewSliceFile("", "", []files.File{f})
+
+	var last cmds.Progress
+	mfr := NewMultiFileReader(sf, true)
+	mfr.OnFileData = uploadProgress(sf, func(p cmds.Progress) { last = p })
+	if _, err := ioutil.ReadAll(mfr); err != nil {
+		t.Fatal(err)
+	}
+
+	if last.Current != 11 || last.Unit != "bytes" {
+		t.Errorf("expected 11 bytes of file contents, got %+v", last)
+	}
+	if last.Total != 11 {
+		t.Errorf("expected a total of 11 bytes, got %d", last.Total)
+	}
+}
@@ -1,20 +1,25 @@
 package http
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 
 	cmds "github.com/ipfs/go-commands"
 	files "github.com/ipfs/go-commands/files"
 )
 
-// Parse parses the data in a http.Request and returns a command Request object
-func Parse(r *http.Request, root *cmds.Command) (cmds.Request, error) {
+// resolvePath returns the path and the command of the URL of r, and the
+// argument that is passed in the path, if any.
+func resolvePath(r *http.Request, root *cmds.Command) ([]string, *cmds.Command, []string, error) {
 	if !strings.HasPrefix(r.URL.Path, ApiPath) {
-		return nil, errors.New("Unexpected path prefix")
+		return nil, nil, nil, errors.New("Unexpected path prefix")
 	}
 	path := strings.Split(strings.TrimPrefix(r.URL.Path, ApiPath+"/"), "/")
 
@@ -23,11 +28,11 @@ func Parse(r *http.Request, root *cmds.Command) (cmds.Request, error) {
 	cmd, err := root.Get(path[:len(path)-1])
 	if err != nil {
 		// 404 if there is no command at that path
-		return nil, ErrNotFound
+		return nil, nil, nil, ErrNotFound
 
 	} else if sub := cmd.Subcommand(path[len(path)-1]); sub == nil {
 		if len(path) <= 1 {
-			return nil, ErrNotFound
+			return nil, nil, nil, ErrNotFound
 		}
 
 		// if the last string in the path isn't a subcommand, use it as an argument
@@ -38,6 +43,21 @@ func Parse(r *http.Request, root *cmds.Command) (cmds.Request, error) {
 	} else {
 		cmd = sub
 	}
+	return path, cmd, stringArgs, nil
+}
+
+// Parse parses the data in a http.Request and returns a command Request object
+func Parse(r *http.Request, root *cmds.Command) (cmds.Request, error) {
+	return parse(nil, r, root, DefaultMaxJSONBodySize)
+}
+
+// parse is Parse, with maxJSON as the size limit of JSON bodies. w is told
+// to close the connection if a body is too large, it may be nil.
+func parse(w http.ResponseWriter, r *http.Request, root *cmds.Command, maxJSON int64) (cmds.Request, error) {
+	path, cmd, stringArgs, err := resolvePath(r, root)
+	if err != nil {
+		return nil, err
+	}
 
 	opts, stringArgs2 := parseOptions(r)
 	stringArgs = append(stringArgs, stringArgs2...)
@@ -95,13 +115,23 @@ func Parse(r *http.Request, root *cmds.Command) (cmds.Request, error) {
 	contentType := r.Header.Get(contentTypeHeader)
 	mediatype, _, _ := mime.ParseMediaType(contentType)
 
-	var f *files.MultipartFile
-	if mediatype == "multipart/form-data" {
-		f = &files.MultipartFile{Mediatype: mediatype}
-		f.Reader, err = r.MultipartReader()
+	var f files.File
+	switch mediatype {
+	case "multipart/form-data":
+		mpf := &files.MultipartFile{Mediatype: mediatype}
+		mpf.Reader, err = r.MultipartReader()
 		if err != nil {
 			return nil, err
 		}
+		f = mpf
+
+	case applicationJson:
+		if cmd.InputSchema != nil {
+			f, err = parseJSONBody(w, r, cmd.InputSchema, maxJSON)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// if there is a required filearg, error if no files were provided
@@ -113,15 +143,40 @@ func Parse(r *http.Request, root *cmds.Command) (cmds.Request, error) {
 	if err != nil {
 		return nil, err
 	}
+	// remote requests have no stdin, the server's isn't the client's
+	req.SetStdin(nil)
 
 	err = cmd.CheckArguments(req)
 	if err != nil {
 		return nil, err
 	}
 
+	parseRequestMeta(r, req)
+
 	return req, nil
 }
 
+// parseRequestMeta sets the ID, metadata and last event ID sent by the
+// client on req. Header names are case-insensitive, so metadata keys are
+// lowercased.
+func parseRequestMeta(r *http.Request, req cmds.Request) {
+	if id := r.Header.Get(requestIDHeader); id != "" {
+		req.SetID(id)
+	}
+	if id, err := strconv.ParseUint(r.Header.Get(lastEventIDHeader), 10, 64); err == nil {
+		cmds.LastEventIDKey.Set(req, id)
+	}
+
+	for k, v := range r.Header {
+		if len(v) == 0 || len(k) <= len(requestMetaHeaderPrefix) {
+			continue
+		}
+		if strings.EqualFold(k[:len(requestMetaHeaderPrefix)], requestMetaHeaderPrefix) {
+			req.SetMetadata(strings.ToLower(k[len(requestMetaHeaderPrefix):]), v[0])
+		}
+	}
+}
+
 func parseOptions(r *http.Request) (map[string]interface{}, []string) {
 	opts := make(map[string]interface{})
 	var args []string
@@ -144,3 +199,26 @@ func parseOptions(r *http.Request) (map[string]interface{}, []string) {
 
 	return opts, args
 }
+
+// parseJSONBody validates a JSON request body against the command's input
+// schema. The body is passed on to the command as a file. Bodies larger than
+// max bytes are rejected.
+func parseJSONBody(w http.ResponseWriter, r *http.Request, schema cmds.Schema, max int64) (files.File, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, max))
+	if err != nil {
+		if int64(len(body)) >= max {
+			return nil, fmt.Errorf("JSON body is larger than %d bytes", max)
+		}
+		return nil, err
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, fmt.Errorf("Invalid JSON body: %s", err)
+	}
+	if err := schema.Validate(v); err != nil {
+		return nil, err
+	}
+
+	return files.NewReaderFile("", "", ioutil.NopCloser(bytes.NewReader(body)), nil), nil
+}
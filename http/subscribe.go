@@ -0,0 +1,56 @@
+package http
+
+import (
+	"time"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// SubscribeRetry is how long Subscribe waits before reconnecting.
+var SubscribeRetry = time.Second
+
+// Subscribe sends the request of a subscribe command (see
+// cmds.Command.Subscribe) with c, and calls handle with the events it
+// receives. When the connection breaks, or the server drops the subscriber
+// for falling behind, it reconnects, resuming after the last event handled.
+// It returns nil once the request is cancelled, or the error of a request the
+// server refused.
+func Subscribe(c Client, req cmds.Request, handle func(cmds.Event)) error {
+	ctx := req.Context()
+	for {
+		res, err := c.Send(req)
+		if err == nil {
+			if e := res.Error(); e != nil {
+				res.Close()
+				return e
+			}
+
+			// the stream only ends early if the response is closed
+			stop := make(chan struct{})
+			go func() {
+				select {
+				case <-ctx.Done():
+					res.Close()
+				case <-stop:
+				}
+			}()
+
+			if ch, ok := res.Output().(<-chan interface{}); ok {
+				for v := range ch {
+					if ev, ok := v.(cmds.Event); ok {
+						cmds.LastEventIDKey.Set(req, ev.ID)
+						handle(ev)
+					}
+				}
+			}
+			close(stop)
+			res.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(SubscribeRetry):
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	context "golang.org/x/net/context"
+
+	cmds "github.com/ipfs/go-commands"
+)
+
+// WireLogger receives the lines of the wire log of requests: the request
+// and status lines, headers, frame types and the start of bodies. Lines
+// start with "> " for data that's sent, "< " for data that's received and
+// "! " for transport errors.
+type WireLogger func(line string)
+
+// WireLogKey enables the wire log of a request sent by the client. Servers
+// log with ServerConfig.WireLog.
+var WireLogKey = cmds.NewKey("http.wireLog", WireLogger(nil))
+
+// wireLogBodyLimit is the number of bytes of a body that are logged
+const wireLogBodyLimit = 512
+
+func (l WireLogger) logf(format string, args ...interface{}) {
+	if l != nil {
+		l(fmt.Sprintf(format, args...))
+	}
+}
+
+// redactedHeaders are the headers carrying credentials, the values of which
+// aren't logged
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// request logs the request line of a request for u, with the values of the
+// query parameters for which secret returns true redacted (see
+// cmds.SecretOption).
+func (l WireLogger) request(prefix, method string, u *url.URL, proto string, secret func(name string) bool) {
+	if l == nil {
+		return
+	}
+
+	uri := u.RequestURI()
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		for i, p := range params {
+			k := strings.SplitN(p, "=", 2)[0]
+			if name, err := url.QueryUnescape(k); err == nil && secret(name) {
+				params[i] = k + "=" + cmds.Redacted
+			}
+		}
+		c := *u
+		c.RawQuery = strings.Join(params, "&")
+		uri = c.RequestURI()
+	}
+	l.logf("%s%s %s %s", prefix, method, uri, proto)
+}
+
+// headers logs h, sorted by name. The values of the headers carrying
+// credentials are redacted.
+func (l WireLogger) headers(prefix string, h http.Header) {
+	if l == nil {
+		return
+	}
+
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, v := range h[name] {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] {
+				v = cmds.Redacted
+			}
+			l.logf("%s%s: %s", prefix, name, v)
+		}
+	}
+}
+
+// tap returns a reader that logs the start of the data read from r, and its
+// length when it's read to the end.
+func (l WireLogger) tap(prefix string, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &wireTap{r: r, log: l, prefix: prefix}
+}
+
+// tapBody taps the body of an HTTP request or response, keeping its Closer
+func (l WireLogger) tapBody(prefix string, body io.ReadCloser) io.ReadCloser {
+	if l == nil {
+		return body
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{l.tap(prefix, body), body}
+}
+
+// frames logs the types of the frames of an output channel as they are sent,
+// until in is closed or ctx is done.
+func (l WireLogger) frames(ctx context.Context, prefix string, in <-chan interface{}) <-chan interface{} {
+	if l == nil {
+		return in
+	}
+
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		for v := range in {
+			t := cmds.FrameValue
+			if f, ok := v.(cmds.Frame); ok {
+				t = f.Type
+			}
+			l.logf("%sframe: %s", prefix, t)
+
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+type wireTap struct {
+	r      io.Reader
+	log    WireLogger
+	prefix string
+	n      int
+}
+
+func (t *wireTap) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 && t.n < wireLogBodyLimit {
+		logged := p[:n]
+		if t.n+n > wireLogBodyLimit {
+			logged = logged[:wireLogBodyLimit-t.n]
+		}
+		t.log.logf("%sbody: %s", t.prefix, formatWireData(logged))
+	}
+	t.n += n
+
+	if err == io.EOF {
+		t.log.logf("%sbody end (%d bytes)", t.prefix, t.n)
+	}
+	return n, err
+}
+
+// formatWireData quotes b, or summarizes it if it's binary data
+func formatWireData(b []byte) string {
+	// drop a rune that was cut off by the truncation
+	text := b
+	for i := 0; i < utf8.UTFMax-1 && len(text) > 0 && !utf8.Valid(text); i++ {
+		text = text[:len(text)-1]
+	}
+
+	if isBinary(text) {
+		return fmt.Sprintf("<%d bytes of binary data>", len(b))
+	}
+	return strconv.Quote(string(text))
+}
+
+// isBinary returns true if b isn't UTF-8 text
+func isBinary(b []byte) bool {
+	if !utf8.Valid(b) {
+		return true
+	}
+	for _, c := range b {
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The checks of Lint, which name the kind of mistake a LintFinding reports.
+const (
+	LintMissingHelp    = "missing-help"
+	LintOptionType     = "option-type"
+	LintAliasConflict  = "alias-conflict"
+	LintUnreachable    = "unreachable"
+	LintMissingType    = "missing-type"
+	LintArgumentOrder  = "argument-order"
+	LintSensitiveField = "sensitive-field"
+)
+
+// LintFinding is a mistake Lint found in a command tree.
+type LintFinding struct {
+	Path    []string // of the command, empty for the root
+	Check   string   // e.g. LintMissingHelp
+	Message string
+}
+
+func (f LintFinding) String() string {
+	path := strings.Join(f.Path, " ")
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("%s: %s: %s", path, f.Check, f.Message)
+}
+
+// Lint checks the tree of commands rooted at root for common authoring
+// mistakes, e.g. in the tests of downstream projects. Findings are sorted by
+// command path, and in the order of the checks for each command.
+func Lint(root *Command) []LintFinding {
+	var findings []LintFinding
+	lintCommand(root, nil, map[string][]string{}, &findings)
+	return findings
+}
+
+// lintCommand checks cmd, where inherited maps the option names of its
+// ancestors (and the global options) to the paths that declare them.
+func lintCommand(cmd *Command, path []string, inherited map[string][]string, findings *[]LintFinding) {
+	report := func(check, format string, args ...interface{}) {
+		*findings = append(*findings, LintFinding{
+			Path:    path,
+			Check:   check,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if len(path) > 0 && cmd.Helptext.Tagline == "" {
+		report(LintMissingHelp, "the command has no tagline")
+	}
+	for _, opt := range cmd.Options {
+		if opt.Description() == "" {
+			report(LintMissingHelp, "option '%s' has no description", opt.Names()[0])
+		}
+	}
+	for _, arg := range cmd.Arguments {
+		if arg.Description == "" {
+			report(LintMissingHelp, "argument '%s' has no description", arg.Name)
+		}
+	}
+
+	for _, opt := range cmd.Options {
+		if _, ok := converters[opt.Type()]; !ok && opt.Type() != String {
+			report(LintOptionType, "option '%s' has the unsupported type %s", opt.Names()[0], opt.Type())
+		}
+	}
+
+	// option names are shared with the ancestors and global options
+	declared := make(map[string][]string, len(inherited))
+	for name, p := range inherited {
+		declared[name] = p
+	}
+	if len(path) == 0 {
+		for _, opt := range globalOptions {
+			if overridableGlobals[opt] {
+				continue // commands may have options of their own instead
+			}
+			for _, name := range opt.Names() {
+				declared[name] = nil
+			}
+		}
+	}
+	for _, opt := range cmd.Options {
+		for _, name := range opt.Names() {
+			if p, ok := declared[name]; ok {
+				where := "a global option"
+				if p != nil {
+					where = "an option of " + strings.Join(p, " ")
+					if len(p) == 0 {
+						where = "an option of the root"
+					}
+				}
+				report(LintAliasConflict, "option name '%s' is already %s", name, where)
+				continue
+			}
+			declared[name] = append([]string{}, path...)
+		}
+	}
+
+	for i, arg := range cmd.Arguments {
+		if arg.Variadic && i < len(cmd.Arguments)-1 {
+			report(LintArgumentOrder, "variadic argument '%s' isn't the last argument", arg.Name)
+		}
+	}
+
+	callable := cmd.Run != nil || cmd.Subscribe != nil
+	if !callable && len(cmd.Subcommands) == 0 && len(path) > 0 {
+		report(LintUnreachable, "the command has neither a Run function nor subcommands")
+	}
+	if cmd.DefaultSubcommand != "" {
+		if _, ok := cmd.Subcommands[cmd.DefaultSubcommand]; !ok {
+			report(LintUnreachable, "the default subcommand '%s' doesn't exist", cmd.DefaultSubcommand)
+		} else if callable {
+			report(LintUnreachable, "the default subcommand '%s' is never used, the command has a Run function", cmd.DefaultSubcommand)
+		}
+	}
+	if cmd.Run != nil && cmd.Type == nil && !cmd.RawOutput {
+		report(LintMissingType, "the command has a Run function but no output Type")
+	}
+	if cmd.Type != nil {
+		for _, name := range unexportedSensitive(reflect.TypeOf(cmd.Type), map[reflect.Type]bool{}) {
+			report(LintSensitiveField, "field '%s' is tagged as sensitive but unexported, it can't be masked", name)
+		}
+	}
+
+	names := make([]string, 0, len(cmd.Subcommands))
+	for name := range cmd.Subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sub := cmd.Subcommands[name]
+		subPath := append(append([]string{}, path...), name)
+		switch {
+		case sub == nil:
+			*findings = append(*findings, LintFinding{subPath, LintUnreachable, "the subcommand is nil"})
+		case name == "" || strings.ContainsAny(name, " \t"):
+			report(LintUnreachable, "subcommand %q can't be named on the command line", name)
+		default:
+			lintCommand(sub, subPath, declared, findings)
+		}
+	}
+}
+
+// LintCommand returns a command that lints the tree rooted at root, e.g. to
+// run as a builtin in the CI of a downstream project. It fails if there are
+// findings.
+func LintCommand(root *Command) *Command {
+	return &Command{
+		Helptext: HelpText{
+			Tagline:          "Check the command tree for authoring mistakes.",
+			ShortDescription: "Reports missing help text, unsupported option types, conflicting option names, unreachable commands, missing output types and sensitive fields that can't be masked.",
+		},
+		Run: func(req Request, res Response) {
+			findings := Lint(root)
+			if len(findings) > 0 {
+				res.SetError(fmt.Errorf("%d lint findings:\n%s", len(findings), lintText(findings)), ErrNormal)
+				return
+			}
+			res.SetOutput(&findings)
+		},
+		Marshalers: MarshalerMap{
+			Text: func(res Response) (io.Reader, error) {
+				return strings.NewReader(lintText(*res.Output().(*[]LintFinding))), nil
+			},
+		},
+		Type: []LintFinding{},
+	}
+}
+
+func lintText(findings []LintFinding) string {
+	var b strings.Builder
+	for _, f := range findings {
+		fmt.Fprintln(&b, f.String())
+	}
+	return b.String()
+}
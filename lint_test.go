@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	run := func(req Request, res Response) {}
+	root := &Command{
+		Options: []Option{
+			StringOption("name", "n", "a name"),
+		},
+		Subcommands: map[string]*Command{
+			"ok": {
+				Helptext:  HelpText{Tagline: "fine"},
+				Arguments: []Argument{StringArg("a", true, false, "an arg")},
+				Run:       run,
+				Type:      "",
+			},
+			"bad": {
+				Options: []Option{
+					BoolOption("n", "shadows the root's option"),
+					BoolOption("timeout", "shadows a global option"),
+					BoolOption("verbose", "v", "overrides an overridable global option"),
+					&option{names: []string{"odd"}, kind: reflect.Map, description: "a map"},
+					IntOption("count", ""),
+				},
+				Arguments: []Argument{
+					StringArg("a", true, true, "first"),
+					StringArg("b", true, false, "second"),
+				},
+				Run: run,
+			},
+			"empty": {
+				Helptext: HelpText{Tagline: "nothing here"},
+			},
+			"nil": nil,
+			"secret": {
+				Helptext: HelpText{Tagline: "keys"},
+				Run:      run,
+				Type:     []lintKey{},
+			},
+		},
+	}
+
+	var got []string
+	for _, f := range Lint(root) {
+		got = append(got, f.String())
+	}
+	expected := []string{
+		"bad: missing-help: the command has no tagline",
+		"bad: missing-help: option 'count' has no description",
+		"bad: option-type: option 'odd' has the unsupported type map",
+		"bad: alias-conflict: option name 'n' is already an option of the root",
+		"bad: alias-conflict: option name 'timeout' is already a global option",
+		"bad: argument-order: variadic argument 'a' isn't the last argument",
+		"bad: missing-type: the command has a Run function but no output Type",
+		"empty: unreachable: the command has neither a Run function nor subcommands",
+		"nil: unreachable: the subcommand is nil",
+		"secret: sensitive-field: field 'lintKey.secret' is tagged as sensitive but unexported, it can't be masked",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected findings:\n%q\ngot:\n%q", expected, got)
+	}
+
+	lint := LintCommand(root)
+	req, err := NewRequest(nil, nil, nil, nil, lint, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := lint.Call(req); res.Error() == nil {
+		t.Error("Expected the lint command to fail")
+	}
+	if findings := Lint(&Command{Run: run, Type: ""}); len(findings) != 0 {
+		t.Errorf("Expected no findings, got %v", findings)
+	}
+}
+
+type lintKey struct {
+	Name   string
+	Secret string `cmds:"sensitive"`
+	secret string `cmds:"sensitive"`
+}
+
+func TestLintDefaultSubcommand(t *testing.T) {
+	run := func(req Request, res Response) {}
+	tail := &Command{Helptext: HelpText{Tagline: "follow"}, Run: run, Type: ""}
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"log":    {Helptext: HelpText{Tagline: "logs"}, DefaultSubcommand: "tail", Subcommands: map[string]*Command{"tail": tail}},
+			"typo":   {Helptext: HelpText{Tagline: "logs"}, DefaultSubcommand: "tial", Subcommands: map[string]*Command{"tail": tail}},
+			"runner": {Helptext: HelpText{Tagline: "logs"}, DefaultSubcommand: "tail", Subcommands: map[string]*Command{"tail": tail}, Run: run, Type: ""},
+		},
+	}
+
+	var got []string
+	for _, f := range Lint(root) {
+		got = append(got, f.String())
+	}
+	expected := []string{
+		"runner: unreachable: the default subcommand 'tail' is never used, the command has a Run function",
+		"typo: unreachable: the default subcommand 'tial' doesn't exist",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected findings:\n%q\ngot:\n%q", expected, got)
+	}
+}
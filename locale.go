@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"time"
+)
+
+// The metadata keys of the caller's locale and timezone. Like all metadata,
+// they are forwarded with the request, so servers can format times and sort
+// strings the way the caller would locally.
+const (
+	LocaleMeta   = "locale"
+	TimezoneMeta = "timezone"
+)
+
+// SetLocale declares the locale of the caller of req, as a language tag like
+// "en-US".
+func SetLocale(req Request, tag string) {
+	req.SetMetadata(LocaleMeta, tag)
+}
+
+// Locale returns the locale the caller of req declared, or "" if it didn't.
+func Locale(req Request) string {
+	return req.Metadata()[LocaleMeta]
+}
+
+// SetTimezone declares the timezone of the caller of req, as an IANA name like
+// "Europe/Berlin". It returns an error if the timezone isn't known.
+func SetTimezone(req Request, name string) error {
+	if _, err := time.LoadLocation(name); err != nil {
+		return err
+	}
+	req.SetMetadata(TimezoneMeta, name)
+	return nil
+}
+
+// Location returns the timezone the caller of req declared, or the local
+// timezone if it didn't declare a known one.
+func Location(req Request) *time.Location {
+	name, ok := req.Metadata()[TimezoneMeta]
+	if !ok {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocale(t *testing.T) {
+	req, _ := NewRequest(nil, nil, nil, nil, nil, nil)
+	if Locale(req) != "" || Location(req) != time.Local {
+		t.Error("Expected no locale and the local timezone by default")
+	}
+
+	SetLocale(req, "de-DE")
+	if err := SetTimezone(req, "Europe/Berlin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTimezone(req, "Nowhere/Special"); err == nil {
+		t.Error("Expected an error for an unknown timezone")
+	}
+
+	// like the rest of the metadata, clones keep them
+	req, _ = CloneRequest(req)
+	if l := Locale(req); l != "de-DE" {
+		t.Errorf("Expected locale de-DE, got %q", l)
+	}
+	if loc := Location(req); loc.String() != "Europe/Berlin" {
+		t.Errorf("Expected timezone Europe/Berlin, got %q", loc)
+	}
+}
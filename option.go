@@ -27,6 +27,8 @@ type option struct {
 	names       []string
 	kind        reflect.Kind
 	description string
+	path        bool
+	secret      bool
 }
 
 func (o *option) Names() []string {
@@ -41,6 +43,14 @@ func (o *option) Description() string {
 	return o.description
 }
 
+func (o *option) IsPath() bool {
+	return o.path
+}
+
+func (o *option) IsSecret() bool {
+	return o.secret
+}
+
 // constructor helper functions
 func NewOption(kind reflect.Kind, names ...string) Option {
 	if len(names) < 2 {
@@ -80,6 +90,72 @@ func StringOption(names ...string) Option {
 	return NewOption(String, names...)
 }
 
+// PathOption is a string option whose value is a file system path. The CLI
+// expands `~` and environment variables (`$VAR`) in its value.
+func PathOption(names ...string) Option {
+	opt := NewOption(String, names...).(*option)
+	opt.path = true
+	return opt
+}
+
+// SecretOption is a string option whose value (e.g. a password or an API
+// token) is redacted when requests are recorded (see MarshalRedactedRequest).
+func SecretOption(names ...string) Option {
+	opt := NewOption(String, names...).(*option)
+	opt.secret = true
+	return opt
+}
+
+// IsPathOption returns true if the value of opt is a file system path (see
+// PathOption). Options that aren't made by this package are paths if they
+// have an `IsPath() bool` method that returns true.
+func IsPathOption(opt Option) bool {
+	p, ok := opt.(interface{ IsPath() bool })
+	return ok && p.IsPath()
+}
+
+// IsExperimentalOption returns true if opt can only be set when experimental
+// features are enabled (see ExperimentalOption). Options that aren't made by
+// this package are experimental if they have an `IsExperimental() bool`
+// method that returns true.
+func IsExperimentalOption(opt Option) bool {
+	e, ok := opt.(interface{ IsExperimental() bool })
+	return ok && e.IsExperimental()
+}
+
+// IsSecretOption returns true if the value of opt is redacted when requests
+// are recorded (see SecretOption). Options that aren't made by this package
+// are secret if they have an `IsSecret() bool` method that returns true.
+func IsSecretOption(opt Option) bool {
+	s, ok := opt.(interface{ IsSecret() bool })
+	return ok && s.IsSecret()
+}
+
+// ExperimentalOption returns an option like opt that can only be set when
+// experimental features are enabled (see EnableExperimentalOpt). opt may be
+// any Option, it is wrapped.
+func ExperimentalOption(opt Option) Option {
+	return &experimentalOption{opt}
+}
+
+// experimentalOption is an Option that is experimental, and a path or secret
+// if the option it wraps is.
+type experimentalOption struct {
+	Option
+}
+
+func (o *experimentalOption) IsExperimental() bool {
+	return true
+}
+
+func (o *experimentalOption) IsPath() bool {
+	return IsPathOption(o.Option)
+}
+
+func (o *experimentalOption) IsSecret() bool {
+	return IsSecretOption(o.Option)
+}
+
 type OptionValue struct {
 	value interface{}
 	found bool
@@ -152,27 +228,149 @@ func (ov OptionValue) String() (value string, found bool, err error) {
 	return val, ov.found, err
 }
 
+// OptionRequirement declares that the Requires options must be set when
+// Option is set to Value, e.g. "if --type=custom then --spec is required". A
+// nil Value means whenever Option is set at all. Values are compared by
+// their string form.
+type OptionRequirement struct {
+	Option   string
+	Value    interface{}
+	Requires []string
+}
+
 // Flag names
 const (
-	EncShort   = "enc"
-	EncLong    = "encoding"
-	RecShort   = "r"
-	RecLong    = "recursive"
-	ChanOpt    = "stream-channels"
-	TimeoutOpt = "timeout"
+	EncShort         = "enc"
+	EncLong          = "encoding"
+	RecShort         = "r"
+	RecLong          = "recursive"
+	ChanOpt          = "stream-channels"
+	TimeoutOpt       = "timeout"
+	DeadlineOpt      = "deadline"
+	ShowSensitiveOpt = "show-sensitive"
+	VerboseOpt       = "verbose"
+	QuietOpt         = "quiet"
+	InteractiveOpt   = "interactive"
+	JSONErrorsOpt    = "json-errors"
+	TransferStatsOpt = "show-transfer-stats"
+	OutputFormatOpt  = "output-format"
+	CompactJSONOpt   = "compact-json"
+	StatOpt          = "stat"
+	CompressOpt      = "compress"
+	ColorOpt         = "color"
+
+	EnableExperimentalOpt = "enable-experimental"
+	YesOpt                = "yes"
+	NoPagerOpt            = "no-pager"
+	DryRunOpt             = "dry-run"
+
+	ProgressOpt = "progress"
 )
 
 // options that are used by this package
-var OptionEncodingType = StringOption(EncShort, EncLong, "The encoding type the output should be encoded with (json, xml, or text)")
+var OptionEncodingType Option = &encodingOption{StringOption(EncShort, EncLong, "The encoding type the output should be encoded with")}
 var OptionRecursivePath = BoolOption(RecShort, RecLong, "Add directory paths recursively")
 var OptionStreamChannels = BoolOption(ChanOpt, "Stream channel output")
-var OptionTimeout = StringOption(TimeoutOpt, "set a global timeout on the command")
+var OptionTimeout = StringOption(TimeoutOpt, "set a global timeout on the command (0 or 'none' for no timeout)")
+var OptionDeadline = StringOption(DeadlineOpt, "set an absolute deadline (RFC3339 time) on the command")
+var OptionShowSensitive = BoolOption(ShowSensitiveOpt, "Show sensitive output fields (if authorized)")
+var OptionVerbose = BoolOption(VerboseOpt, "v", "Include extra detail in the output, e.g. all output fields instead of a concise view")
+var OptionQuiet = BoolOption(QuietOpt, "q", "Write only the essential output, e.g. no progress")
+var OptionInteractive = BoolOption(InteractiveOpt, "Prompt for missing required arguments and options")
+var OptionJSONErrors = BoolOption(JSONErrorsOpt, "Write errors as JSON objects on stdout")
+var OptionTransferStats = BoolOption(TransferStatsOpt, "Show the bytes transferred over the network")
+var OptionOutputFormat = StringOption(OutputFormatOpt, "The format the output should be rendered in, if the command has several")
+var OptionCompactJSON = BoolOption(CompactJSONOpt, "Encode JSON output on a single line, instead of indented")
+var OptionStat = BoolOption(StatOpt, "Show a summary of the command's trailers (e.g. timing and counts) after its output")
+var OptionEnableExperimental = BoolOption(EnableExperimentalOpt, "Enable experimental commands and options")
+var OptionYes = BoolOption(YesOpt, "Answer yes to confirmation prompts, e.g. of destructive commands")
+var OptionColor = StringOption(ColorOpt, "When to color the output: auto (on terminals, unless $NO_COLOR is set), always or never")
+var OptionNoPager = BoolOption(NoPagerOpt, "Don't pipe long text output through $PAGER")
+var OptionDryRun = BoolOption(DryRunOpt, "Show what the command would do, without doing it")
+
+// OptionProgress is not global, since many commands have a progress option
+// of their own. Commands that take files can add it to their Options to
+// let the CLI show the progress of uploading them.
+var OptionProgress = BoolOption(ProgressOpt, "Show the progress of uploading the files")
+
+// OptionCompress is not global either, commands like get often have their own
+// compress option. Commands whose output is written to files can add it to
+// their Options to let the CLI gzip the output (see cli.OutputWriter).
+var OptionCompress = BoolOption(CompressOpt, "Compress the output with gzip when it is written to a file")
 
 // global options, added to every command
 var globalOptions = []Option{
 	OptionEncodingType,
 	OptionStreamChannels,
 	OptionTimeout,
+	OptionDeadline,
+	OptionShowSensitive,
+	OptionVerbose,
+	OptionQuiet,
+	OptionInteractive,
+	OptionJSONErrors,
+	OptionTransferStats,
+	OptionOutputFormat,
+	OptionCompactJSON,
+	OptionStat,
+	OptionColor,
+	OptionEnableExperimental,
+	OptionYes,
+	OptionNoPager,
+	OptionDryRun,
+}
+
+// overridableGlobals are the global options that commands may define options
+// of their own with the same names, which then take their place. Many
+// commands had their own --quiet, --verbose or --dry-run before the global
+// ones. Use GlobalOption to read them.
+var overridableGlobals = map[Option]bool{
+	OptionVerbose:  true,
+	OptionQuiet:    true,
+	OptionDryRun:   true,
+	OptionStat:     true,
+	OptionYes:      true,
+	OptionDeadline: true,
+
+	OptionInteractive:        true,
+	OptionJSONErrors:         true,
+	OptionOutputFormat:       true,
+	OptionCompactJSON:        true,
+	OptionColor:              true,
+	OptionEnableExperimental: true,
+	OptionNoPager:            true,
+	OptionShowSensitive:      true,
+	OptionTransferStats:      true,
+}
+
+// localOptions only change how front-ends present the output of a request,
+// so clients don't send them to servers.
+var localOptions = map[Option]bool{
+	OptionInteractive: true,
+	OptionJSONErrors:  true,
+	OptionCompactJSON: true,
+	OptionStat:        true,
+	OptionColor:       true,
+	OptionNoPager:     true,
+	OptionCompress:    true,
+}
+
+// IsLocalOption returns true if opt only changes how a front-end presents
+// the output (like --color or --no-pager), so it isn't sent to servers.
+func IsLocalOption(opt Option) bool {
+	return localOptions[opt]
+}
+
+// GlobalOption returns the value of the global option opt in req. If the
+// command defines an option of its own in its place (see overridableGlobals),
+// the value isn't found.
+func GlobalOption(req Request, opt Option) OptionValue {
+	for _, name := range opt.Names() {
+		if v := req.Option(name); v != nil && v.Definition() == opt {
+			return *v
+		}
+	}
+	return OptionValue{def: opt}
 }
 
 // the above array of Options, wrapped in a Command
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Protobuf is the protobuf EncodingType. The output is encoded as a stream of
+// messages, each prefixed by its varint-encoded length, a single one unless
+// the command streams a channel. Errors are encoded as the message
+//
+//	message Error {
+//		string Message = 1;
+//		uint32 Code = 2;
+//		string Kind = 3;
+//	}
+const Protobuf = "protobuf"
+
+// ProtoMarshaler is implemented by protobuf messages, like the ones generated
+// by gogo/protobuf.
+type ProtoMarshaler interface {
+	Marshal() ([]byte, error)
+}
+
+// ErrNoProtoMessage is returned by the protobuf encoding for output values
+// that aren't messages, if the command doesn't convert them (see
+// Command.ProtoMessage).
+var ErrNoProtoMessage = errors.New("This command doesn't support the protobuf encoding")
+
+// protoMessage returns the message v is encoded as.
+func protoMessage(cmd *Command, v interface{}) (ProtoMarshaler, error) {
+	if m, ok := v.(ProtoMarshaler); ok {
+		return m, nil
+	}
+	if cmd == nil || cmd.ProtoMessage == nil {
+		return nil, ErrNoProtoMessage
+	}
+	return cmd.ProtoMessage(v)
+}
+
+// errorMessage encodes an Error as the protobuf message of errors, see
+// Protobuf.
+type errorMessage struct {
+	*Error
+}
+
+func (e errorMessage) Marshal() ([]byte, error) {
+	var b []byte
+	if e.Message != "" {
+		b = appendProtoString(b, 1, e.Message)
+	}
+	if e.Code != 0 {
+		b = appendUvarint(append(b, 2<<3), uint64(e.Code))
+	}
+	if e.Kind != "" {
+		b = appendProtoString(b, 3, e.Kind)
+	}
+	return b, nil
+}
+
+// appendProtoString appends the length-delimited field with the given number
+// to b.
+func appendProtoString(b []byte, field int, s string) []byte {
+	b = appendUvarint(append(b, byte(field<<3|2)), uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// marshalProtoMessage encodes v as a length-prefixed protobuf message.
+func marshalProtoMessage(cmd *Command, v interface{}) (io.Reader, error) {
+	m, err := protoMessage(cmd, v)
+	if err != nil {
+		return nil, err
+	}
+	b, err := m.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("Could not encode protobuf message: %s", err)
+	}
+
+	prefix := appendUvarint(nil, uint64(len(b)))
+	return io.MultiReader(bytes.NewReader(prefix), bytes.NewReader(b)), nil
+}
+
+func marshalProtobuf(res Response) (io.Reader, error) {
+	if res.Error() != nil {
+		return marshalProtoMessage(nil, errorMessage{res.Error()})
+	}
+
+	cmd := res.Request().Command()
+
+	ch, ok := res.Output().(<-chan interface{})
+	if !ok {
+		return marshalProtoMessage(cmd, res.Output())
+	}
+
+	return &ChannelMarshaler{
+		Channel: ch,
+		Marshaler: func(v interface{}) (io.Reader, error) {
+			return marshalProtoMessage(cmd, v)
+		},
+		Res: res,
+	}, nil
+}
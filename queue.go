@@ -0,0 +1,328 @@
+package commands
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// JobStatus is the state of a queued request.
+type JobStatus string
+
+const (
+	JobQueued      JobStatus = "queued"
+	JobRunning     JobStatus = "running"
+	JobDone        JobStatus = "done"
+	JobFailed      JobStatus = "failed"
+	JobInterrupted JobStatus = "interrupted" // was running when the queue stopped
+)
+
+// JobRecord is the persisted state of a queued request.
+type JobRecord struct {
+	ID      string
+	Request []byte // encoded by MarshalRequest
+	Status  JobStatus
+	Error   string `json:",omitempty"`
+	Queued  time.Time
+}
+
+// JobStore persists the records of a Queue, so queued requests survive
+// restarts of the process. It is implemented by the embedding application.
+type JobStore interface {
+	Put(rec JobRecord) error
+	Get(id string) (JobRecord, bool, error)
+	List() ([]JobRecord, error)
+}
+
+// Queue runs requests one at a time, in the order they were enqueued, as
+// detached work in a Registry. If it has a JobStore, the queue is persisted:
+// Restore resumes the requests that were queued when the process stopped.
+//
+// Requests are persisted with MarshalRequest, so their files and stdin are
+// not part of them.
+type Queue struct {
+	root  *Command
+	reg   *Registry
+	store JobStore
+
+	mu      sync.Mutex
+	pending []JobRecord
+	records map[string]JobRecord // used without a store, or when it fails
+	pushed  map[string]bool      // jobs pushed by this queue, see Restore
+	notify  chan struct{}
+	started bool
+}
+
+// NewQueue returns a Queue running requests for commands in the tree of
+// root. store may be nil, the queue is kept in memory then.
+func NewQueue(root *Command, reg *Registry, store JobStore) *Queue {
+	return &Queue{
+		root:    root,
+		reg:     reg,
+		store:   store,
+		records: make(map[string]JobRecord),
+		pushed:  make(map[string]bool),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// Enqueue adds req to the queue, returning the ID of its job.
+func (q *Queue) Enqueue(req Request) (string, error) {
+	data, err := MarshalRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	rec := JobRecord{
+		ID:      newRequestID(),
+		Request: data,
+		Status:  JobQueued,
+		Queued:  time.Now(),
+	}
+	if err := q.put(rec); err != nil {
+		return "", err
+	}
+
+	if err := q.push(rec); err != nil {
+		// the caller is told it failed, so it must not run on Restore
+		rec.Status = JobFailed
+		rec.Error = err.Error()
+		q.finish(rec)
+		return "", err
+	}
+	return rec.ID, nil
+}
+
+// Restore resumes the jobs that were queued in the store, and marks the jobs
+// that were running as interrupted: they are not run again, since they may
+// not be safe to repeat. The jobs this queue already knows of, e.g. when
+// Restore is called again, are left as they are.
+func (q *Queue) Restore() error {
+	if q.store == nil {
+		return nil
+	}
+
+	recs, err := q.store.List()
+	if err != nil {
+		return err
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Queued.Before(recs[j].Queued) })
+
+	for _, rec := range recs {
+		q.mu.Lock()
+		pushed := q.pushed[rec.ID]
+		q.mu.Unlock()
+		if pushed {
+			continue
+		}
+
+		switch rec.Status {
+		case JobRunning:
+			rec.Status = JobInterrupted
+			if err := q.put(rec); err != nil {
+				return err
+			}
+		case JobQueued:
+			if err := q.push(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Status returns the record of the job with the given ID.
+func (q *Queue) Status(id string) (JobRecord, bool, error) {
+	q.mu.Lock()
+	rec, ok := q.records[id]
+	q.mu.Unlock()
+
+	if ok || q.store == nil {
+		return rec, ok, nil
+	}
+	return q.store.Get(id)
+}
+
+func (q *Queue) put(rec JobRecord) error {
+	if q.store != nil {
+		return q.store.Put(rec)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.records[rec.ID] = rec
+	return nil
+}
+
+// finish records the final state of rec. If the store fails, the record is
+// kept in memory instead, so Status still reports it.
+func (q *Queue) finish(rec JobRecord) {
+	if err := q.put(rec); err != nil {
+		q.mu.Lock()
+		q.records[rec.ID] = rec
+		q.mu.Unlock()
+	}
+}
+
+// push adds rec to the pending jobs, starting the worker if needed.
+func (q *Queue) push(rec JobRecord) error {
+	q.mu.Lock()
+	q.pending = append(q.pending, rec)
+	q.pushed[rec.ID] = true
+	start := !q.started
+	q.started = true
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	if start {
+		_, err := q.reg.Start("queue", "", q.work)
+		if err != nil {
+			q.mu.Lock()
+			q.started = false
+			for i, p := range q.pending {
+				if p.ID == rec.ID {
+					q.pending = append(q.pending[:i], q.pending[i+1:]...)
+					break
+				}
+			}
+			delete(q.pushed, rec.ID)
+			q.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// work runs the pending jobs until ctx is done.
+func (q *Queue) work(ctx context.Context) {
+	for {
+		q.mu.Lock()
+		var rec JobRecord
+		ok := len(q.pending) > 0
+		if ok {
+			rec = q.pending[0]
+			q.pending = q.pending[1:]
+		}
+		q.mu.Unlock()
+
+		if !ok {
+			select {
+			case <-q.notify:
+				continue
+			case <-ctx.Done():
+				q.stop()
+				return
+			}
+		}
+
+		q.run(ctx, rec)
+		if ctx.Err() != nil {
+			q.stop()
+			return
+		}
+	}
+}
+
+// stop marks the worker as stopped, so the next push starts a new one.
+func (q *Queue) stop() {
+	q.mu.Lock()
+	q.started = false
+	q.mu.Unlock()
+}
+
+func (q *Queue) run(ctx context.Context, rec JobRecord) {
+	rec.Status = JobRunning
+	if err := q.put(rec); err != nil {
+		rec.Status = JobFailed
+		rec.Error = err.Error()
+		q.finish(rec)
+		return
+	}
+
+	err := q.call(ctx, rec)
+	if ctx.Err() != nil {
+		// stopped while running, leave it for Restore to report
+		return
+	}
+
+	rec.Status = JobDone
+	if err != nil {
+		rec.Status = JobFailed
+		rec.Error = err.Error()
+	}
+	q.finish(rec)
+}
+
+func (q *Queue) call(ctx context.Context, rec JobRecord) error {
+	req, err := UnmarshalRequest(rec.Request, q.root)
+	if err != nil {
+		return err
+	}
+	req.SetStdin(nil)
+	req.SetID(rec.ID)
+
+	err = req.SetRootContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	res := q.root.Call(req)
+	if e := res.Error(); e != nil {
+		return e
+	}
+
+	// consume streamed output, the command may block on it
+	if ch, ok := res.Output().(<-chan interface{}); ok {
+		for range ch {
+		}
+		if e := res.Error(); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// MemoryJobStore is a JobStore that keeps the records in memory, e.g. for
+// tests.
+type MemoryJobStore struct {
+	mu      sync.Mutex
+	records map[string]JobRecord
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{records: make(map[string]JobRecord)}
+}
+
+func (s *MemoryJobStore) Put(rec JobRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[rec.ID] = rec
+	return nil
+}
+
+func (s *MemoryJobStore) Get(id string) (JobRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[id]
+	return rec, ok, nil
+}
+
+func (s *MemoryJobStore) List() ([]JobRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recs := make([]JobRecord, 0, len(s.records))
+	for _, rec := range s.records {
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestQueue(t *testing.T) {
+	var mu sync.Mutex
+	var ran []string
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"echo": {
+				Arguments: []Argument{
+					StringArg("text", true, false, "some text"),
+				},
+				Run: func(req Request, res Response) {
+					mu.Lock()
+					ran = append(ran, req.Arguments()[0])
+					mu.Unlock()
+
+					if req.Arguments()[0] == "fail" {
+						res.SetError(errors.New("failed"), ErrNormal)
+					}
+				},
+			},
+		},
+	}
+
+	waitFor := func(q *Queue, id string, status JobStatus) JobRecord {
+		for i := 0; i < 1000; i++ {
+			rec, ok, err := q.Status(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok && rec.Status == status {
+				return rec
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("Job %s didn't reach status %s", id, status)
+		return JobRecord{}
+	}
+
+	store := NewMemoryJobStore()
+	reg := NewRegistry(context.Background())
+	q := NewQueue(root, reg, store)
+
+	var ids []string
+	for _, text := range []string{"a", "fail", "b"} {
+		req, err := NewRequestBuilder(root).Path("echo").Arg(text).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := q.Enqueue(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	waitFor(q, ids[0], JobDone)
+	if rec := waitFor(q, ids[1], JobFailed); rec.Error != "failed" {
+		t.Errorf("Expected the error to be recorded, got %q", rec.Error)
+	}
+	waitFor(q, ids[2], JobDone)
+
+	mu.Lock()
+	if len(ran) != 3 || ran[0] != "a" || ran[1] != "fail" || ran[2] != "b" {
+		t.Errorf("Expected the jobs to run in order, got %v", ran)
+	}
+	ran = nil
+	mu.Unlock()
+
+	// the worker is started again after it was cancelled
+	for _, j := range reg.Jobs() {
+		reg.Cancel(j.ID)
+	}
+	req, err := NewRequestBuilder(root).Path("echo").Arg("d").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000 && len(reg.Jobs()) > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	id, err := q.Enqueue(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(q, id, JobDone)
+
+	mu.Lock()
+	ran = nil
+	mu.Unlock()
+
+	if err := reg.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(req); err != ErrShuttingDown {
+		t.Errorf("Expected ErrShuttingDown after the shutdown, got %v", err)
+	}
+
+	// jobs that were queued or running when the process stopped
+	req, err = NewRequestBuilder(root).Path("echo").Arg("c").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put(JobRecord{ID: "running", Request: data, Status: JobRunning, Queued: time.Now()})
+	store.Put(JobRecord{ID: "queued", Request: data, Status: JobQueued, Queued: time.Now()})
+
+	reg = NewRegistry(context.Background())
+	defer reg.Shutdown(context.Background())
+	q = NewQueue(root, reg, store)
+	if err := q.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(q, "queued", JobDone)
+	waitFor(q, "running", JobInterrupted)
+	waitFor(q, ids[1], JobFailed)
+
+	// a second Restore doesn't run the jobs again
+	if err := q.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(q, "queued", JobDone)
+
+	mu.Lock()
+	if len(ran) != 1 || ran[0] != "c" {
+		t.Errorf("Expected only the queued job to run again, got %v", ran)
+	}
+	mu.Unlock()
+}
+
+// failingStore fails to save the records with the given status.
+type failingStore struct {
+	*MemoryJobStore
+	status JobStatus
+}
+
+func (s failingStore) Put(rec JobRecord) error {
+	if rec.Status == s.status {
+		return errors.New("store failed")
+	}
+	return s.MemoryJobStore.Put(rec)
+}
+
+func TestQueueStoreErrors(t *testing.T) {
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"noop": {Run: func(req Request, res Response) {}},
+		},
+	}
+
+	for _, status := range []JobStatus{JobRunning, JobDone} {
+		reg := NewRegistry(context.Background())
+		q := NewQueue(root, reg, failingStore{NewMemoryJobStore(), status})
+
+		req, err := NewRequestBuilder(root).Path("noop").Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := q.Enqueue(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rec JobRecord
+		for i := 0; i < 1000; i++ {
+			rec, _, err = q.Status(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.Status != JobQueued && rec.Status != JobRunning {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		if status == JobRunning && (rec.Status != JobFailed || rec.Error != "store failed") {
+			t.Errorf("Expected the job to fail with the store error, got %+v", rec)
+		}
+		if status == JobDone && rec.Status != JobDone {
+			t.Errorf("Expected the job to be done, got %+v", rec)
+		}
+		reg.Shutdown(context.Background())
+	}
+}
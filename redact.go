@@ -0,0 +1,228 @@
+package commands
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Redacted replaces the value of sensitive string fields in redacted output.
+// Sensitive fields of any other type are set to their zero value.
+const Redacted = "<redacted>"
+
+// SensitiveScope is the scope a request needs to be granted (in addition to
+// the --show-sensitive option) to see sensitive output fields unmasked.
+const SensitiveScope = "sensitive"
+
+// scopesKey is the key of the request scopes in the request's values
+var scopesKey = NewKey("cmds.scopes", []string(nil))
+
+// GrantScopes authorizes the request for the given scopes. Front-ends grant
+// scopes after authenticating the caller, e.g. a local CLI invocation may be
+// granted SensitiveScope while remote API calls are not.
+func GrantScopes(req Request, scopes ...string) {
+	granted, _ := scopesKey.Get(req).([]string)
+
+	// never append in place, the slice may be shared with a cloned request
+	scopesKey.Set(req, append(granted[:len(granted):len(granted)], scopes...))
+}
+
+// HasScope returns true if the request was granted the given scope.
+func HasScope(req Request, scope string) bool {
+	granted, _ := scopesKey.Get(req).([]string)
+	for _, s := range granted {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTagFlag returns true if the `cmds` struct tag of the field contains the
+// given flag, e.g. `cmds:"sensitive"`.
+func hasTagFlag(field reflect.StructField, flag string) bool {
+	for _, f := range strings.Split(field.Tag.Get("cmds"), ",") {
+		if strings.TrimSpace(f) == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactSensitive is an EmitterMiddleware that masks sensitive fields in
+// output values. Fields are sensitive if they are tagged with
+// `cmds:"sensitive"`, or if their name is listed in Command.Sensitive.
+// Values are only emitted unmasked if the --show-sensitive option is set and
+// the request was granted SensitiveScope.
+//
+// RedactSensitive is applied before any other middleware to the output of
+// the commands that may have sensitive fields, see mayBeSensitive.
+func RedactSensitive(req Request, next Emitter) Emitter {
+	show, _, _ := GlobalOption(req, OptionShowSensitive).Bool()
+	if show && HasScope(req, SensitiveScope) {
+		return next
+	}
+
+	fields := map[string]bool{}
+	if cmd := req.Command(); cmd != nil {
+		for _, name := range cmd.Sensitive {
+			fields[name] = true
+		}
+	}
+
+	return func(v interface{}) error {
+		if v == nil {
+			return next(v)
+		}
+		return next(Redact(v, fields))
+	}
+}
+
+// Redact returns a copy of v with all sensitive fields masked (see
+// RedactSensitive). Names in fields mark additional fields of a top-level
+// struct as sensitive. If there is nothing to mask, v is returned as is.
+//
+// Unexported fields can't be set, so they are copied unmasked even if they
+// are tagged as sensitive (Lint reports such tags).
+func Redact(v interface{}, fields map[string]bool) interface{} {
+	rv := reflect.ValueOf(v)
+	if len(fields) == 0 && !hasSensitive(rv.Type(), map[reflect.Type]bool{}) {
+		return v
+	}
+	return redactValue(rv, fields, map[uintptr]reflect.Value{}).Interface()
+}
+
+// mayBeSensitive returns true if the output of cmd may have sensitive fields.
+// Commands without a Type may output anything, so their values are checked
+// one by one.
+func mayBeSensitive(cmd *Command) bool {
+	if len(cmd.Sensitive) > 0 || cmd.Type == nil {
+		return true
+	}
+	return hasSensitive(reflect.TypeOf(cmd.Type), map[reflect.Type]bool{})
+}
+
+// hasSensitive returns true if values of type t can contain sensitive fields.
+// Interface types can hold any value, so they are checked when redacting.
+func hasSensitive(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return hasSensitive(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if hasTagFlag(field, "sensitive") || hasSensitive(field.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unexportedSensitive returns the unexported fields tagged as sensitive in
+// values of type t (as "Type.field"), which Redact can't mask.
+func unexportedSensitive(t reflect.Type, seen map[reflect.Type]bool) []string {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	var names []string
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		names = unexportedSensitive(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" && hasTagFlag(field, "sensitive") {
+				names = append(names, t.Name()+"."+field.Name)
+			}
+			names = append(names, unexportedSensitive(field.Type, seen)...)
+		}
+	}
+	return names
+}
+
+// redactValue returns a masked copy of v. seen maps the pointers that were
+// already copied to their copies, so cyclic values are copied with the same
+// cycles.
+func redactValue(v reflect.Value, fields map[string]bool, seen map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(redactValue(v.Elem(), fields, seen))
+		return out
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if out, ok := seen[v.Pointer()]; ok && out.Type() == v.Type() {
+			return out
+		}
+		out := reflect.New(v.Type().Elem())
+		seen[v.Pointer()] = out
+		out.Elem().Set(redactValue(v.Elem(), fields, seen))
+		return out
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redactValue(v.Index(i), nil, seen))
+		}
+		return out
+
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redactValue(v.Index(i), nil, seen))
+		}
+		return out
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMap(v.Type())
+		for _, key := range v.MapKeys() {
+			out.SetMapIndex(key, redactValue(v.MapIndex(key), nil, seen))
+		}
+		return out
+
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			f := out.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+
+			if fields[field.Name] || hasTagFlag(field, "sensitive") {
+				if f.Kind() == reflect.String {
+					f.SetString(Redacted)
+				} else {
+					f.Set(reflect.Zero(f.Type()))
+				}
+				continue
+			}
+			f.Set(redactValue(f, nil, seen))
+		}
+		return out
+	}
+
+	return v
+}
@@ -0,0 +1,94 @@
+package commands
+
+import "testing"
+
+type testKey struct {
+	Name    string
+	Secret  string `cmds:"sensitive"`
+	Address string
+}
+
+func TestRedactSensitive(t *testing.T) {
+	cmd := &Command{
+		Sensitive: []string{"Address"},
+		Run: func(req Request, res Response) {
+			res.SetOutput(&testKey{"self", "hunter2", "10.0.0.1"})
+		},
+	}
+	optDefs, _ := cmd.GetOptions(nil)
+
+	call := func(show bool, scopes ...string) *testKey {
+		req, _ := NewRequest(nil, nil, nil, nil, cmd, optDefs)
+		if show {
+			req.SetOption(ShowSensitiveOpt, true)
+		}
+		GrantScopes(req, scopes...)
+		return cmd.Call(req).Output().(*testKey)
+	}
+
+	key := call(false)
+	if key.Name != "self" || key.Secret != Redacted || key.Address != Redacted {
+		t.Errorf("Expected sensitive fields to be masked, got %+v", key)
+	}
+
+	key = call(true)
+	if key.Secret != Redacted {
+		t.Error("Expected sensitive fields to be masked without the sensitive scope")
+	}
+
+	key = call(false, SensitiveScope)
+	if key.Secret != Redacted {
+		t.Error("Expected sensitive fields to be masked without --show-sensitive")
+	}
+
+	key = call(true, SensitiveScope)
+	if key.Secret != "hunter2" || key.Address != "10.0.0.1" {
+		t.Errorf("Expected sensitive fields to be shown, got %+v", key)
+	}
+
+	keys := Redact([]testKey{{"a", "b", "c"}}, nil).([]testKey)
+	if keys[0].Secret != Redacted || keys[0].Address != "c" {
+		t.Errorf("Expected nested sensitive fields to be masked, got %+v", keys)
+	}
+
+	type node struct {
+		Secret string `cmds:"sensitive"`
+		Next   *node
+	}
+	ring := &node{Secret: "a"}
+	ring.Next = &node{Secret: "b", Next: ring}
+	out := Redact(ring, nil).(*node)
+	if out.Secret != Redacted || out.Next.Secret != Redacted || out.Next.Next != out {
+		t.Errorf("Expected the cycle to be copied masked, got %+v", out)
+	}
+	if ring.Secret != "a" {
+		t.Error("Expected the original value not to be changed")
+	}
+}
+
+func TestMayBeSensitive(t *testing.T) {
+	type plain struct{ Name string }
+	type wrapper struct{ Value interface{} }
+
+	for i, tc := range []struct {
+		cmd      *Command
+		expected bool
+	}{
+		{&Command{}, true},
+		{&Command{Type: plain{}}, false},
+		{&Command{Type: ""}, false},
+		{&Command{Type: plain{}, Sensitive: []string{"Name"}}, true},
+		{&Command{Type: &testKey{}}, true},
+		{&Command{Type: []testKey{}}, true},
+		{&Command{Type: wrapper{}}, true},
+	} {
+		if s := mayBeSensitive(tc.cmd); s != tc.expected {
+			t.Errorf("%d: expected %v, got %v", i, tc.expected, s)
+		}
+	}
+
+	out := Redact(wrapper{Value: testKey{"a", "b", "c"}}, nil).(wrapper)
+	if key := out.Value.(testKey); key.Secret != Redacted {
+		t.Errorf("Expected sensitive fields behind interfaces to be masked, got %+v", key)
+	}
+}
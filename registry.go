@@ -0,0 +1,181 @@
+package commands
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ErrNoRegistry is returned by Detach if no Registry was attached to the
+// request.
+var ErrNoRegistry = errors.New("no registry for detached work was attached to the request")
+
+// ErrShuttingDown is returned by Detach once the registry is shutting down.
+var ErrShuttingDown = errors.New("not starting detached work, shutting down")
+
+// RegistryKey is the key the host application attaches its Registry to
+// requests with.
+var RegistryKey = NewKey("cmds.registry", (*Registry)(nil))
+
+// JobInfo describes detached work in flight.
+type JobInfo struct {
+	ID        string
+	Name      string
+	RequestID string
+	Started   time.Time
+}
+
+type job struct {
+	info   JobInfo
+	seq    uint64
+	cancel context.CancelFunc
+}
+
+// Registry keeps track of work that commands detach from their request, so
+// "start a long job and return immediately" commands neither leak goroutines
+// nor get cancelled once their response is sent. The host application
+// creates a Registry for its lifetime and shuts it down when it exits.
+type Registry struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	jobs     map[string]*job
+	hooks    []func()
+	closing  bool
+	running  sync.WaitGroup
+	sequence uint64
+}
+
+// NewRegistry returns a Registry whose work runs in contexts derived from
+// ctx (rather than from the requests that started it).
+func NewRegistry(ctx context.Context) *Registry {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Registry{
+		ctx:    ctx,
+		cancel: cancel,
+		jobs:   make(map[string]*job),
+	}
+}
+
+// Detach runs fn in the background, registered in the Registry attached to
+// req. The context passed to fn is not cancelled when the request ends, only
+// when the job is cancelled or the registry shuts down. It returns the ID of
+// the job.
+func Detach(req Request, name string, fn func(ctx context.Context)) (string, error) {
+	r, ok := RegistryKey.Get(req).(*Registry)
+	if !ok || r == nil {
+		return "", ErrNoRegistry
+	}
+	return r.Start(name, req.ID(), fn)
+}
+
+// Start runs fn in the background as a job named name. requestID is the ID
+// of the request that started it, if any.
+func (r *Registry) Start(name, requestID string, fn func(ctx context.Context)) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closing {
+		return "", ErrShuttingDown
+	}
+
+	r.sequence++
+	ctx, cancel := context.WithCancel(r.ctx)
+	j := &job{
+		info: JobInfo{
+			ID:        newRequestID(),
+			Name:      name,
+			RequestID: requestID,
+			Started:   time.Now(),
+		},
+		seq:    r.sequence,
+		cancel: cancel,
+	}
+	r.jobs[j.info.ID] = j
+
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		defer cancel()
+
+		fn(ctx)
+
+		r.mu.Lock()
+		delete(r.jobs, j.info.ID)
+		r.mu.Unlock()
+	}()
+
+	return j.info.ID, nil
+}
+
+// Jobs returns the jobs in flight, in the order they were started.
+func (r *Registry) Jobs() []JobInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	jobs := make([]*job, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].seq < jobs[k].seq })
+
+	infos := make([]JobInfo, len(jobs))
+	for i, j := range jobs {
+		infos[i] = j.info
+	}
+	return infos
+}
+
+// Cancel cancels the context of the job with the given ID. It returns false
+// if there is no such job in flight.
+func (r *Registry) Cancel(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j, ok := r.jobs[id]
+	if ok {
+		j.cancel()
+	}
+	return ok
+}
+
+// OnShutdown registers a function that is called when the registry shuts
+// down, before waiting for the jobs in flight.
+func (r *Registry) OnShutdown(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hooks = append(r.hooks, fn)
+}
+
+// Shutdown stops accepting new jobs, runs the shutdown hooks, cancels the
+// jobs in flight and waits for them to return, or for ctx to be done.
+func (r *Registry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	r.closing = true
+	hooks := r.hooks
+	r.hooks = nil
+	r.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+	r.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry(context.Background())
+
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	cmd := &Command{
+		Run: func(req Request, res Response) {
+			id, err := Detach(req, "long job", func(ctx context.Context) {
+				close(started)
+				<-ctx.Done()
+				close(stopped)
+			})
+			if err != nil {
+				res.SetError(err, ErrNormal)
+				return
+			}
+			res.SetOutput(id)
+		},
+	}
+
+	optDefs, err := cmd.GetOptions([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := NewRequest(nil, nil, nil, nil, cmd, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := cmd.Call(req); res.Error() == nil {
+		t.Error("Expected an error without a registry")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req.SetRootContext(ctx)
+	RegistryKey.Set(req, reg)
+	res := cmd.Call(req)
+	if res.Error() != nil {
+		t.Fatal(res.Error())
+	}
+
+	// ending the request doesn't stop the job
+	cancel()
+	<-started
+	select {
+	case <-stopped:
+		t.Fatal("Expected the job to keep running after the request ended")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	jobs := reg.Jobs()
+	if len(jobs) != 1 || jobs[0].ID != res.Output() || jobs[0].Name != "long job" || jobs[0].RequestID != req.ID() {
+		t.Errorf("Expected the job to be registered, got %+v", jobs)
+	}
+
+	hookRan := false
+	reg.OnShutdown(func() { hookRan = true })
+	if err := reg.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-stopped
+	if !hookRan {
+		t.Error("Expected the shutdown hook to run")
+	}
+	if len(reg.Jobs()) != 0 {
+		t.Error("Expected no jobs after shutdown")
+	}
+	if _, err := reg.Start("late", "", func(context.Context) {}); err != ErrShuttingDown {
+		t.Errorf("Expected ErrShuttingDown, got %v", err)
+	}
+}
+
+func TestRegistryCancel(t *testing.T) {
+	reg := NewRegistry(context.Background())
+
+	stopped := make(chan struct{})
+	id, err := reg.Start("job", "", func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reg.Cancel("nope") {
+		t.Error("Expected cancelling an unknown job to fail")
+	}
+	if !reg.Cancel(id) {
+		t.Error("Expected the job to be cancelled")
+	}
+	<-stopped
+}
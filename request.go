@@ -1,11 +1,14 @@
 package commands
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"reflect"
 	"strconv"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
@@ -16,7 +19,11 @@ import (
 
 type OptMap map[string]interface{}
 
-// Request represents a call to a command from a consumer
+// Request represents a call to a command from a consumer.
+//
+// Options, values and metadata may be read and set concurrently, e.g. from
+// goroutines spawned by a command's Run. The map returned by Values is the
+// exception: use Value and SetValue when it is shared between goroutines.
 type Request interface {
 	Path() []string
 	Option(name string) *OptionValue
@@ -31,9 +38,74 @@ type Request interface {
 	SetRootContext(context.Context) error
 	Command() *Command
 	Values() map[string]interface{}
+	Value(key string) (interface{}, bool)
+	SetValue(key string, val interface{})
 	Stdin() io.Reader
 
+	// SetStdin sets the reader the command's stdin arguments are read from.
+	// Requests read from os.Stdin by default, nil means there is no stdin.
+	SetStdin(io.Reader)
+
+	// ID returns the identifier of the request. Front-ends forward it so an
+	// invocation can be correlated with the activity it causes on a server.
+	ID() string
+	SetID(string)
+
+	// Metadata returns a copy of the request's string metadata, which is
+	// forwarded along with the request like its ID.
+	Metadata() map[string]string
+	SetMetadata(key, value string)
+
 	ConvertOptions() error
+
+	// DryRun returns true if the --dry-run option is set: commands that
+	// support it (see Command.SupportsDryRun) report what they would do,
+	// without doing it.
+	DryRun() bool
+}
+
+// CancelRequest cancels the context of req, recording cause as the reason.
+// Only the first cause is recorded. Requests that aren't made by this package
+// can be cancelled if they have a `Cancel(cause error)` method, CancelRequest
+// returns false for others.
+func CancelRequest(req Request, cause error) bool {
+	c, ok := req.(interface{ Cancel(cause error) })
+	if ok {
+		c.Cancel(cause)
+	}
+	return ok
+}
+
+// CancelCause returns the reason the context of req was cancelled, or nil if
+// it wasn't: the error passed to CancelRequest, a TimeoutError or
+// DeadlineError if it expired, or the error of the context otherwise (e.g.
+// when the root context was cancelled). Requests that aren't made by this
+// package report the error of their context, unless they have a
+// `Cause() error` method.
+func CancelCause(req Request) error {
+	if c, ok := req.(interface{ Cause() error }); ok {
+		return c.Cause()
+	}
+	if ctx := req.Context(); ctx != nil {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// CloneRequest returns a copy of req that can be modified without affecting
+// the original. Options, arguments and the values map are copied, while the
+// values themselves, files and stdin are shared. The clone has a context of
+// its own, derived from the original's, so cancelling the clone doesn't
+// cancel the original. The clone keeps the ID of the original.
+//
+// Requests that aren't made by this package can be cloned if they have a
+// `Clone() Request` method. CloneRequest returns false for others.
+func CloneRequest(req Request) (Request, bool) {
+	c, ok := req.(interface{ Clone() Request })
+	if !ok {
+		return nil, false
+	}
+	return c.Clone(), true
 }
 
 type request struct {
@@ -46,6 +118,13 @@ type request struct {
 	optionDefs map[string]Option
 	values     map[string]interface{}
 	stdin      io.Reader
+	id         string
+	metadata   map[string]string
+	cancel     context.CancelFunc
+	cause      error
+
+	// mu guards options, values, id, metadata and the context
+	mu sync.RWMutex
 }
 
 // Path returns the command path of this request
@@ -61,6 +140,9 @@ func (r *request) Option(name string) *OptionValue {
 		return nil
 	}
 
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	// try all the possible names, break if we find a value
 	for _, n := range option.Names() {
 		val, found := r.options[n]
@@ -75,6 +157,9 @@ func (r *request) Option(name string) *OptionValue {
 
 // Options returns a copy of the option map
 func (r *request) Options() OptMap {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	output := make(OptMap)
 	for k, v := range r.options {
 		output[k] = v
@@ -83,15 +168,49 @@ func (r *request) Options() OptMap {
 }
 
 func (r *request) SetRootContext(ctx context.Context) error {
-	ctx, err := getContext(ctx, r)
+	ctx, cancel, err := getContext(ctx, r)
 	if err != nil {
 		return err
 	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.rctx = ctx
+	r.cancel = cancel
+	r.cause = nil
 	return nil
 }
 
+func (r *request) Cancel(cause error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel == nil {
+		return
+	}
+	if r.cause == nil && r.rctx.Err() == nil {
+		r.cause = cause
+	}
+	r.cancel()
+}
+
+func (r *request) Cause() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.rctx == nil || r.rctx.Err() == nil {
+		return nil
+	}
+	if r.cause != nil {
+		return r.cause
+	}
+	if expiry, ok := r.rctx.Value(expiryKey{}).(error); ok && r.rctx.Err() == context.DeadlineExceeded {
+		return expiry
+	}
+	return r.rctx.Err()
+}
+
 // SetOption sets the value of the option for given name.
 func (r *request) SetOption(name string, val interface{}) {
 	// find the option with the specified name
@@ -100,6 +219,9 @@ func (r *request) SetOption(name string, val interface{}) {
 		return
 	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	// try all the possible names, if we already have a value then set over it
 	for _, n := range option.Names() {
 		_, found := r.options[n]
@@ -114,7 +236,9 @@ func (r *request) SetOption(name string, val interface{}) {
 
 // SetOptions sets the option values, unsetting any values that were previously set
 func (r *request) SetOptions(opts OptMap) error {
+	r.mu.Lock()
 	r.options = opts
+	r.mu.Unlock()
 	return r.ConvertOptions()
 }
 
@@ -125,6 +249,7 @@ func (r *request) Arguments() []string {
 
 func (r *request) SetArguments(args []string) {
 	r.arguments = args
+	r.fillArgDefaults()
 }
 
 func (r *request) Files() files.File {
@@ -136,31 +261,97 @@ func (r *request) SetFiles(f files.File) {
 }
 
 func (r *request) Context() context.Context {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	return r.rctx
 }
 
-func getContext(base context.Context, req Request) (context.Context, error) {
+// NoTimeout is the value of the timeout option that disables the timeout,
+// like "0". Servers may not permit it (see the http ServerConfig).
+const NoTimeout = "none"
+
+// TimeoutDisabled returns true if the timeout option of req explicitly
+// disables the timeout, with "0" or NoTimeout.
+func TimeoutDisabled(req Request) bool {
+	opt := req.Option(TimeoutOpt)
+	if opt == nil {
+		return false
+	}
+	tout, found, _ := opt.String()
+	return found && isNoTimeout(tout)
+}
+
+func isNoTimeout(tout string) bool {
+	if tout == NoTimeout {
+		return true
+	}
+	d, err := time.ParseDuration(tout)
+	return err == nil && d == 0
+}
+
+// getContext derives the context of req from base, applying its timeout and
+// deadline options. If it has a timeout or deadline, the error describing its
+// expiry is stored in the context under expiryKey.
+func getContext(base context.Context, req Request) (context.Context, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(base)
+
+	var expiry error
+	var expires time.Time
+
 	tout, found, err := req.Option("timeout").String()
 	if err != nil {
-		return nil, fmt.Errorf("error parsing timeout option: %s", err)
+		cancel()
+		return nil, nil, fmt.Errorf("error parsing timeout option: %s", err)
 	}
+	if found && !isNoTimeout(tout) {
+		duration, err := time.ParseDuration(tout)
+		if err != nil {
+			cancel()
+			return nil, nil, fmt.Errorf("error parsing timeout option: %s", err)
+		}
 
-	var ctx context.Context
+		expires = time.Now().Add(duration)
+		expiry = TimeoutError{duration}
+	}
+
+	// if both are set, whichever expires first applies
+	dl, found, err := GlobalOption(req, OptionDeadline).String()
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("error parsing deadline option: %s", err)
+	}
 	if found {
-		duration, err := time.ParseDuration(tout)
+		deadline, err := time.Parse(time.RFC3339, dl)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing timeout option: %s", err)
+			cancel()
+			return nil, nil, fmt.Errorf("error parsing deadline option: %s", err)
 		}
 
-		tctx, _ := context.WithTimeout(base, duration)
-		ctx = tctx
-	} else {
-		cctx, _ := context.WithCancel(base)
-		ctx = cctx
+		if expiry == nil || deadline.Before(expires) {
+			expires = deadline
+			expiry = DeadlineError{deadline}
+		}
+	}
+
+	if expiry != nil {
+		var dlCancel context.CancelFunc
+		ctx, dlCancel = context.WithDeadline(ctx, expires)
+		ctx = context.WithValue(ctx, expiryKey{}, expiry)
+
+		parentCancel := cancel
+		cancel = func() {
+			dlCancel()
+			parentCancel()
+		}
 	}
-	return ctx, nil
+	return ctx, cancel, nil
 }
 
+// expiryKey is the context key of the TimeoutError or DeadlineError of a
+// request's context, see getContext.
+type expiryKey struct{}
+
 func (r *request) Command() *Command {
 	return r.cmd
 }
@@ -193,15 +384,135 @@ var converters = map[reflect.Kind]converter{
 	},
 }
 
+// Values returns the values map. It is not safe for concurrent use, see
+// Value and SetValue.
 func (r *request) Values() map[string]interface{} {
 	return r.values
 }
 
+// Value returns the value stored for key in the values map.
+func (r *request) Value(key string) (interface{}, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.values[key]
+	return v, ok
+}
+
+// SetValue stores val for key in the values map.
+func (r *request) SetValue(key string, val interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.values[key] = val
+}
+
 func (r *request) Stdin() io.Reader {
 	return r.stdin
 }
 
+func (r *request) SetStdin(stdin io.Reader) {
+	r.stdin = stdin
+}
+
+func (r *request) ID() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.id
+}
+
+func (r *request) SetID(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.id = id
+}
+
+func (r *request) Metadata() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.copyMetadata()
+}
+
+func (r *request) copyMetadata() map[string]string {
+	output := make(map[string]string, len(r.metadata))
+	for k, v := range r.metadata {
+		output[k] = v
+	}
+	return output
+}
+
+func (r *request) SetMetadata(key, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.metadata == nil {
+		r.metadata = make(map[string]string)
+	}
+	r.metadata[key] = value
+}
+
+// Clone implements the optional interface of CloneRequest.
+func (r *request) Clone() Request {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	options := make(OptMap, len(r.options))
+	for k, v := range r.options {
+		options[k] = v
+	}
+
+	var arguments []string
+	if r.arguments != nil {
+		arguments = make([]string, len(r.arguments))
+		copy(arguments, r.arguments)
+	}
+
+	path := make([]string, len(r.path))
+	copy(path, r.path)
+
+	values := make(map[string]interface{}, len(r.values))
+	for k, v := range r.values {
+		values[k] = v
+	}
+
+	var rctx context.Context
+	var cancel context.CancelFunc
+	if r.rctx != nil {
+		rctx, cancel = context.WithCancel(r.rctx)
+	}
+
+	return &request{
+		path:       path,
+		options:    options,
+		arguments:  arguments,
+		files:      r.files,
+		cmd:        r.cmd,
+		rctx:       rctx,
+		cancel:     cancel,
+		optionDefs: r.optionDefs,
+		values:     values,
+		stdin:      r.stdin,
+		id:         r.id,
+		metadata:   r.copyMetadata(),
+	}
+}
+
+func (r *request) DryRun() bool {
+	opt := r.Option(DryRunOpt)
+	if opt == nil {
+		return false
+	}
+	dryRun, _, _ := opt.Bool()
+	return dryRun
+}
+
 func (r *request) ConvertOptions() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	for k, v := range r.options {
 		opt, ok := r.optionDefs[k]
 		if !ok {
@@ -243,9 +554,104 @@ func (r *request) ConvertOptions() error {
 		}
 	}
 
+	if r.cmd != nil {
+		return r.checkRequirements(r.cmd.Requires)
+	}
 	return nil
 }
 
+// checkRequirements returns an error explaining the first requirement that
+// isn't met by the options. The lock must be held.
+func (r *request) checkRequirements(reqs []OptionRequirement) error {
+	for _, req := range reqs {
+		val, found := r.optionValue(req.Option)
+		if !found || (req.Value != nil && fmt.Sprint(val) != fmt.Sprint(req.Value)) {
+			continue
+		}
+
+		for _, name := range req.Requires {
+			if _, found := r.optionValue(name); found {
+				continue
+			}
+
+			if req.Value == nil {
+				return fmt.Errorf("Option '%s' is required when option '%s' is set", name, req.Option)
+			}
+			return fmt.Errorf("Option '%s' is required when option '%s' is '%v'", name, req.Option, req.Value)
+		}
+	}
+	return nil
+}
+
+// optionValue returns the value of the option with the given name, under
+// any of its names. The lock must be held.
+func (r *request) optionValue(name string) (interface{}, bool) {
+	names := []string{name}
+	if option, found := r.optionDefs[name]; found {
+		names = option.Names()
+	}
+
+	for _, n := range names {
+		if val, found := r.options[n]; found {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// fillArgDefaults appends the default values of any optional string
+// arguments that weren't provided. Values are only filled in while every
+// preceding argument definition has a value, so the positions of the provided
+// arguments never shift.
+func (r *request) fillArgDefaults() {
+	if r.cmd == nil {
+		return
+	}
+
+	numRequired := 0
+	for _, argDef := range r.cmd.Arguments {
+		if argDef.Type == ArgString && argDef.Required {
+			numRequired++
+		}
+	}
+
+	args := make([]string, 0, len(r.arguments)+len(r.cmd.Arguments))
+	valueIndex := 0
+	gap := false
+	for _, argDef := range r.cmd.Arguments {
+		if argDef.Type != ArgString {
+			continue
+		}
+
+		// optional arguments are skipped if the remaining values are needed
+		// for the required arguments (see CheckArguments)
+		if len(r.arguments)-valueIndex <= numRequired && !argDef.Required {
+			if argDef.Default != "" && !gap {
+				args = append(args, argDef.Default)
+			} else {
+				gap = true
+			}
+			continue
+		}
+		if argDef.Required {
+			numRequired--
+		}
+
+		if valueIndex >= len(r.arguments) {
+			break
+		}
+		if argDef.Variadic {
+			args = append(args, r.arguments[valueIndex:]...)
+			valueIndex = len(r.arguments)
+			continue
+		}
+		args = append(args, r.arguments[valueIndex])
+		valueIndex++
+	}
+
+	r.arguments = append(args, r.arguments[valueIndex:]...)
+}
+
 // NewEmptyRequest initializes an empty request
 func NewEmptyRequest() (Request, error) {
 	return NewRequest(nil, nil, nil, nil, nil, nil)
@@ -271,7 +677,10 @@ func NewRequest(path []string, opts OptMap, args []string, file files.File, cmd
 		optionDefs: optDefs,
 		values:     values,
 		stdin:      os.Stdin,
+		id:         newRequestID(),
 	}
+	req.fillArgDefaults()
+
 	err := req.ConvertOptions()
 	if err != nil {
 		return nil, err
@@ -279,3 +688,12 @@ func NewRequest(path []string, opts OptMap, args []string, file files.File, cmd
 
 	return req, nil
 }
+
+// newRequestID returns a random identifier for a new request.
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
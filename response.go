@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
 )
 
 // ErrorType signfies a category of errors
@@ -25,12 +27,67 @@ const (
 type Error struct {
 	Message string
 	Code    ErrorType
+
+	// Kind is a stable, machine-readable identifier of the error (e.g.
+	// "not-found"), for clients to branch on instead of the message.
+	Kind string `json:",omitempty" xml:",omitempty"`
+
+	// Details optionally holds structured data about the error, e.g. the
+	// name of the missing object.
+	Details map[string]interface{} `json:",omitempty" xml:"-"`
+
+	// Hints are suggested remediations of the error for the user, e.g.
+	// "did you mean --recursive?".
+	Hints []string `json:",omitempty" xml:",omitempty"`
+
+	// err is the underlying error, it's not encoded
+	err error
 }
 
 func (e Error) Error() string {
 	return e.Message
 }
 
+// Unwrap returns the underlying error, so errors.Is and errors.As see it.
+func (e Error) Unwrap() error {
+	return e.err
+}
+
+// WrapError returns an Error for err with the given code and kind.
+func WrapError(err error, code ErrorType, kind string) *Error {
+	return &Error{Message: err.Error(), Code: code, Kind: kind, err: err}
+}
+
+// WithDetail returns a copy of e with the detail k set to v.
+func (e Error) WithDetail(k string, v interface{}) *Error {
+	details := make(map[string]interface{}, len(e.Details)+1)
+	for dk, dv := range e.Details {
+		details[dk] = dv
+	}
+	details[k] = v
+	e.Details = details
+	return &e
+}
+
+// WithHint returns a copy of e with the hint h appended to its hints.
+func (e Error) WithHint(h string) *Error {
+	e.Hints = append(e.Hints[:len(e.Hints):len(e.Hints)], h)
+	return &e
+}
+
+// asError returns err as an *Error, if it is (or wraps) an Error.
+func asError(err error) (*Error, bool) {
+	var pe *Error
+	if errors.As(err, &pe) {
+		return pe, true
+	}
+	var e Error
+	if errors.As(err, &e) {
+		return &e, true
+	}
+	return nil, false
+}
+
 // EncodingType defines a supported encoding
 type EncodingType string
 
@@ -39,6 +96,10 @@ const (
 	JSON = "json"
 	XML  = "xml"
 	Text = "text"
+	YAML = "yaml"
+	// NDJSON encodes each value of a channel output as a JSON object on its
+	// own line, so it can be processed as soon as it's written
+	NDJSON = "ndjson"
 	// TODO: support more encoding types
 )
 
@@ -50,13 +111,65 @@ func marshalJson(value interface{}) (io.Reader, error) {
 	return bytes.NewReader(b), nil
 }
 
+// marshalCompactJson encodes value as JSON on a single line
+func marshalCompactJson(value interface{}) (io.Reader, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(append(b, '\n')), nil
+}
+
 var marshallers = map[EncodingType]Marshaler{
 	JSON: func(res Response) (io.Reader, error) {
+		marshal := marshalJson
+		if compact, _, _ := GlobalOption(res.Request(), OptionCompactJSON).Bool(); compact {
+			marshal = marshalCompactJson
+		}
+
+		ch, ok := res.Output().(<-chan interface{})
+		if ok {
+			return &ChannelMarshaler{
+				Channel:   ch,
+				Marshaler: marshal,
+				Res:       res,
+			}, nil
+		}
+
+		var value interface{}
+		if res.Error() != nil {
+			value = res.Error()
+		} else {
+			value = res.Output()
+		}
+		return marshal(value)
+	},
+	YAML: func(res Response) (io.Reader, error) {
+		ch, ok := res.Output().(<-chan interface{})
+		if ok {
+			return &ChannelMarshaler{
+				Channel:   ch,
+				Marshaler: marshalYamlDocument,
+				Res:       res,
+			}, nil
+		}
+
+		var value interface{}
+		if res.Error() != nil {
+			value = res.Error()
+		} else {
+			value = res.Output()
+		}
+		return marshalYaml(value)
+	},
+	NDJSON: func(res Response) (io.Reader, error) {
 		ch, ok := res.Output().(<-chan interface{})
 		if ok {
+			// the ChannelMarshaler returns each value in its own reads, so
+			// every line is flushed as soon as it's marshalled
 			return &ChannelMarshaler{
 				Channel:   ch,
-				Marshaler: marshalJson,
+				Marshaler: marshalCompactJson,
 				Res:       res,
 			}, nil
 		}
@@ -67,8 +180,11 @@ var marshallers = map[EncodingType]Marshaler{
 		} else {
 			value = res.Output()
 		}
-		return marshalJson(value)
+		return marshalCompactJson(value)
 	},
+	Protobuf: marshalProtobuf,
+	CSV:      tableMarshaler(','),
+	TSV:      tableMarshaler('\t'),
 	XML: func(res Response) (io.Reader, error) {
 		var value interface{}
 		if res.Error() != nil {
@@ -118,15 +234,94 @@ type Response interface {
 	Stderr() io.Writer
 }
 
+// AddWarning adds a non-fatal diagnostic to res, which doesn't abort the
+// output. It may be called while the output is being read. Responses that
+// aren't made by this package keep warnings if they have an
+// `AddWarning(string)` method, others drop them.
+func AddWarning(res Response, msg string) {
+	if w, ok := res.(interface{ AddWarning(string) }); ok {
+		w.AddWarning(msg)
+	}
+}
+
+// Warnings returns the warnings added to res, see AddWarning. Responses that
+// aren't made by this package have warnings if they have a
+// `Warnings() []string` method.
+func Warnings(res Response) []string {
+	if w, ok := res.(interface{ Warnings() []string }); ok {
+		return w.Warnings()
+	}
+	return nil
+}
+
+// SetTrailer attaches metadata to res, e.g. the elapsed time or the number of
+// items processed. Unlike the output, trailers may be set until the output
+// was read, and are sent after it. Names are lowercase header tokens, like
+// "elapsed" or "items". Responses that aren't made by this package keep
+// trailers if they have a `SetTrailer(name, value string)` method, others
+// drop them.
+func SetTrailer(res Response, name, value string) {
+	if t, ok := res.(interface{ SetTrailer(name, value string) }); ok {
+		t.SetTrailer(name, value)
+	}
+}
+
+// Trailers returns the trailers set on res, see SetTrailer. Responses that
+// aren't made by this package have trailers if they have a
+// `Trailers() map[string]string` method.
+func Trailers(res Response) map[string]string {
+	if t, ok := res.(interface{ Trailers() map[string]string }); ok {
+		return t.Trailers()
+	}
+	return nil
+}
+
+// SetItemCount sets the number of values the channel output of res is
+// expected to have, as a hint for progress displays. Responses that aren't
+// made by this package keep it if they have a `SetItemCount(uint64)` method.
+func SetItemCount(res Response, n uint64) {
+	if c, ok := res.(interface{ SetItemCount(uint64) }); ok {
+		c.SetItemCount(n)
+	}
+}
+
+// ItemCount returns the number of values the channel output of res is
+// expected to have, see SetItemCount. Zero means it isn't known.
+func ItemCount(res Response) uint64 {
+	if c, ok := res.(interface{ ItemCount() uint64 }); ok {
+		return c.ItemCount()
+	}
+	return 0
+}
+
+// Tee copies the output read from the Reader of res to the writers as well
+// (e.g. a log file), without running the command again. It has to be called
+// before Reader. A writer that fails is dropped, without failing the output.
+// Responses that aren't made by this package can be teed if they have a
+// `Tee(...io.Writer)` method, Tee returns false for others.
+func Tee(res Response, w ...io.Writer) bool {
+	t, ok := res.(interface{ Tee(...io.Writer) })
+	if ok {
+		t.Tee(w...)
+	}
+	return ok
+}
+
 type response struct {
 	req    Request
 	err    *Error
 	value  interface{}
 	out    io.Reader
 	length uint64
+	items  uint64
 	stdout io.Writer
 	stderr io.Writer
 	closer io.Closer
+	sinks  []io.Writer
+
+	metaMu   sync.Mutex // guards err, warnings and trailers
+	warnings []string
+	trailers map[string]string
 }
 
 func (r *response) Request() Request {
@@ -149,16 +344,35 @@ func (r *response) SetLength(l uint64) {
 	r.length = l
 }
 
+func (r *response) ItemCount() uint64 {
+	return r.items
+}
+
+func (r *response) SetItemCount(n uint64) {
+	r.items = n
+}
+
 func (r *response) Error() *Error {
+	r.metaMu.Lock()
+	defer r.metaMu.Unlock()
 	return r.err
 }
 
 func (r *response) SetError(err error, code ErrorType) {
-	r.err = &Error{Message: err.Error(), Code: code}
+	e := &Error{Message: err.Error(), Code: code, err: err}
+	if ce, ok := asError(err); ok {
+		// keep the kind and details of structured errors
+		e.Kind = ce.Kind
+		e.Details = ce.Details
+		e.Hints = ce.Hints
+	}
+	r.metaMu.Lock()
+	r.err = e
+	r.metaMu.Unlock()
 }
 
 func (r *response) Marshal() (io.Reader, error) {
-	if r.err == nil && r.value == nil {
+	if r.Error() == nil && r.value == nil {
 		return bytes.NewReader([]byte{}), nil
 	}
 
@@ -177,12 +391,17 @@ func (r *response) Marshal() (io.Reader, error) {
 	}
 
 	var marshaller Marshaler
-	if r.req.Command() != nil && r.req.Command().Marshalers != nil {
-		marshaller = r.req.Command().Marshalers[encType]
+	if cmd := r.req.Command(); cmd != nil {
+		if format, found, _ := GlobalOption(r.req, OptionOutputFormat).String(); found {
+			marshaller = cmd.Formats[format][encType]
+		}
+		if marshaller == nil && cmd.Marshalers != nil {
+			marshaller = cmd.Marshalers[encType]
+		}
 	}
 	if marshaller == nil {
 		var ok bool
-		marshaller, ok = marshallers[encType]
+		marshaller, ok = encoder(encType)
 		if !ok {
 			return nil, fmt.Errorf("No marshaller found for encoding type '%s'", enc)
 		}
@@ -215,11 +434,39 @@ func (r *response) Reader() (io.Reader, error) {
 
 			r.out = marshalled
 		}
+
+		if len(r.sinks) > 0 {
+			r.out = &teeReader{r: r.out, sinks: append([]io.Writer(nil), r.sinks...)}
+		}
 	}
 
 	return r.out, nil
 }
 
+func (r *response) Tee(w ...io.Writer) {
+	r.sinks = append(r.sinks, w...)
+}
+
+// teeReader writes what is read from r to its sinks, dropping those that fail.
+type teeReader struct {
+	r     io.Reader
+	sinks []io.Writer
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		sinks := t.sinks[:0]
+		for _, w := range t.sinks {
+			if _, werr := w.Write(p[:n]); werr == nil {
+				sinks = append(sinks, w)
+			}
+		}
+		t.sinks = sinks
+	}
+	return n, err
+}
+
 func (r *response) Close() error {
 	if r.closer != nil {
 		return r.closer.Close()
@@ -239,6 +486,37 @@ func (r *response) Stderr() io.Writer {
 	return r.stderr
 }
 
+func (r *response) AddWarning(msg string) {
+	r.metaMu.Lock()
+	defer r.metaMu.Unlock()
+	r.warnings = append(r.warnings, msg)
+}
+
+func (r *response) Warnings() []string {
+	r.metaMu.Lock()
+	defer r.metaMu.Unlock()
+	return append([]string(nil), r.warnings...)
+}
+
+func (r *response) SetTrailer(name, value string) {
+	r.metaMu.Lock()
+	defer r.metaMu.Unlock()
+	if r.trailers == nil {
+		r.trailers = make(map[string]string)
+	}
+	r.trailers[name] = value
+}
+
+func (r *response) Trailers() map[string]string {
+	r.metaMu.Lock()
+	defer r.metaMu.Unlock()
+	trailers := make(map[string]string, len(r.trailers))
+	for k, v := range r.trailers {
+		trailers[k] = v
+	}
+	return trailers
+}
+
 // NewResponse returns a response to match given Request
 func NewResponse(req Request) Response {
 	return &response{
@@ -2,9 +2,14 @@ package commands
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 type TestOutput struct {
@@ -59,3 +64,648 @@ func removeWhitespace(input string) string {
 	input = strings.Replace(input, "\n", "", -1)
 	return strings.Replace(input, "\r", "", -1)
 }
+
+type tieredOutput struct {
+	Name string
+	Size int
+	Hash string `cmds:"verbose"`
+}
+
+func TestMarshalFields(t *testing.T) {
+	cmd := &Command{}
+	opts, _ := cmd.GetOptions(nil)
+
+	marshal := func(verbose bool) string {
+		req, _ := NewRequest(nil, nil, nil, nil, nil, opts)
+		if verbose {
+			req.SetOption(VerboseOpt, true)
+		}
+		res := NewResponse(req)
+		res.SetOutput(&tieredOutput{"a", 1, "Qm"})
+
+		reader, err := MarshalFields(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(reader)
+		return buf.String()
+	}
+
+	if out := marshal(false); out != "Name: a\nSize: 1\n" {
+		t.Errorf("Incorrect default output: %q", out)
+	}
+	if out := marshal(true); out != "Name: a\nSize: 1\nHash: Qm\n" {
+		t.Errorf("Incorrect verbose output: %q", out)
+	}
+}
+
+func TestMarshalYaml(t *testing.T) {
+	type link struct {
+		Name string `json:"name"`
+		Size int    `json:"size,omitempty"`
+	}
+	type object struct {
+		Hash  string                 `json:"hash"`
+		Links []link                 `json:"links"`
+		Tags  []string               `json:"tags"`
+		Meta  map[string]interface{} `json:"meta"`
+		Note  string                 `json:"note"`
+		Empty []int                  `json:"empty"`
+	}
+
+	cmd := &Command{}
+	opts, _ := cmd.GetOptions(nil)
+	req, _ := NewRequest(nil, OptMap{EncShort: YAML}, nil, nil, cmd, opts)
+
+	res := NewResponse(req)
+	res.SetOutput(object{
+		Hash:  "QmHash",
+		Links: []link{{"a", 1}, {"b: c", 0}},
+		Tags:  []string{"true", "x"},
+		Meta:  map[string]interface{}{"n": nil, "ok": true},
+		Note:  "",
+		Empty: []int{},
+	})
+
+	reader, err := res.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(reader)
+
+	expected := `hash: QmHash
+links:
+  - name: a
+    size: 1
+  - name: "b: c"
+tags:
+  - "true"
+  - x
+meta:
+  "n": null
+  ok: true
+note: ""
+empty: []
+`
+	if buf.String() != expected {
+		t.Errorf("Incorrect YAML output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	ch := make(chan interface{}, 2)
+	ch <- link{"a", 1}
+	ch <- "b"
+	close(ch)
+	res = NewResponse(req)
+	res.SetOutput((<-chan interface{})(ch))
+
+	reader, err = res.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	buf.ReadFrom(reader)
+	expected = "---\nname: a\nsize: 1\n---\nb\n"
+	if buf.String() != expected {
+		t.Errorf("Incorrect YAML stream output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	for s, quoted := range map[string]bool{
+		"0x10": true, "0o17": true, "0b101": true, "1_000": true,
+		".inf": true, "+.Inf": true, ".NaN": true, "1:20": true,
+		"2001-12-14": true, "2001-12-14t21:59:43.10-05:00": true,
+		"v1.0": false, "0xyz": false, "1-2-3": false, "a:b": false,
+	} {
+		if yamlNeedsQuotes(s) != quoted {
+			t.Errorf("Expected quoting %q to be %v", s, quoted)
+		}
+	}
+}
+
+type testMessage struct {
+	data string
+}
+
+func (m *testMessage) Marshal() ([]byte, error) {
+	return []byte(m.data), nil
+}
+
+func TestMarshalProtobuf(t *testing.T) {
+	marshal := func(cmd *Command, out interface{}) (string, error) {
+		opts, _ := cmd.GetOptions(nil)
+		req, _ := NewRequest(nil, OptMap{EncShort: Protobuf}, nil, nil, cmd, opts)
+		res := NewResponse(req)
+		if err, ok := out.(error); ok {
+			res.SetError(err, ErrClient)
+		} else {
+			res.SetOutput(out)
+		}
+
+		reader, err := res.Marshal()
+		if err != nil {
+			return "", err
+		}
+		buf := new(bytes.Buffer)
+		_, err = buf.ReadFrom(reader)
+		return buf.String(), err
+	}
+
+	out, err := marshal(&Command{}, &testMessage{"abc"})
+	if err != nil || out != "\x03abc" {
+		t.Errorf("Expected the message to be encoded, got %q (%v)", out, err)
+	}
+
+	out, err = marshal(&Command{}, errors.New("oops"))
+	if err != nil || out != "\x08\x0a\x04oops\x10\x01" {
+		t.Errorf("Expected the error to be encoded as a message, got %q (%v)", out, err)
+	}
+
+	if _, err := marshal(&Command{}, "abc"); err != ErrNoProtoMessage {
+		t.Errorf("Expected ErrNoProtoMessage, got %v", err)
+	}
+
+	cmd := &Command{
+		ProtoMessage: func(v interface{}) (ProtoMarshaler, error) {
+			return &testMessage{v.(string)}, nil
+		},
+	}
+	ch := make(chan interface{}, 2)
+	ch <- "ab"
+	ch <- "c"
+	close(ch)
+	out, err = marshal(cmd, (<-chan interface{})(ch))
+	if err != nil || out != "\x02ab\x01c" {
+		t.Errorf("Expected length-delimited messages, got %q (%v)", out, err)
+	}
+}
+
+func TestMarshalNdjson(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+	}
+
+	cmd := &Command{}
+	opts, _ := cmd.GetOptions(nil)
+	req, _ := NewRequest(nil, OptMap{EncShort: NDJSON}, nil, nil, cmd, opts)
+	res := NewResponse(req)
+
+	ch := make(chan interface{})
+	res.SetOutput((<-chan interface{})(ch))
+	reader, err := res.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		ch <- item{"a"}
+		ch <- item{"b"}
+		close(ch)
+	}()
+
+	// each value is returned as soon as it's sent, without waiting for the
+	// rest of the channel
+	buf := make([]byte, 1024)
+	for _, expected := range []string{"{\"name\":\"a\"}\n", "{\"name\":\"b\"}\n"} {
+		n, err := reader.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != expected {
+			t.Errorf("Expected line %q, got %q", expected, buf[:n])
+		}
+		// the end of the value
+		if n, err = reader.Read(buf); n != 0 || err != nil {
+			t.Fatalf("Expected an empty read, got %d bytes (%v)", n, err)
+		}
+	}
+	if _, err := reader.Read(buf); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
+
+func TestMarshalTable(t *testing.T) {
+	type row struct {
+		Name   string `csv:"name"`
+		Size   int    `csv:"size"`
+		Hidden bool   `csv:"-"`
+		Note   *string
+	}
+
+	marshal := func(enc string, out interface{}) (string, error) {
+		cmd := &Command{}
+		opts, _ := cmd.GetOptions(nil)
+		req, _ := NewRequest(nil, OptMap{EncShort: enc}, nil, nil, cmd, opts)
+		res := NewResponse(req)
+		res.SetOutput(out)
+
+		reader, err := res.Marshal()
+		if err != nil {
+			return "", err
+		}
+		buf := new(bytes.Buffer)
+		_, err = buf.ReadFrom(reader)
+		return buf.String(), err
+	}
+
+	note := "a, b"
+	out, err := marshal(CSV, []row{{"x", 1, true, nil}, {"y", 2, false, &note}})
+	expected := "name,size,Note\nx,1,\ny,2,\"a, b\"\n"
+	if err != nil || out != expected {
+		t.Errorf("Expected %q, got %q (%v)", expected, out, err)
+	}
+
+	ch := make(chan interface{}, 2)
+	ch <- &row{Name: "x"}
+	ch <- []*row{{Name: "y", Size: 3}}
+	close(ch)
+	out, err = marshal(TSV, (<-chan interface{})(ch))
+	expected = "name\tsize\tNote\nx\t0\t\ny\t3\t\n"
+	if err != nil || out != expected {
+		t.Errorf("Expected %q, got %q (%v)", expected, out, err)
+	}
+
+	if _, err := marshal(CSV, "abc"); err != ErrNotTabular {
+		t.Errorf("Expected ErrNotTabular, got %v", err)
+	}
+	if _, err := marshal(CSV, []struct{ Tags []string }{{}}); err == nil {
+		t.Error("Expected nested values to fail")
+	}
+
+	// the command can finish its output after the marshaler failed
+	unbuffered := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(unbuffered)
+		unbuffered <- "not a row"
+		unbuffered <- &row{Name: "x"}
+	}()
+	if _, err := marshal(CSV, (<-chan interface{})(unbuffered)); err != ErrNotTabular {
+		t.Errorf("Expected ErrNotTabular, got %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the rest of the output to be drained")
+	}
+}
+
+func TestTextTableMarshaler(t *testing.T) {
+	type row struct {
+		Name string `csv:"name"`
+		Size int    `csv:"size"`
+		Path string `csv:"path"`
+	}
+
+	marshal := func(f TableFormat, out interface{}) (string, error) {
+		cmd := &Command{
+			Marshalers: MarshalerMap{Text: TextTableMarshaler(f)},
+		}
+		opts, _ := cmd.GetOptions(nil)
+		req, _ := NewRequest(nil, OptMap{EncShort: Text}, nil, nil, cmd, opts)
+		res := NewResponse(req)
+		res.SetOutput(out)
+
+		reader, err := res.Marshal()
+		if err != nil {
+			return "", err
+		}
+		buf := new(bytes.Buffer)
+		_, err = buf.ReadFrom(reader)
+		return buf.String(), err
+	}
+
+	rows := []row{{"a", 1, "/x"}, {"bcd", 1024, "/long/path/to/file"}}
+	out, err := marshal(TableFormat{Header: true}, rows)
+	expected := "NAME  SIZE  PATH\n" +
+		"a     1     /x\n" +
+		"bcd   1024  /long/path/to/file\n"
+	if err != nil || out != expected {
+		t.Errorf("Expected %q, got %q (%v)", expected, out, err)
+	}
+
+	ch := make(chan interface{}, 2)
+	ch <- rows[0]
+	ch <- &rows[1]
+	close(ch)
+	out, err = marshal(TableFormat{Width: 16}, (<-chan interface{})(ch))
+	expected = "a    1     /x\n" +
+		"bcd  1024  /lon…\n"
+	if err != nil || out != expected {
+		t.Errorf("Expected %q, got %q (%v)", expected, out, err)
+	}
+
+	defer os.Setenv("COLUMNS", os.Getenv("COLUMNS"))
+	os.Setenv("COLUMNS", "16")
+	out, err = marshal(TableFormat{FitTerminal: true}, rows)
+	if err != nil || out != expected {
+		t.Errorf("Expected the terminal width to apply, got %q (%v)", out, err)
+	}
+
+	// the command can finish its output after the marshaler failed
+	unbuffered := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(unbuffered)
+		unbuffered <- rows[0]
+		unbuffered <- "not a row"
+		unbuffered <- rows[1]
+	}()
+	if _, err := marshal(TableFormat{}, (<-chan interface{})(unbuffered)); err != ErrNotTabular {
+		t.Errorf("Expected ErrNotTabular, got %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the rest of the output to be drained")
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	const upper = EncodingType("test-upper")
+	RegisterEncoder(upper, func(res Response) (io.Reader, error) {
+		return strings.NewReader(strings.ToUpper(fmt.Sprint(res.Output()))), nil
+	})
+
+	found := false
+	for _, name := range Encoders() {
+		found = found || name == upper
+	}
+	if !found {
+		t.Errorf("Expected %s to be listed in %v", upper, Encoders())
+	}
+	desc := OptionEncodingType.Description()
+	if !strings.Contains(desc, string(upper)+",") || !strings.Contains(desc, "protobuf,") || !strings.HasSuffix(desc, ", or yaml)") {
+		t.Errorf("Expected the encodings to be listed in the option description, got %q", desc)
+	}
+
+	cmd := &Command{}
+	opts, _ := cmd.GetOptions(nil)
+	req, _ := NewRequest(nil, OptMap{EncShort: string(upper)}, nil, nil, cmd, opts)
+	res := NewResponse(req)
+	res.SetOutput("abc")
+
+	reader, err := res.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(reader)
+	if buf.String() != "ABC" {
+		t.Errorf("Expected the registered encoder to be used, got %q", buf.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a builtin encoding to panic")
+		}
+	}()
+	RegisterEncoder(JSON, func(res Response) (io.Reader, error) { return nil, nil })
+}
+
+func TestOutputFormats(t *testing.T) {
+	text := func(s string) Marshaler {
+		return func(res Response) (io.Reader, error) {
+			return strings.NewReader(s + ":" + res.Output().(string)), nil
+		}
+	}
+
+	cmd := &Command{
+		Run: func(req Request, res Response) {
+			res.SetOutput("abc")
+		},
+		Marshalers: MarshalerMap{Text: text("default")},
+		Formats: map[string]MarshalerMap{
+			"short": {Text: text("short")},
+			"long":  {Text: text("long")},
+		},
+	}
+
+	call := func(opts OptMap) (string, error) {
+		optDefs, _ := cmd.GetOptions(nil)
+		req, err := NewRequest(nil, opts, nil, nil, cmd, optDefs)
+		if err != nil {
+			return "", err
+		}
+		res := cmd.Call(req)
+		if res.Error() != nil {
+			return "", res.Error()
+		}
+
+		reader, err := res.Marshal()
+		if err != nil {
+			return "", err
+		}
+		buf := new(bytes.Buffer)
+		_, err = buf.ReadFrom(reader)
+		return buf.String(), err
+	}
+
+	cases := []struct {
+		opts     OptMap
+		expected string
+	}{
+		{OptMap{EncShort: Text}, "default:abc"},
+		{OptMap{EncShort: Text, OutputFormatOpt: "short"}, "short:abc"},
+		{OptMap{EncShort: Text, OutputFormatOpt: "long"}, "long:abc"},
+		{OptMap{EncShort: JSON, OutputFormatOpt: "long"}, "\"abc\""},
+	}
+	for _, c := range cases {
+		out, err := call(c.opts)
+		if err != nil || out != c.expected {
+			t.Errorf("Expected %q for %v, got %q (%v)", c.expected, c.opts, out, err)
+		}
+	}
+
+	_, err := call(OptMap{EncShort: Text, OutputFormatOpt: "wide"})
+	if err == nil || !strings.Contains(err.Error(), "long, short") {
+		t.Errorf("Expected an unknown format error listing the formats, got %v", err)
+	}
+}
+
+func TestCompactJSON(t *testing.T) {
+	type value struct {
+		A int
+		B []string
+	}
+
+	marshal := func(opts OptMap, out interface{}) string {
+		cmd := &Command{}
+		optDefs, _ := cmd.GetOptions(nil)
+		req, _ := NewRequest(nil, opts, nil, nil, cmd, optDefs)
+		res := NewResponse(req)
+		res.SetOutput(out)
+
+		reader, err := res.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(reader)
+		return buf.String()
+	}
+
+	v := value{1, []string{"x"}}
+	if out := marshal(OptMap{EncShort: JSON}, v); !strings.Contains(out, "\n  ") {
+		t.Errorf("Expected indented JSON by default, got %q", out)
+	}
+	if out := marshal(OptMap{EncShort: JSON, CompactJSONOpt: true}, v); out != "{\"A\":1,\"B\":[\"x\"]}\n" {
+		t.Errorf("Expected compact JSON, got %q", out)
+	}
+
+	ch := make(chan interface{}, 2)
+	ch <- v
+	ch <- value{2, nil}
+	close(ch)
+	out := marshal(OptMap{EncShort: JSON, CompactJSONOpt: true}, (<-chan interface{})(ch))
+	if out != "{\"A\":1,\"B\":[\"x\"]}\n{\"A\":2,\"B\":null}\n" {
+		t.Errorf("Expected a compact value per line, got %q", out)
+	}
+}
+
+func TestStructuredError(t *testing.T) {
+	cmd := &Command{}
+	opts, _ := cmd.GetOptions(nil)
+
+	marshal := func(enc string) string {
+		req, _ := NewRequest(nil, OptMap{EncShort: enc}, nil, nil, cmd, opts)
+		res := NewResponse(req)
+		res.SetError(WrapError(os.ErrNotExist, ErrNormal, "not-found").WithDetail("path", "/x"), ErrNormal)
+
+		e := res.Error()
+		if e.Kind != "not-found" || e.Details["path"] != "/x" {
+			t.Errorf("Expected the kind and details to be kept, got %+v", e)
+		}
+		if !errors.Is(e, os.ErrNotExist) {
+			t.Error("Expected the error to wrap os.ErrNotExist")
+		}
+
+		reader, err := res.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(reader)
+		return buf.String()
+	}
+
+	out := marshal(JSON)
+	if !strings.Contains(out, `"Kind": "not-found"`) || !strings.Contains(out, `"path": "/x"`) {
+		t.Errorf("Expected the kind and details in the JSON error, got %s", out)
+	}
+	if out := marshal(XML); !strings.Contains(out, "<Kind>not-found</Kind>") {
+		t.Errorf("Expected the kind in the XML error, got %s", out)
+	}
+
+	// errors without a kind are encoded as before
+	req, _ := NewRequest(nil, OptMap{EncShort: JSON}, nil, nil, cmd, opts)
+	res := NewResponse(req)
+	res.SetError(errors.New("oops"), ErrClient)
+	reader, _ := res.Marshal()
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(reader)
+	if strings.Contains(buf.String(), "Kind") || strings.Contains(buf.String(), "Details") {
+		t.Errorf("Expected no kind or details, got %s", buf.String())
+	}
+}
+
+type failingWriter struct{ writes int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+func TestResponseTee(t *testing.T) {
+	cmd := &Command{}
+	opts, _ := cmd.GetOptions(nil)
+	req, _ := NewRequest(nil, OptMap{EncShort: NDJSON}, nil, nil, cmd, opts)
+	res := NewResponse(req)
+
+	ch := make(chan interface{}, 2)
+	ch <- "a"
+	ch <- "b"
+	close(ch)
+	res.SetOutput((<-chan interface{})(ch))
+
+	var log bytes.Buffer
+	failing := &failingWriter{}
+	if !Tee(res, &log, failing) {
+		t.Fatal("Expected the response to be teed")
+	}
+
+	r, err := res.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != "\"a\"\n\"b\"\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+	if log.String() != string(out) {
+		t.Errorf("Expected the sink to get the output %q, got %q", out, log.String())
+	}
+	if failing.writes != 1 {
+		t.Errorf("Expected the failing sink to be dropped after its first write, got %d writes", failing.writes)
+	}
+}
+
+// plainResponse only has the methods of the Response interface.
+type plainResponse struct {
+	Response
+}
+
+func TestWarningsOptional(t *testing.T) {
+	req, _ := NewRequest(nil, nil, nil, nil, &Command{}, nil)
+	res := NewResponse(req)
+	AddWarning(res, "one")
+	if w := Warnings(res); len(w) != 1 || w[0] != "one" {
+		t.Errorf("Expected the warning to be kept, got %q", w)
+	}
+
+	plain := plainResponse{res}
+	AddWarning(plain, "two")
+	if w := Warnings(plain); w != nil {
+		t.Errorf("Expected no warnings without the methods, got %q", w)
+	}
+}
+
+func TestTrailersOptional(t *testing.T) {
+	req, _ := NewRequest(nil, nil, nil, nil, &Command{}, nil)
+	res := NewResponse(req)
+	SetTrailer(res, "items", "2")
+	if tr := Trailers(res); tr["items"] != "2" {
+		t.Errorf("Expected the trailer to be kept, got %v", tr)
+	}
+
+	plain := plainResponse{res}
+	SetTrailer(plain, "elapsed", "1s")
+	if tr := Trailers(plain); tr != nil {
+		t.Errorf("Expected no trailers without the methods, got %v", tr)
+	}
+}
+
+func TestItemCountOptional(t *testing.T) {
+	req, _ := NewRequest(nil, nil, nil, nil, &Command{}, nil)
+	res := NewResponse(req)
+	SetItemCount(res, 3)
+	if n := ItemCount(res); n != 3 {
+		t.Errorf("Expected the item count to be kept, got %d", n)
+	}
+	if n := ItemCount(plainResponse{res}); n != 0 {
+		t.Errorf("Expected no item count without the methods, got %d", n)
+	}
+}
+
+func TestTeeOptional(t *testing.T) {
+	req, _ := NewRequest(nil, nil, nil, nil, &Command{}, nil)
+	if Tee(plainResponse{NewResponse(req)}, new(bytes.Buffer)) {
+		t.Error("Expected responses without the method not to be teed")
+	}
+}
@@ -0,0 +1,449 @@
+package commands
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is a JSON Schema document.
+type Schema map[string]interface{}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// TypeSchema returns the JSON Schema of the JSON encoding of values of type t.
+// Struct fields are named and omitted following the `json` struct tags.
+// Types with custom JSON marshalling are described by an empty (any value)
+// schema, and recursive types are cut off at the first repetition.
+func TypeSchema(t reflect.Type) Schema {
+	if t == nil {
+		return Schema{}
+	}
+	return typeSchema(t, map[reflect.Type]bool{})
+}
+
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return Schema{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is encoded as a base64 string
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return Schema{"type": "array", "items": typeSchema(t.Elem(), seen)}
+
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": typeSchema(t.Elem(), seen)}
+
+	case reflect.Struct:
+		if seen[t] {
+			return Schema{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		properties := Schema{}
+		required := []string{}
+		for _, f := range dominantFields(structFields(t, 0, false, map[reflect.Type]bool{})) {
+			properties[f.name] = typeSchema(f.typ, seen)
+			if f.required {
+				required = append(required, f.name)
+			}
+		}
+
+		schema := Schema{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+
+	// interfaces, channels, functions etc.
+	return Schema{}
+}
+
+// schemaField is a field of the JSON encoding of a struct, see structFields
+type schemaField struct {
+	name     string
+	typ      reflect.Type
+	required bool
+	depth    int
+	tagged   bool
+}
+
+// structFields returns the fields of the JSON encoding of struct t, promoting
+// the fields of embedded structs like encoding/json does. Pointer fields,
+// omitempty fields and the fields promoted from embedded pointers are not
+// required, since they can be null or missing.
+func structFields(t reflect.Type, depth int, optional bool, visited map[reflect.Type]bool) []schemaField {
+	if visited[t] {
+		return nil
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	var fields []schemaField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		ft := field.Type
+		if field.Anonymous && ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.PkgPath != "" && !(field.Anonymous && ft.Kind() == reflect.Struct) {
+			continue // unexported
+		}
+
+		name, omitEmpty, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+		tagged := strings.Split(field.Tag.Get("json"), ",")[0] != ""
+		if field.Anonymous && ft.Kind() == reflect.Struct && !tagged {
+			inner := optional || field.Type.Kind() == reflect.Ptr
+			fields = append(fields, structFields(ft, depth+1, inner, visited)...)
+			continue
+		}
+
+		fields = append(fields, schemaField{
+			name:     name,
+			typ:      field.Type,
+			required: !optional && !omitEmpty && field.Type.Kind() != reflect.Ptr,
+			depth:    depth,
+			tagged:   tagged,
+		})
+	}
+	return fields
+}
+
+// dominantFields drops the fields hidden by others of the same name, with the
+// rules of encoding/json: the shallowest field wins, and of several at the
+// same depth only a single tagged one does.
+func dominantFields(fields []schemaField) []schemaField {
+	byName := map[string][]schemaField{}
+	var names []string
+	for _, f := range fields {
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	var out []schemaField
+	for _, name := range names {
+		candidates := byName[name]
+		depth := candidates[0].depth
+		for _, f := range candidates {
+			if f.depth < depth {
+				depth = f.depth
+			}
+		}
+
+		var shallow, tagged []schemaField
+		for _, f := range candidates {
+			if f.depth == depth {
+				shallow = append(shallow, f)
+				if f.tagged {
+					tagged = append(tagged, f)
+				}
+			}
+		}
+		switch {
+		case len(shallow) == 1:
+			out = append(out, shallow[0])
+		case len(tagged) == 1:
+			out = append(out, tagged[0])
+		}
+	}
+	return out
+}
+
+// jsonFieldName returns the name of a struct field in its JSON encoding
+func jsonFieldName(field reflect.StructField) (name string, omitEmpty, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, p := range parts[1:] {
+		if p == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, false
+}
+
+// SchemaError describes a value that doesn't match its JSON Schema. Path is
+// the location of the value in the document, e.g. "/links/0/name".
+type SchemaError struct {
+	Path    string
+	Message string
+}
+
+// ValidationError is the list of problems found by Schema.Validate.
+type ValidationError []SchemaError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, se := range e {
+		path := se.Path
+		if path == "" {
+			path = "/"
+		}
+		msgs[i] = path + ": " + se.Message
+	}
+	return "Invalid input: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks a decoded JSON value (as produced by encoding/json when
+// decoding into an interface{}) against the schema. It supports the type,
+// enum, properties, required, additionalProperties, items, minItems,
+// maxItems, minLength, maxLength, minimum and maximum keywords. A nil error is
+// returned if the value is valid, otherwise it is a ValidationError.
+func (s Schema) Validate(v interface{}) error {
+	var errs ValidationError
+	validate(s, v, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// asSchema converts sub-schemas (which are plain maps if the schema itself
+// was decoded from JSON)
+func asSchema(v interface{}) (Schema, bool) {
+	switch s := v.(type) {
+	case Schema:
+		return s, true
+	case map[string]interface{}:
+		return Schema(s), true
+	}
+	return nil, false
+}
+
+func jsonType(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		// not float64(int64(val)), which overflows for large values
+		if math.Trunc(val) == val && !math.IsInf(val, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func typeMatches(expected interface{}, actual string) bool {
+	switch t := expected.(type) {
+	case string:
+		return t == actual || (t == "number" && actual == "integer")
+	case []string:
+		for _, e := range t {
+			if typeMatches(e, actual) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, e := range t {
+			if typeMatches(e, actual) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// toFloat returns the value of the number v, which may be of any of Go's
+// numeric types: schemas declared in Go hold ints, decoded values float64s.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// enumEqual returns true if v is the enum value e. Numbers are equal if they
+// have the same value, whatever their types.
+func enumEqual(e, v interface{}) bool {
+	if ef, ok := toFloat(e); ok {
+		vf, ok := toFloat(v)
+		return ok && ef == vf
+	}
+	return reflect.DeepEqual(e, v)
+}
+
+func validate(s Schema, v interface{}, path string, errs *ValidationError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, SchemaError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	actual := jsonType(v)
+	if expected, ok := s["type"]; ok && !typeMatches(expected, actual) {
+		fail("expected %v, got %s", expected, actual)
+		return
+	}
+
+	if enum, ok := s["enum"]; ok {
+		found := false
+		for _, e := range reflectSlice(enum) {
+			if enumEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value must be one of %v", enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		n := float64(utf8.RuneCountInString(val))
+		if min, ok := toFloat(s["minLength"]); ok && n < min {
+			fail("must be at least %v characters long", min)
+		}
+		if max, ok := toFloat(s["maxLength"]); ok && n > max {
+			fail("must be at most %v characters long", max)
+		}
+
+	case float64:
+		if min, ok := toFloat(s["minimum"]); ok && val < min {
+			fail("must be at least %v", min)
+		}
+		if max, ok := toFloat(s["maximum"]); ok && val > max {
+			fail("must be at most %v", max)
+		}
+
+	case []interface{}:
+		if min, ok := toFloat(s["minItems"]); ok && float64(len(val)) < min {
+			fail("must have at least %v items", min)
+		}
+		if max, ok := toFloat(s["maxItems"]); ok && float64(len(val)) > max {
+			fail("must have at most %v items", max)
+		}
+		if items, ok := asSchema(s["items"]); ok {
+			for i, item := range val {
+				validate(items, item, fmt.Sprintf("%s/%d", path, i), errs)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range reflectSlice(s["required"]) {
+			if _, ok := val[fmt.Sprint(name)]; !ok {
+				*errs = append(*errs, SchemaError{
+					Path:    path + "/" + fmt.Sprint(name),
+					Message: "required field is missing",
+				})
+			}
+		}
+
+		properties, _ := asSchema(s["properties"])
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fieldPath := path + "/" + name
+			if prop, ok := asSchema(properties[name]); ok {
+				validate(prop, val[name], fieldPath, errs)
+				continue
+			}
+
+			switch additional := s["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					*errs = append(*errs, SchemaError{Path: fieldPath, Message: "unknown field"})
+				}
+			default:
+				if as, ok := asSchema(additional); ok {
+					validate(as, val[name], fieldPath, errs)
+				}
+			}
+		}
+	}
+}
+
+// reflectSlice returns the elements of any slice (e.g. []string as written in
+// Go, or []interface{} as decoded from JSON)
+func reflectSlice(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil
+	}
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type schemaBase struct {
+	ID   string
+	Name int // hidden by schemaOutput.Name
+}
+
+type schemaExtra struct {
+	Extra string
+}
+
+type schemaOutput struct {
+	schemaBase
+	*schemaExtra
+	Name    string
+	Size    int64    `json:"size,omitempty"`
+	Links   []string `json:",omitempty"`
+	Ignored string   `json:"-"`
+	Next    *schemaOutput
+}
+
+func TestTypeSchema(t *testing.T) {
+	schema := TypeSchema(reflect.TypeOf(&schemaOutput{}))
+	b, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"properties":{"Extra":{"type":"string"},"ID":{"type":"string"},` +
+		`"Links":{"items":{"type":"string"},"type":"array"},` +
+		`"Name":{"type":"string"},"Next":{"type":"object"},"size":{"type":"integer"}},` +
+		`"required":["ID","Name"],"type":"object"}`
+	if string(b) != expected {
+		t.Errorf("Incorrect schema:\n%s\ninstead of\n%s", b, expected)
+	}
+}
+
+func TestExport(t *testing.T) {
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"b": {Type: ""},
+			"a": {
+				Arguments: []Argument{StringArg("key", true, false, "a key")},
+				Type:      schemaOutput{},
+			},
+		},
+	}
+
+	info := root.Export("root")
+	if len(info.Subcommands) != 2 || info.Subcommands[0].Name != "a" || info.Subcommands[1].Name != "b" {
+		t.Fatalf("Expected sorted subcommands, got %+v", info.Subcommands)
+	}
+	if info.Subcommands[0].Output["type"] != "object" || info.Subcommands[1].Output["type"] != "string" {
+		t.Error("Expected output schemas to be exported")
+	}
+	if len(info.Subcommands[0].Arguments) != 1 || !info.Subcommands[0].Arguments[0].Required {
+		t.Error("Expected arguments to be exported")
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	var schema Schema
+	err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["name"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 3},
+			"count": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "items": {"enum": ["a", "b"]}}
+		}
+	}`), &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test := func(body string, expected ...string) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(body), &v); err != nil {
+			t.Fatal(err)
+		}
+
+		err := schema.Validate(v)
+		if len(expected) == 0 {
+			if err != nil {
+				t.Errorf("%s should be valid, got: %s", body, err)
+			}
+			return
+		}
+
+		verr, ok := err.(ValidationError)
+		if !ok || len(verr) != len(expected) {
+			t.Errorf("%s should have failed with %d errors, got: %v", body, len(expected), err)
+			return
+		}
+		for i, path := range expected {
+			if verr[i].Path != path {
+				t.Errorf("%s: expected error at %s, got %s", body, path, verr[i].Path)
+			}
+		}
+	}
+
+	test(`{"name": "x", "count": 1, "tags": ["a"]}`)
+	test(`{"count": 1}`, "/name")
+	test(`{"name": "", "count": 1.5}`, "/count", "/name")
+	test(`{"name": "x", "tags": ["a", "c"], "other": 1}`, "/other", "/tags/1")
+	test(`[]`, "")
+	test(`{"name": "héé"}`)
+	test(`{"name": "héés"}`, "/name")
+	test(`{"name": "x", "count": 1e300}`)
+
+	// schemas declared in Go hold other number types than decoded values
+	schema = Schema{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"level": Schema{"enum": []interface{}{1, 2}},
+			"size":  Schema{"type": "integer", "minimum": int32(1), "maximum": uint8(10)},
+		},
+	}
+	test(`{"level": 2, "size": 10}`)
+	test(`{"level": 3, "size": 0}`, "/level", "/size")
+	test(`{"level": "1", "size": 11}`, "/level", "/size")
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// serializedRequest is the JSON representation of a Request. Option values are
+// stored as strings (like they are sent over HTTP), so they can be converted
+// back to the types of their definitions.
+type serializedRequest struct {
+	Path      []string
+	Options   map[string]string `json:",omitempty"`
+	Arguments []string          `json:",omitempty"`
+	Stdin     bool              `json:",omitempty"`
+	ID        string            `json:",omitempty"`
+	Metadata  map[string]string `json:",omitempty"`
+}
+
+// MarshalRequest encodes the path, options, arguments, ID and metadata of a
+// Request as JSON, along with whether it reads from stdin. Files, the context and the
+// values map are not part of the encoding.
+func MarshalRequest(req Request) ([]byte, error) {
+	return marshalRequest(req, false)
+}
+
+// MarshalRedactedRequest encodes a Request like MarshalRequest, with the values
+// of secret options (see SecretOption) replaced by Redacted. Redacted options
+// are left unset by UnmarshalRequest.
+func MarshalRedactedRequest(req Request) ([]byte, error) {
+	return marshalRequest(req, true)
+}
+
+func marshalRequest(req Request, redact bool) ([]byte, error) {
+	sr := serializedRequest{
+		Path:      req.Path(),
+		Arguments: req.Arguments(),
+		Stdin:     req.Stdin() != nil,
+		ID:        req.ID(),
+	}
+	if md := req.Metadata(); len(md) > 0 {
+		sr.Metadata = md
+	}
+
+	opts := req.Options()
+	if len(opts) > 0 {
+		sr.Options = make(map[string]string, len(opts))
+		for k, v := range opts {
+			if redact && isSecretOption(req, k) {
+				sr.Options[k] = Redacted
+				continue
+			}
+			sr.Options[k] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	return json.Marshal(sr)
+}
+
+// isSecretOption returns true if the option is defined as a secret option
+func isSecretOption(req Request, name string) bool {
+	opt := req.Option(name)
+	return opt != nil && IsSecretOption(opt.Definition())
+}
+
+// UnmarshalRequest decodes a Request encoded by MarshalRequest, resolving its
+// command and option definitions in the tree of root. The request reads from
+// os.Stdin if the original request read from stdin.
+func UnmarshalRequest(data []byte, root *Command) (Request, error) {
+	var sr serializedRequest
+	if err := json.Unmarshal(data, &sr); err != nil {
+		return nil, err
+	}
+
+	cmd, err := root.Get(sr.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	optDefs, err := root.GetOptions(sr.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := make(OptMap, len(sr.Options))
+	for k, v := range sr.Options {
+		if def, ok := optDefs[k]; ok && IsSecretOption(def) && v == Redacted {
+			continue
+		}
+		opts[k] = v
+	}
+
+	req, err := NewRequest(sr.Path, opts, sr.Arguments, nil, cmd, optDefs)
+	if err != nil {
+		return nil, err
+	}
+
+	if sr.ID != "" {
+		req.SetID(sr.ID)
+	}
+	for k, v := range sr.Metadata {
+		req.SetMetadata(k, v)
+	}
+
+	if !sr.Stdin {
+		req.SetStdin(nil)
+	} else {
+		req.SetStdin(os.Stdin)
+	}
+	return req, nil
+}
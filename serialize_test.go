@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRequestSerialization(t *testing.T) {
+	sub := &Command{
+		Options: []Option{
+			IntOption("n", "count", "a number"),
+			BoolOption("q", "quiet", "be quiet"),
+		},
+		Arguments: []Argument{
+			StringArg("a", true, true, "some arg"),
+		},
+	}
+	root := &Command{
+		Subcommands: map[string]*Command{
+			"sub": sub,
+		},
+	}
+
+	optDefs, _ := root.GetOptions([]string{"sub"})
+	req, err := NewRequest([]string{"sub"}, OptMap{"n": 5, "q": true, EncShort: "json"}, []string{"x", "y"}, nil, sub, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.SetMetadata("trace", "xyz")
+
+	data, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req2, err := UnmarshalRequest(data, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req2.Command() != sub || len(req2.Path()) != 1 || req2.Path()[0] != "sub" {
+		t.Error("Expected the command to be resolved")
+	}
+	if n, _, err := req2.Option("count").Int(); n != 5 || err != nil {
+		t.Errorf("Expected option 'count' to be 5, got %v (%v)", n, err)
+	}
+	if q, _, err := req2.Option("quiet").Bool(); !q || err != nil {
+		t.Errorf("Expected option 'quiet' to be true, got %v (%v)", q, err)
+	}
+	if args := req2.Arguments(); len(args) != 2 || args[0] != "x" || args[1] != "y" {
+		t.Errorf("Expected arguments [x y], got %v", args)
+	}
+	if req2.ID() == "" || req2.ID() != req.ID() {
+		t.Errorf("Expected request ID %q, got %q", req.ID(), req2.ID())
+	}
+	if req2.Metadata()["trace"] != "xyz" {
+		t.Errorf("Expected metadata 'trace' to be 'xyz', got %v", req2.Metadata())
+	}
+	if req2.Stdin() == nil {
+		t.Error("Expected the request to read from stdin")
+	}
+}
+
+func TestRedactedRequestSerialization(t *testing.T) {
+	cmd := &Command{
+		Options: []Option{
+			SecretOption("token", "an API token"),
+			StringOption("name", "a name"),
+		},
+	}
+
+	optDefs, _ := cmd.GetOptions(nil)
+	req, err := NewRequest(nil, OptMap{"token": "s3cret", "name": "x"}, nil, nil, cmd, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := MarshalRedactedRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Errorf("Expected the secret option to be redacted, got %s", data)
+	}
+
+	req2, err := UnmarshalRequest(data, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := req2.Option("token").String(); found {
+		t.Error("Expected the redacted option to be unset")
+	}
+	if name, _, _ := req2.Option("name").String(); name != "x" {
+		t.Errorf("Expected option 'name' to be 'x', got %q", name)
+	}
+
+	data, _ = MarshalRequest(req)
+	if !strings.Contains(string(data), "s3cret") {
+		t.Errorf("Expected MarshalRequest to keep secret options, got %s", data)
+	}
+}
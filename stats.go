@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// TransferStats counts the bytes of the request and response bodies a request
+// transferred over the network. Uploaded bytes were sent by the client, and
+// downloaded bytes by the server. TransferStats are safe for concurrent use,
+// as bodies are streamed while commands run.
+type TransferStats struct {
+	uploaded   uint64
+	downloaded uint64
+}
+
+// TransferStatsKey is the key of a request's TransferStats, see
+// TrackTransfer.
+var TransferStatsKey = NewKey("cmds.transferStats", (*TransferStats)(nil))
+
+// TrackTransfer returns the TransferStats of the request, adding them if the
+// request has none yet. Clients and servers count the bytes they transfer
+// for the request in them.
+func TrackTransfer(req Request) *TransferStats {
+	if s, ok := TransferStatsKey.Get(req).(*TransferStats); ok {
+		return s
+	}
+	s := &TransferStats{}
+	TransferStatsKey.Set(req, s)
+	return s
+}
+
+// UploadProgressKey is the key of a function the HTTP client calls with the
+// progress of uploading a request's files. Total is the sum of the files'
+// sizes, or zero if some size isn't known, and Current counts the bytes of
+// file contents only, not the multipart encoding around them.
+var UploadProgressKey = NewKey("cmds.uploadProgress", (func(Progress))(nil))
+
+// AddUploaded counts n bytes sent by the client.
+func (s *TransferStats) AddUploaded(n int) {
+	atomic.AddUint64(&s.uploaded, uint64(n))
+}
+
+// AddDownloaded counts n bytes sent by the server.
+func (s *TransferStats) AddDownloaded(n int) {
+	atomic.AddUint64(&s.downloaded, uint64(n))
+}
+
+// Uploaded returns the number of bytes sent by the client.
+func (s *TransferStats) Uploaded() uint64 {
+	return atomic.LoadUint64(&s.uploaded)
+}
+
+// Downloaded returns the number of bytes sent by the server.
+func (s *TransferStats) Downloaded() uint64 {
+	return atomic.LoadUint64(&s.downloaded)
+}
+
+func (s *TransferStats) String() string {
+	return fmt.Sprintf("%d bytes uploaded, %d bytes downloaded", s.Uploaded(), s.Downloaded())
+}
+
+// CountingReader counts the bytes read from Reader with Count.
+type CountingReader struct {
+	Reader io.Reader
+	Count  func(n int)
+}
+
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.Count(n)
+	}
+	return n, err
+}
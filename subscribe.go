@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Event is an output value of a subscription. IDs are assigned by the Topic
+// in publishing order, so subscribers can resume after the last event they
+// received.
+type Event struct {
+	ID    uint64
+	Value interface{}
+}
+
+// LastEventIDKey is the key of the ID of the last event a subscriber received.
+// Subscriptions of requests with one start with the events published after
+// it that the Topic still has, instead of with new events.
+var LastEventIDKey = NewKey("cmds.lastEventID", uint64(0))
+
+// Topic fans the events published on it out to its subscribers. Each
+// subscriber has a bounded buffer: subscribers that fall further behind are
+// dropped (their output channel is closed), and can resume from the topic's
+// history with the ID of the last event they received.
+type Topic struct {
+	mu      sync.Mutex
+	lastID  uint64
+	history []Event
+	subs    map[*subscriber]struct{}
+
+	buffer      int
+	historySize int
+}
+
+type subscriber struct {
+	ch chan Event
+}
+
+// NewTopic returns a Topic with subscriber buffers of the given size, which
+// keeps the last history events for resuming subscribers.
+func NewTopic(buffer, history int) *Topic {
+	return &Topic{
+		subs:        make(map[*subscriber]struct{}),
+		buffer:      buffer,
+		historySize: history,
+	}
+}
+
+// Publish sends v to the subscribers of the topic, and returns the ID of its
+// event.
+func (t *Topic) Publish(v interface{}) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastID++
+	ev := Event{ID: t.lastID, Value: v}
+	if t.historySize > 0 {
+		if len(t.history) == t.historySize {
+			t.history = append(t.history[:0], t.history[1:]...)
+		}
+		t.history = append(t.history, ev)
+	}
+
+	for s := range t.subs {
+		select {
+		case s.ch <- ev:
+		default:
+			// too slow, it has to resume
+			delete(t.subs, s)
+			close(s.ch)
+		}
+	}
+	return ev.ID
+}
+
+// Subscribe returns a channel of the Event values published on the topic,
+// starting after the event with the ID after (0 for new events only). The
+// channel is closed when ctx is done, or when the subscriber falls behind.
+func (t *Topic) Subscribe(ctx context.Context, after uint64) <-chan interface{} {
+	t.mu.Lock()
+	var replay []Event
+	if after > 0 {
+		for _, ev := range t.history {
+			if ev.ID > after {
+				replay = append(replay, ev)
+			}
+		}
+	}
+	s := &subscriber{ch: make(chan Event, t.buffer+len(replay))}
+	for _, ev := range replay {
+		s.ch <- ev
+	}
+	t.subs[s] = struct{}{}
+	t.mu.Unlock()
+
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		defer t.unsubscribe(s)
+
+		for {
+			select {
+			case ev, ok := <-s.ch:
+				if !ok {
+					return
+				}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Subscribers returns the number of subscribers of the topic.
+func (t *Topic) Subscribers() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.subs)
+}
+
+func (t *Topic) unsubscribe(s *subscriber) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.subs[s]; ok {
+		delete(t.subs, s)
+		close(s.ch)
+	}
+}
+
+// subscribeRun is the Run function of subscribe commands, which outputs the
+// events of the command's topic.
+func subscribeRun(cmd *Command) Function {
+	return func(req Request, res Response) {
+		topic, err := cmd.Subscribe(req)
+		if err != nil {
+			res.SetError(err, ErrNormal)
+			return
+		}
+		after, _ := LastEventIDKey.Get(req).(uint64)
+		res.SetOutput(topic.Subscribe(req.Context(), after))
+	}
+}
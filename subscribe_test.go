@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestTopic(t *testing.T) {
+	topic := NewTopic(1, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	topic.Publish("a")
+	topic.Publish("b")
+	topic.Publish("c")
+
+	// resuming replays the events still in the history
+	ch := topic.Subscribe(ctx, 1)
+	for _, expected := range []Event{{2, "b"}, {3, "c"}} {
+		if ev := <-ch; ev != expected {
+			t.Errorf("Expected %v, got %v", expected, ev)
+		}
+	}
+
+	cancel()
+	for range ch {
+	}
+
+	// with a buffer of one event (and one being sent), the subscriber
+	// is dropped by the third event it doesn't read
+	ch = topic.Subscribe(context.Background(), 0)
+	for i := 0; i < 3 && topic.Subscribers() > 0; i++ {
+		topic.Publish(i)
+	}
+	if n := topic.Subscribers(); n != 0 {
+		t.Errorf("Expected the slow subscriber to be dropped, got %d subscribers", n)
+	}
+	var got []interface{}
+	for v := range ch {
+		got = append(got, v.(Event).Value)
+	}
+	if len(got) > 2 || (len(got) > 0 && got[0] != 0) {
+		t.Errorf("Unexpected events of the dropped subscriber %v", got)
+	}
+
+	// cancelling the context unsubscribes
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	ch = topic.Subscribe(ctx2, 0)
+	cancel2()
+	for range ch {
+	}
+	if n := topic.Subscribers(); n != 0 {
+		t.Errorf("Expected no subscribers, got %d", n)
+	}
+}
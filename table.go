@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// TableFormat configures the text tables of TextTableMarshaler.
+type TableFormat struct {
+	// Header adds a row with the column names
+	Header bool
+
+	// Width truncates lines to at most Width characters. Zero means no
+	// limit, unless FitTerminal is set.
+	Width int
+
+	// FitTerminal truncates lines to the width of the terminal on stdout
+	// (see TerminalWidth) if Width is zero. Lines aren't truncated when
+	// stdout isn't a terminal.
+	FitTerminal bool
+}
+
+// TextTableMarshaler returns a Text Marshaler that renders output structs (or
+// slices of them) as a table with aligned columns. Columns are named and
+// selected like the ones of the CSV encoding. Channel outputs are read to
+// the end, so all their rows can be aligned.
+func TextTableMarshaler(f TableFormat) Marshaler {
+	return func(res Response) (io.Reader, error) {
+		var rows []reflect.Value
+		var t reflect.Type
+
+		ch, ok := res.Output().(<-chan interface{})
+		if !ok {
+			var err error
+			rows, t, err = tableRows(res.Output())
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			for v := range ch {
+				r, rt, err := tableRows(v)
+				if err == nil && t != nil && rt != t {
+					err = ErrNotTabular
+				}
+				if err != nil {
+					drainOutput(res, ch)
+					return nil, err
+				}
+				if t == nil {
+					t = rt
+				}
+				rows = append(rows, r...)
+			}
+			if e := res.Error(); e != nil {
+				return nil, e
+			}
+			if t == nil { // no values
+				return bytes.NewReader(nil), nil
+			}
+		}
+
+		cols, err := tableColumns(t)
+		if err != nil {
+			return nil, err
+		}
+
+		var cells [][]string
+		if f.Header {
+			header := make([]string, len(cols))
+			for i, c := range cols {
+				header[i] = strings.ToUpper(c.name)
+			}
+			cells = append(cells, header)
+		}
+		for _, row := range rows {
+			record := make([]string, len(cols))
+			for i, c := range cols {
+				record[i] = tableCell(row.Field(c.index))
+			}
+			cells = append(cells, record)
+		}
+
+		width := f.Width
+		if width == 0 && f.FitTerminal {
+			width = TerminalWidth(os.Stdout)
+		}
+		return bytes.NewReader(formatTable(cells, width)), nil
+	}
+}
+
+// drainOutput reads the rest of ch in the background, until it is closed or
+// the request is cancelled, so the command doesn't block on an output that is
+// no longer read after a marshaler failed.
+func drainOutput(res Response, ch <-chan interface{}) {
+	var done <-chan struct{}
+	if ctx := res.Request().Context(); ctx != nil {
+		done = ctx.Done()
+	}
+
+	go func() {
+		for {
+			select {
+			case _, ok := <-ch:
+				if !ok {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// formatTable aligns the columns of cells, separated by two spaces, and
+// truncates the lines to width characters (if width isn't zero).
+func formatTable(cells [][]string, width int) []byte {
+	var widths []int
+	for _, record := range cells {
+		for i, cell := range record {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, record := range cells {
+		var line strings.Builder
+		for i, cell := range record {
+			if i > 0 {
+				line.WriteString("  ")
+			}
+			line.WriteString(cell)
+			if i < len(record)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+			}
+		}
+
+		s := strings.TrimRight(line.String(), " ")
+		if width > 0 && utf8.RuneCountInString(s) > width {
+			s = string([]rune(s)[:width-1]) + "…"
+		}
+		buf.WriteString(s)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"os"
+	"strconv"
+)
+
+// TerminalWidth returns the number of columns of the terminal f, or of the
+// $COLUMNS environment variable if it's set. It returns 0 if the width is
+// unknown, e.g. when f is a pipe.
+func TerminalWidth(f *os.File) int {
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	return terminalWidth(f)
+}
+
+// TerminalHeight returns the number of rows of the terminal f, or of the
+// $LINES environment variable if it's set. It returns 0 if the height is
+// unknown.
+func TerminalHeight(f *os.File) int {
+	if rows, err := strconv.Atoi(os.Getenv("LINES")); err == nil && rows > 0 {
+		return rows
+	}
+	return terminalHeight(f)
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package commands
+
+import (
+	"os"
+)
+
+func terminalWidth(f *os.File) int {
+	return 0
+}
+
+func terminalHeight(f *os.File) int {
+	return 0
+}
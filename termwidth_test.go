@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTerminalWidth(t *testing.T) {
+	defer os.Setenv("COLUMNS", os.Getenv("COLUMNS"))
+
+	os.Setenv("COLUMNS", "123")
+	if w := TerminalWidth(os.Stdout); w != 123 {
+		t.Errorf("Expected the width of $COLUMNS, got %d", w)
+	}
+
+	os.Setenv("COLUMNS", "")
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if width := TerminalWidth(w); width != 0 {
+		t.Errorf("Expected pipes to have no width, got %d", width)
+	}
+}
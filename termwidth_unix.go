@@ -0,0 +1,34 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package commands
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// winsize is the struct of the TIOCGWINSZ ioctl, see tty_ioctl(4)
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+func terminalWidth(f *os.File) int {
+	return int(getWinsize(f).cols)
+}
+
+func terminalHeight(f *os.File) int {
+	return int(getWinsize(f).rows)
+}
+
+// getWinsize returns the size of the terminal f, which is zero if f isn't a
+// terminal.
+func getWinsize(f *os.File) winsize {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return winsize{}
+	}
+	return ws
+}
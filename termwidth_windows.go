@@ -0,0 +1,46 @@
+//go:build windows
+// +build windows
+
+package commands
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procGetConsoleScreenBufferInfo = syscall.NewLazyDLL("kernel32.dll").NewProc("GetConsoleScreenBufferInfo")
+
+// consoleScreenBufferInfo is the CONSOLE_SCREEN_BUFFER_INFO struct, see
+// https://learn.microsoft.com/windows/console/console-screen-buffer-info-str
+type consoleScreenBufferInfo struct {
+	sizeX, sizeY             int16
+	cursorX, cursorY         int16
+	attributes               uint16
+	left, top, right, bottom int16
+	maxWindowX, maxWindowY   int16
+}
+
+func terminalWidth(f *os.File) int {
+	info, ok := screenBufferInfo(f)
+	if !ok {
+		return 0
+	}
+	return int(info.right-info.left) + 1
+}
+
+func terminalHeight(f *os.File) int {
+	info, ok := screenBufferInfo(f)
+	if !ok {
+		return 0
+	}
+	return int(info.bottom-info.top) + 1
+}
+
+// screenBufferInfo returns the screen buffer of the console f, the window of
+// which is its visible part.
+func screenBufferInfo(f *os.File) (consoleScreenBufferInfo, bool) {
+	var info consoleScreenBufferInfo
+	r, _, _ := procGetConsoleScreenBufferInfo.Call(f.Fd(), uintptr(unsafe.Pointer(&info)))
+	return info, r != 0
+}
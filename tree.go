@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"reflect"
+	"sort"
+)
+
+// CommandInfo is a machine-readable description of a command (and its
+// subcommands), e.g. for generating API clients and documentation.
+type CommandInfo struct {
+	Name        string
+	Tagline     string         `json:",omitempty"`
+	Category    string         `json:",omitempty"`
+	Hidden      bool           `json:",omitempty"`
+	DryRun      bool           `json:",omitempty"` // the command supports --dry-run
+	Options     []OptionInfo   `json:",omitempty"`
+	Arguments   []ArgumentInfo `json:",omitempty"`
+	Subcommands []CommandInfo  `json:",omitempty"`
+
+	// Output is the JSON Schema of the command's output Type. For commands that
+	// stream their output, it describes each of the streamed values.
+	Output Schema `json:",omitempty"`
+}
+
+// OptionInfo is a machine-readable description of an option.
+type OptionInfo struct {
+	Names       []string
+	Type        string
+	Description string
+}
+
+// ArgumentInfo is a machine-readable description of an argument.
+type ArgumentInfo struct {
+	Name        string
+	Type        string
+	Required    bool
+	Variadic    bool
+	Description string
+}
+
+// Export returns the machine-readable description of the tree of commands
+// rooted at c, where name is the name of c itself. Subcommands are sorted by
+// name.
+func (c *Command) Export(name string) CommandInfo {
+	info := CommandInfo{
+		Name:     name,
+		Tagline:  c.Helptext.Tagline,
+		Category: c.Category,
+		Hidden:   c.Hidden,
+		DryRun:   c.SupportsDryRun,
+	}
+
+	for _, opt := range c.Options {
+		info.Options = append(info.Options, OptionInfo{
+			Names:       opt.Names(),
+			Type:        opt.Type().String(),
+			Description: opt.Description(),
+		})
+	}
+
+	for _, arg := range c.Arguments {
+		argType := "string"
+		if arg.Type == ArgFile {
+			argType = "file"
+		}
+		info.Arguments = append(info.Arguments, ArgumentInfo{
+			Name:        arg.Name,
+			Type:        argType,
+			Required:    arg.Required,
+			Variadic:    arg.Variadic,
+			Description: arg.Description,
+		})
+	}
+
+	if c.Type != nil {
+		info.Output = TypeSchema(reflect.TypeOf(c.Type))
+	}
+
+	names := make([]string, 0, len(c.Subcommands))
+	for name, sub := range c.Subcommands {
+		if sub.IsEnabled() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		info.Subcommands = append(info.Subcommands, c.Subcommands[name].Export(name))
+	}
+
+	return info
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Key is a typed key for a request's values, so host applications can attach
+// objects (like their node or config) to a request and commands can retrieve
+// them with a checked type assertion:
+//
+//	var NodeKey = cmds.NewKey("myapp.node", (*Node)(nil))
+//
+//	NodeKey.Set(req, node)
+//	node, ok := NodeKey.Get(req).(*Node)
+//
+// Values are stored under the key's name, which should be namespaced to avoid
+// collisions with other packages.
+type Key struct {
+	name string
+	typ  reflect.Type
+}
+
+// NewKey returns a key for values of the type of zero stored under name.
+func NewKey(name string, zero interface{}) Key {
+	return Key{name, reflect.TypeOf(zero)}
+}
+
+// Name returns the name the key's values are stored under.
+func (k Key) Name() string {
+	return k.name
+}
+
+// Get returns the value stored for the key in the request. It returns nil if
+// there is no value, or if the value isn't of the key's type.
+func (k Key) Get(req Request) interface{} {
+	v, ok := req.Value(k.name)
+	if !ok || v == nil || reflect.TypeOf(v) != k.typ {
+		return nil
+	}
+	return v
+}
+
+// Set stores v for the key in the request. It panics if v can't be assigned
+// to a value of the key's type.
+func (k Key) Set(req Request, v interface{}) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		rv = reflect.Zero(k.typ)
+	}
+	if !rv.Type().AssignableTo(k.typ) {
+		panic(fmt.Sprintf("cmds: setting %s to a value of type %s, not %s", k.name, rv.Type(), k.typ))
+	}
+
+	out := reflect.New(k.typ).Elem()
+	out.Set(rv)
+	req.SetValue(k.name, out.Interface())
+}
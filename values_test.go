@@ -0,0 +1,43 @@
+package commands
+
+import "testing"
+
+func TestKey(t *testing.T) {
+	type node struct{ id string }
+	type handler func()
+	nodeKey := NewKey("test.node", (*node)(nil))
+	countKey := NewKey("test.count", 0)
+	handlerKey := NewKey("test.handler", handler(nil))
+
+	req, err := NewEmptyRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, ok := nodeKey.Get(req).(*node); ok || n != nil {
+		t.Error("Expected no value before it is set")
+	}
+
+	nodeKey.Set(req, &node{"abc"})
+	if n, ok := nodeKey.Get(req).(*node); !ok || n.id != "abc" {
+		t.Errorf("Expected the node to be returned, got %v", n)
+	}
+
+	req.SetValue(countKey.Name(), "not an int")
+	if n, ok := countKey.Get(req).(int); ok || n != 0 {
+		t.Error("Expected a value of the wrong type not to be returned")
+	}
+
+	// values of an assignable type are stored as the key's type
+	handlerKey.Set(req, func() {})
+	if _, ok := handlerKey.Get(req).(handler); !ok {
+		t.Error("Expected the function to be stored as a handler")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected setting a value of another type to panic")
+		}
+	}()
+	countKey.Set(req, "not an int")
+}
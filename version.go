@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// VersionOpt is the name of the root option and subcommand added by
+// RegisterVersion.
+const VersionOpt = "version"
+
+// OptionVersion is the --version option of the root, which the CLI resolves
+// to the version subcommand.
+var OptionVersion = BoolOption(VersionOpt, "Show the version and exit")
+
+// VersionInfo describes the build of a program, e.g. set with -ldflags at
+// build time. Only Version is required.
+type VersionInfo struct {
+	Version   string // semantic version, e.g. "0.4.2"
+	Commit    string `json:",omitempty"`
+	BuildDate string `json:",omitempty"`
+}
+
+func (v VersionInfo) String() string {
+	var details []string
+	if v.Commit != "" {
+		details = append(details, "commit "+v.Commit)
+	}
+	if v.BuildDate != "" {
+		details = append(details, "built "+v.BuildDate)
+	}
+	if len(details) == 0 {
+		return v.Version
+	}
+	return fmt.Sprintf("%s (%s)", v.Version, strings.Join(details, ", "))
+}
+
+// VersionCommand returns a command that outputs info, as a VersionInfo for
+// JSON and other encodings, and as a single line of text.
+func VersionCommand(info VersionInfo) *Command {
+	return &Command{
+		Helptext: HelpText{
+			Tagline: "Show the version.",
+		},
+		Run: func(req Request, res Response) {
+			v := info
+			res.SetOutput(&v)
+		},
+		Marshalers: MarshalerMap{
+			Text: func(res Response) (io.Reader, error) {
+				return strings.NewReader(res.Output().(*VersionInfo).String() + "\n"), nil
+			},
+		},
+		Type: VersionInfo{},
+	}
+}
+
+// RegisterVersion adds a version subcommand (see VersionCommand) and a
+// --version option to the root command c, unless it already has them.
+func (c *Command) RegisterVersion(info VersionInfo) {
+	if c.Subcommands == nil {
+		c.Subcommands = map[string]*Command{}
+	}
+	if _, ok := c.Subcommands[VersionOpt]; !ok {
+		c.Subcommands[VersionOpt] = VersionCommand(info)
+	}
+	for _, opt := range c.Options {
+		for _, name := range opt.Names() {
+			if name == VersionOpt {
+				return
+			}
+		}
+	}
+	c.Options = append(c.Options, OptionVersion)
+}
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestRegisterVersion(t *testing.T) {
+	root := &Command{}
+	root.RegisterVersion(VersionInfo{Version: "0.4.2", Commit: "abc123", BuildDate: "2016-05-01"})
+	root.RegisterVersion(VersionInfo{Version: "ignored"})
+
+	if len(root.Options) != 1 || root.Options[0] != OptionVersion {
+		t.Errorf("Expected a single --version option, got %v", root.Options)
+	}
+	if findings := Lint(root); len(findings) != 0 {
+		t.Errorf("Expected no lint findings, got %v", findings)
+	}
+
+	path := []string{"version"}
+	optDefs, err := root.GetOptions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := NewRequest(path, OptMap{EncShort: Text}, nil, nil, root.Subcommands["version"], optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := root.Call(req)
+	if res.Error() != nil {
+		t.Fatal(res.Error())
+	}
+	if v := res.Output().(*VersionInfo); v.Version != "0.4.2" || v.Commit != "abc123" {
+		t.Errorf("unexpected version %+v", v)
+	}
+
+	out, err := res.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := ioutil.ReadAll(out)
+	if s := string(text); s != "0.4.2 (commit abc123, built 2016-05-01)\n" {
+		t.Errorf("unexpected text %q", s)
+	}
+
+	if s := (VersionInfo{Version: "1.0.0"}).String(); s != "1.0.0" {
+		t.Errorf("unexpected version %q", s)
+	}
+}
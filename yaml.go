@@ -0,0 +1,215 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// marshalYaml encodes value as a YAML document. The value is encoded with
+// encoding/json first, so it follows the same struct tags as JSON output,
+// and keeps the order of struct fields.
+func marshalYaml(value interface{}) (io.Reader, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	node, err := readYamlNode(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeYamlNode(&buf, node, 0)
+	return &buf, nil
+}
+
+// marshalYamlDocument encodes value as a YAML document with a start marker,
+// so a stream of them can be told apart.
+func marshalYamlDocument(value interface{}) (io.Reader, error) {
+	r, err := marshalYaml(value)
+	if err != nil {
+		return nil, err
+	}
+	return io.MultiReader(strings.NewReader("---\n"), r), nil
+}
+
+// yamlMap is a JSON object with its keys in order.
+type yamlMap struct {
+	keys   []string
+	values []interface{}
+}
+
+// readYamlNode reads a value from the JSON token stream. Objects are read as
+// yamlMaps, arrays as []interface{} and the rest as scalars.
+func readYamlNode(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		m := &yamlMap{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := readYamlNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			m.keys = append(m.keys, key.(string))
+			m.values = append(m.values, v)
+		}
+		_, err = dec.Token()
+		return m, err
+
+	case json.Delim('['):
+		l := []interface{}{}
+		for dec.More() {
+			v, err := readYamlNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		_, err = dec.Token()
+		return l, err
+	}
+
+	return tok, nil
+}
+
+// writeYamlNode writes node at the given indentation level. Nested maps and
+// lists start on a new line, so the caller has to write the line break before
+// them.
+func writeYamlNode(w *bytes.Buffer, node interface{}, indent int) {
+	prefix := strings.Repeat("  ", indent)
+
+	switch n := node.(type) {
+	case *yamlMap:
+		if len(n.keys) == 0 {
+			w.WriteString(prefix + "{}\n")
+			return
+		}
+		for i, key := range n.keys {
+			w.WriteString(prefix + yamlScalar(key) + ":")
+			writeYamlValue(w, n.values[i], indent+1)
+		}
+
+	case []interface{}:
+		if len(n) == 0 {
+			w.WriteString(prefix + "[]\n")
+			return
+		}
+		for _, v := range n {
+			if m, ok := v.(*yamlMap); ok && len(m.keys) > 0 {
+				// start maps on the line of the dash, "- key: value"
+				var item bytes.Buffer
+				writeYamlNode(&item, m, indent+1)
+				w.WriteString(prefix + "- ")
+				w.Write(item.Bytes()[len(prefix)+2:])
+				continue
+			}
+
+			w.WriteString(prefix + "-")
+			writeYamlValue(w, v, indent+1)
+		}
+
+	default:
+		w.WriteString(prefix + yamlScalar(n) + "\n")
+	}
+}
+
+// writeYamlValue writes the value of a map entry or list item, after its key
+// or dash.
+func writeYamlValue(w *bytes.Buffer, v interface{}, indent int) {
+	switch n := v.(type) {
+	case *yamlMap:
+		if len(n.keys) > 0 {
+			w.WriteString("\n")
+			writeYamlNode(w, n, indent)
+			return
+		}
+		w.WriteString(" {}\n")
+	case []interface{}:
+		if len(n) > 0 {
+			w.WriteString("\n")
+			writeYamlNode(w, n, indent)
+			return
+		}
+		w.WriteString(" []\n")
+	default:
+		w.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+// yamlScalar formats a JSON scalar. Strings are quoted if they would be read
+// as anything else.
+func yamlScalar(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(s)
+	case json.Number:
+		return s.String()
+	case string:
+		if yamlNeedsQuotes(s) {
+			return strconv.Quote(s)
+		}
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// yamlImplicit matches the plain scalars the YAML 1.1 and 1.2 resolvers read
+// as something other than a string, that strconv doesn't parse: special
+// floats, sexagesimal numbers and timestamps.
+var yamlImplicit = regexp.MustCompile(`^(?i:[-+]?\.(inf|nan)|[-+]?[0-9][0-9_]*(:[0-5]?[0-9])+(\.[0-9_]*)?|[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}([Tt \t].*)?)$`)
+
+func yamlNeedsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	// base prefixes and digit separators, e.g. 0x10, 0o17 and 1_000
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return true
+	}
+	if _, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return true
+	}
+	if yamlImplicit.MatchString(s) {
+		return true
+	}
+
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}